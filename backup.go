@@ -0,0 +1,194 @@
+package kvstore
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"io"
+	"sort"
+)
+
+const (
+	// RestorePendingWrites batches written at a time by Restore of a badger store
+	RestorePendingWrites = 256
+
+	// backupListSize max keys in a list of a backup written by a store in memory
+	backupListSize = 1000
+
+	// backupMaxListBytes a list bigger than it is a corrupt backup
+	backupMaxListBytes = 1 << 30
+
+	// backupMetaDelete badger meta bit of a delete
+	backupMetaDelete byte = 1 << 0
+)
+
+var (
+	BadBackupError = errors.New("bad backup")
+)
+
+func (b badgerStore) BackupCtx(ctx context.Context, w io.Writer, since uint64, buckets ...[]byte) (uint64, error) {
+	b.log.debug("Backup", b.log.keys("buckets", buckets))
+	stream := b.db.NewStream()
+	stream.LogPrefix = "kvstore.Backup"
+	if len(buckets) == 1 {
+		stream.Prefix = b.format.BucketPrefix(buckets[0])
+	}
+	if len(buckets) > 0 {
+		stream.ChooseKey = func(item *badger.Item) bool {
+			return inBuckets(b.format, buckets, item.Key())
+		}
+	}
+
+	// the stream reads versions after SinceTs
+	stream.SinceTs = since
+	version, err := stream.Backup(ctxWriter{ctx: ctx, w: w}, since)
+	return max(version, since), err
+}
+
+func (b badgerStore) RestoreCtx(ctx context.Context, r io.Reader) error {
+	b.log.debug("Restore")
+	if b.opts.ReadOnly {
+		return ReadOnlyError
+	}
+	defer b.cache.clear()
+	return b.db.Load(ctxReader{ctx: ctx, r: r}, RestorePendingWrites)
+}
+
+// Backup a store in memory keeps no deletes, an incremental backup has the keys written after since
+func (m *memStore) BackupCtx(ctx context.Context, w io.Writer, since uint64, buckets ...[]byte) (uint64, error) {
+	m.log.debug("Backup", m.log.keys("buckets", buckets))
+	var list pb.KVList
+	version := since
+	err := m.scanRaw(ctx, nil, func(key string, e memEntry) {
+		if e.version <= since || expired(e.expiresAt) {
+			return
+		}
+		if len(buckets) > 0 && !inBuckets(m.format, buckets, []byte(key)) {
+			return
+		}
+		list.Kv = append(list.Kv, &pb.KV{
+			Key:       []byte(key),
+			Value:     copyBytes(e.value),
+			UserMeta:  []byte{e.meta},
+			Version:   e.version,
+			ExpiresAt: e.expiresAt,
+			Meta:      []byte{0},
+		})
+		version = max(version, e.version)
+	})
+	if err != nil {
+		return since, err
+	}
+	for len(list.Kv) > 0 {
+		n := min(len(list.Kv), backupListSize)
+		if err := writeKVList(ctxWriter{ctx: ctx, w: w}, &pb.KVList{Kv: list.Kv[:n]}); err != nil {
+			return since, err
+		}
+		list.Kv = list.Kv[n:]
+	}
+	return version, nil
+}
+
+// Restore keep the last version of each key in the backup, it is one commit to watchers
+func (m *memStore) RestoreCtx(ctx context.Context, r io.Reader) error {
+	m.log.debug("Restore")
+	latest := make(map[string]*pb.KV)
+	err := readKVLists(ctxReader{ctx: ctx, r: r}, func(kv *pb.KV) error {
+		if last, ok := latest[string(kv.Key)]; !ok || kv.Version > last.Version {
+			latest[string(kv.Key)] = kv
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(latest))
+	for key := range latest {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publish()
+	if err := m.writable(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		kv := latest[key]
+		if len(kv.Meta) > 0 && kv.Meta[0]&backupMetaDelete != 0 {
+			m.remove(key)
+		} else {
+			meta := byte(0)
+			if len(kv.UserMeta) > 0 {
+				meta = kv.UserMeta[0]
+			}
+			m.put(key, kv.Value, kv.ExpiresAt, meta)
+		}
+	}
+	return nil
+}
+
+// inBuckets check an engine key belongs to one of buckets
+func inBuckets(format KeyFormat, buckets [][]byte, key []byte) bool {
+	for _, bucket := range buckets {
+		if format.inBucket(bucket, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeKVList write a list like badger.DB.Backup, its size in uint64 little endian then the list
+func writeKVList(w io.Writer, list *pb.KVList) error {
+	buf, err := list.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint64(len(buf))); err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// readKVLists visit every key of a backup written by badger.DB.Backup
+func readKVLists(r io.Reader, visit func(kv *pb.KV) error) error {
+	br := bufio.NewReaderSize(r, 16<<10)
+	var buf []byte
+	for {
+		var size uint64
+		err := binary.Read(br, binary.LittleEndian, &size)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", BadBackupError, err)
+		}
+		if size > backupMaxListBytes {
+			return fmt.Errorf("%w: list of %d bytes", BadBackupError, size)
+		}
+		if uint64(cap(buf)) < size {
+			buf = make([]byte, size)
+		}
+		if _, err := io.ReadFull(br, buf[:size]); err != nil {
+			return fmt.Errorf("%w: %v", BadBackupError, err)
+		}
+		var list pb.KVList
+		if err := list.Unmarshal(buf[:size]); err != nil {
+			return fmt.Errorf("%w: %v", BadBackupError, err)
+		}
+		for _, kv := range list.Kv {
+			if err := visit(kv); err != nil {
+				return err
+			}
+		}
+	}
+}
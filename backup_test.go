@@ -0,0 +1,95 @@
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// restoreTargets a badger store and a memory store to restore backups
+func restoreTargets(t *testing.T) []KvStore {
+	b, err := Open(EngineBadger, Options{})
+	assert.True(t, err == nil)
+	m, err := Open(EngineMemory, Options{})
+	assert.True(t, err == nil)
+	t.Cleanup(func() {
+		_ = b.Close()
+		_ = m.Close()
+	})
+	return []KvStore{b, m}
+}
+
+// test a full backup then an incremental one are restored to both engines
+func TestBackup(t *testing.T) {
+	testStores(t, fillCursorKeys, func(t *testing.T, s KvStore) {
+		var full bytes.Buffer
+		version, err := s.Backup(&full, 0)
+		assert.True(t, err == nil, "%v", err)
+		assert.True(t, version > 0)
+
+		assert.True(t, s.Set(TestBucket, []byte("key-20"), []byte("v-key-20")) == nil)
+		assert.True(t, s.Delete(TestBucket, []byte("key-00")) == nil)
+		var incr bytes.Buffer
+		next, err := s.Backup(&incr, version)
+		assert.True(t, err == nil)
+		assert.True(t, next > version)
+
+		var empty bytes.Buffer
+		last, err := s.Backup(&empty, next)
+		assert.True(t, err == nil)
+		assert.Equal(t, next, last)
+		assert.Equal(t, 0, empty.Len())
+
+		_, mem := s.(*memStore)
+		for _, target := range restoreTargets(t) {
+			assert.True(t, target.Restore(bytes.NewReader(full.Bytes())) == nil)
+			keys, err := target.KeyStringsWithoutValues(TestBucket, nil)
+			assert.True(t, err == nil)
+			assert.Equal(t, cursorKeys(0, 20, false, 5), keys)
+			v, _, _ := target.Get([]byte("test"), []byte("key-00"))
+			assert.Equal(t, "other", string(v))
+
+			assert.True(t, target.Restore(bytes.NewReader(incr.Bytes())) == nil)
+			v, _, _ = target.Get(TestBucket, []byte("key-20"))
+			assert.Equal(t, "v-key-20", string(v))
+			_, found, _ := target.Get(TestBucket, []byte("key-00"))
+			assert.Equal(t, mem, found, "a memory store keeps no deletes")
+		}
+	})
+}
+
+// test a backup of some buckets
+func TestBackupBuckets(t *testing.T) {
+	testStores(t, fillCursorKeys, func(t *testing.T, s KvStore) {
+		var buf bytes.Buffer
+		_, err := s.Backup(&buf, 0, []byte("test"), []byte("test_bucket_1"))
+		assert.True(t, err == nil)
+		for _, target := range restoreTargets(t) {
+			assert.True(t, target.Restore(bytes.NewReader(buf.Bytes())) == nil)
+			keys, _ := target.KeyStringsWithoutValues(TestBucket, nil)
+			assert.Equal(t, 0, len(keys))
+			keys, _ = target.KeyStringsWithoutValues([]byte("test"), nil)
+			assert.Equal(t, []string{"key-00"}, keys)
+			keys, _ = target.KeyStringsWithoutValues([]byte("test_bucket_1"), nil)
+			assert.Equal(t, []string{"key-00"}, keys)
+		}
+	})
+}
+
+// test restore errors
+func TestRestoreError(t *testing.T) {
+	for _, engine := range []string{EngineBadger, EngineMemory} {
+		s, err := Open(engine, Options{})
+		assert.True(t, err == nil)
+		err = s.Restore(bytes.NewReader([]byte{1, 2, 3}))
+		assert.True(t, err != nil, engine)
+		if engine == EngineMemory {
+			assert.True(t, errors.Is(err, BadBackupError))
+		}
+		_ = s.Close()
+	}
+
+	s, _ := Open(EngineMemory, Options{ReadOnly: true})
+	assert.True(t, errors.Is(s.Restore(bytes.NewReader(nil)), ReadOnlyError))
+}
@@ -0,0 +1,203 @@
+package kvstore
+
+import (
+	"bytes"
+	"container/list"
+	"hash/fnv"
+	"sync"
+)
+
+const (
+	// cacheEntryOverhead bytes counted for an entry besides its key and value
+	cacheEntryOverhead = 64
+
+	// cacheShards keys are spread on shards of generations, a write only delays fills of keys of its shard
+	cacheShards = 256
+)
+
+// CacheOptions of the read-through cache of Get in front of badger, a cache with MaxBytes 0 is disabled.
+// Writes through the store invalidate keys they write, Restore and Exec empty the cache
+type CacheOptions struct {
+	// MaxBytes bytes of keys and values kept, the least recently used keys are evicted first
+	MaxBytes int64
+
+	// Buckets cached, nil caches every bucket
+	Buckets [][]byte
+
+	// Negative cache keys not found too
+	Negative bool
+}
+
+// CacheStats of the cache of a store
+type CacheStats struct {
+	// Hits and Misses of Get in cached buckets
+	Hits   uint64
+	Misses uint64
+
+	// Evictions entries evicted to keep Bytes under MaxBytes
+	Evictions uint64
+
+	// Entries and Bytes kept, including keys not found
+	Entries  int
+	Bytes    int64
+	MaxBytes int64
+}
+
+// cacheEntry a key cached, found is false for a key not found
+type cacheEntry struct {
+	key       string
+	value     []byte
+	found     bool
+	expiresAt uint64
+}
+
+func (e *cacheEntry) size() int64 {
+	return int64(len(e.key) + len(e.value) + cacheEntryOverhead)
+}
+
+// cache a LRU cache of encoded keys, a nil cache caches nothing
+type cache struct {
+	opts    CacheOptions
+	buckets map[string]struct{} // nil for every bucket
+
+	mu          sync.Mutex
+	lru         *list.List // of *cacheEntry, the most recently used first
+	entries     map[string]*list.Element
+	bytes       int64
+	generations [cacheShards]uint64 // of each shard, incremented by every invalidation of a key of the shard
+	hits        uint64
+	misses      uint64
+	evictions   uint64
+}
+
+// shard of a key
+func shard(key []byte) int {
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % cacheShards)
+}
+
+// newCache nil if opts disable the cache
+func newCache(opts CacheOptions) *cache {
+	if opts.MaxBytes <= 0 {
+		return nil
+	}
+	c := &cache{opts: opts, lru: list.New(), entries: make(map[string]*list.Element)}
+	if opts.Buckets != nil {
+		c.buckets = make(map[string]struct{}, len(opts.Buckets))
+		for _, bucket := range opts.Buckets {
+			c.buckets[string(bucket)] = struct{}{}
+		}
+	}
+	return c
+}
+
+// enabled check keys of bucket are cached
+func (c *cache) enabled(bucket []byte) bool {
+	if c == nil {
+		return false
+	}
+	if c.buckets == nil {
+		return true
+	}
+	_, ok := c.buckets[string(bucket)]
+	return ok
+}
+
+// get a copy of a cached value, ok is false for a miss. It returns the generation of the key to pass to fill
+// after a miss
+func (c *cache) get(key []byte) (v []byte, found, ok bool, generation uint64) {
+	i := shard(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	generation = c.generations[i]
+	if el, hit := c.entries[string(key)]; hit {
+		e := el.Value.(*cacheEntry)
+		if e.expiresAt == 0 || remaining(e.expiresAt) > 0 {
+			c.hits++
+			c.lru.MoveToFront(el)
+			return bytes.Clone(e.value), e.found, true, generation
+		}
+		c.remove(el)
+	}
+	c.misses++
+	return nil, false, false, generation
+}
+
+// fill the cache with a value read at generation, unless keys of its shard were invalidated since
+func (c *cache) fill(generation uint64, key, v []byte, found bool, expiresAt uint64) {
+	if !found && !c.opts.Negative {
+		return
+	}
+	e := &cacheEntry{key: string(key), value: bytes.Clone(v), found: found, expiresAt: expiresAt}
+	if e.size() > c.opts.MaxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generations[shard(key)] {
+		return
+	}
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.bytes += e.size()
+	for c.bytes > c.opts.MaxBytes {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+// invalidate keys written
+func (c *cache) invalidate(keys ...[]byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		c.generations[shard(key)]++
+		if el, ok := c.entries[string(key)]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+// clear every key, after writes with unknown keys
+func (c *cache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.generations {
+		c.generations[i]++
+	}
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.bytes = 0
+}
+
+func (c *cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.bytes -= e.size()
+}
+
+// stats of the cache, zero for a nil cache
+func (c *cache) stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   len(c.entries),
+		Bytes:     c.bytes,
+		MaxBytes:  c.opts.MaxBytes,
+	}
+}
@@ -0,0 +1,177 @@
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newCachedStore(t *testing.T, opts CacheOptions) KvStore {
+	s, err := Open(EngineBadger, Options{Cache: opts})
+	assert.True(t, err == nil)
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	return s
+}
+
+// get a value of a key expected to exist
+func get(t *testing.T, s KvStore, k string) string {
+	v, found, err := s.Get(TestBucket, []byte(k))
+	assert.True(t, err == nil && found, "%s: %v", k, err)
+	return string(v)
+}
+
+// test Get reads through the cache and writes invalidate it
+func TestCache(t *testing.T) {
+	s := newCachedStore(t, CacheOptions{MaxBytes: 1 << 20, Negative: true})
+	assert.True(t, s.Set(TestBucket, []byte("a"), []byte("1")) == nil)
+	assert.Equal(t, "1", get(t, s, "a"))
+	v, _, _ := s.Get(TestBucket, []byte("a"))
+	v[0] = 'x'
+	assert.Equal(t, "1", get(t, s, "a"), "a value returned is a copy")
+	stats, _ := s.Stats()
+	assert.Equal(t, uint64(2), stats.Cache.Hits)
+	assert.Equal(t, uint64(1), stats.Cache.Misses)
+	assert.Equal(t, 1, stats.Cache.Entries)
+
+	for i := 0; i < 2; i++ {
+		_, found, err := s.Get(TestBucket, []byte("b"))
+		assert.True(t, errors.Is(err, KeyNotFoundError) && !found)
+	}
+	stats, _ = s.Stats()
+	assert.Equal(t, uint64(3), stats.Cache.Hits, "a key not found is cached")
+
+	for _, write := range []struct {
+		f    func() error
+		want string
+	}{
+		{func() error { return s.Set(TestBucket, []byte("b"), []byte("2")) }, "2"},
+		{func() error { return s.SetWithTTL(TestBucket, []byte("b"), []byte("3"), time.Hour) }, "3"},
+		{func() error {
+			return s.PSet(TestBucket, [][]byte{[]byte("a"), []byte("b")}, [][]byte{[]byte("4"), []byte("4")})
+		}, "4"},
+		{func() error { return s.CompareAndSwap(TestBucket, []byte("b"), []byte("4"), []byte("5")) }, "5"},
+		{func() error { _, err := s.Incr(TestBucket, []byte("b"), 1); return err }, "6"},
+		{func() error {
+			return s.Update(func(txn Txn) error { return txn.Set(TestBucket, []byte("b"), []byte("7")) })
+		}, "7"},
+		{func() error {
+			return s.Batch(func(txn Txn) error { return txn.Set(TestBucket, []byte("b"), []byte("8")) })
+		}, "8"},
+	} {
+		_, _, _ = s.Get(TestBucket, []byte("b"))
+		assert.True(t, write.f() == nil)
+		assert.Equal(t, write.want, get(t, s, "b"))
+		assert.Equal(t, write.want, get(t, s, "b"))
+	}
+	assert.Equal(t, "4", get(t, s, "a"))
+
+	assert.True(t, s.Delete(TestBucket, []byte("b")) == nil)
+	_, _, err := s.Get(TestBucket, []byte("b"))
+	assert.Equal(t, KeyNotFoundError, err)
+	assert.True(t, s.Set(TestBucket, []byte("b"), []byte("9")) == nil)
+	assert.Equal(t, "9", get(t, s, "b"))
+	assert.True(t, s.DeleteKeys(TestBucket, [][]byte{[]byte("a"), []byte("b")}) == nil)
+	_, _, err = s.Get(TestBucket, []byte("a"))
+	assert.Equal(t, KeyNotFoundError, err)
+}
+
+// test a sequence invalidates its key when it writes a lease
+func TestCacheSequence(t *testing.T) {
+	s := newCachedStore(t, CacheOptions{MaxBytes: 1 << 20, Negative: true})
+	_, _, err := s.Get(TestBucket, []byte("seq"))
+	assert.Equal(t, KeyNotFoundError, err)
+	seq, err := s.Sequence(TestBucket, []byte("seq"), 2)
+	assert.True(t, err == nil)
+	lease := get(t, s, "seq")
+	for i := 0; i < 3; i++ {
+		_, err = seq.Next()
+		assert.True(t, err == nil)
+	}
+	assert.True(t, get(t, s, "seq") != lease, "the lease of the first numbers is used up")
+	assert.True(t, seq.Release() == nil)
+}
+
+// test Restore empties the cache
+func TestCacheRestore(t *testing.T) {
+	s := newCachedStore(t, CacheOptions{MaxBytes: 1 << 20, Negative: true})
+	src := newCachedStore(t, CacheOptions{})
+	assert.True(t, src.Set(TestBucket, []byte("a"), []byte("1")) == nil)
+	var buf bytes.Buffer
+	_, err := src.Backup(&buf, 0)
+	assert.True(t, err == nil)
+
+	_, _, err = s.Get(TestBucket, []byte("a"))
+	assert.Equal(t, KeyNotFoundError, err)
+	assert.True(t, s.Restore(&buf) == nil)
+	assert.Equal(t, "1", get(t, s, "a"))
+}
+
+// test only keys of the buckets of the options are cached
+func TestCacheBuckets(t *testing.T) {
+	s := newCachedStore(t, CacheOptions{MaxBytes: 1 << 20, Buckets: [][]byte{TestBucket}})
+	other := []byte("other")
+	assert.True(t, s.Set(TestBucket, []byte("a"), []byte("1")) == nil)
+	assert.True(t, s.Set(other, []byte("a"), []byte("1")) == nil)
+	for i := 0; i < 2; i++ {
+		_ = get(t, s, "a")
+		_, _, _ = s.Get(other, []byte("a"))
+		_, _, _ = s.Get(TestBucket, []byte("missing"))
+	}
+	stats, _ := s.Stats()
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 3, Entries: 1, Bytes: stats.Cache.Bytes, MaxBytes: 1 << 20},
+		stats.Cache, "keys not found are not cached without Negative")
+
+	stats, _ = newCachedStore(t, CacheOptions{}).Stats()
+	assert.Equal(t, CacheStats{}, stats.Cache)
+}
+
+// test the least recently used keys are evicted, expired and invalidated keys are not served
+func TestCacheEviction(t *testing.T) {
+	c := newCache(CacheOptions{MaxBytes: 3 * (cacheEntryOverhead + 2)})
+	for _, k := range []string{"a", "b", "c"} {
+		_, _, _, generation := c.get([]byte(k))
+		c.fill(generation, []byte(k), []byte("v"), true, 0)
+	}
+	_, _, ok, generation := c.get([]byte("a"))
+	assert.True(t, ok)
+	c.fill(generation, []byte("d"), []byte("v"), true, 0)
+	_, _, ok, _ = c.get([]byte("b"))
+	assert.True(t, !ok, "b is the least recently used")
+	stats := c.stats()
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, 3, stats.Entries)
+	assert.Equal(t, int64(3*(cacheEntryOverhead+2)), stats.Bytes)
+
+	_, _, _, generation = c.get([]byte("e"))
+	c.invalidate([]byte("e"))
+	c.fill(generation, []byte("e"), []byte("v"), true, 0)
+	_, _, ok, _ = c.get([]byte("e"))
+	assert.True(t, !ok, "a value read before an invalidation is not cached")
+
+	// an invalidation of a key of another shard does not stop a fill
+	assert.True(t, shard([]byte("e")) != shard([]byte("x")))
+	_, _, _, generation = c.get([]byte("e"))
+	c.invalidate([]byte("x"))
+	c.fill(generation, []byte("e"), []byte("v"), true, 0)
+	_, _, ok, _ = c.get([]byte("e"))
+	assert.True(t, ok)
+
+	_, _, _, generation = c.get([]byte("f"))
+	c.fill(generation, []byte("f"), []byte("v"), true, uint64(time.Now().Add(-time.Second).Unix()))
+	_, _, ok, _ = c.get([]byte("f"))
+	assert.True(t, !ok, "an expired key is a miss")
+
+	c.fill(generation, []byte("g"), []byte("v"), false, 0)
+	_, _, ok, _ = c.get([]byte("g"))
+	assert.True(t, !ok, "keys not found are not cached without Negative")
+
+	c.clear()
+	assert.Equal(t, 0, c.stats().Entries)
+	var nilCache *cache
+	assert.True(t, !nilCache.enabled(TestBucket))
+	nilCache.invalidate([]byte("a"))
+}
@@ -0,0 +1,85 @@
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+)
+
+var (
+	PreconditionFailedError = errors.New("precondition failed")
+)
+
+// updateFunc run f in a read-write transaction
+type updateFunc func(f func(txn Txn) error) error
+
+// updater the updateFunc of UpdateCtx with ctx
+func (b badgerStore) updater(ctx context.Context) updateFunc {
+	return func(f func(txn Txn) error) error {
+		return b.UpdateCtx(ctx, f)
+	}
+}
+
+// updater the updateFunc of UpdateCtx with ctx
+func (m *memStore) updater(ctx context.Context) updateFunc {
+	return func(f func(txn Txn) error) error {
+		return m.UpdateCtx(ctx, f)
+	}
+}
+
+// compareAndSwap set v if the key exists with the expected value
+func compareAndSwap(update updateFunc, bucket, k, expected, v []byte) error {
+	return update(func(txn Txn) error {
+		old, err := txn.Get(bucket, k)
+		if errors.Is(err, KeyNotFoundError) || (err == nil && !bytes.Equal(old, expected)) {
+			return PreconditionFailedError
+		}
+		if err != nil {
+			return err
+		}
+		return txn.Set(bucket, k, v)
+	})
+}
+
+// setIfAbsent set v if the key does not exist
+func setIfAbsent(update updateFunc, bucket, k, v []byte) error {
+	return update(func(txn Txn) error {
+		_, err := txn.Get(bucket, k)
+		if err == nil {
+			return PreconditionFailedError
+		}
+		if !errors.Is(err, KeyNotFoundError) {
+			return err
+		}
+		return txn.Set(bucket, k, v)
+	})
+}
+
+// deleteIfEquals delete the key if it exists with the expected value
+func deleteIfEquals(update updateFunc, bucket, k, expected []byte) error {
+	return update(func(txn Txn) error {
+		old, err := txn.Get(bucket, k)
+		if errors.Is(err, KeyNotFoundError) || (err == nil && !bytes.Equal(old, expected)) {
+			return PreconditionFailedError
+		}
+		if err != nil {
+			return err
+		}
+		return txn.Delete(bucket, k)
+	})
+}
+
+func (b badgerStore) CompareAndSwapCtx(ctx context.Context, bucket, k, expected, v []byte) error {
+	b.log.debug("CompareAndSwap", b.log.key("key", b.format.Encode(bucket, k)), b.log.value("expected", expected), b.log.value("value", v))
+	return compareAndSwap(b.updater(ctx), bucket, k, expected, v)
+}
+
+func (b badgerStore) SetIfAbsentCtx(ctx context.Context, bucket, k, v []byte) error {
+	b.log.debug("SetIfAbsent", b.log.key("key", b.format.Encode(bucket, k)), b.log.value("value", v))
+	return setIfAbsent(b.updater(ctx), bucket, k, v)
+}
+
+func (b badgerStore) DeleteIfEqualsCtx(ctx context.Context, bucket, k, expected []byte) error {
+	b.log.debug("DeleteIfEquals", b.log.key("key", b.format.Encode(bucket, k)), b.log.value("expected", expected))
+	return deleteIfEquals(b.updater(ctx), bucket, k, expected)
+}
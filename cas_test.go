@@ -0,0 +1,62 @@
+package kvstore
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// test conditional writes
+func TestCompareAndSwap(t *testing.T) {
+	testStores(t, nil, func(t *testing.T, s KvStore) {
+		broker := []byte("cluster#broker#name#@cluster-test@broker-1")
+
+		assert.True(t, errors.Is(s.CompareAndSwap(TestBucket, broker, []byte("a"), []byte("b")), PreconditionFailedError))
+		assert.True(t, s.SetIfAbsent(TestBucket, broker, []byte("a")) == nil)
+		assert.True(t, errors.Is(s.SetIfAbsent(TestBucket, broker, []byte("b")), PreconditionFailedError))
+
+		assert.True(t, errors.Is(s.CompareAndSwap(TestBucket, broker, []byte("b"), []byte("c")), PreconditionFailedError))
+		assert.True(t, s.CompareAndSwap(TestBucket, broker, []byte("a"), []byte("c")) == nil)
+		v, _, _ := s.Get(TestBucket, broker)
+		assert.Equal(t, "c", string(v))
+
+		assert.True(t, errors.Is(s.DeleteIfEquals(TestBucket, broker, []byte("a")), PreconditionFailedError))
+		assert.True(t, s.DeleteIfEquals(TestBucket, broker, []byte("c")) == nil)
+		_, f, _ := s.Get(TestBucket, broker)
+		assert.False(t, f)
+		assert.True(t, errors.Is(s.DeleteIfEquals(TestBucket, broker, []byte("c")), PreconditionFailedError))
+	})
+}
+
+// test only one of concurrent swaps from the same value wins
+func TestCompareAndSwapConcurrent(t *testing.T) {
+	testStores(t, nil, func(t *testing.T, s KvStore) {
+		assert.True(t, s.Set(TestBucket, []byte("leader"), []byte("none")) == nil)
+
+		var wg sync.WaitGroup
+		var lock sync.Mutex
+		var winners []string
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				name := "broker-" + strconv.Itoa(i)
+				err := s.CompareAndSwap(TestBucket, []byte("leader"), []byte("none"), []byte(name))
+				if err == nil {
+					lock.Lock()
+					winners = append(winners, name)
+					lock.Unlock()
+				} else if !errors.Is(err, PreconditionFailedError) && !errors.Is(err, TxnConflictError) {
+					t.Errorf("swap error %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, len(winners))
+		v, _, _ := s.Get(TestBucket, []byte("leader"))
+		assert.Equal(t, winners[0], string(v))
+	})
+}
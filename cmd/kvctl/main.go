@@ -0,0 +1,461 @@
+// Command kvctl operates on a store directory created by kvstore.NewBadgerStore.
+//
+//	kvctl -dir path [-value-dir path] [-create] [-key-format f] [-readonly] [-v] command [flags] [args]
+//
+// Keys are relative to a bucket like KvStore methods, open a copy of a live directory with -readonly.
+// A directory without a store is refused unless -create is given, so a mistyped -dir creates nothing
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	kvstore "github.com/gmqio/kv-store"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	store  kvstore.KvStore
+}
+
+type command struct {
+	usage string
+	run   func(e *env, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"get":     {"get [-bucket b] key", get},
+		"set":     {"set [-bucket b] [-ttl d] key value", set},
+		"del":     {"del [-bucket b] key...", del},
+		"scan":    {"scan [-bucket b] [-prefix p] [-start k] [-end k] [-limit n] [-reverse] [-keys-only]", scan},
+		"buckets": {"buckets", buckets},
+		"count":   {"count [-bucket b] [-prefix p], every bucket without -bucket", count},
+		"dump":    {"dump [-format jsonl|csv] [-bucket b]... [-o file]", dump},
+		"load":    {"load [-format jsonl|csv] [-batch n] [-dry-run] [-verify] [file]", load},
+		"backup":  {"backup [-since version] [-bucket b]... [-o file]", backup},
+		"restore": {"restore [file]", restore},
+		"gc":      {"gc [-ratio r]", gc},
+		"stats":   {"stats", stats},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run kvctl with args, return the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("kvctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", "", "store directory")
+	valueDir := fs.String("value-dir", "", "value directory, -dir if empty")
+	create := fs.Bool("create", false, "create a store if -dir has none")
+	var format keyFormatFlag
+	fs.Var(&format, "key-format", "key format auto|legacy|length-prefixed, auto use the format recorded in -dir")
+	readOnly := fs.Bool("readonly", false, "open the store read only")
+	verbose := fs.Bool("v", false, "log of badger")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "usage: kvctl -dir path [-value-dir path] [-create] [-key-format f] [-readonly] [-v] command [flags] [args]")
+		fs.PrintDefaults()
+		_, _ = fmt.Fprintln(stderr, "commands:")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			_, _ = fmt.Fprintln(stderr, "  "+commands[name].usage)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 || *dir == "" {
+		fs.Usage()
+		return 2
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		_, _ = fmt.Fprintf(stderr, "kvctl: unknown command %s\n", fs.Arg(0))
+		fs.Usage()
+		return 2
+	}
+
+	if !*create {
+		if _, err := os.Stat(filepath.Join(*dir, badger.ManifestFilename)); err != nil {
+			_, _ = fmt.Fprintf(stderr, "kvctl: open %s: no store in the directory, -create for a new one\n", *dir)
+			return 1
+		}
+	}
+	opts := kvstore.Options{Dir: *dir, ValueDir: *valueDir, ReadOnly: *readOnly, KeyFormat: kvstore.KeyFormat(format)}
+	if !*verbose {
+		// above error, nothing is logged
+		opts.Log.Level = new(slog.LevelVar)
+		opts.Log.Level.Set(slog.LevelError + 1)
+	}
+	store, err := kvstore.Open(kvstore.EngineBadger, opts)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "kvctl: open %s: %v\n", *dir, err)
+		return 1
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	e := &env{stdin: stdin, stdout: stdout, stderr: stderr, store: store}
+	if err := cmd.run(e, fs.Args()[1:]); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			_, _ = fmt.Fprintf(stderr, "kvctl %s: %v\n", fs.Arg(0), err)
+		}
+		return 1
+	}
+	return 0
+}
+
+// bucketsFlag a flag given many times
+type bucketsFlag [][]byte
+
+func (b *bucketsFlag) String() string {
+	var names []string
+	for _, bucket := range *b {
+		names = append(names, string(bucket))
+	}
+	return strings.Join(names, ",")
+}
+
+func (b *bucketsFlag) Set(v string) error {
+	*b = append(*b, []byte(v))
+	return nil
+}
+
+// keyFormatFlag a key format by its name
+type keyFormatFlag kvstore.KeyFormat
+
+func (f *keyFormatFlag) String() string {
+	return kvstore.KeyFormat(*f).String()
+}
+
+func (f *keyFormatFlag) Set(v string) error {
+	for _, format := range []kvstore.KeyFormat{kvstore.KeyFormatAuto, kvstore.KeyFormatLegacy, kvstore.KeyFormatLengthPrefixed} {
+		if format.String() == v {
+			*f = keyFormatFlag(format)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown key format %q", v)
+}
+
+// flags of a command
+func flags(e *env, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(e.stderr, "usage: kvctl "+commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse flags and check the number of args
+func parse(fs *flag.FlagSet, args []string, min, max int) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < min || (max >= 0 && fs.NArg() > max) {
+		fs.Usage()
+		return fmt.Errorf("%d args", fs.NArg())
+	}
+	return nil
+}
+
+// show bytes as they are if they are printable, quoted if not
+func show(b []byte) string {
+	if utf8.Valid(b) && strings.IndexFunc(string(b), func(r rune) bool {
+		return !unicode.IsPrint(r)
+	}) < 0 {
+		return string(b)
+	}
+	return strconv.Quote(string(b))
+}
+
+// create a file, or stdout if path is empty
+func create(e *env, path string) (io.Writer, func() error, error) {
+	if path == "" {
+		return e.stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+// open a file of args, or stdin without args
+func open(e *env, args []string) (io.Reader, func() error, error) {
+	if len(args) == 0 || args[0] == "-" {
+		return e.stdin, func() error { return nil }, nil
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+func get(e *env, args []string) error {
+	fs := flags(e, "get")
+	bucket := fs.String("bucket", "", "bucket")
+	if err := parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	v, _, err := e.store.Get([]byte(*bucket), []byte(fs.Arg(0)))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(e.stdout, show(v))
+	return err
+}
+
+func set(e *env, args []string) error {
+	fs := flags(e, "set")
+	bucket := fs.String("bucket", "", "bucket")
+	ttl := fs.Duration("ttl", 0, "time to live, 0 never expires")
+	if err := parse(fs, args, 2, 2); err != nil {
+		return err
+	}
+	return e.store.SetWithTTL([]byte(*bucket), []byte(fs.Arg(0)), []byte(fs.Arg(1)), *ttl)
+}
+
+func del(e *env, args []string) error {
+	fs := flags(e, "del")
+	bucket := fs.String("bucket", "", "bucket")
+	if err := parse(fs, args, 1, -1); err != nil {
+		return err
+	}
+	var keys [][]byte
+	for _, key := range fs.Args() {
+		keys = append(keys, []byte(key))
+	}
+	return e.store.DeleteKeys([]byte(*bucket), keys)
+}
+
+func scan(e *env, args []string) error {
+	fs := flags(e, "scan")
+	bucket := fs.String("bucket", "", "bucket")
+	prefix := fs.String("prefix", "", "key prefix")
+	start := fs.String("start", "", "first key")
+	end := fs.String("end", "", "key after the last key")
+	limit := fs.Int("limit", 0, "max keys, 0 is no limit")
+	reverse := fs.Bool("reverse", false, "from the last key")
+	keysOnly := fs.Bool("keys-only", false, "do not print values")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	opts := kvstore.CursorOptions{
+		Prefix:   []byte(*prefix),
+		Limit:    *limit,
+		Reverse:  *reverse,
+		KeysOnly: *keysOnly,
+	}
+	if *start != "" {
+		opts.Start = []byte(*start)
+	}
+	if *end != "" {
+		opts.End = []byte(*end)
+	}
+	c, err := e.store.Cursor([]byte(*bucket), opts)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for c.Seek(nil); c.Valid(); c.Next() {
+		if *keysOnly {
+			_, err = fmt.Fprintln(e.stdout, show(c.Key()))
+		} else {
+			var v []byte
+			if v, err = c.Value(); err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(e.stdout, "%s\t%s\n", show(c.Key()), show(v))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func buckets(e *env, args []string) error {
+	if err := parse(flags(e, "buckets"), args, 0, 0); err != nil {
+		return err
+	}
+	all, err := e.store.Buckets()
+	if err != nil {
+		return err
+	}
+	for _, bucket := range all {
+		if _, err := fmt.Fprintln(e.stdout, show(bucket)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func count(e *env, args []string) error {
+	fs := flags(e, "count")
+	var bucket bucketsFlag
+	fs.Var(&bucket, "bucket", "bucket, may be given many times")
+	prefix := fs.String("prefix", "", "key prefix")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if bucket == nil {
+		var err error
+		if bucket, err = e.store.Buckets(); err != nil {
+			return err
+		}
+	}
+	n := 0
+	for _, b := range bucket {
+		c, err := e.store.Cursor(b, kvstore.CursorOptions{Prefix: []byte(*prefix), KeysOnly: true})
+		if err != nil {
+			return err
+		}
+		for c.Seek(nil); c.Valid(); c.Next() {
+			n++
+		}
+		_ = c.Close()
+	}
+	_, err := fmt.Fprintln(e.stdout, n)
+	return err
+}
+
+func dump(e *env, args []string) error {
+	fs := flags(e, "dump")
+	format := fs.String("format", string(kvstore.DumpJSONLines), "jsonl or csv")
+	var bucket bucketsFlag
+	fs.Var(&bucket, "bucket", "bucket, may be given many times. Every bucket if not given")
+	out := fs.String("o", "", "output file, stdout if empty")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	w, closeFile, err := create(e, *out)
+	if err != nil {
+		return err
+	}
+	n, err := kvstore.Export(e.store, w, kvstore.ExportOptions{Format: kvstore.DumpFormat(*format), Buckets: bucket})
+	if cerr := closeFile(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.stderr, "dumped %d records\n", n)
+	return err
+}
+
+func load(e *env, args []string) error {
+	fs := flags(e, "load")
+	format := fs.String("format", string(kvstore.DumpJSONLines), "jsonl or csv")
+	batch := fs.Int("batch", kvstore.DefaultImportBatchSize, "records written in a batch")
+	dryRun := fs.Bool("dry-run", false, "check records without writing")
+	verify := fs.Bool("verify", false, "compare records with the store")
+	if err := parse(fs, args, 0, 1); err != nil {
+		return err
+	}
+	r, closeFile, err := open(e, fs.Args())
+	if err != nil {
+		return err
+	}
+	defer closeFile()
+	result, err := kvstore.Import(e.store, r, kvstore.ImportOptions{
+		Format:    kvstore.DumpFormat(*format),
+		BatchSize: *batch,
+		DryRun:    *dryRun,
+		Verify:    *verify,
+	})
+	_, _ = fmt.Fprintf(e.stdout, "records %d written %d expired %d mismatched %d\n",
+		result.Records, result.Written, result.Expired, result.Mismatched)
+	return err
+}
+
+func backup(e *env, args []string) error {
+	fs := flags(e, "backup")
+	since := fs.Uint64("since", 0, "version of the last backup, 0 for a full backup")
+	var bucket bucketsFlag
+	fs.Var(&bucket, "bucket", "bucket, may be given many times. Every bucket if not given")
+	out := fs.String("o", "", "output file, stdout if empty")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	w, closeFile, err := create(e, *out)
+	if err != nil {
+		return err
+	}
+	version, err := e.store.Backup(w, *since, bucket...)
+	if cerr := closeFile(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.stderr, "version %d\n", version)
+	return err
+}
+
+func restore(e *env, args []string) error {
+	fs := flags(e, "restore")
+	if err := parse(fs, args, 0, 1); err != nil {
+		return err
+	}
+	r, closeFile, err := open(e, fs.Args())
+	if err != nil {
+		return err
+	}
+	defer closeFile()
+	return e.store.Restore(r)
+}
+
+func gc(e *env, args []string) error {
+	fs := flags(e, "gc")
+	ratio := fs.Float64("ratio", 0.5, "rewrite a value log file with at least this ratio to discard")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	start := time.Now()
+	n, err := e.store.GC(*ratio)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.stdout, "rewritten %d files in %s\n", n, time.Since(start).Round(time.Millisecond))
+	return err
+}
+
+func stats(e *env, args []string) error {
+	if err := parse(flags(e, "stats"), args, 0, 0); err != nil {
+		return err
+	}
+	s, err := e.store.Stats()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.stdout, "engine\t%s\nkey format\t%s\nread only\t%t\nkeys\t%d\ntables\t%d\nlsm size\t%d\nvlog size\t%d\n",
+		s.Engine, s.KeyFormat, s.ReadOnly, s.Keys, s.Tables, s.LSMSize, s.VLogSize)
+	return err
+}
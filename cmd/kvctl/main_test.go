@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// kvctl run a command, return exit code and stdout
+func kvctl(t *testing.T, stdin string, args ...string) (int, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	t.Logf("kvctl %s: %d %s", strings.Join(args, " "), code, stderr.String())
+	return code, stdout.String()
+}
+
+// test commands on a store directory
+func TestKvctl(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "store")
+	run := func(args ...string) string {
+		code, out := kvctl(t, "", append([]string{"-dir", dir}, args...)...)
+		assert.Equal(t, 0, code)
+		return out
+	}
+
+	code, _ := kvctl(t, "", "-dir", dir, "set", "-bucket", "brokers", "broker-1", "up")
+	assert.Equal(t, 1, code, "a directory without a store is refused")
+	_, err := os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+	run("-create", "set", "-bucket", "brokers", "broker-1", "up")
+	run("set", "-bucket", "brokers", "broker-2", "down")
+	run("set", "-bucket", "topics", "orders", "3")
+	assert.Equal(t, "up\n", run("get", "-bucket", "brokers", "broker-1"))
+	assert.Equal(t, "brokers\ntopics\n", run("buckets"))
+	assert.Equal(t, "3\n", run("count"))
+	assert.Equal(t, "2\n", run("count", "-bucket", "brokers"))
+	assert.Equal(t, "broker-1\tup\nbroker-2\tdown\n", run("scan", "-bucket", "brokers"))
+	assert.Equal(t, "broker-2\n", run("scan", "-bucket", "brokers", "-reverse", "-limit", "1", "-keys-only"))
+
+	dump := filepath.Join(t.TempDir(), "dump.jsonl")
+	run("dump", "-o", dump)
+	backup := filepath.Join(t.TempDir(), "backup")
+	run("backup", "-o", backup)
+
+	run("del", "-bucket", "brokers", "broker-1", "broker-2")
+	assert.Equal(t, "0\n", run("count", "-bucket", "brokers"))
+	code, out := kvctl(t, "", "-dir", dir, "load", "-dry-run", "-verify", dump)
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "records 3 written 0 expired 0 mismatched 2\n", out)
+	assert.Equal(t, "records 3 written 3 expired 0 mismatched 0\n", run("load", "-verify", dump))
+	restored := filepath.Join(t.TempDir(), "restored")
+	code, _ = kvctl(t, "", "-dir", restored, "-create", "restore", backup)
+	assert.Equal(t, 0, code)
+	code, out = kvctl(t, "", "-dir", restored, "scan", "-bucket", "brokers")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "broker-1\tup\nbroker-2\tdown\n", out)
+
+	run("gc")
+	assert.True(t, strings.HasPrefix(run("stats"), "engine\tbadger\nkey format\tlegacy\n"))
+
+	// a copy opened read only
+	code, _ = kvctl(t, "", "-dir", dir, "-readonly", "set", "k", "v")
+	assert.Equal(t, 1, code)
+	code, out = kvctl(t, "", "-dir", dir, "-readonly", "get", "-bucket", "topics", "orders")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "3\n", out)
+}
+
+// test the key format of a new store and of a store opened again
+func TestKvctlKeyFormat(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "store")
+	code, _ := kvctl(t, "", "-dir", dir, "-create", "-key-format", "length-prefixed", "set", "k", "v")
+	assert.Equal(t, 0, code)
+	code, out := kvctl(t, "", "-dir", dir, "stats")
+	assert.Equal(t, 0, code)
+	assert.True(t, strings.HasPrefix(out, "engine\tbadger\nkey format\tlength-prefixed\n"))
+	code, _ = kvctl(t, "", "-dir", dir, "-key-format", "legacy", "get", "k")
+	assert.Equal(t, 1, code, "the format recorded in the directory is another one")
+	code, _ = kvctl(t, "", "-dir", dir, "-key-format", "nope", "get", "k")
+	assert.Equal(t, 2, code)
+}
+
+// test usage errors
+func TestKvctlUsage(t *testing.T) {
+	dir := t.TempDir()
+	code, _ := kvctl(t, "")
+	assert.Equal(t, 2, code)
+	code, _ = kvctl(t, "", "-dir", dir, "nothing")
+	assert.Equal(t, 2, code)
+	code, _ = kvctl(t, "", "-dir", dir, "get")
+	assert.Equal(t, 1, code)
+	code, _ = kvctl(t, "", "-dir", dir, "get", "not-exist")
+	assert.Equal(t, 1, code)
+	code, _ = kvctl(t, "", "-dir", filepath.Join(dir, "not-exist"), "-readonly", "stats")
+	assert.Equal(t, 1, code)
+	_, err := os.Stat(filepath.Join(dir, "not-exist"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,176 @@
+package kvstore
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+)
+
+var (
+	NotIntegerError = errors.New("value is not an integer or out of range")
+)
+
+// Sequence allocate unique increasing numbers from 0, a lease of numbers is taken from the store at a time.
+// *badger.Sequence is a Sequence
+type Sequence interface {
+	// Next number of the sequence
+	Next() (uint64, error)
+
+	// Release give back numbers not used in the lease, call it before the store is closed
+	Release() error
+}
+
+// incr add delta to a decimal integer value in a transaction of update, a key not found is 0.
+// A conflict wrote nothing, the transaction runs again until it commits
+func incr(update updateFunc, bucket, k []byte, delta int64) (int64, error) {
+	var n int64
+	for {
+		err := update(func(txn Txn) error {
+			n = 0
+			v, err := txn.Get(bucket, k)
+			if err == nil {
+				if n, err = strconv.ParseInt(string(v), 10, 64); err != nil {
+					return fmt.Errorf("%w: %q", NotIntegerError, v)
+				}
+			} else if !errors.Is(err, KeyNotFoundError) {
+				return err
+			}
+			if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+				return NotIntegerError
+			}
+			n += delta
+			return txn.Set(bucket, k, []byte(strconv.FormatInt(n, 10)))
+		})
+		if !errors.Is(err, TxnConflictError) {
+			return n, err
+		}
+	}
+}
+
+func (b badgerStore) IncrCtx(ctx context.Context, bucket, k []byte, delta int64) (int64, error) {
+	b.log.debug("Incr", b.log.key("key", b.format.Encode(bucket, k)), slog.Int64("delta", delta))
+	return incr(b.updater(ctx), bucket, k, delta)
+}
+
+func (b badgerStore) SequenceCtx(ctx context.Context, bucket, name []byte, leaseSize uint64) (Sequence, error) {
+	newKey := b.format.Encode(bucket, name)
+	b.log.debug("Sequence", b.log.key("key", newKey))
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	seq, err := b.db.GetSequence(newKey, leaseSize)
+	b.cache.invalidate(newKey)
+	if err != nil {
+		return nil, err
+	}
+	if !b.cache.enabled(bucket) {
+		return seq, nil
+	}
+	return cachedSequence{Sequence: seq, cache: b.cache, key: newKey}, nil
+}
+
+// cachedSequence a badger.Sequence of a cached bucket, a lease written invalidates the key of the sequence
+type cachedSequence struct {
+	*badger.Sequence
+	cache *cache
+	key   []byte
+}
+
+func (s cachedSequence) Next() (uint64, error) {
+	defer s.cache.invalidate(s.key)
+	return s.Sequence.Next()
+}
+
+func (s cachedSequence) Release() error {
+	defer s.cache.invalidate(s.key)
+	return s.Sequence.Release()
+}
+
+// leaseSequence a Sequence on transactions of a store, leases are stored like badger.Sequence
+type leaseSequence struct {
+	lock      sync.Mutex
+	update    updateFunc
+	bucket    []byte
+	name      []byte
+	leaseSize uint64
+	next      uint64
+	leased    uint64
+}
+
+func newLeaseSequence(update updateFunc, bucket, name []byte, leaseSize uint64) (Sequence, error) {
+	if len(name) == 0 {
+		return nil, badger.ErrEmptyKey
+	}
+	if leaseSize == 0 {
+		return nil, badger.ErrZeroBandwidth
+	}
+	seq := &leaseSequence{
+		update:    update,
+		bucket:    copyBytes(bucket),
+		name:      copyBytes(name),
+		leaseSize: leaseSize,
+	}
+	return seq, seq.renew()
+}
+
+func (seq *leaseSequence) Next() (uint64, error) {
+	seq.lock.Lock()
+	defer seq.lock.Unlock()
+	if seq.next >= seq.leased {
+		if err := seq.renew(); err != nil {
+			return 0, err
+		}
+	}
+	n := seq.next
+	seq.next++
+	return n, nil
+}
+
+func (seq *leaseSequence) Release() error {
+	seq.lock.Lock()
+	defer seq.lock.Unlock()
+	err := seq.update(func(txn Txn) error {
+		v, err := txn.Get(seq.bucket, seq.name)
+		if err != nil {
+			return err
+		}
+		if len(v) == 8 && binary.BigEndian.Uint64(v) == seq.leased {
+			return txn.Set(seq.bucket, seq.name, binary.BigEndian.AppendUint64(nil, seq.next))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	seq.leased = seq.next
+	return nil
+}
+
+// renew take a new lease from the stored one
+func (seq *leaseSequence) renew() error {
+	return seq.update(func(txn Txn) error {
+		v, err := txn.Get(seq.bucket, seq.name)
+		switch {
+		case errors.Is(err, KeyNotFoundError):
+			seq.next = 0
+		case err != nil:
+			return err
+		case len(v) != 8:
+			return fmt.Errorf("%w: sequence %q", NotIntegerError, v)
+		default:
+			seq.next = binary.BigEndian.Uint64(v)
+		}
+		lease := seq.next + seq.leaseSize
+		if err := txn.Set(seq.bucket, seq.name, binary.BigEndian.AppendUint64(nil, lease)); err != nil {
+			return err
+		}
+		seq.leased = lease
+		return nil
+	})
+}
@@ -0,0 +1,92 @@
+package kvstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"sync"
+	"testing"
+)
+
+// test incr a decimal value
+func TestIncr(t *testing.T) {
+	testStores(t, nil, func(t *testing.T, s KvStore) {
+		n, err := s.Incr(TestBucket, []byte("counter"), 1)
+		assert.True(t, err == nil)
+		assert.Equal(t, int64(1), n)
+		n, err = s.Incr(TestBucket, []byte("counter"), -11)
+		assert.True(t, err == nil)
+		assert.Equal(t, int64(-10), n)
+		v, _, _ := s.Get(TestBucket, []byte("counter"))
+		assert.Equal(t, "-10", string(v))
+
+		assert.True(t, s.Set(TestBucket, []byte("name"), []byte("tiger")) == nil)
+		_, err = s.Incr(TestBucket, []byte("name"), 1)
+		assert.True(t, errors.Is(err, NotIntegerError))
+
+		_, err = s.Incr(TestBucket, []byte("max"), math.MaxInt64)
+		assert.True(t, err == nil)
+		_, err = s.Incr(TestBucket, []byte("max"), 1)
+		assert.True(t, errors.Is(err, NotIntegerError))
+	})
+}
+
+// test concurrent incr loses no update
+func TestIncrConcurrent(t *testing.T) {
+	testStores(t, nil, func(t *testing.T, s KvStore) {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					if _, err := s.Incr(TestBucket, []byte("counter"), 2); err != nil {
+						t.Errorf("incr error %v", err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		n, err := s.Incr(TestBucket, []byte("counter"), 0)
+		assert.True(t, err == nil)
+		assert.Equal(t, int64(8*20*2), n)
+	})
+}
+
+// test sequences allocate unique numbers and continue after release
+func TestSequence(t *testing.T) {
+	testStores(t, nil, func(t *testing.T, s KvStore) {
+		seq1, err := s.Sequence(TestBucket, []byte("id"), 10)
+		assert.True(t, err == nil)
+		seq2, err := s.Sequence(TestBucket, []byte("id"), 10)
+		assert.True(t, err == nil)
+
+		seen := map[uint64]bool{}
+		for i := 0; i < 25; i++ {
+			for _, seq := range []Sequence{seq1, seq2} {
+				n, err := seq.Next()
+				assert.True(t, err == nil)
+				assert.False(t, seen[n], "number %d twice", n)
+				seen[n] = true
+			}
+		}
+		assert.True(t, seq2.Release() == nil)
+		assert.True(t, seq1.Release() == nil)
+
+		// seq2 took the last lease, its release gives back numbers from 55
+		v, _, err := s.Get(TestBucket, []byte("id"))
+		assert.True(t, err == nil)
+		assert.Equal(t, uint64(55), binary.BigEndian.Uint64(v))
+
+		seq3, err := s.Sequence(TestBucket, []byte("id"), 10)
+		assert.True(t, err == nil)
+		n, err := seq3.Next()
+		assert.True(t, err == nil)
+		assert.Equal(t, uint64(55), n)
+		assert.True(t, seq3.Release() == nil)
+
+		_, err = s.Sequence(TestBucket, []byte("id"), 0)
+		assert.True(t, err != nil)
+	})
+}
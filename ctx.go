@@ -0,0 +1,585 @@
+package kvstore
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// KvStoreCtx a KvStore with methods taking a context, a call stopped by its context returns ctx.Err().
+// Methods of KvStore run with context.Background. Stores of this package are KvStoreCtx, WithContext
+// adapts other stores
+type KvStoreCtx interface {
+	KvStore
+
+	// SetCtx and the write methods below return the error of ctx if it is done before they commit
+	SetCtx(ctx context.Context, bucket, k []byte, v []byte) error
+
+	// GetCtx and the reads below return the error of ctx if it is done before they read
+	GetCtx(ctx context.Context, bucket, k []byte) (result []byte, found bool, e error)
+	SetWithTTLCtx(ctx context.Context, bucket, k []byte, v []byte, ttl time.Duration) error
+	PSetCtx(ctx context.Context, bucket []byte, keys, values [][]byte) error
+	PSetWithTTLCtx(ctx context.Context, bucket []byte, keys, values [][]byte, ttl time.Duration) error
+	TTLCtx(ctx context.Context, bucket, k []byte) (time.Duration, error)
+	PersistCtx(ctx context.Context, bucket, k []byte) error
+	PGetCtx(ctx context.Context, bucket []byte, keys [][]byte) ([][]byte, error)
+	CompareAndSwapCtx(ctx context.Context, bucket, k, expected, v []byte) error
+	SetIfAbsentCtx(ctx context.Context, bucket, k, v []byte) error
+	IncrCtx(ctx context.Context, bucket, k []byte, delta int64) (int64, error)
+	SequenceCtx(ctx context.Context, bucket, name []byte, leaseSize uint64) (Sequence, error)
+	DeleteCtx(ctx context.Context, bucket, key []byte) error
+	DeleteIfEqualsCtx(ctx context.Context, bucket, k, expected []byte) error
+	DeleteKeysCtx(ctx context.Context, bucket []byte, keys [][]byte) error
+
+	// KeysCtx and the scans below check ctx between keys, a scan stopped returns the error of ctx
+	KeysCtx(ctx context.Context, bucket, prefix []byte) (keys [][]byte, values [][]byte, err error)
+	KeyStringsCtx(ctx context.Context, bucket, prefix []byte) (keys []string, values [][]byte, err error)
+	KeysWithoutValuesCtx(ctx context.Context, bucket, prefix []byte) (keys [][]byte, err error)
+	KeyStringsWithoutValuesCtx(ctx context.Context, bucket, prefix []byte) (keys []string, err error)
+
+	// CursorCtx check ctx when the cursor is opened, a cursor is closed by its caller
+	CursorCtx(ctx context.Context, bucket []byte, opts CursorOptions) (Cursor, error)
+
+	// RangeCtx check ctx between keys of the page
+	RangeCtx(ctx context.Context, bucket []byte, opts RangeOptions) (RangePage, error)
+	BucketsCtx(ctx context.Context) ([][]byte, error)
+	AllKeysCtx(ctx context.Context, async func(key string, deletedOrExpired bool)) error
+
+	// SyncCtx check ctx before the sync
+	SyncCtx(ctx context.Context) error
+
+	// GCCtx check ctx between files rewritten
+	GCCtx(ctx context.Context, discardRatio float64) (int, error)
+
+	// BackupCtx stop writing the backup when ctx is done
+	BackupCtx(ctx context.Context, w io.Writer, since uint64, buckets ...[]byte) (uint64, error)
+
+	// RestoreCtx stop reading the backup when ctx is done, keys loaded before are kept
+	RestoreCtx(ctx context.Context, r io.Reader) error
+
+	// UpdateCtx check ctx before each run of f and before the commit, Txn.Scan checks it between keys
+	UpdateCtx(ctx context.Context, f func(txn Txn) error) error
+
+	// ViewCtx check ctx before f runs, Txn.Scan checks it between keys
+	ViewCtx(ctx context.Context, f func(txn Txn) error) error
+
+	// BatchCtx check ctx before each commit, Txn.Scan checks it between keys
+	BatchCtx(ctx context.Context, f func(txn Txn) error) error
+}
+
+var (
+	_ KvStoreCtx = badgerStore{}
+	_ KvStoreCtx = (*memStore)(nil)
+)
+
+// allKeysCtx a store not KvStoreCtx stopping AllKeys with a context, like stores of Wrap
+type allKeysCtx interface {
+	AllKeysCtx(ctx context.Context, async func(key string, deletedOrExpired bool)) error
+}
+
+// WithContext store as a KvStoreCtx. A store not implementing it checks ctx before each call only, and
+// between keys for AllKeys, the backup written or read by Backup and Restore, and transactions
+func WithContext(store KvStore) KvStoreCtx {
+	if s, ok := store.(KvStoreCtx); ok {
+		return s
+	}
+	return ctxStore{KvStore: store}
+}
+
+// ctxReader fails reads once ctx is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// ctxWriter fails writes once ctx is done
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (c ctxWriter) Write(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.w.Write(p)
+}
+
+// ctxTxn run f unless ctx is done, and fail the transaction if ctx is done after f
+func ctxTxn(ctx context.Context, f func(txn Txn) error) func(txn Txn) error {
+	return func(txn Txn) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := f(txn); err != nil {
+			return err
+		}
+		return ctx.Err()
+	}
+}
+
+// ctxStore a KvStore checking a context before its calls
+type ctxStore struct {
+	KvStore
+}
+
+func (s ctxStore) SetCtx(ctx context.Context, bucket, k []byte, v []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.KvStore.Set(bucket, k, v)
+}
+
+func (s ctxStore) GetCtx(ctx context.Context, bucket, k []byte) (result []byte, found bool, e error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	return s.KvStore.Get(bucket, k)
+}
+
+func (s ctxStore) SetWithTTLCtx(ctx context.Context, bucket, k []byte, v []byte, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.KvStore.SetWithTTL(bucket, k, v, ttl)
+}
+
+func (s ctxStore) PSetCtx(ctx context.Context, bucket []byte, keys, values [][]byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.KvStore.PSet(bucket, keys, values)
+}
+
+func (s ctxStore) PSetWithTTLCtx(ctx context.Context, bucket []byte, keys, values [][]byte, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.KvStore.PSetWithTTL(bucket, keys, values, ttl)
+}
+
+func (s ctxStore) TTLCtx(ctx context.Context, bucket, k []byte) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.KvStore.TTL(bucket, k)
+}
+
+func (s ctxStore) PersistCtx(ctx context.Context, bucket, k []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.KvStore.Persist(bucket, k)
+}
+
+func (s ctxStore) PGetCtx(ctx context.Context, bucket []byte, keys [][]byte) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.KvStore.PGet(bucket, keys)
+}
+
+func (s ctxStore) CompareAndSwapCtx(ctx context.Context, bucket, k, expected, v []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.KvStore.CompareAndSwap(bucket, k, expected, v)
+}
+
+func (s ctxStore) SetIfAbsentCtx(ctx context.Context, bucket, k, v []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.KvStore.SetIfAbsent(bucket, k, v)
+}
+
+func (s ctxStore) IncrCtx(ctx context.Context, bucket, k []byte, delta int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.KvStore.Incr(bucket, k, delta)
+}
+
+func (s ctxStore) SequenceCtx(ctx context.Context, bucket, name []byte, leaseSize uint64) (Sequence, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.KvStore.Sequence(bucket, name, leaseSize)
+}
+
+func (s ctxStore) DeleteCtx(ctx context.Context, bucket, key []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.KvStore.Delete(bucket, key)
+}
+
+func (s ctxStore) DeleteIfEqualsCtx(ctx context.Context, bucket, k, expected []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.KvStore.DeleteIfEquals(bucket, k, expected)
+}
+
+func (s ctxStore) DeleteKeysCtx(ctx context.Context, bucket []byte, keys [][]byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.KvStore.DeleteKeys(bucket, keys)
+}
+
+func (s ctxStore) KeysCtx(ctx context.Context, bucket, prefix []byte) (keys [][]byte, values [][]byte, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	return s.KvStore.Keys(bucket, prefix)
+}
+
+func (s ctxStore) KeyStringsCtx(ctx context.Context, bucket, prefix []byte) (keys []string, values [][]byte, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	return s.KvStore.KeyStrings(bucket, prefix)
+}
+
+func (s ctxStore) KeysWithoutValuesCtx(ctx context.Context, bucket, prefix []byte) (keys [][]byte, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.KvStore.KeysWithoutValues(bucket, prefix)
+}
+
+func (s ctxStore) KeyStringsWithoutValuesCtx(ctx context.Context, bucket, prefix []byte) (keys []string, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.KvStore.KeyStringsWithoutValues(bucket, prefix)
+}
+
+func (s ctxStore) CursorCtx(ctx context.Context, bucket []byte, opts CursorOptions) (Cursor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.KvStore.Cursor(bucket, opts)
+}
+
+func (s ctxStore) RangeCtx(ctx context.Context, bucket []byte, opts RangeOptions) (RangePage, error) {
+	if err := ctx.Err(); err != nil {
+		return RangePage{}, err
+	}
+	return s.KvStore.Range(bucket, opts)
+}
+
+func (s ctxStore) BucketsCtx(ctx context.Context) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.KvStore.Buckets()
+}
+
+// AllKeysCtx of a store with an AllKeysCtx method stops when ctx is done. Other stores scan until the end,
+// async is not called after ctx is done
+func (s ctxStore) AllKeysCtx(ctx context.Context, async func(key string, deletedOrExpired bool)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if scanner, ok := s.KvStore.(allKeysCtx); ok {
+		return scanner.AllKeysCtx(ctx, async)
+	}
+	err := s.KvStore.AllKeys(func(key string, deletedOrExpired bool) {
+		if ctx.Err() == nil {
+			async(key, deletedOrExpired)
+		}
+	})
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+func (s ctxStore) SyncCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.KvStore.Sync()
+}
+
+func (s ctxStore) GCCtx(ctx context.Context, discardRatio float64) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.KvStore.GC(discardRatio)
+}
+
+func (s ctxStore) BackupCtx(ctx context.Context, w io.Writer, since uint64, buckets ...[]byte) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return since, err
+	}
+	return s.KvStore.Backup(ctxWriter{ctx: ctx, w: w}, since, buckets...)
+}
+
+func (s ctxStore) RestoreCtx(ctx context.Context, r io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.KvStore.Restore(ctxReader{ctx: ctx, r: r})
+}
+
+func (s ctxStore) UpdateCtx(ctx context.Context, f func(txn Txn) error) error {
+	return s.KvStore.Update(ctxTxn(ctx, f))
+}
+
+func (s ctxStore) ViewCtx(ctx context.Context, f func(txn Txn) error) error {
+	return s.KvStore.View(ctxTxn(ctx, f))
+}
+
+func (s ctxStore) BatchCtx(ctx context.Context, f func(txn Txn) error) error {
+	return s.KvStore.Batch(ctxTxn(ctx, f))
+}
+
+func (b badgerStore) Set(bucket, k []byte, v []byte) error {
+	return b.SetCtx(context.Background(), bucket, k, v)
+}
+
+func (b badgerStore) Get(bucket, k []byte) (result []byte, found bool, e error) {
+	return b.GetCtx(context.Background(), bucket, k)
+}
+
+func (b badgerStore) SetWithTTL(bucket, k []byte, v []byte, ttl time.Duration) error {
+	return b.SetWithTTLCtx(context.Background(), bucket, k, v, ttl)
+}
+
+func (b badgerStore) PSet(bucket []byte, keys, values [][]byte) error {
+	return b.PSetCtx(context.Background(), bucket, keys, values)
+}
+
+func (b badgerStore) PSetWithTTL(bucket []byte, keys, values [][]byte, ttl time.Duration) error {
+	return b.PSetWithTTLCtx(context.Background(), bucket, keys, values, ttl)
+}
+
+func (b badgerStore) TTL(bucket, k []byte) (time.Duration, error) {
+	return b.TTLCtx(context.Background(), bucket, k)
+}
+
+func (b badgerStore) Persist(bucket, k []byte) error {
+	return b.PersistCtx(context.Background(), bucket, k)
+}
+
+func (b badgerStore) PGet(bucket []byte, keys [][]byte) ([][]byte, error) {
+	return b.PGetCtx(context.Background(), bucket, keys)
+}
+
+func (b badgerStore) CompareAndSwap(bucket, k, expected, v []byte) error {
+	return b.CompareAndSwapCtx(context.Background(), bucket, k, expected, v)
+}
+
+func (b badgerStore) SetIfAbsent(bucket, k, v []byte) error {
+	return b.SetIfAbsentCtx(context.Background(), bucket, k, v)
+}
+
+func (b badgerStore) Incr(bucket, k []byte, delta int64) (int64, error) {
+	return b.IncrCtx(context.Background(), bucket, k, delta)
+}
+
+func (b badgerStore) Sequence(bucket, name []byte, leaseSize uint64) (Sequence, error) {
+	return b.SequenceCtx(context.Background(), bucket, name, leaseSize)
+}
+
+func (b badgerStore) Delete(bucket, key []byte) error {
+	return b.DeleteCtx(context.Background(), bucket, key)
+}
+
+func (b badgerStore) DeleteIfEquals(bucket, k, expected []byte) error {
+	return b.DeleteIfEqualsCtx(context.Background(), bucket, k, expected)
+}
+
+func (b badgerStore) DeleteKeys(bucket []byte, keys [][]byte) error {
+	return b.DeleteKeysCtx(context.Background(), bucket, keys)
+}
+
+func (b badgerStore) Keys(bucket, prefix []byte) (keys [][]byte, values [][]byte, err error) {
+	return b.KeysCtx(context.Background(), bucket, prefix)
+}
+
+func (b badgerStore) KeyStrings(bucket, prefix []byte) (keys []string, values [][]byte, err error) {
+	return b.KeyStringsCtx(context.Background(), bucket, prefix)
+}
+
+func (b badgerStore) KeysWithoutValues(bucket, prefix []byte) (keys [][]byte, err error) {
+	return b.KeysWithoutValuesCtx(context.Background(), bucket, prefix)
+}
+
+func (b badgerStore) KeyStringsWithoutValues(bucket, prefix []byte) (keys []string, err error) {
+	return b.KeyStringsWithoutValuesCtx(context.Background(), bucket, prefix)
+}
+
+func (b badgerStore) Cursor(bucket []byte, opts CursorOptions) (Cursor, error) {
+	return b.CursorCtx(context.Background(), bucket, opts)
+}
+
+func (b badgerStore) Range(bucket []byte, opts RangeOptions) (RangePage, error) {
+	return b.RangeCtx(context.Background(), bucket, opts)
+}
+
+func (b badgerStore) Buckets() ([][]byte, error) {
+	return b.BucketsCtx(context.Background())
+}
+
+func (b badgerStore) AllKeys(async func(key string, deletedOrExpired bool)) error {
+	return b.AllKeysCtx(context.Background(), async)
+}
+
+func (b badgerStore) Sync() error {
+	return b.SyncCtx(context.Background())
+}
+
+func (b badgerStore) GC(discardRatio float64) (int, error) {
+	return b.GCCtx(context.Background(), discardRatio)
+}
+
+func (b badgerStore) Backup(w io.Writer, since uint64, buckets ...[]byte) (uint64, error) {
+	return b.BackupCtx(context.Background(), w, since, buckets...)
+}
+
+func (b badgerStore) Restore(r io.Reader) error {
+	return b.RestoreCtx(context.Background(), r)
+}
+
+func (b badgerStore) Update(f func(txn Txn) error) error {
+	return b.UpdateCtx(context.Background(), f)
+}
+
+func (b badgerStore) View(f func(txn Txn) error) error {
+	return b.ViewCtx(context.Background(), f)
+}
+
+func (b badgerStore) Batch(f func(txn Txn) error) error {
+	return b.BatchCtx(context.Background(), f)
+}
+
+func (m *memStore) Set(bucket, k []byte, v []byte) error {
+	return m.SetCtx(context.Background(), bucket, k, v)
+}
+
+func (m *memStore) Get(bucket, k []byte) (result []byte, found bool, e error) {
+	return m.GetCtx(context.Background(), bucket, k)
+}
+
+func (m *memStore) SetWithTTL(bucket, k []byte, v []byte, ttl time.Duration) error {
+	return m.SetWithTTLCtx(context.Background(), bucket, k, v, ttl)
+}
+
+func (m *memStore) PSet(bucket []byte, keys, values [][]byte) error {
+	return m.PSetCtx(context.Background(), bucket, keys, values)
+}
+
+func (m *memStore) PSetWithTTL(bucket []byte, keys, values [][]byte, ttl time.Duration) error {
+	return m.PSetWithTTLCtx(context.Background(), bucket, keys, values, ttl)
+}
+
+func (m *memStore) TTL(bucket, k []byte) (time.Duration, error) {
+	return m.TTLCtx(context.Background(), bucket, k)
+}
+
+func (m *memStore) Persist(bucket, k []byte) error {
+	return m.PersistCtx(context.Background(), bucket, k)
+}
+
+func (m *memStore) PGet(bucket []byte, keys [][]byte) ([][]byte, error) {
+	return m.PGetCtx(context.Background(), bucket, keys)
+}
+
+func (m *memStore) CompareAndSwap(bucket, k, expected, v []byte) error {
+	return m.CompareAndSwapCtx(context.Background(), bucket, k, expected, v)
+}
+
+func (m *memStore) SetIfAbsent(bucket, k, v []byte) error {
+	return m.SetIfAbsentCtx(context.Background(), bucket, k, v)
+}
+
+func (m *memStore) Incr(bucket, k []byte, delta int64) (int64, error) {
+	return m.IncrCtx(context.Background(), bucket, k, delta)
+}
+
+func (m *memStore) Sequence(bucket, name []byte, leaseSize uint64) (Sequence, error) {
+	return m.SequenceCtx(context.Background(), bucket, name, leaseSize)
+}
+
+func (m *memStore) Delete(bucket, key []byte) error {
+	return m.DeleteCtx(context.Background(), bucket, key)
+}
+
+func (m *memStore) DeleteIfEquals(bucket, k, expected []byte) error {
+	return m.DeleteIfEqualsCtx(context.Background(), bucket, k, expected)
+}
+
+func (m *memStore) DeleteKeys(bucket []byte, keys [][]byte) error {
+	return m.DeleteKeysCtx(context.Background(), bucket, keys)
+}
+
+func (m *memStore) Keys(bucket, prefix []byte) (keys [][]byte, values [][]byte, err error) {
+	return m.KeysCtx(context.Background(), bucket, prefix)
+}
+
+func (m *memStore) KeyStrings(bucket, prefix []byte) (keys []string, values [][]byte, err error) {
+	return m.KeyStringsCtx(context.Background(), bucket, prefix)
+}
+
+func (m *memStore) KeysWithoutValues(bucket, prefix []byte) (keys [][]byte, err error) {
+	return m.KeysWithoutValuesCtx(context.Background(), bucket, prefix)
+}
+
+func (m *memStore) KeyStringsWithoutValues(bucket, prefix []byte) (keys []string, err error) {
+	return m.KeyStringsWithoutValuesCtx(context.Background(), bucket, prefix)
+}
+
+func (m *memStore) Cursor(bucket []byte, opts CursorOptions) (Cursor, error) {
+	return m.CursorCtx(context.Background(), bucket, opts)
+}
+
+func (m *memStore) Range(bucket []byte, opts RangeOptions) (RangePage, error) {
+	return m.RangeCtx(context.Background(), bucket, opts)
+}
+
+func (m *memStore) Buckets() ([][]byte, error) {
+	return m.BucketsCtx(context.Background())
+}
+
+func (m *memStore) AllKeys(async func(key string, deletedOrExpired bool)) error {
+	return m.AllKeysCtx(context.Background(), async)
+}
+
+func (m *memStore) Sync() error {
+	return m.SyncCtx(context.Background())
+}
+
+func (m *memStore) GC(discardRatio float64) (int, error) {
+	return m.GCCtx(context.Background(), discardRatio)
+}
+
+func (m *memStore) Backup(w io.Writer, since uint64, buckets ...[]byte) (uint64, error) {
+	return m.BackupCtx(context.Background(), w, since, buckets...)
+}
+
+func (m *memStore) Restore(r io.Reader) error {
+	return m.RestoreCtx(context.Background(), r)
+}
+
+func (m *memStore) Update(f func(txn Txn) error) error {
+	return m.UpdateCtx(context.Background(), f)
+}
+
+func (m *memStore) View(f func(txn Txn) error) error {
+	return m.ViewCtx(context.Background(), f)
+}
+
+func (m *memStore) Batch(f func(txn Txn) error) error {
+	return m.BatchCtx(context.Background(), f)
+}
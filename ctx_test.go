@@ -0,0 +1,150 @@
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// test calls with a done context fail with its error and write nothing
+func TestCanceled(t *testing.T) {
+	testStores(t, fillCursorKeys, func(t *testing.T, s KvStore) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		cs := s.(KvStoreCtx)
+
+		assert.Equal(t, context.Canceled, cs.SetCtx(ctx, TestBucket, []byte("new"), []byte("v")))
+		assert.Equal(t, context.Canceled, cs.PSetCtx(ctx, TestBucket, [][]byte{[]byte("new")}, [][]byte{[]byte("v")}))
+		assert.Equal(t, context.Canceled, cs.DeleteCtx(ctx, TestBucket, []byte("key-00")))
+		_, err := cs.IncrCtx(ctx, TestBucket, []byte("n"), 1)
+		assert.Equal(t, context.Canceled, err)
+		_, _, err = cs.GetCtx(ctx, TestBucket, []byte("key-00"))
+		assert.Equal(t, context.Canceled, err)
+		_, _, err = cs.KeysCtx(ctx, TestBucket, nil)
+		assert.Equal(t, context.Canceled, err)
+		_, err = cs.RangeCtx(ctx, TestBucket, RangeOptions{})
+		assert.Equal(t, context.Canceled, err)
+		_, err = cs.BucketsCtx(ctx)
+		assert.Equal(t, context.Canceled, err)
+		_, err = cs.BackupCtx(ctx, &bytes.Buffer{}, 0)
+		assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+
+		_, _, err = s.Get(TestBucket, []byte("new"))
+		assert.Equal(t, KeyNotFoundError, err)
+		_, _, err = s.Get(TestBucket, []byte("key-00"))
+		assert.True(t, err == nil)
+	})
+}
+
+// test scans stop between keys when the context is done
+func TestCanceledScan(t *testing.T) {
+	testStores(t, fillCursorKeys, func(t *testing.T, s KvStore) {
+		cs := WithContext(s)
+		ctx, cancel := context.WithCancel(context.Background())
+		n := 0
+		err := cs.AllKeysCtx(ctx, func(key string, deletedOrExpired bool) {
+			if n++; n == 3 {
+				cancel()
+			}
+		})
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 3, n)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		n = 0
+		err = cs.ViewCtx(ctx, func(txn Txn) error {
+			return txn.Scan(TestBucket, []byte("key-"), func(k, v []byte) error {
+				if n++; n == 3 {
+					cancel()
+				}
+				return nil
+			})
+		})
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 3, n)
+	})
+}
+
+// test a transaction is not committed when its context is done before the commit
+func TestCanceledUpdate(t *testing.T) {
+	testStores(t, nil, func(t *testing.T, s KvStore) {
+		ctx, cancel := context.WithCancel(context.Background())
+		err := WithContext(s).UpdateCtx(ctx, func(txn Txn) error {
+			defer cancel()
+			return txn.Set(TestBucket, []byte("k"), []byte("v"))
+		})
+		assert.Equal(t, context.Canceled, err)
+		_, _, err = s.Get(TestBucket, []byte("k"))
+		assert.Equal(t, KeyNotFoundError, err)
+
+		assert.True(t, WithContext(s).UpdateCtx(context.Background(), func(txn Txn) error {
+			return txn.Set(TestBucket, []byte("k"), []byte("v"))
+		}) == nil)
+		v, _, _ := s.Get(TestBucket, []byte("k"))
+		assert.Equal(t, "v", string(v))
+	})
+}
+
+// plainStore a store hiding the methods with a context of its store
+type plainStore struct {
+	KvStore
+}
+
+// test WithContext adapts a store without methods taking a context
+func TestWithContext(t *testing.T) {
+	s := newMemoryStore(t)
+	fillCursorKeys(s)
+	cs := WithContext(plainStore{KvStore: s})
+	_, ok := cs.(ctxStore)
+	assert.True(t, ok)
+	assert.Equal(t, s, WithContext(s))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	v, found, err := cs.GetCtx(ctx, TestBucket, []byte("key-01"))
+	assert.True(t, err == nil && found)
+	assert.Equal(t, "v-key-01", string(v))
+
+	n := 0
+	err = cs.AllKeysCtx(ctx, func(key string, deletedOrExpired bool) {
+		if n++; n == 3 {
+			cancel()
+		}
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 3, n, "keys after the context is done are not visited")
+	assert.Equal(t, context.Canceled, cs.SetCtx(ctx, TestBucket, []byte("new"), nil))
+	assert.Equal(t, context.Canceled, cs.ViewCtx(ctx, func(txn Txn) error { return nil }))
+
+	// the scan of a store with AllKeysCtx stops, a plain store scans every key
+	all := 0
+	assert.True(t, s.AllKeys(func(key string, deletedOrExpired bool) { all++ }) == nil)
+	for _, c := range []struct {
+		wrap    func(s KvStore) KvStore
+		scanned int
+	}{
+		{func(s KvStore) KvStore { return Wrap(s) }, 3},
+		{func(s KvStore) KvStore { return plainStore{KvStore: s} }, all},
+	} {
+		scanned := 0
+		counted := Wrap(s, func(c *Call, next Handler) error {
+			async := c.Args[0].(func(key string, deletedOrExpired bool))
+			c.Args[0] = func(key string, deletedOrExpired bool) {
+				scanned++
+				async(key, deletedOrExpired)
+			}
+			return next(c)
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		n = 0
+		err = WithContext(c.wrap(counted)).AllKeysCtx(ctx, func(key string, deletedOrExpired bool) {
+			if n++; n == 3 {
+				cancel()
+			}
+		})
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 3, n)
+		assert.Equal(t, c.scanned, scanned)
+	}
+}
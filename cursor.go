@@ -0,0 +1,290 @@
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// CursorOptions options of a cursor over a bucket, keys are relative to the bucket
+type CursorOptions struct {
+	// Prefix only visit keys with prefix
+	Prefix []byte
+
+	// Start first key, included. nil to start from the first key
+	Start []byte
+
+	// End last key, excluded. nil to end after the last key
+	End []byte
+
+	// Reverse visit keys from the last to the first
+	Reverse bool
+
+	// KeysOnly do not prefetch values, Value still reads them one by one
+	KeysOnly bool
+
+	// Limit max keys to visit after a Seek, 0 is no limit
+	Limit int
+}
+
+// Cursor stream keys of a bucket in order without loading them into memory, it is not safe for concurrent use.
+// A new cursor is not positioned, call Seek first:
+//
+//	for c.Seek(nil); c.Valid(); c.Next() {
+//		use(c.Key())
+//	}
+type Cursor interface {
+	// Seek move to key, or the first key after it in the cursor order. nil move to the first key
+	Seek(key []byte) bool
+
+	// Next move to the next key in the cursor order
+	Next() bool
+
+	// Prev move to the previous key in the cursor order
+	Prev() bool
+
+	// Valid check the cursor is at a key
+	Valid() bool
+
+	// Key at the cursor with bucket removed
+	Key() []byte
+
+	// Value at the cursor
+	Value() ([]byte, error)
+
+	// ExpiresAt unix time in seconds the key at the cursor expires at, 0 if it never expires
+	ExpiresAt() uint64
+
+	// UserMeta user meta of badger of the key at the cursor, see Txn.SetWithMeta
+	UserMeta() byte
+
+	// Close release the cursor, a badger cursor keeps a read transaction open until closed
+	Close() error
+}
+
+// cursorRange bounds of a cursor as engine keys
+type cursorRange struct {
+	format KeyFormat
+	bucket []byte
+	prefix []byte // bucket prefix with CursorOptions.Prefix
+	lower  []byte // included
+	upper  []byte // excluded, nil no bound
+}
+
+func newCursorRange(format KeyFormat, bucket []byte, opts CursorOptions) cursorRange {
+	bucketPrefix := format.BucketPrefix(bucket)
+	r := cursorRange{
+		format: format,
+		bucket: bucket,
+		prefix: append(copyBytes(bucketPrefix), opts.Prefix...),
+	}
+	r.lower = r.prefix
+	r.upper = prefixEnd(r.prefix)
+	if opts.Start != nil {
+		if start := append(copyBytes(bucketPrefix), opts.Start...); bytes.Compare(start, r.lower) > 0 {
+			r.lower = start
+		}
+	}
+	if opts.End != nil {
+		if end := append(copyBytes(bucketPrefix), opts.End...); r.upper == nil || bytes.Compare(end, r.upper) < 0 {
+			r.upper = end
+		}
+	}
+	return r
+}
+
+// seekKey the engine key of a user key, nil for nil
+func (r cursorRange) seekKey(key []byte) []byte {
+	if key == nil {
+		return nil
+	}
+	return r.format.Encode(r.bucket, key)
+}
+
+// below check raw is before the lower bound
+func (r cursorRange) below(raw []byte) bool {
+	return bytes.Compare(raw, r.lower) < 0
+}
+
+// above check raw is at or after the upper bound
+func (r cursorRange) above(raw []byte) bool {
+	return r.upper != nil && bytes.Compare(raw, r.upper) >= 0
+}
+
+// visible check raw is a key of the cursor
+func (r cursorRange) visible(raw []byte) bool {
+	return bytes.HasPrefix(raw, r.prefix) && r.format.inBucket(r.bucket, raw)
+}
+
+// prefixEnd the first key after all keys with prefix, nil if there is none
+func prefixEnd(prefix []byte) []byte {
+	end := copyBytes(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+type badgerCursor struct {
+	txn     *badger.Txn
+	r       cursorRange
+	opts    CursorOptions
+	forward *badger.Iterator
+	reverse *badger.Iterator
+	at      *badger.Iterator // iterator positioned at item
+	item    *badger.Item
+	key     []byte // engine key of item
+	count   int
+}
+
+func (b badgerStore) CursorCtx(ctx context.Context, bucket []byte, opts CursorOptions) (Cursor, error) {
+	b.log.debug("Cursor", b.log.key("bucket", bucket), b.log.key("prefix", opts.Prefix))
+	if b.db.IsClosed() {
+		return nil, StoreClosedError
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &badgerCursor{
+		txn:  b.db.NewTransaction(false),
+		r:    newCursorRange(b.format, bucket, opts),
+		opts: opts,
+	}, nil
+}
+
+// iterator in ascending or descending key order
+func (c *badgerCursor) iterator(ascending bool) *badger.Iterator {
+	it := &c.forward
+	if !ascending {
+		it = &c.reverse
+	}
+	if *it == nil {
+		opts := badger.IteratorOptions{
+			PrefetchValues: !c.opts.KeysOnly,
+			PrefetchSize:   100,
+			Reverse:        !ascending,
+		}
+		if ascending {
+			opts.Prefix = c.r.prefix // a reverse iterator with prefix can not rewind to the last key
+		}
+		*it = c.txn.NewIterator(opts)
+	}
+	return *it
+}
+
+func (c *badgerCursor) Seek(key []byte) bool {
+	c.count = 1
+	ascending := !c.opts.Reverse
+	it := c.iterator(ascending)
+	raw := c.r.seekKey(key)
+	if ascending {
+		if raw == nil || c.r.below(raw) {
+			raw = c.r.lower
+		}
+		it.Seek(raw)
+		return c.settle(it, ascending, nil)
+	}
+	if raw == nil || c.r.above(raw) {
+		if c.r.upper == nil {
+			it.Rewind()
+			return c.settle(it, ascending, nil)
+		}
+		it.Seek(c.r.upper)
+		return c.settle(it, ascending, c.r.upper)
+	}
+	it.Seek(raw)
+	return c.settle(it, ascending, nil)
+}
+
+func (c *badgerCursor) Next() bool {
+	if c.opts.Limit > 0 && c.count >= c.opts.Limit {
+		c.at, c.item, c.key = nil, nil, nil
+		return false
+	}
+	c.count++
+	return c.move(!c.opts.Reverse)
+}
+
+func (c *badgerCursor) Prev() bool {
+	c.count--
+	return c.move(c.opts.Reverse)
+}
+
+// move one key in ascending or descending order
+func (c *badgerCursor) move(ascending bool) bool {
+	if c.item == nil {
+		return false
+	}
+	it := c.iterator(ascending)
+	if c.at == it {
+		it.Next()
+		return c.settle(it, ascending, nil)
+	}
+	it.Seek(c.key)
+	return c.settle(it, ascending, c.key)
+}
+
+// settle on the first visible key from it, skipping a key equal to skip
+func (c *badgerCursor) settle(it *badger.Iterator, ascending bool, skip []byte) bool {
+	c.at, c.item, c.key = nil, nil, nil
+	for ; it.Valid(); it.Next() {
+		item := it.Item()
+		raw := item.Key()
+		if (ascending && c.r.above(raw)) || (!ascending && c.r.below(raw)) {
+			return false
+		}
+		if item.IsDeletedOrExpired() || !c.r.visible(raw) || (skip != nil && bytes.Equal(raw, skip)) {
+			continue
+		}
+		c.at, c.item, c.key = it, item, item.KeyCopy(nil)
+		return true
+	}
+	return false
+}
+
+func (c *badgerCursor) Valid() bool {
+	return c.item != nil
+}
+
+func (c *badgerCursor) Key() []byte {
+	if c.item == nil {
+		return nil
+	}
+	return c.r.format.userKey(c.r.bucket, c.key)
+}
+
+func (c *badgerCursor) Value() ([]byte, error) {
+	if c.item == nil {
+		return nil, KeyNotFoundError
+	}
+	return c.item.ValueCopy(nil)
+}
+
+func (c *badgerCursor) ExpiresAt() uint64 {
+	if c.item == nil {
+		return 0
+	}
+	return c.item.ExpiresAt()
+}
+
+func (c *badgerCursor) UserMeta() byte {
+	if c.item == nil {
+		return 0
+	}
+	return c.item.UserMeta()
+}
+
+func (c *badgerCursor) Close() error {
+	if c.forward != nil {
+		c.forward.Close()
+	}
+	if c.reverse != nil {
+		c.reverse.Close()
+	}
+	c.forward, c.reverse, c.at, c.item = nil, nil, nil, nil
+	c.txn.Discard()
+	return nil
+}
@@ -0,0 +1,171 @@
+package kvstore
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// testStores run f with a badger store and a memory store, both filled by fill
+func testStores(t *testing.T, fill func(s KvStore), f func(t *testing.T, s KvStore)) {
+	var dir = getDataPath()
+	t.Logf("data path %s", dir)
+	b, err := Open(EngineBadger, Options{Dir: dir})
+	assert.True(t, err == nil)
+	defer func() {
+		_ = b.Close()
+		_ = os.RemoveAll(dir)
+	}()
+	m := newMemoryStore(t)
+
+	stores := map[string]KvStore{EngineBadger: b, EngineMemory: m}
+	for _, s := range stores {
+		if fill != nil {
+			fill(s)
+		}
+	}
+	for _, name := range []string{EngineBadger, EngineMemory} {
+		s := stores[name]
+		t.Run(name, func(t *testing.T) {
+			f(t, s)
+		})
+	}
+}
+
+// fillCursorKeys set key-00 to key-19 in TestBucket and some keys around it
+func fillCursorKeys(s KvStore) {
+	for i := 0; i < 20; i++ {
+		k := fmt.Sprintf("key-%02d", i)
+		_ = s.Set(TestBucket, []byte(k), []byte("v-"+k))
+	}
+	_ = s.Set([]byte("test"), []byte("key-00"), []byte("other"))
+	_ = s.Set([]byte("test_bucket_1"), []byte("key-00"), []byte("other"))
+	_ = s.Delete(TestBucket, []byte("key-05"))
+}
+
+// collect keys from the cursor position on
+func collect(c Cursor) []string {
+	var keys []string
+	for ; c.Valid(); c.Next() {
+		keys = append(keys, string(c.Key()))
+	}
+	return keys
+}
+
+func cursorKeys(from, to int, reverse bool, skip ...int) []string {
+	var keys []string
+	for i := from; i < to; i++ {
+		deleted := false
+		for _, s := range skip {
+			deleted = deleted || s == i
+		}
+		if !deleted {
+			keys = append(keys, fmt.Sprintf("key-%02d", i))
+		}
+	}
+	if reverse {
+		for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+	return keys
+}
+
+// test forward and reverse cursor over a bucket
+func TestCursor(t *testing.T) {
+	testStores(t, fillCursorKeys, func(t *testing.T, s KvStore) {
+		c, err := s.Cursor(TestBucket, CursorOptions{})
+		assert.True(t, err == nil)
+		assert.False(t, c.Valid())
+		assert.True(t, c.Seek(nil))
+		v, err := c.Value()
+		assert.True(t, err == nil)
+		assert.Equal(t, "v-key-00", string(v))
+		assert.Equal(t, cursorKeys(0, 20, false, 5), collect(c))
+		assert.True(t, c.Close() == nil)
+
+		c, err = s.Cursor(TestBucket, CursorOptions{Reverse: true, KeysOnly: true})
+		assert.True(t, err == nil)
+		c.Seek(nil)
+		v, err = c.Value()
+		assert.True(t, err == nil)
+		assert.Equal(t, "v-key-19", string(v))
+		assert.Equal(t, cursorKeys(0, 20, true, 5), collect(c))
+		assert.True(t, c.Close() == nil)
+	})
+}
+
+// test cursor with bounds, prefix and limit
+func TestCursorRange(t *testing.T) {
+	testStores(t, fillCursorKeys, func(t *testing.T, s KvStore) {
+		c, _ := s.Cursor(TestBucket, CursorOptions{Start: []byte("key-03"), End: []byte("key-08")})
+		c.Seek(nil)
+		assert.Equal(t, cursorKeys(3, 8, false, 5), collect(c))
+		c.Seek([]byte("key-07"))
+		assert.Equal(t, cursorKeys(7, 8, false), collect(c))
+		_ = c.Close()
+
+		c, _ = s.Cursor(TestBucket, CursorOptions{Start: []byte("key-03"), End: []byte("key-08"), Reverse: true})
+		c.Seek(nil)
+		assert.Equal(t, cursorKeys(3, 8, true, 5), collect(c))
+		c.Seek([]byte("key-05"))
+		assert.Equal(t, cursorKeys(3, 5, true), collect(c))
+		_ = c.Close()
+
+		c, _ = s.Cursor(TestBucket, CursorOptions{Prefix: []byte("key-1"), Limit: 3})
+		c.Seek(nil)
+		assert.Equal(t, cursorKeys(10, 13, false), collect(c))
+		c.Seek([]byte("key-15"))
+		assert.Equal(t, cursorKeys(15, 18, false), collect(c))
+		_ = c.Close()
+
+		c, _ = s.Cursor(TestBucket, CursorOptions{Prefix: []byte("key-1"), Reverse: true})
+		c.Seek(nil)
+		assert.Equal(t, cursorKeys(10, 20, true), collect(c))
+		_ = c.Close()
+
+		c, _ = s.Cursor([]byte("test"), CursorOptions{})
+		c.Seek(nil)
+		assert.Equal(t, []string{"key-00"}, collect(c))
+		_ = c.Close()
+
+		c, _ = s.Cursor([]byte("not-exist"), CursorOptions{Reverse: true})
+		assert.False(t, c.Seek(nil))
+		_ = c.Close()
+	})
+}
+
+// test moving back and forth
+func TestCursorPrev(t *testing.T) {
+	testStores(t, fillCursorKeys, func(t *testing.T, s KvStore) {
+		for _, reverse := range []bool{false, true} {
+			c, _ := s.Cursor(TestBucket, CursorOptions{Reverse: reverse})
+			assert.True(t, c.Seek([]byte("key-05")))
+			if reverse {
+				assert.Equal(t, "key-04", string(c.Key()))
+				assert.True(t, c.Prev())
+				assert.Equal(t, "key-06", string(c.Key()))
+				assert.True(t, c.Next())
+				assert.Equal(t, "key-04", string(c.Key()))
+			} else {
+				assert.Equal(t, "key-06", string(c.Key()))
+				assert.True(t, c.Prev())
+				assert.Equal(t, "key-04", string(c.Key()))
+				assert.True(t, c.Prev())
+				assert.Equal(t, "key-03", string(c.Key()))
+				assert.True(t, c.Next())
+				assert.Equal(t, "key-04", string(c.Key()))
+				assert.True(t, c.Next())
+				assert.Equal(t, "key-06", string(c.Key()))
+			}
+			_ = c.Close()
+		}
+
+		c, _ := s.Cursor(TestBucket, CursorOptions{})
+		c.Seek(nil)
+		assert.False(t, c.Prev())
+		assert.False(t, c.Valid())
+		_ = c.Close()
+	})
+}
@@ -0,0 +1,404 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// DumpFormat a readable format of Export and Import
+type DumpFormat string
+
+const (
+	// DumpJSONLines a json object of a DumpRecord per line
+	DumpJSONLines DumpFormat = "jsonl"
+
+	// DumpCSV a header line then a DumpRecord per line, columns are named like json fields
+	DumpCSV DumpFormat = "csv"
+
+	// DefaultImportBatchSize records written in a batch when ImportOptions.BatchSize is 0
+	DefaultImportBatchSize = 1000
+
+	// dumpBase64 DumpRecord.Encoding when bucket and key are base64
+	dumpBase64 = "base64"
+)
+
+var (
+	UnknownDumpFormatError = errors.New("unknown dump format")
+	BadDumpRecordError     = errors.New("bad dump record")
+	VerifyFailedError      = errors.New("verify failed")
+
+	dumpColumns = []string{"bucket", "key", "value", "expires_at", "encoding", "meta"}
+)
+
+// DumpRecord a key-value in a dump. Bucket and key are text, or base64 if one of them is not utf-8
+type DumpRecord struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+
+	// Value base64
+	Value string `json:"value"`
+
+	// ExpiresAt unix time in seconds, 0 never expires
+	ExpiresAt uint64 `json:"expires_at,omitempty"`
+
+	// Encoding "base64" if Bucket and Key are base64, empty if they are text
+	Encoding string `json:"encoding,omitempty"`
+
+	// Meta user meta of badger, 0 if it is not set
+	Meta byte `json:"meta,omitempty"`
+}
+
+// ExportOptions options of Export
+type ExportOptions struct {
+	Format DumpFormat
+
+	// Buckets to export, nil for every bucket of the store
+	Buckets [][]byte
+}
+
+// ImportOptions options of Import
+type ImportOptions struct {
+	Format DumpFormat
+
+	// BatchSize records written in a batch, 0 is DefaultImportBatchSize
+	BatchSize int
+
+	// DryRun read and check every record without writing
+	DryRun bool
+
+	// Verify read back every record and compare it with the store, with DryRun the dump is only compared
+	Verify bool
+}
+
+// ImportResult counts of an Import
+type ImportResult struct {
+	Records    int
+	Written    int
+	Expired    int // skipped
+	Mismatched int
+}
+
+// NewDumpRecord a record of a key-value in a bucket
+func NewDumpRecord(bucket, key, value []byte, expiresAt uint64, meta byte) DumpRecord {
+	r := DumpRecord{
+		Bucket:    string(bucket),
+		Key:       string(key),
+		Value:     base64.StdEncoding.EncodeToString(value),
+		ExpiresAt: expiresAt,
+		Meta:      meta,
+	}
+	if !utf8.Valid(bucket) || !utf8.Valid(key) {
+		r.Bucket = base64.StdEncoding.EncodeToString(bucket)
+		r.Key = base64.StdEncoding.EncodeToString(key)
+		r.Encoding = dumpBase64
+	}
+	return r
+}
+
+// Decode bucket, key and value of the record
+func (r DumpRecord) Decode() (bucket, key, value []byte, err error) {
+	switch r.Encoding {
+	case "":
+		bucket, key = []byte(r.Bucket), []byte(r.Key)
+	case dumpBase64:
+		if bucket, err = base64.StdEncoding.DecodeString(r.Bucket); err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: bucket %v", BadDumpRecordError, err)
+		}
+		if key, err = base64.StdEncoding.DecodeString(r.Key); err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: key %v", BadDumpRecordError, err)
+		}
+	default:
+		return nil, nil, nil, fmt.Errorf("%w: encoding %q", BadDumpRecordError, r.Encoding)
+	}
+	if value, err = base64.StdEncoding.DecodeString(r.Value); err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: value %v", BadDumpRecordError, err)
+	}
+	return bucket, key, value, nil
+}
+
+// Export write live keys of buckets in order, return the number of records
+func Export(s KvStore, w io.Writer, opts ExportOptions) (int, error) {
+	dw, err := newDumpWriter(w, opts.Format)
+	if err != nil {
+		return 0, err
+	}
+	buckets := opts.Buckets
+	if buckets == nil {
+		if buckets, err = s.Buckets(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := 0
+	for _, bucket := range buckets {
+		c, err := s.Cursor(bucket, CursorOptions{})
+		if err != nil {
+			return n, err
+		}
+		for c.Seek(nil); c.Valid(); c.Next() {
+			v, err := c.Value()
+			if err != nil {
+				_ = c.Close()
+				return n, err
+			}
+			if err := dw.write(NewDumpRecord(bucket, c.Key(), v, c.ExpiresAt(), c.UserMeta())); err != nil {
+				_ = c.Close()
+				return n, err
+			}
+			n++
+		}
+		if err := c.Close(); err != nil {
+			return n, err
+		}
+	}
+	return n, dw.flush()
+}
+
+// Import read a dump and write it in batches, records expired are skipped.
+// Batches are not atomic, an error leaves batches written before it
+func Import(s KvStore, r io.Reader, opts ImportOptions) (ImportResult, error) {
+	var result ImportResult
+	dr, err := newDumpReader(r, opts.Format)
+	if err != nil {
+		return result, err
+	}
+	size := opts.BatchSize
+	if size <= 0 {
+		size = DefaultImportBatchSize
+	}
+
+	var batch []importRecord
+	flush := func() error {
+		// a record can expire while its batch fills, a ttl of 0 would keep it forever
+		live, ttls := batch[:0], make([]time.Duration, 0, len(batch))
+		for _, rec := range batch {
+			ttl := rec.ttl()
+			if rec.expiresAt > 0 && ttl <= 0 {
+				result.Expired++
+				continue
+			}
+			live, ttls = append(live, rec), append(ttls, ttl)
+		}
+		batch = live
+		if len(batch) == 0 {
+			return nil
+		}
+		if !opts.DryRun {
+			err := s.Batch(func(txn Txn) error {
+				for i, rec := range batch {
+					if err := txn.SetWithMeta(rec.bucket, rec.key, rec.value, rec.meta, ttls[i]); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			result.Written += len(batch)
+		}
+		if opts.Verify {
+			for _, rec := range batch {
+				v, _, err := s.Get(rec.bucket, rec.key)
+				if err != nil && !errors.Is(err, KeyNotFoundError) {
+					return err
+				}
+				if err != nil || !bytes.Equal(v, rec.value) {
+					result.Mismatched++
+				}
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		rec, err := dr.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("record %d: %w", result.Records+1, err)
+		}
+		result.Records++
+		bucket, key, value, err := rec.Decode()
+		if err != nil {
+			return result, fmt.Errorf("record %d: %w", result.Records, err)
+		}
+		if expired(rec.ExpiresAt) {
+			result.Expired++
+			continue
+		}
+		batch = append(batch, importRecord{bucket: bucket, key: key, value: value, expiresAt: rec.ExpiresAt, meta: rec.Meta})
+		if len(batch) == size {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return result, err
+	}
+	if result.Mismatched > 0 {
+		return result, fmt.Errorf("%w: %d of %d records", VerifyFailedError, result.Mismatched, result.Records)
+	}
+	return result, nil
+}
+
+type importRecord struct {
+	bucket, key, value []byte
+	expiresAt          uint64
+	meta               byte
+}
+
+// ttl left of the record, 0 never expires
+func (r importRecord) ttl() time.Duration {
+	return remaining(r.expiresAt)
+}
+
+type dumpWriter interface {
+	write(r DumpRecord) error
+	flush() error
+}
+
+type dumpReader interface {
+	// read the next record, io.EOF at the end
+	read() (DumpRecord, error)
+}
+
+func newDumpWriter(w io.Writer, format DumpFormat) (dumpWriter, error) {
+	switch format {
+	case DumpJSONLines:
+		return jsonDumpWriter{json.NewEncoder(w)}, nil
+	case DumpCSV:
+		cw := csv.NewWriter(w)
+		return &csvDumpWriter{w: cw}, cw.Write(dumpColumns)
+	}
+	return nil, fmt.Errorf("%w: %q", UnknownDumpFormatError, format)
+}
+
+func newDumpReader(r io.Reader, format DumpFormat) (dumpReader, error) {
+	switch format {
+	case DumpJSONLines:
+		return jsonDumpReader{json.NewDecoder(r)}, nil
+	case DumpCSV:
+		return newCSVDumpReader(r)
+	}
+	return nil, fmt.Errorf("%w: %q", UnknownDumpFormatError, format)
+}
+
+type jsonDumpWriter struct {
+	e *json.Encoder
+}
+
+func (w jsonDumpWriter) write(r DumpRecord) error {
+	return w.e.Encode(r)
+}
+
+func (w jsonDumpWriter) flush() error {
+	return nil
+}
+
+type jsonDumpReader struct {
+	d *json.Decoder
+}
+
+func (r jsonDumpReader) read() (DumpRecord, error) {
+	var rec DumpRecord
+	err := r.d.Decode(&rec)
+	if err != nil && err != io.EOF {
+		return rec, fmt.Errorf("%w: %v", BadDumpRecordError, err)
+	}
+	return rec, err
+}
+
+type csvDumpWriter struct {
+	w *csv.Writer
+}
+
+func (w *csvDumpWriter) write(r DumpRecord) error {
+	expiresAt := ""
+	if r.ExpiresAt > 0 {
+		expiresAt = strconv.FormatUint(r.ExpiresAt, 10)
+	}
+	meta := ""
+	if r.Meta > 0 {
+		meta = strconv.Itoa(int(r.Meta))
+	}
+	return w.w.Write([]string{r.Bucket, r.Key, r.Value, expiresAt, r.Encoding, meta})
+}
+
+func (w *csvDumpWriter) flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// csvDumpReader finds columns by the header, columns not known are ignored
+type csvDumpReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func newCSVDumpReader(r io.Reader) (dumpReader, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return &csvDumpReader{r: cr}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", BadDumpRecordError, err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range dumpColumns[:3] {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: no column %s", BadDumpRecordError, name)
+		}
+	}
+	return &csvDumpReader{r: cr, columns: columns}, nil
+}
+
+func (r *csvDumpReader) read() (DumpRecord, error) {
+	var rec DumpRecord
+	if r.columns == nil {
+		return rec, io.EOF
+	}
+	row, err := r.r.Read()
+	if err == io.EOF {
+		return rec, err
+	}
+	if err != nil {
+		return rec, fmt.Errorf("%w: %v", BadDumpRecordError, err)
+	}
+	column := func(name string) string {
+		if i, ok := r.columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	rec.Bucket, rec.Key, rec.Value, rec.Encoding = column("bucket"), column("key"), column("value"), column("encoding")
+	if expiresAt := column("expires_at"); expiresAt != "" {
+		if rec.ExpiresAt, err = strconv.ParseUint(expiresAt, 10, 64); err != nil {
+			return rec, fmt.Errorf("%w: expires_at %q", BadDumpRecordError, expiresAt)
+		}
+	}
+	if meta := column("meta"); meta != "" {
+		n, err := strconv.ParseUint(meta, 10, 8)
+		if err != nil {
+			return rec, fmt.Errorf("%w: meta %q", BadDumpRecordError, meta)
+		}
+		rec.Meta = byte(n)
+	}
+	return rec, nil
+}
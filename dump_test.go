@@ -0,0 +1,171 @@
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// test buckets of a store
+func TestBuckets(t *testing.T) {
+	testStores(t, fillCursorKeys, func(t *testing.T, s KvStore) {
+		buckets, err := s.Buckets()
+		assert.True(t, err == nil)
+		assert.Equal(t, []string{"test", "test_bucket", "test_bucket_1"}, toStrings(buckets))
+
+		assert.True(t, s.Delete([]byte("test"), []byte("key-00")) == nil)
+		assert.True(t, s.Set(nil, []byte("no-bucket"), []byte("v")) == nil)
+		buckets, err = s.Buckets()
+		assert.True(t, err == nil)
+		assert.Equal(t, []string{"", "test_bucket", "test_bucket_1"}, toStrings(buckets))
+	})
+
+	s, _ := Open(EngineMemory, Options{KeyFormat: KeyFormatLengthPrefixed})
+	_ = s.Set([]byte("a@b"), []byte("k"), []byte("v"))
+	_ = s.Set([]byte("a"), []byte("@b"), []byte("v"))
+	buckets, err := s.Buckets()
+	assert.True(t, err == nil)
+	assert.Equal(t, []string{"a", "a@b"}, toStrings(buckets))
+}
+
+// test exporting a store and importing it in both formats
+func TestExportImport(t *testing.T) {
+	fill := func(s KvStore) {
+		fillCursorKeys(s)
+		_ = s.Set([]byte{0xff, 0x00}, []byte{0xfe}, []byte{0x01, 0x02})
+		_ = s.SetWithTTL(TestBucket, []byte("ttl"), []byte("v-ttl"), time.Hour)
+	}
+	testStores(t, fill, func(t *testing.T, s KvStore) {
+		for _, format := range []DumpFormat{DumpJSONLines, DumpCSV} {
+			var buf bytes.Buffer
+			n, err := Export(s, &buf, ExportOptions{Format: format})
+			assert.True(t, err == nil, "%v", err)
+			assert.Equal(t, 23, n)
+
+			for _, target := range restoreTargets(t) {
+				result, err := Import(target, bytes.NewReader(buf.Bytes()), ImportOptions{Format: format, BatchSize: 5, Verify: true})
+				assert.True(t, err == nil, "%v", err)
+				assert.Equal(t, ImportResult{Records: 23, Written: 23}, result)
+
+				keys, _ := target.KeyStringsWithoutValues(TestBucket, nil)
+				assert.Equal(t, append(cursorKeys(0, 20, false, 5), "ttl"), keys)
+				v, _, _ := target.Get([]byte{0xff, 0x00}, []byte{0xfe})
+				assert.Equal(t, []byte{0x01, 0x02}, v)
+				ttl, _ := target.TTL(TestBucket, []byte("ttl"))
+				assert.True(t, ttl > 59*time.Minute, "ttl %s", ttl)
+			}
+		}
+
+		var buf bytes.Buffer
+		n, err := Export(s, &buf, ExportOptions{Format: DumpJSONLines, Buckets: [][]byte{[]byte("test")}})
+		assert.True(t, err == nil)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, `{"bucket":"test","key":"key-00","value":"b3RoZXI="}`+"\n", buf.String())
+	})
+}
+
+// test dry run and verify
+func TestImportDryRun(t *testing.T) {
+	testStores(t, fillCursorKeys, func(t *testing.T, s KvStore) {
+		var buf bytes.Buffer
+		_, err := Export(s, &buf, ExportOptions{Format: DumpCSV})
+		assert.True(t, err == nil)
+
+		target, _ := Open(EngineMemory, Options{})
+		result, err := Import(target, bytes.NewReader(buf.Bytes()), ImportOptions{Format: DumpCSV, DryRun: true})
+		assert.True(t, err == nil)
+		assert.Equal(t, ImportResult{Records: 21}, result)
+		buckets, _ := target.Buckets()
+		assert.Equal(t, 0, len(buckets))
+
+		// the dump matches the store until it changes
+		result, err = Import(s, bytes.NewReader(buf.Bytes()), ImportOptions{Format: DumpCSV, DryRun: true, Verify: true})
+		assert.True(t, err == nil)
+		assert.Equal(t, 0, result.Mismatched)
+		assert.True(t, s.Set(TestBucket, []byte("key-00"), []byte("changed")) == nil)
+		assert.True(t, s.Delete(TestBucket, []byte("key-01")) == nil)
+		result, err = Import(s, bytes.NewReader(buf.Bytes()), ImportOptions{Format: DumpCSV, DryRun: true, Verify: true})
+		assert.True(t, errors.Is(err, VerifyFailedError))
+		assert.Equal(t, 2, result.Mismatched)
+	})
+}
+
+// test bad dumps
+func TestImportError(t *testing.T) {
+	s, _ := Open(EngineMemory, Options{})
+	_, err := Import(s, strings.NewReader(""), ImportOptions{Format: "xml"})
+	assert.True(t, errors.Is(err, UnknownDumpFormatError))
+
+	result, err := Import(s, strings.NewReader(`{"bucket":"b","key":"k","value":"dg=="}`+"\n"+`{"bucket":"b","key":"k","value":"not base64"}`), ImportOptions{Format: DumpJSONLines})
+	assert.True(t, errors.Is(err, BadDumpRecordError))
+	assert.Equal(t, 2, result.Records)
+
+	_, err = Import(s, strings.NewReader("bucket,key\nb,k\n"), ImportOptions{Format: DumpCSV})
+	assert.True(t, errors.Is(err, BadDumpRecordError))
+
+	result, err = Import(s, strings.NewReader("bucket,key,value,expires_at\nb,k,dg==,1\n"), ImportOptions{Format: DumpCSV})
+	assert.True(t, err == nil)
+	assert.Equal(t, ImportResult{Records: 1, Expired: 1}, result)
+}
+
+// lateReader a dump whose end is read after a time
+type lateReader struct {
+	r  io.Reader
+	at time.Time
+}
+
+func (l lateReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if err == io.EOF {
+		time.Sleep(time.Until(l.at))
+	}
+	return n, err
+}
+
+// test a record expired after it is read and before its batch is written is not kept
+func TestImportExpiresInBatch(t *testing.T) {
+	testStores(t, nil, func(t *testing.T, s KvStore) {
+		expiresAt := time.Now().Unix() + 1
+		dump := fmt.Sprintf(`{"bucket":"b","key":"late","value":"dg==","expires_at":%d}`+"\n"+`{"bucket":"b","key":"k","value":"dg=="}`+"\n", expiresAt)
+		r := lateReader{strings.NewReader(dump), time.Unix(expiresAt, 0).Add(10 * time.Millisecond)}
+		result, err := Import(s, r, ImportOptions{Format: DumpJSONLines})
+		assert.True(t, err == nil, "%v", err)
+		assert.Equal(t, ImportResult{Records: 2, Written: 1, Expired: 1}, result)
+		_, _, err = s.Get([]byte("b"), []byte("late"))
+		assert.Equal(t, KeyNotFoundError, err)
+	})
+}
+
+// test user meta of keys is exported and imported
+func TestExportImportMeta(t *testing.T) {
+	fill := func(s KvStore) {
+		_ = s.Update(func(txn Txn) error {
+			return txn.SetWithMeta(TestBucket, []byte("meta"), []byte("v"), 7, 0)
+		})
+		_ = s.Set(TestBucket, []byte("plain"), []byte("v"))
+	}
+	testStores(t, fill, func(t *testing.T, s KvStore) {
+		for _, format := range []DumpFormat{DumpJSONLines, DumpCSV} {
+			var buf bytes.Buffer
+			_, err := Export(s, &buf, ExportOptions{Format: format})
+			assert.True(t, err == nil, "%v", err)
+			for _, target := range restoreTargets(t) {
+				_, err := Import(target, bytes.NewReader(buf.Bytes()), ImportOptions{Format: format})
+				assert.True(t, err == nil, "%v", err)
+				c, err := target.Cursor(TestBucket, CursorOptions{})
+				assert.True(t, err == nil)
+				meta := map[string]byte{}
+				for ok := c.Seek(nil); ok; ok = c.Next() {
+					meta[string(c.Key())] = c.UserMeta()
+				}
+				_ = c.Close()
+				assert.Equal(t, map[string]byte{"meta": 7, "plain": 0}, meta, "%s", format)
+			}
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"sort"
+	"sync"
+)
+
+const (
+	// EngineBadger stores keys and values in badger
+	EngineBadger = "badger"
+
+	// EngineMemory stores keys and values in an ordered map in memory
+	EngineMemory = "memory"
+)
+
+var (
+	EngineNotFoundError = errors.New("engine not found")
+	NotSupportedError   = errors.New("not supported by engine")
+	ReadOnlyError       = errors.New("store is read only")
+	StoreClosedError    = errors.New("store closed")
+)
+
+// Options engine independent options to open a store
+type Options struct {
+	// Dir store path for keys, and for values too if ValueDir is empty. Empty Dir keeps everything in memory
+	Dir string
+
+	// ValueDir store path for values
+	ValueDir string
+
+	// ReadOnly open the store read only, writes return an error
+	ReadOnly bool
+
+	// KeyFormat how buckets and keys are encoded, KeyFormatAuto use the format recorded in Dir
+	KeyFormat KeyFormat
+
+	// Log how the store logs, badger logs there too
+	Log LogOptions
+
+	// Cache a read-through cache of Get in front of badger, a store in memory has none
+	Cache CacheOptions
+
+	// LegacyPrefixes Keys, KeyStrings, KeysWithoutValues and KeyStringsWithoutValues also take a prefix from
+	// before scans were bucket scoped, made relative by LegacyPrefix. NewBadgerStore sets it
+	//
+	// Deprecated: pass prefixes relative to the bucket
+	LegacyPrefixes bool
+}
+
+// Opener open a store with options
+type Opener func(opts Options) (KvStore, error)
+
+var (
+	enginesLock sync.RWMutex
+	engines     = make(map[string]Opener)
+)
+
+func init() {
+	Register(EngineBadger, openBadger)
+	Register(EngineMemory, NewMemoryStore)
+}
+
+// Register an opener by engine name, it panics if the name is registered twice
+func Register(engine string, opener Opener) {
+	enginesLock.Lock()
+	defer enginesLock.Unlock()
+	if opener == nil {
+		panic("kvstore: Register opener is nil")
+	}
+	if _, dup := engines[engine]; dup {
+		panic("kvstore: Register called twice for engine " + engine)
+	}
+	engines[engine] = opener
+}
+
+// Engines return sorted names of registered engines
+func Engines() []string {
+	enginesLock.RLock()
+	defer enginesLock.RUnlock()
+	var names []string
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open a store by engine name
+func Open(engine string, opts Options) (KvStore, error) {
+	enginesLock.RLock()
+	opener, ok := engines[engine]
+	enginesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", EngineNotFoundError, engine)
+	}
+	return opener(opts)
+}
+
+func openBadger(opts Options) (KvStore, error) {
+	bopts := badger.DefaultOptions(opts.Dir).WithReadOnly(opts.ReadOnly)
+	if opts.Dir == "" {
+		bopts = bopts.WithInMemory(true)
+	}
+	if opts.ValueDir != "" {
+		bopts = bopts.WithValueDir(opts.ValueDir)
+	}
+	log := newLogger(opts.Log)
+	return newBadgerStore(bopts.WithLogger(badgerLogger{log: log}), opts.KeyFormat, opts.LegacyPrefixes, log, newCache(opts.Cache))
+}
@@ -0,0 +1,45 @@
+package kvstore
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// test open stores by engine name
+func TestOpen(t *testing.T) {
+	assert.Contains(t, Engines(), EngineBadger)
+	assert.Contains(t, Engines(), EngineMemory)
+
+	var dir = getDataPath()
+	t.Logf("data path %s", dir)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	for _, engine := range []string{EngineBadger, EngineMemory} {
+		s, err := Open(engine, Options{Dir: dir})
+		assert.True(t, err == nil, "engine %s, %v", engine, err)
+		assert.True(t, s.Set(TestBucket, []byte("tiger"), []byte(engine)) == nil)
+		v, f, err := s.Get(TestBucket, []byte("tiger"))
+		assert.True(t, err == nil && f)
+		assert.Equal(t, engine, string(v))
+		assert.True(t, s.Close() == nil)
+	}
+
+	_, err := Open("not-exist", Options{})
+	assert.True(t, errors.Is(err, EngineNotFoundError))
+}
+
+// test register an engine twice
+func TestRegister(t *testing.T) {
+	assert.Panics(t, func() {
+		Register(EngineMemory, NewMemoryStore)
+	})
+
+	Register("memory-test", NewMemoryStore)
+	s, err := Open("memory-test", Options{})
+	assert.True(t, err == nil)
+	assert.True(t, s.Close() == nil)
+}
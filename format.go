@@ -0,0 +1,174 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FormatFile name of the file in a store directory recording the key format
+	FormatFile = "KVSTORE_FORMAT"
+)
+
+var (
+	KeyFormatMismatchError = errors.New("key format mismatch")
+	BadKeyError            = errors.New("bad key")
+)
+
+// KeyFormat how a bucket and a key are encoded into one key of the engine
+type KeyFormat uint8
+
+const (
+	// KeyFormatAuto use the format recorded in the directory, KeyFormatLegacy for a new directory
+	KeyFormatAuto KeyFormat = iota
+
+	// KeyFormatLegacy join bucket and key with Split like BuildKey.
+	// bucket a@b with key c collides with bucket a with key b@c
+	KeyFormatLegacy
+
+	// KeyFormatLengthPrefixed put the uvarint length of the bucket before bucket and key, buckets never collide
+	KeyFormatLengthPrefixed
+)
+
+func (f KeyFormat) String() string {
+	switch f {
+	case KeyFormatAuto:
+		return "auto"
+	case KeyFormatLegacy:
+		return "legacy"
+	case KeyFormatLengthPrefixed:
+		return "length-prefixed"
+	}
+	return "unknown(" + strconv.Itoa(int(f)) + ")"
+}
+
+// orLegacy resolve KeyFormatAuto to KeyFormatLegacy
+func (f KeyFormat) orLegacy() KeyFormat {
+	if f == KeyFormatAuto {
+		return KeyFormatLegacy
+	}
+	return f
+}
+
+// Encode bucket and key into a key of the engine
+func (f KeyFormat) Encode(bucket, key []byte) []byte {
+	if f.orLegacy() == KeyFormatLegacy {
+		return BuildKey(len(bucket)+len(key), bucket, key)
+	}
+	return append(f.BucketPrefix(bucket), key...)
+}
+
+// BucketPrefix every key of bucket starts with it
+func (f KeyFormat) BucketPrefix(bucket []byte) []byte {
+	if f.orLegacy() == KeyFormatLegacy {
+		if len(bucket) == 0 {
+			return []byte{}
+		}
+		return append(copyBytes(bucket), Split...)
+	}
+	result := make([]byte, binary.MaxVarintLen64+len(bucket))
+	n := binary.PutUvarint(result, uint64(len(bucket)))
+	copy(result[n:], bucket)
+	return result[:n+len(bucket)]
+}
+
+// Decode split a key of the engine into bucket and key.
+// Legacy keys are split at the first Split, a key without Split has an empty bucket
+func (f KeyFormat) Decode(raw []byte) (bucket, key []byte, err error) {
+	if f.orLegacy() == KeyFormatLegacy {
+		if i := bytes.Index(raw, Split); i >= 0 {
+			return raw[:i], raw[i+SplitLength:], nil
+		}
+		return []byte{}, raw, nil
+	}
+	size, n := binary.Uvarint(raw)
+	if n <= 0 || uint64(len(raw)-n) < size {
+		return nil, nil, fmt.Errorf("%w: %q", BadKeyError, raw)
+	}
+	return raw[n : n+int(size)], raw[n+int(size):], nil
+}
+
+// userKey copy key of bucket out of raw
+func (f KeyFormat) userKey(bucket, raw []byte) []byte {
+	return copyBytes(bytes.TrimPrefix(raw, f.BucketPrefix(bucket)))
+}
+
+// scanPrefix the engine key prefix to scan keys with prefix in bucket, prefix is always relative to the bucket
+func (f KeyFormat) scanPrefix(bucket, prefix []byte) []byte {
+	return append(f.BucketPrefix(bucket), prefix...)
+}
+
+// LegacyPrefix a prefix relative to bucket for a prefix from before scans were bucket scoped, which
+// started with the bucket and Split like BuildKey(len(bucket)+len(prefix), bucket, prefix) or was the bucket
+// itself. Any other prefix is returned as it is
+//
+// Deprecated: pass prefixes relative to the bucket
+func LegacyPrefix(bucket, prefix []byte) []byte {
+	if len(bucket) == 0 {
+		return prefix
+	}
+	if bytes.Equal(prefix, bucket) {
+		return nil
+	}
+	if legacy := KeyFormatLegacy.BucketPrefix(bucket); bytes.HasPrefix(prefix, legacy) {
+		return prefix[len(legacy):]
+	}
+	return prefix
+}
+
+// inBucket check raw is a key of bucket. A legacy key with Split is never in the empty bucket
+func (f KeyFormat) inBucket(bucket, raw []byte) bool {
+	if f.orLegacy() == KeyFormatLegacy && len(bucket) == 0 {
+		return !bytes.Contains(raw, Split)
+	}
+	return bytes.HasPrefix(raw, f.BucketPrefix(bucket))
+}
+
+// ReadKeyFormat read the key format recorded in dir, found is false if there is no record
+func ReadKeyFormat(dir string) (format KeyFormat, found bool, err error) {
+	content, err := os.ReadFile(filepath.Join(dir, FormatFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return KeyFormatAuto, false, nil
+	}
+	if err != nil {
+		return KeyFormatAuto, false, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || n <= int(KeyFormatAuto) || n > int(KeyFormatLengthPrefixed) {
+		return KeyFormatAuto, false, fmt.Errorf("bad key format %q in %s", content, filepath.Join(dir, FormatFile))
+	}
+	return KeyFormat(n), true, nil
+}
+
+// WriteKeyFormat record the key format in dir
+func WriteKeyFormat(dir string, format KeyFormat) error {
+	if format == KeyFormatAuto {
+		return fmt.Errorf("%w: can not record %s", KeyFormatMismatchError, format)
+	}
+	return os.WriteFile(filepath.Join(dir, FormatFile), []byte(strconv.Itoa(int(format))+"\n"), 0644)
+}
+
+// resolveKeyFormat pick the key format of a directory before it is opened, and whether it should be recorded.
+// A directory with data but no record is from before formats were recorded, so it is legacy
+func resolveKeyFormat(dir string, want KeyFormat) (format KeyFormat, record bool, err error) {
+	recorded, found, err := ReadKeyFormat(dir)
+	if err != nil {
+		return want, false, err
+	}
+	if !found {
+		recorded = KeyFormatLegacy
+		if _, err := os.Stat(filepath.Join(dir, "MANIFEST")); errors.Is(err, os.ErrNotExist) {
+			recorded = want.orLegacy()
+		}
+	}
+	if want != KeyFormatAuto && want != recorded {
+		return want, false, fmt.Errorf("%w: %s uses %s keys, want %s, see MigrateKeyFormat", KeyFormatMismatchError, dir, recorded, want)
+	}
+	return recorded, !found, nil
+}
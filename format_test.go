@@ -0,0 +1,151 @@
+package kvstore
+
+import (
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// test legacy keys are the same as BuildKey
+func TestKeyFormatLegacy(t *testing.T) {
+	bucket := []byte("hello")
+	key := []byte("gmq")
+
+	assert.Equal(t, BuildKey(len(bucket)+len(key), bucket, key), KeyFormatLegacy.Encode(bucket, key))
+	assert.Equal(t, KeyFormatLegacy.Encode(bucket, key), KeyFormatAuto.Encode(bucket, key))
+	assert.Equal(t, "hello@", string(KeyFormatLegacy.BucketPrefix(bucket)))
+	assert.Equal(t, "", string(KeyFormatLegacy.BucketPrefix(nil)))
+
+	b, k, err := KeyFormatLegacy.Decode([]byte("hello@gmq@1"))
+	assert.True(t, err == nil)
+	assert.Equal(t, "hello", string(b))
+	assert.Equal(t, "gmq@1", string(k))
+
+	// bucket a@b with key c collides with bucket a with key b@c
+	assert.Equal(t, KeyFormatLegacy.Encode([]byte("a@b"), []byte("c")), KeyFormatLegacy.Encode([]byte("a"), []byte("b@c")))
+}
+
+// test length prefixed keys never collide
+func TestKeyFormatLengthPrefixed(t *testing.T) {
+	f := KeyFormatLengthPrefixed
+	assert.NotEqual(t, f.Encode([]byte("a@b"), []byte("c")), f.Encode([]byte("a"), []byte("b@c")))
+	assert.Equal(t, []byte{3, 'a', '@', 'b', 'c'}, f.Encode([]byte("a@b"), []byte("c")))
+	assert.Equal(t, []byte{0, 'c'}, f.Encode(nil, []byte("c")))
+
+	for _, bucket := range [][]byte{nil, []byte("a@b"), make([]byte, 300)} {
+		b, k, err := f.Decode(f.Encode(bucket, []byte("gmq")))
+		assert.True(t, err == nil)
+		assert.Equal(t, len(bucket), len(b))
+		assert.Equal(t, "gmq", string(k))
+	}
+
+	_, _, err := f.Decode([]byte{5, 'a'})
+	assert.True(t, errors.Is(err, BadKeyError))
+}
+
+// test the key format is recorded in a directory and checked on open
+func TestKeyFormatRecord(t *testing.T) {
+	var dir = getDataPath()
+	t.Logf("data path %s", dir)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	s, err := Open(EngineBadger, Options{Dir: dir, KeyFormat: KeyFormatLengthPrefixed})
+	assert.True(t, err == nil)
+	assert.Equal(t, KeyFormatLengthPrefixed, s.KeyFormat())
+	assert.True(t, s.Set([]byte("a@b"), []byte("c"), []byte("1")) == nil)
+	assert.True(t, s.Set([]byte("a"), []byte("b@c"), []byte("2")) == nil)
+	assert.True(t, s.Close() == nil)
+
+	f, found, err := ReadKeyFormat(dir)
+	assert.True(t, err == nil && found)
+	assert.Equal(t, KeyFormatLengthPrefixed, f)
+
+	// auto use the recorded format
+	s, err = NewBadgerStore(badger.DefaultOptions(dir))
+	assert.True(t, err == nil)
+	assert.Equal(t, KeyFormatLengthPrefixed, s.KeyFormat())
+	v, _, err := s.Get([]byte("a@b"), []byte("c"))
+	assert.True(t, err == nil)
+	assert.Equal(t, "1", string(v))
+	assert.True(t, s.Close() == nil)
+
+	_, err = Open(EngineBadger, Options{Dir: dir, KeyFormat: KeyFormatLegacy})
+	assert.True(t, errors.Is(err, KeyFormatMismatchError))
+}
+
+// test a directory with data but no record is legacy
+func TestKeyFormatUnrecorded(t *testing.T) {
+	var dir = getDataPath()
+	t.Logf("data path %s", dir)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	s, err := NewBadgerStore(badger.DefaultOptions(dir))
+	assert.True(t, err == nil)
+	assert.Equal(t, KeyFormatLegacy, s.KeyFormat())
+	assert.True(t, s.Close() == nil)
+	assert.True(t, os.Remove(dir+"/"+FormatFile) == nil)
+
+	_, err = Open(EngineBadger, Options{Dir: dir, KeyFormat: KeyFormatLengthPrefixed})
+	assert.True(t, errors.Is(err, KeyFormatMismatchError))
+
+	s, err = NewBadgerStore(badger.DefaultOptions(dir))
+	assert.True(t, err == nil)
+	assert.Equal(t, KeyFormatLegacy, s.KeyFormat())
+	assert.True(t, s.Close() == nil)
+	f, found, err := ReadKeyFormat(dir)
+	assert.True(t, err == nil && found)
+	assert.Equal(t, KeyFormatLegacy, f)
+}
+
+// test a prefix equal to the bucket or starting with it is relative to the bucket like any other
+func TestScanPrefix(t *testing.T) {
+	testStores(t, nil, func(t *testing.T, s KvStore) {
+		bucket := []byte("user")
+		for _, k := range []string{"user1", "user@x", "other"} {
+			assert.True(t, s.Set(bucket, []byte(k), []byte("v")) == nil)
+		}
+		keys, err := s.KeyStringsWithoutValues(bucket, []byte("user"))
+		assert.True(t, err == nil)
+		assert.Equal(t, []string{"user1", "user@x"}, keys)
+		keys, err = s.KeyStringsWithoutValues(bucket, []byte("user@"))
+		assert.True(t, err == nil)
+		assert.Equal(t, []string{"user@x"}, keys)
+	})
+}
+
+// test prefixes from before scans were bucket scoped are made relative
+func TestLegacyPrefix(t *testing.T) {
+	bucket := []byte("user")
+	assert.Equal(t, 0, len(LegacyPrefix(bucket, []byte("user"))))
+	assert.Equal(t, "a", string(LegacyPrefix(bucket, []byte("user@a"))))
+	assert.Equal(t, "usera", string(LegacyPrefix(bucket, []byte("usera"))))
+	assert.Equal(t, "user", string(LegacyPrefix(nil, []byte("user"))))
+}
+
+// test stores with LegacyPrefixes take prefixes that start with the bucket
+func TestLegacyPrefixes(t *testing.T) {
+	bucket := []byte("user")
+	for _, engine := range []string{EngineBadger, EngineMemory} {
+		s, err := Open(engine, Options{LegacyPrefixes: true})
+		assert.True(t, err == nil)
+		for _, k := range []string{"a1", "a2", "b"} {
+			assert.True(t, s.Set(bucket, []byte(k), []byte("v")) == nil)
+		}
+		keys, err := s.KeyStringsWithoutValues(bucket, BuildKey(len(bucket)+1, bucket, []byte("a")))
+		assert.True(t, err == nil)
+		assert.Equal(t, []string{"a1", "a2"}, keys, engine)
+		keys, err = s.KeyStringsWithoutValues(bucket, bucket)
+		assert.True(t, err == nil)
+		assert.Equal(t, []string{"a1", "a2", "b"}, keys, engine)
+		keys, err = s.KeyStringsWithoutValues(bucket, []byte("a"))
+		assert.True(t, err == nil)
+		assert.Equal(t, []string{"a1", "a2"}, keys, engine)
+		assert.True(t, s.Close() == nil)
+	}
+}
@@ -0,0 +1,642 @@
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"io"
+	"reflect"
+	"time"
+)
+
+// Op of a Call, the name of the method of KvStore
+const (
+	OpSet                     = "Set"
+	OpGet                     = "Get"
+	OpSetWithTTL              = "SetWithTTL"
+	OpPSet                    = "PSet"
+	OpPSetWithTTL             = "PSetWithTTL"
+	OpTTL                     = "TTL"
+	OpPersist                 = "Persist"
+	OpPGet                    = "PGet"
+	OpCompareAndSwap          = "CompareAndSwap"
+	OpSetIfAbsent             = "SetIfAbsent"
+	OpIncr                    = "Incr"
+	OpSequence                = "Sequence"
+	OpDelete                  = "Delete"
+	OpDeleteIfEquals          = "DeleteIfEquals"
+	OpDeleteKeys              = "DeleteKeys"
+	OpKeys                    = "Keys"
+	OpKeyStrings              = "KeyStrings"
+	OpKeysWithoutValues       = "KeysWithoutValues"
+	OpKeyStringsWithoutValues = "KeyStringsWithoutValues"
+	OpCursor                  = "Cursor"
+	OpRange                   = "Range"
+	OpWatch                   = "Watch"
+	OpWatchFrom               = "WatchFrom"
+	OpBuckets                 = "Buckets"
+	OpAllKeys                 = "AllKeys"
+	OpClose                   = "Close"
+	OpSync                    = "Sync"
+	OpGC                      = "GC"
+	OpStats                   = "Stats"
+	OpBackup                  = "Backup"
+	OpRestore                 = "Restore"
+	OpUpdate                  = "Update"
+	OpView                    = "View"
+	OpBatch                   = "Batch"
+	OpExec                    = "Exec"
+	OpReadOnly                = "ReadOnly"
+	OpPath                    = "Path"
+	OpKeyFormat               = "KeyFormat"
+)
+
+var (
+	UnknownOpError = errors.New("unknown op")
+	BadCallError   = errors.New("bad call")
+)
+
+// Call a call of a method of KvStore seen by interceptors. An interceptor may change the call before passing
+// it on and its results after. Arguments and results by Op:
+//
+//	Set, SetIfAbsent, PSet              Keys, Values
+//	SetWithTTL, PSetWithTTL             Keys, Values, Args ttl
+//	CompareAndSwap                      Keys, Values, Args expected
+//	Get                                 Keys, returns Values, Results found
+//	PGet                                Keys, returns Values
+//	TTL                                 Keys, Results ttl
+//	Persist, Delete, DeleteKeys         Keys
+//	DeleteIfEquals                      Keys, Args expected
+//	Incr                                Keys, Args delta, Results the new value
+//	Sequence                            Keys the name, Args leaseSize, Results Sequence
+//	Keys, KeyStrings                    Prefix, returns Keys, Values
+//	KeysWithoutValues, KeyStrings...    Prefix, returns Keys
+//	Cursor                              Args CursorOptions, Results Cursor
+//	Range                               Args RangeOptions, returns Keys, Values, Results the token
+//	Watch                               Prefix, Args ctx, Results the channel
+//	WatchFrom                           Prefix, Args ctx, version, Results the channel
+//	Buckets                             Results the buckets
+//	AllKeys                             Args async, ctx, wrap async to see every key
+//	GC                                  Args discardRatio, Results files rewritten
+//	Stats, ReadOnly, Path, KeyFormat    Results the value
+//	Backup                              Args w, since, buckets, Results the version
+//	Restore                             Args r
+//	Update, View, Batch, Exec           Args f, wrap it to see the transaction
+//	Close, Sync                         nothing
+//
+// An interceptor returning without calling next sets the results itself, missing results are zero values.
+// An argument or a result of another type, or a nil function, fails the call with BadCallError
+type Call struct {
+	// Op name of the method, like OpSet or OpAllKeys
+	Op string
+
+	// Bucket of the call, nil for methods without one
+	Bucket []byte
+
+	// Keys given to the call, a scan sets the keys it returns
+	Keys [][]byte
+
+	// Values given to the call, a read sets the values it returns
+	Values [][]byte
+
+	// Prefix of a scan or a watch
+	Prefix []byte
+
+	// Args other arguments of the call in order
+	Args []interface{}
+
+	// Results other results of the call in order
+	Results []interface{}
+}
+
+// Handler run a call
+type Handler func(c *Call) error
+
+// Interceptor run a call with next, the handler of the interceptors after it and the store
+type Interceptor func(c *Call, next Handler) error
+
+// key i of the call, nil if it is missing
+func (c *Call) key(i int) []byte {
+	if i < len(c.Keys) {
+		return c.Keys[i]
+	}
+	return nil
+}
+
+// value i of the call, nil if it is missing
+func (c *Call) value(i int) []byte {
+	if i < len(c.Values) {
+		return c.Values[i]
+	}
+	return nil
+}
+
+// arg i of the call, nil if it is missing
+func (c *Call) arg(i int) interface{} {
+	if i < len(c.Args) {
+		return c.Args[i]
+	}
+	return nil
+}
+
+// result i of the call, nil if it is missing
+func (c *Call) result(i int) interface{} {
+	if i < len(c.Results) {
+		return c.Results[i]
+	}
+	return nil
+}
+
+// interceptedStore a store running every call through interceptors
+type interceptedStore struct {
+	store   KvStore
+	handler Handler
+}
+
+var (
+	_ KvStore    = (*interceptedStore)(nil)
+	_ allKeysCtx = (*interceptedStore)(nil)
+	_ unwrapper  = (*interceptedStore)(nil)
+)
+
+// Wrap run every call of store through interceptors, the first one sees the call first and its results last
+func Wrap(store KvStore, interceptors ...Interceptor) KvStore {
+	s := &interceptedStore{store: store}
+	s.handler = s.invoke
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], s.handler
+		s.handler = func(c *Call) error {
+			return interceptor(c, next)
+		}
+	}
+	return s
+}
+
+// Unwrap the store of Wrap
+func (s *interceptedStore) Unwrap() KvStore {
+	return s.store
+}
+
+// unwrapper a store wrapping another
+type unwrapper interface {
+	Unwrap() KvStore
+}
+
+// unwrap the innermost store of wrappers
+func unwrap(store KvStore) KvStore {
+	for {
+		u, ok := store.(unwrapper)
+		if !ok {
+			return store
+		}
+		store = u.Unwrap()
+	}
+}
+
+// invoke the method of the store for a call
+func (s *interceptedStore) invoke(c *Call) error {
+	switch c.Op {
+	case OpSet:
+		return s.store.Set(c.Bucket, c.key(0), c.value(0))
+	case OpGet:
+		v, found, err := s.store.Get(c.Bucket, c.key(0))
+		c.Values, c.Results = [][]byte{v}, []interface{}{found}
+		return err
+	case OpSetWithTTL:
+		ttl, err := argOf[time.Duration](c, 0)
+		if err != nil {
+			return err
+		}
+		return s.store.SetWithTTL(c.Bucket, c.key(0), c.value(0), ttl)
+	case OpPSet:
+		return s.store.PSet(c.Bucket, c.Keys, c.Values)
+	case OpPSetWithTTL:
+		ttl, err := argOf[time.Duration](c, 0)
+		if err != nil {
+			return err
+		}
+		return s.store.PSetWithTTL(c.Bucket, c.Keys, c.Values, ttl)
+	case OpTTL:
+		ttl, err := s.store.TTL(c.Bucket, c.key(0))
+		c.Results = []interface{}{ttl}
+		return err
+	case OpPersist:
+		return s.store.Persist(c.Bucket, c.key(0))
+	case OpPGet:
+		values, err := s.store.PGet(c.Bucket, c.Keys)
+		c.Values = values
+		return err
+	case OpCompareAndSwap:
+		expected, err := argOf[[]byte](c, 0)
+		if err != nil {
+			return err
+		}
+		return s.store.CompareAndSwap(c.Bucket, c.key(0), expected, c.value(0))
+	case OpSetIfAbsent:
+		return s.store.SetIfAbsent(c.Bucket, c.key(0), c.value(0))
+	case OpIncr:
+		delta, err := argOf[int64](c, 0)
+		if err != nil {
+			return err
+		}
+		n, err := s.store.Incr(c.Bucket, c.key(0), delta)
+		c.Results = []interface{}{n}
+		return err
+	case OpSequence:
+		leaseSize, err := argOf[uint64](c, 0)
+		if err != nil {
+			return err
+		}
+		seq, err := s.store.Sequence(c.Bucket, c.key(0), leaseSize)
+		c.Results = []interface{}{seq}
+		return err
+	case OpDelete:
+		return s.store.Delete(c.Bucket, c.key(0))
+	case OpDeleteIfEquals:
+		expected, err := argOf[[]byte](c, 0)
+		if err != nil {
+			return err
+		}
+		return s.store.DeleteIfEquals(c.Bucket, c.key(0), expected)
+	case OpDeleteKeys:
+		return s.store.DeleteKeys(c.Bucket, c.Keys)
+	case OpKeys:
+		keys, values, err := s.store.Keys(c.Bucket, c.Prefix)
+		c.Keys, c.Values = keys, values
+		return err
+	case OpKeyStrings:
+		keys, values, err := s.store.KeyStrings(c.Bucket, c.Prefix)
+		c.Keys, c.Values = stringsToBytes(keys), values
+		return err
+	case OpKeysWithoutValues:
+		keys, err := s.store.KeysWithoutValues(c.Bucket, c.Prefix)
+		c.Keys = keys
+		return err
+	case OpKeyStringsWithoutValues:
+		keys, err := s.store.KeyStringsWithoutValues(c.Bucket, c.Prefix)
+		c.Keys = stringsToBytes(keys)
+		return err
+	case OpCursor:
+		opts, err := argOf[CursorOptions](c, 0)
+		if err != nil {
+			return err
+		}
+		cursor, err := s.store.Cursor(c.Bucket, opts)
+		c.Results = []interface{}{cursor}
+		return err
+	case OpRange:
+		opts, err := argOf[RangeOptions](c, 0)
+		if err != nil {
+			return err
+		}
+		page, err := s.store.Range(c.Bucket, opts)
+		c.Keys, c.Values, c.Results = page.Keys, page.Values, []interface{}{page.Token}
+		return err
+	case OpWatch:
+		ctx, err := argOf[context.Context](c, 0)
+		if err != nil {
+			return err
+		}
+		ch, err := s.store.Watch(ctx, c.Bucket, c.Prefix)
+		c.Results = []interface{}{ch}
+		return err
+	case OpWatchFrom:
+		ctx, err := argOf[context.Context](c, 0)
+		if err != nil {
+			return err
+		}
+		version, err := argOf[uint64](c, 1)
+		if err != nil {
+			return err
+		}
+		ch, err := s.store.WatchFrom(ctx, c.Bucket, c.Prefix, version)
+		c.Results = []interface{}{ch}
+		return err
+	case OpBuckets:
+		buckets, err := s.store.Buckets()
+		c.Results = []interface{}{buckets}
+		return err
+	case OpAllKeys:
+		async, err := funcArg[func(key string, deletedOrExpired bool)](c, 0)
+		if err != nil {
+			return err
+		}
+		ctx, err := argOf[context.Context](c, 1)
+		if err != nil {
+			return err
+		}
+		return WithContext(s.store).AllKeysCtx(ctx, async)
+	case OpClose:
+		return s.store.Close()
+	case OpSync:
+		return s.store.Sync()
+	case OpGC:
+		discardRatio, err := argOf[float64](c, 0)
+		if err != nil {
+			return err
+		}
+		n, err := s.store.GC(discardRatio)
+		c.Results = []interface{}{n}
+		return err
+	case OpStats:
+		stats, err := s.store.Stats()
+		c.Results = []interface{}{stats}
+		return err
+	case OpBackup:
+		w, err := argOf[io.Writer](c, 0)
+		if err != nil {
+			return err
+		}
+		since, err := argOf[uint64](c, 1)
+		if err != nil {
+			return err
+		}
+		buckets, err := argOf[[][]byte](c, 2)
+		if err != nil {
+			return err
+		}
+		version, err := s.store.Backup(w, since, buckets...)
+		c.Results = []interface{}{version}
+		return err
+	case OpRestore:
+		r, err := argOf[io.Reader](c, 0)
+		if err != nil {
+			return err
+		}
+		return s.store.Restore(r)
+	case OpUpdate, OpView, OpBatch:
+		f, err := funcArg[func(txn Txn) error](c, 0)
+		if err != nil {
+			return err
+		}
+		switch c.Op {
+		case OpUpdate:
+			return s.store.Update(f)
+		case OpView:
+			return s.store.View(f)
+		}
+		return s.store.Batch(f)
+	case OpExec:
+		f, err := funcArg[func(txn *badger.Txn) error](c, 0)
+		if err != nil {
+			return err
+		}
+		return s.store.Exec(f)
+	case OpReadOnly:
+		c.Results = []interface{}{s.store.ReadOnly()}
+		return nil
+	case OpPath:
+		c.Results = []interface{}{s.store.Path()}
+		return nil
+	case OpKeyFormat:
+		c.Results = []interface{}{s.store.KeyFormat()}
+		return nil
+	}
+	return UnknownOpError
+}
+
+// argOf arg i of the call as a T, BadCallError if it is missing or of another type
+func argOf[T any](c *Call, i int) (T, error) {
+	v, ok := c.arg(i).(T)
+	if !ok {
+		return v, fmt.Errorf("%w: %s arg %d is %T, not %v", BadCallError, c.Op, i, c.arg(i), reflect.TypeOf((*T)(nil)).Elem())
+	}
+	return v, nil
+}
+
+// funcArg arg i of the call as a function of type T, BadCallError if it is nil too
+func funcArg[T any](c *Call, i int) (T, error) {
+	f, err := argOf[T](c, i)
+	if err == nil && reflect.ValueOf(f).IsNil() {
+		err = fmt.Errorf("%w: %s arg %d is a nil function", BadCallError, c.Op, i)
+	}
+	return f, err
+}
+
+// resultOf result i of the call as a T and err of the call. A missing result is the zero value, a result of
+// another type is BadCallError
+func resultOf[T any](c *Call, i int, err error) (T, error) {
+	v, ok := c.result(i).(T)
+	if !ok && c.result(i) != nil {
+		return v, fmt.Errorf("%w: %s result %d is %T, not %v", BadCallError, c.Op, i, c.result(i), reflect.TypeOf((*T)(nil)).Elem())
+	}
+	return v, err
+}
+
+// stringsToBytes keys as bytes
+func stringsToBytes(keys []string) [][]byte {
+	if keys == nil {
+		return nil
+	}
+	b := make([][]byte, len(keys))
+	for i, k := range keys {
+		b[i] = []byte(k)
+	}
+	return b
+}
+
+// bytesToStrings keys as strings
+func bytesToStrings(keys [][]byte) []string {
+	if keys == nil {
+		return nil
+	}
+	s := make([]string, len(keys))
+	for i, k := range keys {
+		s[i] = string(k)
+	}
+	return s
+}
+
+func (s *interceptedStore) Set(bucket, k []byte, v []byte) error {
+	return s.handler(&Call{Op: OpSet, Bucket: bucket, Keys: [][]byte{k}, Values: [][]byte{v}})
+}
+
+func (s *interceptedStore) Get(bucket, k []byte) ([]byte, bool, error) {
+	c := &Call{Op: OpGet, Bucket: bucket, Keys: [][]byte{k}}
+	found, err := resultOf[bool](c, 0, s.handler(c))
+	return c.value(0), found, err
+}
+
+func (s *interceptedStore) SetWithTTL(bucket, k []byte, v []byte, ttl time.Duration) error {
+	return s.handler(&Call{Op: OpSetWithTTL, Bucket: bucket, Keys: [][]byte{k}, Values: [][]byte{v},
+		Args: []interface{}{ttl}})
+}
+
+func (s *interceptedStore) PSet(bucket []byte, keys, values [][]byte) error {
+	return s.handler(&Call{Op: OpPSet, Bucket: bucket, Keys: keys, Values: values})
+}
+
+func (s *interceptedStore) PSetWithTTL(bucket []byte, keys, values [][]byte, ttl time.Duration) error {
+	return s.handler(&Call{Op: OpPSetWithTTL, Bucket: bucket, Keys: keys, Values: values,
+		Args: []interface{}{ttl}})
+}
+
+func (s *interceptedStore) TTL(bucket, k []byte) (time.Duration, error) {
+	c := &Call{Op: OpTTL, Bucket: bucket, Keys: [][]byte{k}}
+	return resultOf[time.Duration](c, 0, s.handler(c))
+}
+
+func (s *interceptedStore) Persist(bucket, k []byte) error {
+	return s.handler(&Call{Op: OpPersist, Bucket: bucket, Keys: [][]byte{k}})
+}
+
+func (s *interceptedStore) PGet(bucket []byte, keys [][]byte) ([][]byte, error) {
+	c := &Call{Op: OpPGet, Bucket: bucket, Keys: keys}
+	err := s.handler(c)
+	return c.Values, err
+}
+
+func (s *interceptedStore) CompareAndSwap(bucket, k, expected, v []byte) error {
+	return s.handler(&Call{Op: OpCompareAndSwap, Bucket: bucket, Keys: [][]byte{k}, Values: [][]byte{v},
+		Args: []interface{}{expected}})
+}
+
+func (s *interceptedStore) SetIfAbsent(bucket, k, v []byte) error {
+	return s.handler(&Call{Op: OpSetIfAbsent, Bucket: bucket, Keys: [][]byte{k}, Values: [][]byte{v}})
+}
+
+func (s *interceptedStore) Incr(bucket, k []byte, delta int64) (int64, error) {
+	c := &Call{Op: OpIncr, Bucket: bucket, Keys: [][]byte{k}, Args: []interface{}{delta}}
+	return resultOf[int64](c, 0, s.handler(c))
+}
+
+func (s *interceptedStore) Sequence(bucket, name []byte, leaseSize uint64) (Sequence, error) {
+	c := &Call{Op: OpSequence, Bucket: bucket, Keys: [][]byte{name}, Args: []interface{}{leaseSize}}
+	return resultOf[Sequence](c, 0, s.handler(c))
+}
+
+func (s *interceptedStore) Delete(bucket, key []byte) error {
+	return s.handler(&Call{Op: OpDelete, Bucket: bucket, Keys: [][]byte{key}})
+}
+
+func (s *interceptedStore) DeleteIfEquals(bucket, k, expected []byte) error {
+	return s.handler(&Call{Op: OpDeleteIfEquals, Bucket: bucket, Keys: [][]byte{k}, Args: []interface{}{expected}})
+}
+
+func (s *interceptedStore) DeleteKeys(bucket []byte, keys [][]byte) error {
+	return s.handler(&Call{Op: OpDeleteKeys, Bucket: bucket, Keys: keys})
+}
+
+func (s *interceptedStore) Keys(bucket, prefix []byte) (keys [][]byte, values [][]byte, err error) {
+	c := &Call{Op: OpKeys, Bucket: bucket, Prefix: prefix}
+	err = s.handler(c)
+	return c.Keys, c.Values, err
+}
+
+func (s *interceptedStore) KeyStrings(bucket, prefix []byte) (keys []string, values [][]byte, err error) {
+	c := &Call{Op: OpKeyStrings, Bucket: bucket, Prefix: prefix}
+	err = s.handler(c)
+	return bytesToStrings(c.Keys), c.Values, err
+}
+
+func (s *interceptedStore) KeysWithoutValues(bucket, prefix []byte) (keys [][]byte, err error) {
+	c := &Call{Op: OpKeysWithoutValues, Bucket: bucket, Prefix: prefix}
+	err = s.handler(c)
+	return c.Keys, err
+}
+
+func (s *interceptedStore) KeyStringsWithoutValues(bucket, prefix []byte) (keys []string, err error) {
+	c := &Call{Op: OpKeyStringsWithoutValues, Bucket: bucket, Prefix: prefix}
+	err = s.handler(c)
+	return bytesToStrings(c.Keys), err
+}
+
+func (s *interceptedStore) Cursor(bucket []byte, opts CursorOptions) (Cursor, error) {
+	c := &Call{Op: OpCursor, Bucket: bucket, Args: []interface{}{opts}}
+	return resultOf[Cursor](c, 0, s.handler(c))
+}
+
+func (s *interceptedStore) Range(bucket []byte, opts RangeOptions) (RangePage, error) {
+	c := &Call{Op: OpRange, Bucket: bucket, Args: []interface{}{opts}}
+	token, err := resultOf[string](c, 0, s.handler(c))
+	return RangePage{Keys: c.Keys, Values: c.Values, Token: token}, err
+}
+
+func (s *interceptedStore) Watch(ctx context.Context, bucket, prefix []byte) (<-chan Event, error) {
+	c := &Call{Op: OpWatch, Bucket: bucket, Prefix: prefix, Args: []interface{}{ctx}}
+	return resultOf[<-chan Event](c, 0, s.handler(c))
+}
+
+func (s *interceptedStore) WatchFrom(ctx context.Context, bucket, prefix []byte, version uint64) (<-chan Event, error) {
+	c := &Call{Op: OpWatchFrom, Bucket: bucket, Prefix: prefix, Args: []interface{}{ctx, version}}
+	return resultOf[<-chan Event](c, 0, s.handler(c))
+}
+
+func (s *interceptedStore) Buckets() ([][]byte, error) {
+	c := &Call{Op: OpBuckets}
+	return resultOf[[][]byte](c, 0, s.handler(c))
+}
+
+func (s *interceptedStore) AllKeys(async func(key string, deletedOrExpired bool)) error {
+	return s.AllKeysCtx(context.Background(), async)
+}
+
+// AllKeysCtx AllKeys stopped when ctx is done, see WithContext
+func (s *interceptedStore) AllKeysCtx(ctx context.Context, async func(key string, deletedOrExpired bool)) error {
+	return s.handler(&Call{Op: OpAllKeys, Args: []interface{}{async, ctx}})
+}
+
+func (s *interceptedStore) Close() error {
+	return s.handler(&Call{Op: OpClose})
+}
+
+func (s *interceptedStore) Sync() error {
+	return s.handler(&Call{Op: OpSync})
+}
+
+func (s *interceptedStore) GC(discardRatio float64) (int, error) {
+	c := &Call{Op: OpGC, Args: []interface{}{discardRatio}}
+	return resultOf[int](c, 0, s.handler(c))
+}
+
+func (s *interceptedStore) Stats() (Stats, error) {
+	c := &Call{Op: OpStats}
+	return resultOf[Stats](c, 0, s.handler(c))
+}
+
+func (s *interceptedStore) Backup(w io.Writer, since uint64, buckets ...[]byte) (uint64, error) {
+	c := &Call{Op: OpBackup, Args: []interface{}{w, since, buckets}}
+	return resultOf[uint64](c, 0, s.handler(c))
+}
+
+func (s *interceptedStore) Restore(r io.Reader) error {
+	return s.handler(&Call{Op: OpRestore, Args: []interface{}{r}})
+}
+
+func (s *interceptedStore) Update(f func(txn Txn) error) error {
+	return s.handler(&Call{Op: OpUpdate, Args: []interface{}{f}})
+}
+
+func (s *interceptedStore) View(f func(txn Txn) error) error {
+	return s.handler(&Call{Op: OpView, Args: []interface{}{f}})
+}
+
+func (s *interceptedStore) Batch(f func(txn Txn) error) error {
+	return s.handler(&Call{Op: OpBatch, Args: []interface{}{f}})
+}
+
+func (s *interceptedStore) Exec(f func(txn *badger.Txn) error) error {
+	return s.handler(&Call{Op: OpExec, Args: []interface{}{f}})
+}
+
+func (s *interceptedStore) ReadOnly() bool {
+	c := &Call{Op: OpReadOnly}
+	_ = s.handler(c)
+	readOnly, _ := c.result(0).(bool)
+	return readOnly
+}
+
+func (s *interceptedStore) Path() []string {
+	c := &Call{Op: OpPath}
+	_ = s.handler(c)
+	path, _ := c.result(0).([]string)
+	return path
+}
+
+func (s *interceptedStore) KeyFormat() KeyFormat {
+	c := &Call{Op: OpKeyFormat}
+	_ = s.handler(c)
+	format, _ := c.result(0).(KeyFormat)
+	return format
+}
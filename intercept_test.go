@@ -0,0 +1,173 @@
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// test interceptors see calls in order and every method of KvStore goes through them
+func TestWrap(t *testing.T) {
+	var ops []string
+	record := func(name string) Interceptor {
+		return func(c *Call, next Handler) error {
+			ops = append(ops, name+">"+c.Op)
+			err := next(c)
+			ops = append(ops, name+"<"+c.Op)
+			return err
+		}
+	}
+	s := Wrap(newMemoryStore(t), record("a"), record("b"))
+	assert.True(t, s.Set(TestBucket, []byte("k"), []byte("v")) == nil)
+	assert.Equal(t, []string{"a>" + OpSet, "b>" + OpSet, "b<" + OpSet, "a<" + OpSet}, ops)
+	v, found, err := s.Get(TestBucket, []byte("k"))
+	assert.True(t, err == nil && found)
+	assert.Equal(t, "v", string(v))
+	_, found, err = s.Get(TestBucket, []byte("x"))
+	assert.True(t, errors.Is(err, KeyNotFoundError) && !found)
+
+	// an interceptor not calling next sees every method with zero arguments
+	ops = nil
+	skip := func(c *Call, next Handler) error {
+		ops = append(ops, c.Op)
+		return nil
+	}
+	w := reflect.ValueOf(Wrap(newMemoryStore(t), skip))
+	storeType := reflect.TypeOf((*KvStore)(nil)).Elem()
+	for i := 0; i < storeType.NumMethod(); i++ {
+		m := w.MethodByName(storeType.Method(i).Name)
+		args := make([]reflect.Value, m.Type().NumIn())
+		for j := range args {
+			args[j] = reflect.Zero(m.Type().In(j))
+		}
+		if m.Type().IsVariadic() {
+			m.CallSlice(args)
+		} else {
+			m.Call(args)
+		}
+		assert.Equal(t, storeType.Method(i).Name, ops[len(ops)-1])
+	}
+	assert.Equal(t, storeType.NumMethod(), len(ops))
+}
+
+// test interceptors short-circuit, change and observe calls
+func TestInterceptors(t *testing.T) {
+	denied := errors.New("denied")
+	readOnlyBucket := func(c *Call, next Handler) error {
+		if string(c.Bucket) == "ro" && c.Op != OpGet && c.Op != OpKeys {
+			return denied
+		}
+		return next(c)
+	}
+	upper := func(c *Call, next Handler) error {
+		if c.Op == OpSet || c.Op == OpPSet {
+			for i, v := range c.Values {
+				c.Values[i] = bytes.ToUpper(v)
+			}
+		}
+		return next(c)
+	}
+	hidden := func(c *Call, next Handler) error {
+		if c.Op == OpGet && strings.HasPrefix(string(c.Keys[0]), "_") {
+			c.Values, c.Results = nil, []interface{}{false}
+			return KeyNotFoundError
+		}
+		err := next(c)
+		if c.Op == OpKeys {
+			var keys, values [][]byte
+			for i, k := range c.Keys {
+				if !strings.HasPrefix(string(k), "_") {
+					keys, values = append(keys, k), append(values, c.Values[i])
+				}
+			}
+			c.Keys, c.Values = keys, values
+		}
+		return err
+	}
+	var seen []string
+	allKeys := func(c *Call, next Handler) error {
+		if c.Op == OpAllKeys {
+			async := c.Args[0].(func(key string, deletedOrExpired bool))
+			c.Args[0] = func(key string, deletedOrExpired bool) {
+				seen = append(seen, key)
+				async(key, deletedOrExpired)
+			}
+		}
+		return next(c)
+	}
+	s := Wrap(newMemoryStore(t), readOnlyBucket, upper, hidden, allKeys)
+
+	assert.Equal(t, denied, s.Set([]byte("ro"), []byte("a"), nil))
+	assert.Equal(t, denied, s.Delete([]byte("ro"), []byte("a")))
+	assert.True(t, s.PSet(TestBucket, [][]byte{[]byte("a"), []byte("_b")}, [][]byte{[]byte("x"), []byte("y")}) == nil)
+	v, found, err := s.Get(TestBucket, []byte("a"))
+	assert.True(t, err == nil && found)
+	assert.Equal(t, "X", string(v))
+	_, found, err = s.Get(TestBucket, []byte("_b"))
+	assert.True(t, errors.Is(err, KeyNotFoundError) && !found)
+
+	keys, values, err := s.Keys(TestBucket, nil)
+	assert.True(t, err == nil)
+	assert.Equal(t, [][]byte{[]byte("a")}, keys)
+	assert.Equal(t, [][]byte{[]byte("X")}, values)
+	values, err = s.PGet(TestBucket, [][]byte{[]byte("_b")})
+	assert.True(t, err == nil)
+	assert.Equal(t, "Y", string(values[0]), "PGet is not hidden")
+
+	n := 0
+	assert.True(t, s.AllKeys(func(key string, deletedOrExpired bool) { n++ }) == nil)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, n, len(seen))
+
+	page, err := s.Range(TestBucket, RangeOptions{Limit: 1})
+	assert.True(t, err == nil && len(page.Keys) == 1 && page.Token != "")
+	assert.True(t, Wrap(s).ReadOnly() == false)
+	assert.Equal(t, UnknownOpError, Wrap(s, func(c *Call, next Handler) error {
+		c.Op = "Nope"
+		return next(c)
+	}).Sync())
+}
+
+// test arguments and results of another type and nil functions fail calls instead of being zero values
+func TestWrapBadCall(t *testing.T) {
+	set := func(f func(c *Call)) Interceptor {
+		return func(c *Call, next Handler) error {
+			f(c)
+			return next(c)
+		}
+	}
+	s := Wrap(newMemoryStore(t), set(func(c *Call) {
+		if c.Op == OpSetWithTTL || c.Op == OpAllKeys {
+			c.Args[0] = "1h"
+		}
+	}))
+	assert.True(t, errors.Is(s.SetWithTTL(TestBucket, []byte("k"), []byte("v"), time.Hour), BadCallError))
+	assert.True(t, errors.Is(s.AllKeys(func(key string, deletedOrExpired bool) {}), BadCallError))
+	_, _, err := s.Get(TestBucket, []byte("k"))
+	assert.Equal(t, KeyNotFoundError, err, "the key is not set")
+
+	s = Wrap(newMemoryStore(t))
+	assert.True(t, errors.Is(s.Update(nil), BadCallError))
+	assert.True(t, errors.Is(s.View(nil), BadCallError))
+	assert.True(t, errors.Is(s.Batch(nil), BadCallError))
+	assert.True(t, errors.Is(s.Exec(nil), BadCallError))
+	assert.True(t, errors.Is(s.AllKeys(nil), BadCallError))
+	assert.True(t, errors.Is(s.Restore(nil), BadCallError))
+
+	s = Wrap(newMemoryStore(t), func(c *Call, next Handler) error {
+		err := next(c)
+		c.Results = []interface{}{"1"}
+		return err
+	})
+	_, err = s.Incr(TestBucket, []byte("n"), 1)
+	assert.True(t, errors.Is(err, BadCallError))
+	_, err = s.TTL(TestBucket, []byte("n"))
+	assert.True(t, errors.Is(err, BadCallError))
+	page, err := s.Range(TestBucket, RangeOptions{})
+	assert.True(t, err == nil, "the token is a string")
+	assert.Equal(t, "1", page.Token)
+}
@@ -1,19 +1,25 @@
 package kvstore
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"github.com/dgraph-io/badger/v4"
-	"log"
+	"io"
+	"log/slog"
 	"os"
-	"strings"
+	"sort"
+	"time"
 )
 
 const (
+	// DebugFlag environment variable to log at debug level, see LogLevel
 	DebugFlag = "KvBadgerDebug"
 )
 
 var (
+	// CanDebug DebugFlag is set at start
+	//
+	// Deprecated: use LogLevel, it can be changed at runtime
 	CanDebug = os.Getenv(DebugFlag) != ""
 )
 var (
@@ -27,56 +33,79 @@ type KvStore interface {
 	// Get a key-value in a bucket
 	Get(bucket, k []byte) (result []byte, found bool, e error)
 
+	// SetWithTTL set a key-value in a bucket which expires after ttl, ttl <= 0 never expires
+	SetWithTTL(bucket, k []byte, v []byte, ttl time.Duration) error
+
 	// PSet set multi key-values in a bucket
 	PSet(bucket []byte, keys, values [][]byte) error
 
+	// PSetWithTTL set multi key-values in a bucket which expire after ttl, ttl <= 0 never expires
+	PSetWithTTL(bucket []byte, keys, values [][]byte, ttl time.Duration) error
+
+	// TTL remaining lifetime of a key in a bucket, 0 if it never expires
+	TTL(bucket, k []byte) (time.Duration, error)
+
+	// Persist remove the expiry of a key in a bucket
+	Persist(bucket, k []byte) error
+
 	// PGet get multi key-values in a bucket
 	PGet(bucket []byte, keys [][]byte) ([][]byte, error)
 
+	// CompareAndSwap set a key-value in a bucket if the key exists with the expected value,
+	// PreconditionFailedError if it does not
+	CompareAndSwap(bucket, k, expected, v []byte) error
+
+	// SetIfAbsent set a key-value in a bucket if the key does not exist, PreconditionFailedError if it does
+	SetIfAbsent(bucket, k, v []byte) error
+
+	// Incr add delta to a decimal integer value of a key in a bucket and return the new value,
+	// a key not found is 0. NotIntegerError if the value is not an integer, conflicts are retried until it commits
+	Incr(bucket, k []byte, delta int64) (int64, error)
+
+	// Sequence allocate numbers stored in a key of a bucket, leaseSize numbers are taken at a time
+	Sequence(bucket, name []byte, leaseSize uint64) (Sequence, error)
+
 	// Delete a key in a bucket
 	Delete(bucket, key []byte) error
 
+	// DeleteIfEquals delete a key in a bucket if it exists with the expected value,
+	// PreconditionFailedError if it does not
+	DeleteIfEquals(bucket, k, expected []byte) error
+
 	// DeleteKeys delete multi keys in a bucket
 	DeleteKeys(bucket []byte, keys [][]byte) error
 
-	/*
-		https://github.com/dgraph-io/badger/issues/2014
-		TODO bug 使用 keyPrefix := "cluster#broker#name#@cluster-test-1@"， 结果返回如下， 明显不是前缀。。。
-		// 并且 cluster#broker#name#@cluster-test@broker-test-890 等key在db中不存在
-		// 使用 KeyStringsWithoutValues方法可以
-		// 			  cluster#broker#name#@cluster-test@broker-test-890
-		//            cluster#broker#name#@cluster-test@broker-test-9-1
-		//            cluster#broker#name#@cluster-test@broker-test-9010
-		//            cluster#broker#name#@cluster-test@broker-test-9111
-		// 			  cluster#broker#name#@cluster-test@broker-test-922
-		// 			  cluster#broker#name#@cluster-test@broker-test-933
-
-	*/
-	// Keys get key and value in a bucket
+	// Keys get key and value with prefix in a bucket. prefix is relative to the bucket, every returned key
+	// belongs to the bucket with the bucket removed. A store of NewBadgerStore or with Options.LegacyPrefixes also
+	// takes a prefix that starts with the bucket, see LegacyPrefix
 	Keys(bucket, prefix []byte) (keys [][]byte, values [][]byte, err error)
 
-	// KeyStrings return key and values as bytes
+	// KeyStrings return key as string and values as bytes, see Keys
 	KeyStrings(bucket, prefix []byte) (keys []string, values [][]byte, err error)
 
-	/*
-		https://github.com/dgraph-io/badger/issues/2014
-		TODO bug 使用 keyPrefix := "cluster#broker#name#@cluster-test-1@"， 结果返回如下， 明显不是前缀。。。
-		// 并且 cluster#broker#name#@cluster-test@broker-test-890 等key在db中不存在
-		// 使用 KeyStringsWithoutValues方法可以
-		// 			  cluster#broker#name#@cluster-test@broker-test-890
-		//            cluster#broker#name#@cluster-test@broker-test-9-1
-		//            cluster#broker#name#@cluster-test@broker-test-9010
-		//            cluster#broker#name#@cluster-test@broker-test-9111
-		// 			  cluster#broker#name#@cluster-test@broker-test-922
-		// 			  cluster#broker#name#@cluster-test@broker-test-933
-
-	*/
-	// KeysWithoutValues return key as []byte
+	// KeysWithoutValues return key as []byte, see Keys
 	KeysWithoutValues(bucket, prefix []byte) (keys [][]byte, err error)
 
-	// KeyStringsWithoutValues return key as string
+	// KeyStringsWithoutValues return key as string, see Keys
 	KeyStringsWithoutValues(bucket, prefix []byte) (keys []string, err error)
 
+	// Cursor stream keys in a bucket without loading them into memory, close it after use
+	Cursor(bucket []byte, opts CursorOptions) (Cursor, error)
+
+	// Range get a page of keys in a bucket, pass RangePage.Token back to get the next page
+	Range(bucket []byte, opts RangeOptions) (RangePage, error)
+
+	// Watch deliver changes of keys with prefix in a bucket committed after the call, until ctx is done
+	// or the store is closed, then the channel is closed. prefix is relative to the bucket
+	Watch(ctx context.Context, bucket, prefix []byte) (<-chan Event, error)
+
+	// WatchFrom replay changes after version kept by the store then go on like Watch, pass the Version
+	// of the last event handled to resume. Version 0 replays what the store keeps
+	WatchFrom(ctx context.Context, bucket, prefix []byte, version uint64) (<-chan Event, error)
+
+	// Buckets every bucket with a live key in order. Legacy keys are split at the first Split
+	Buckets() ([][]byte, error)
+
 	// AllKeys to get
 	AllKeys(async func(key string, deletedOrExpired bool)) error
 
@@ -86,7 +115,36 @@ type KvStore interface {
 	// Sync flush
 	Sync() error
 
+	// GC rewrite files of values while one has at least discardRatio of values to discard,
+	// return the number of files rewritten
+	GC(discardRatio float64) (int, error)
+
+	// Stats sizes of the store
+	Stats() (Stats, error)
+
+	// Backup write keys with a version after since to w in the format of badger.DB.Backup, since 0 is a full
+	// backup. It returns the version to pass as since for the next incremental backup. With buckets only keys
+	// in them are written
+	Backup(w io.Writer, since uint64, buckets ...[]byte) (uint64, error)
+
+	// Restore load a backup written by Backup, backups are restored in the order they were taken.
+	// The store should have the same KeyFormat as the one backed up, and no other writes while it runs
+	Restore(r io.Reader) error
+
+	// Update run f in a read-write transaction committed if f returns nil. f runs again after a conflict,
+	// up to MaxTxnRetries times
+	Update(f func(txn Txn) error) error
+
+	// View run f in a read-only transaction
+	View(f func(txn Txn) error) error
+
+	// Batch run f in read-write transactions for bulk writes. It is not atomic, a transaction too big is
+	// committed and writes go on in a new one
+	Batch(f func(txn Txn) error) error
+
 	// Exec a transaction. should NOT use it
+	//
+	// Deprecated: it leaks badger and bypasses bucket encoding, use Update or View
 	Exec(f func(txn *badger.Txn) error) error
 
 	// ReadOnly check db is read only
@@ -94,49 +152,122 @@ type KvStore interface {
 
 	// Path store path for key and values'
 	Path() []string
+
+	// KeyFormat how buckets and keys are encoded in the store
+	KeyFormat() KeyFormat
 }
 
 type badgerStore struct {
-	db   *badger.DB
-	opts badger.Options
+	db      *badger.DB
+	opts    badger.Options
+	format  KeyFormat
+	watches *watchHub
+	log     *logger
+	cache   *cache // nil without a cache
+
+	legacyPrefixes bool // see Options.LegacyPrefixes
 }
 
+// NewBadgerStore open a badger store with the key format recorded in opts.Dir, KeyFormatLegacy for a new directory.
+// Its scans take prefixes from before scans were bucket scoped, see Options.LegacyPrefixes
 func NewBadgerStore(opts badger.Options) (KvStore, error) {
+	return newBadgerStore(opts, KeyFormatAuto, true, defaultLogger, nil)
+}
+
+func newBadgerStore(opts badger.Options, format KeyFormat, legacyPrefixes bool, log *logger, cache *cache) (KvStore, error) {
+	record := false
+	if opts.InMemory {
+		format = format.orLegacy()
+	} else {
+		var err error
+		if format, record, err = resolveKeyFormat(opts.Dir, format); err != nil {
+			return nil, err
+		}
+	}
+
 	db, err := badger.Open(opts)
 	if err != nil {
 		return nil, err
 	}
+	if record && !opts.ReadOnly {
+		if err := WriteKeyFormat(opts.Dir, format); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
 
 	return badgerStore{
-		db:   db,
-		opts: opts,
+		db:      db,
+		opts:    opts,
+		format:  format,
+		watches: newWatchHub(db, log),
+		log:     log,
+		cache:   cache,
+
+		legacyPrefixes: legacyPrefixes,
 	}, nil
 }
 
-func (b badgerStore) Set(bucket, k []byte, v []byte) error {
-	newKey := BuildKey(len(bucket)+len(k), bucket, k)
-	L("Set", newKey, v)
+func (b badgerStore) SetCtx(ctx context.Context, bucket, k []byte, v []byte) error {
+	newKey := b.format.Encode(bucket, k)
+	b.log.debug("Set", b.log.key("key", newKey), b.log.value("value", v))
+	defer b.cache.invalidate(newKey)
 	return b.db.Update(func(txn *badger.Txn) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		return txn.Set(newKey, v)
 	})
 }
 
-func (b badgerStore) Get(bucket, k []byte) (result []byte, found bool, e error) {
-	newKey := BuildKey(len(bucket)+len(k), bucket, k)
+func (b badgerStore) SetWithTTLCtx(ctx context.Context, bucket, k []byte, v []byte, ttl time.Duration) error {
+	newKey := b.format.Encode(bucket, k)
+	b.log.debug("SetWithTTL", b.log.key("key", newKey), b.log.value("value", v), slog.Duration("ttl", ttl))
+	defer b.cache.invalidate(newKey)
+	return b.db.Update(func(txn *badger.Txn) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return txn.SetEntry(newEntry(newKey, v, ttl))
+	})
+}
+
+func (b badgerStore) GetCtx(ctx context.Context, bucket, k []byte) (result []byte, found bool, e error) {
+	newKey := b.format.Encode(bucket, k)
 	var v []byte
+	var expiresAt, generation uint64
+
+	cached := b.cache.enabled(bucket)
+	if cached {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		var ok bool
+		if v, found, ok, generation = b.cache.get(newKey); ok {
+			b.log.debug("Get", b.log.key("key", newKey), b.log.value("value", v), slog.Bool("cached", true))
+			if !found {
+				return nil, false, KeyNotFoundError
+			}
+			return v, true, nil
+		}
+	}
 
 	err := b.db.View(func(txn *badger.Txn) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		item, err := txn.Get(newKey)
 		if err == nil {
-			err = item.Value(func(value []byte) error {
-				v = value
-				return nil
-			})
+			expiresAt = item.ExpiresAt()
+			v, err = item.ValueCopy(nil)
 		}
 		return err
 	})
-	L("Get", newKey, v)
+	b.log.debug("Get", b.log.key("key", newKey), b.log.value("value", v))
 
+	if cached && (err == nil || errors.Is(err, badger.ErrKeyNotFound)) {
+		b.cache.fill(generation, newKey, v, err == nil, expiresAt)
+	}
 	if errors.Is(err, badger.ErrKeyNotFound) {
 		return nil, false, KeyNotFoundError
 	}
@@ -146,39 +277,119 @@ func (b badgerStore) Get(bucket, k []byte) (result []byte, found bool, e error)
 	return v, found, err
 }
 
-func (b badgerStore) PSet(bucket []byte, keys, values [][]byte) error {
+func (b badgerStore) PSetCtx(ctx context.Context, bucket []byte, keys, values [][]byte) error {
 	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+	newKeys := make([][]byte, 0, len(keys))
+	defer func() {
+		b.cache.invalidate(newKeys...)
+	}()
 	for i, key := range keys {
-		newKey := BuildKey(len(bucket)+len(key), bucket, key)
-		L("PSet", newKey, values[i])
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		newKey := b.format.Encode(bucket, key)
+		newKeys = append(newKeys, newKey)
+		b.log.debug("PSet", b.log.key("key", newKey), b.log.value("value", values[i]))
 		err := wb.Set(newKey, values[i])
 		if err != nil {
 			return err
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+func (b badgerStore) PSetWithTTLCtx(ctx context.Context, bucket []byte, keys, values [][]byte, ttl time.Duration) error {
+	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+	newKeys := make([][]byte, 0, len(keys))
+	defer func() {
+		b.cache.invalidate(newKeys...)
+	}()
+	for i, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		newKey := b.format.Encode(bucket, key)
+		newKeys = append(newKeys, newKey)
+		b.log.debug("PSetWithTTL", b.log.key("key", newKey), b.log.value("value", values[i]), slog.Duration("ttl", ttl))
+		if err := wb.SetEntry(newEntry(newKey, values[i], ttl)); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return wb.Flush()
 }
 
-func (b badgerStore) PGet(bucket []byte, keys [][]byte) ([][]byte, error) {
+func (b badgerStore) TTLCtx(ctx context.Context, bucket, k []byte) (time.Duration, error) {
+	newKey := b.format.Encode(bucket, k)
+	b.log.debug("TTL", b.log.key("key", newKey))
+	var ttl time.Duration
+	err := b.db.View(func(txn *badger.Txn) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		item, err := txn.Get(newKey)
+		if err == nil {
+			ttl = remaining(item.ExpiresAt())
+		}
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, KeyNotFoundError
+	}
+	return ttl, err
+}
+
+func (b badgerStore) PersistCtx(ctx context.Context, bucket, k []byte) error {
+	newKey := b.format.Encode(bucket, k)
+	b.log.debug("Persist", b.log.key("key", newKey))
+	defer b.cache.invalidate(newKey)
+	err := b.db.Update(func(txn *badger.Txn) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		item, err := txn.Get(newKey)
+		if err != nil || item.ExpiresAt() == 0 {
+			return err
+		}
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		return txn.SetEntry(badger.NewEntry(newKey, v).WithMeta(item.UserMeta()))
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return KeyNotFoundError
+	}
+	return err
+}
+
+func (b badgerStore) PGetCtx(ctx context.Context, bucket []byte, keys [][]byte) ([][]byte, error) {
 	var values = make([][]byte, len(keys))
 	err := b.db.View(func(txn *badger.Txn) error {
 		for i, key := range keys {
-			newKey := BuildKey(len(bucket)+len(key), bucket, key)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			newKey := b.format.Encode(bucket, key)
 			item, err := txn.Get(newKey)
 			if errors.Is(err, badger.ErrKeyNotFound) {
-				L("PGet", newKey, []byte(KeyNotFoundError.Error()))
+				b.log.debug("PGet", b.log.key("key", newKey), slog.Any("error", KeyNotFoundError))
 				return KeyNotFoundError
 			}
 			if err != nil {
 				return err
 			}
-			if err := item.Value(func(val []byte) error {
-				values[i] = val
-				return nil
-			}); err != nil {
+			if values[i], err = item.ValueCopy(nil); err != nil {
 				return err
 			}
-			L("PGet", newKey, values[i])
+			b.log.debug("PGet", b.log.key("key", newKey), b.log.value("value", values[i]))
 		}
 		return nil
 	})
@@ -186,109 +397,143 @@ func (b badgerStore) PGet(bucket []byte, keys [][]byte) ([][]byte, error) {
 	return values, err
 }
 
-func (b badgerStore) Delete(bucket, key []byte) error {
+func (b badgerStore) DeleteCtx(ctx context.Context, bucket, key []byte) error {
 	wb := b.db.NewWriteBatch()
 	defer wb.Cancel()
-	newKey := BuildKey(len(bucket)+len(key), bucket, key)
-	L("Delete", newKey)
+	newKey := b.format.Encode(bucket, key)
+	b.log.debug("Delete", b.log.key("key", newKey))
+	defer b.cache.invalidate(newKey)
 	if err := wb.Delete(newKey); err != nil {
 		return err
-	} else {
-		return wb.Flush()
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return wb.Flush()
 }
 
-func (b badgerStore) DeleteKeys(bucket []byte, keys [][]byte) error {
+func (b badgerStore) DeleteKeysCtx(ctx context.Context, bucket []byte, keys [][]byte) error {
 	wb := b.db.NewWriteBatch()
 	defer wb.Cancel()
+	newKeys := make([][]byte, 0, len(keys))
+	defer func() {
+		b.cache.invalidate(newKeys...)
+	}()
 	for _, key := range keys {
-		newKey := BuildKey(len(bucket)+len(key), bucket, key)
-		L("DeleteKeys", newKey)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		newKey := b.format.Encode(bucket, key)
+		newKeys = append(newKeys, newKey)
+		b.log.debug("DeleteKeys", b.log.key("key", newKey))
 
 		if err := wb.Delete(newKey); err != nil {
 			return err
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return wb.Flush()
 }
 
-func (b badgerStore) Keys(bucket, prefix []byte) (keys [][]byte, values [][]byte, err error) {
-	L("Keys", prefix)
-	err = b.db.View(func(txn *badger.Txn) error {
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			item := it.Item()
-			if item.IsDeletedOrExpired() {
-				continue
-			}
-			userKey := RemovePrefix(item.Key(), BuildKey(len(bucket), bucket, []byte{})) // Remove bucket and split in key
-			keys = append(keys, userKey)
-			v, err := item.ValueCopy(nil)
-			values = append(values, v)
-			if err != nil {
-				return err
-			}
-
+func (b badgerStore) KeysCtx(ctx context.Context, bucket, prefix []byte) (keys [][]byte, values [][]byte, err error) {
+	b.log.debug("Keys", b.log.key("bucket", bucket), b.log.key("prefix", prefix))
+	err = b.scan(ctx, bucket, prefix, true, func(userKey []byte, item *badger.Item) error {
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
 		}
+		keys = append(keys, userKey)
+		values = append(values, v)
 		return nil
 	})
 
 	return keys, values, err
 }
 
-func (b badgerStore) KeyStrings(bucket, prefix []byte) (keys []string, values [][]byte, err error) {
-	L("KeyStrings", prefix)
-	err = b.db.View(func(txn *badger.Txn) error {
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			item := it.Item()
-			if item.IsDeletedOrExpired() {
-				continue
-			}
-			userKey := RemovePrefix(item.Key(), BuildKey(len(bucket), bucket, []byte{}))
-			keys = append(keys, string(userKey))
-			v, err := item.ValueCopy(nil)
-			values = append(values, v)
-			if err != nil {
-				return err
-			}
-
+func (b badgerStore) KeyStringsCtx(ctx context.Context, bucket, prefix []byte) (keys []string, values [][]byte, err error) {
+	b.log.debug("KeyStrings", b.log.key("bucket", bucket), b.log.key("prefix", prefix))
+	err = b.scan(ctx, bucket, prefix, true, func(userKey []byte, item *badger.Item) error {
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
 		}
+		keys = append(keys, string(userKey))
+		values = append(values, v)
 		return nil
 	})
 
 	return keys, values, err
 }
 
-func (b badgerStore) KeysWithoutValues(bucket, prefix []byte) ([][]byte, error) {
-	L("KeysWithoutValues", prefix)
-	var keys [][]byte
-	return keys, b.db.View(func(txn *badger.Txn) error {
+func (b badgerStore) KeysWithoutValuesCtx(ctx context.Context, bucket, prefix []byte) (keys [][]byte, err error) {
+	b.log.debug("KeysWithoutValues", b.log.key("bucket", bucket), b.log.key("prefix", prefix))
+	err = b.scan(ctx, bucket, prefix, false, func(userKey []byte, _ *badger.Item) error {
+		keys = append(keys, userKey)
+		return nil
+	})
+
+	return keys, err
+}
+
+func (b badgerStore) KeyStringsWithoutValuesCtx(ctx context.Context, bucket, prefix []byte) (keys []string, err error) {
+	b.log.debug("KeyStringsWithoutValues", b.log.key("bucket", bucket), b.log.key("prefix", prefix))
+	err = b.scan(ctx, bucket, prefix, false, func(userKey []byte, _ *badger.Item) error {
+		keys = append(keys, string(userKey))
+		return nil
+	})
+
+	return keys, err
+}
+
+// scan visit live keys with prefix in bucket in order until ctx is done, userKey has bucket removed
+func (b badgerStore) scan(ctx context.Context, bucket, prefix []byte, withValues bool, visit func(userKey []byte, item *badger.Item) error) error {
+	if b.legacyPrefixes {
+		prefix = LegacyPrefix(bucket, prefix)
+	}
+	scanPrefix := b.format.scanPrefix(bucket, prefix)
+	return b.db.View(func(txn *badger.Txn) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		it := txn.NewIterator(badger.IteratorOptions{
-			PrefetchValues: false,
+			PrefetchValues: withValues,
 			PrefetchSize:   100,
 			Reverse:        false,
 			AllVersions:    false,
 		})
 		defer it.Close()
-
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		for it.Seek(scanPrefix); it.ValidForPrefix(scanPrefix); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			item := it.Item()
-			if item.IsDeletedOrExpired() {
+			if item.IsDeletedOrExpired() || !b.format.inBucket(bucket, item.Key()) {
 				continue
 			}
-			userKey := RemovePrefix(item.Key(), BuildKey(len(bucket), bucket, []byte{}))
-			keys = append(keys, userKey)
+			if err := visit(b.format.userKey(bucket, item.Key()), item); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
 }
 
-func (b badgerStore) KeyStringsWithoutValues(bucket, prefix []byte) (keys []string, err error) {
-	L("KeyStringsWithoutValues", prefix)
-	err = b.db.View(func(txn *badger.Txn) error {
+func (b badgerStore) RangeCtx(ctx context.Context, bucket []byte, opts RangeOptions) (RangePage, error) {
+	b.log.debug("Range", b.log.key("bucket", bucket), b.log.key("prefix", opts.Prefix))
+	return rangePage(ctx, func(bucket []byte, opts CursorOptions) (Cursor, error) {
+		return b.CursorCtx(ctx, bucket, opts)
+	}, bucket, opts)
+}
+
+func (b badgerStore) BucketsCtx(ctx context.Context) ([][]byte, error) {
+	b.log.debug("Buckets")
+	found := make(map[string]struct{})
+	err := b.db.View(func(txn *badger.Txn) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		it := txn.NewIterator(badger.IteratorOptions{
 			PrefetchValues: false,
 			PrefetchSize:   100,
@@ -296,24 +541,32 @@ func (b badgerStore) KeyStringsWithoutValues(bucket, prefix []byte) (keys []stri
 			AllVersions:    false,
 		})
 		defer it.Close()
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		for it.Rewind(); it.Valid(); {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			item := it.Item()
 			if item.IsDeletedOrExpired() {
+				it.Next()
 				continue
 			}
-			userKey := RemovePrefix(item.Key(), BuildKey(len(bucket), bucket, []byte{}))
-			keys = append(keys, string(userKey))
-
+			if next := addBucket(b.format, found, item.Key()); next != nil {
+				it.Seek(next)
+			} else {
+				it.Next()
+			}
 		}
 		return nil
 	})
-
-	return keys, err
+	return sortedBuckets(found), err
 }
 
-func (b badgerStore) AllKeys(async func(key string, deletedOrExpired bool)) error {
-	L("AllKeys")
+func (b badgerStore) AllKeysCtx(ctx context.Context, async func(key string, deletedOrExpired bool)) error {
+	b.log.debug("AllKeys")
 	return b.db.View(func(txn *badger.Txn) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		it := txn.NewIterator(badger.IteratorOptions{
 			PrefetchValues: false,
 			PrefetchSize:   100,
@@ -322,6 +575,9 @@ func (b badgerStore) AllKeys(async func(key string, deletedOrExpired bool)) erro
 		})
 		defer it.Close()
 		for it.Rewind(); it.Valid(); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			item := it.Item()
 			async(string(item.Key()), item.IsDeletedOrExpired())
 		}
@@ -330,20 +586,25 @@ func (b badgerStore) AllKeys(async func(key string, deletedOrExpired bool)) erro
 }
 
 func (b badgerStore) Close() error {
-	L("Close")
+	b.log.debug("Close")
+	b.watches.close()
 	if !b.db.IsClosed() {
 		return b.db.Close()
 	}
 	return nil
 }
 
-func (b badgerStore) Sync() error {
-	L("Sync")
+func (b badgerStore) SyncCtx(ctx context.Context) error {
+	b.log.debug("Sync")
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return b.db.Sync()
 }
 
 func (b badgerStore) Exec(f func(tx *badger.Txn) error) error {
-	L("Exec")
+	b.log.debug("Exec")
+	defer b.cache.clear()
 	return b.db.Update(func(txn *badger.Txn) error {
 		return f(txn)
 	})
@@ -360,14 +621,39 @@ func (b badgerStore) Path() []string {
 	}
 }
 
-func L(method string, keys ...[]byte) {
-	if CanDebug {
-		var arr []string
-		if keys != nil && len(keys) > 0 {
-			for _, key := range keys {
-				arr = append(arr, string(key))
-			}
-		}
-		log.Printf(fmt.Sprintf("%s,%s,%s:%s", Now(), DebugFlag, method, strings.Join(arr, ",")))
+func (b badgerStore) KeyFormat() KeyFormat {
+	return b.format
+}
+
+// addBucket add the bucket of a key of the engine to found,
+// return the first key after the bucket or nil if keys of the bucket may follow
+func addBucket(format KeyFormat, found map[string]struct{}, raw []byte) []byte {
+	bucket, _, err := format.Decode(raw)
+	if err != nil {
+		return nil
+	}
+	found[string(bucket)] = struct{}{}
+	return prefixEnd(format.BucketPrefix(bucket))
+}
+
+func sortedBuckets(found map[string]struct{}) [][]byte {
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buckets := make([][]byte, len(names))
+	for i, name := range names {
+		buckets[i] = []byte(name)
+	}
+	return buckets
+}
+
+// newEntry an entry expires after ttl, ttl <= 0 never expires
+func newEntry(key, v []byte, ttl time.Duration) *badger.Entry {
+	e := badger.NewEntry(key, v)
+	if ttl > 0 {
+		e = e.WithTTL(ttl)
 	}
+	return e
 }
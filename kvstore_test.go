@@ -454,3 +454,49 @@ func Test_badgerStore_PSetAndeKeyStringsWithoutValues(t *testing.T) {
 	}
 
 }
+
+// test scans are scoped to the bucket and prefix is relative to the bucket
+func Test_badgerStore_KeysInBucket(t *testing.T) {
+	for _, format := range []KeyFormat{KeyFormatLegacy, KeyFormatLengthPrefixed} {
+		var dir = getDataPath()
+		t.Logf("data path %s, format %s", dir, format)
+
+		s, err := Open(EngineBadger, Options{Dir: dir, KeyFormat: format})
+		assert.True(t, err == nil)
+
+		cluster := []byte("cluster#broker#name#")
+		other := []byte("cluster#broker#name#@cluster-test-1")
+		for i := 0; i < 10; i++ {
+			assert.True(t, s.Set(cluster, []byte("@cluster-test-1@broker-"+strconv.Itoa(i)), []byte("1")) == nil)
+			assert.True(t, s.Set(cluster, []byte("@cluster-test@broker-"+strconv.Itoa(i)), []byte("2")) == nil)
+			assert.True(t, s.Set([]byte("cluster#broker#name"), []byte("broker-"+strconv.Itoa(i)), []byte("3")) == nil)
+		}
+		assert.True(t, s.Set(nil, []byte("no-bucket"), []byte("4")) == nil)
+
+		keys, values, err := s.KeyStrings(cluster, []byte("@cluster-test-1@"))
+		assert.True(t, err == nil)
+		assert.Equal(t, 10, len(keys))
+		for i, k := range keys {
+			assert.Equal(t, "@cluster-test-1@broker-"+strconv.Itoa(i), k)
+			assert.Equal(t, "1", string(values[i]))
+		}
+
+		all, err := s.KeysWithoutValues(cluster, nil)
+		assert.True(t, err == nil)
+		assert.Equal(t, 20, len(all))
+
+		if format == KeyFormatLengthPrefixed {
+			// bucket with Split in name is not mixed with keys of other buckets
+			keys, err := s.KeyStringsWithoutValues(other, nil)
+			assert.True(t, err == nil)
+			assert.Equal(t, 0, len(keys))
+		}
+
+		keys, err = s.KeyStringsWithoutValues(nil, nil)
+		assert.True(t, err == nil)
+		assert.Equal(t, []string{"no-bucket"}, keys)
+
+		assert.True(t, s.Close() == nil)
+		_ = os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,45 @@
+// Package kvstoretest runs tests of packages built on kvstore against a store of every engine
+package kvstoretest
+
+import (
+	kvstore "github.com/gmqio/kv-store"
+	"testing"
+)
+
+// Engines the engines of Stores
+var Engines = []string{kvstore.EngineBadger, kvstore.EngineMemory}
+
+// Stores run f in a subtest of each engine of Engines with a store of Open
+func Stores(t *testing.T, opts kvstore.Options, f func(t *testing.T, s kvstore.KvStore)) {
+	for _, engine := range Engines {
+		t.Run(engine, func(t *testing.T) {
+			f(t, Open(t, engine, opts))
+		})
+	}
+}
+
+// Open a store of engine closed at the end of the test. A badger store is in a directory of the test,
+// a read only one is created empty first
+func Open(t *testing.T, engine string, opts kvstore.Options) kvstore.KvStore {
+	t.Helper()
+	if engine == kvstore.EngineBadger && opts.Dir == "" {
+		opts.Dir = t.TempDir()
+		if opts.ReadOnly {
+			s, err := kvstore.Open(engine, kvstore.Options{Dir: opts.Dir})
+			if err != nil {
+				t.Fatalf("create %s: %v", engine, err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatalf("create %s: %v", engine, err)
+			}
+		}
+	}
+	s, err := kvstore.Open(engine, opts)
+	if err != nil {
+		t.Fatalf("open %s: %v", engine, err)
+	}
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	return s
+}
@@ -0,0 +1,215 @@
+package kvstore
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultLogBytes bytes of a key or value logged, longer ones are cut
+const DefaultLogBytes = 64
+
+var (
+	// LogLevel minimum level logged by stores without LogOptions.Level, debug if DebugFlag is set at start.
+	// Set it to toggle debug at runtime
+	LogLevel = new(slog.LevelVar)
+
+	// stderrLogger logger of stores without LogOptions.Logger, levels are checked by the store
+	stderrLogger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	// defaultLogger logger of L and of stores opened without options
+	defaultLogger = newLogger(LogOptions{})
+)
+
+func init() {
+	if CanDebug {
+		LogLevel.Set(slog.LevelDebug)
+	}
+}
+
+// Logger a structured logger, *slog.Logger is a Logger
+type Logger interface {
+	// Enabled report whether the logger logs records of level
+	Enabled(ctx context.Context, level slog.Level) bool
+
+	// LogAttrs log a record of level with a message and attributes
+	LogAttrs(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr)
+}
+
+// LogOptions how a store logs, the zero value logs text to stderr from LogLevel, keys truncated and values
+// by their length only
+type LogOptions struct {
+	// Logger of the store and of badger, nil logs text to stderr
+	Logger Logger
+
+	// Level minimum level logged, nil is LogLevel
+	Level *slog.LevelVar
+
+	// RedactKeys log keys by their length only
+	RedactKeys bool
+
+	// Values log values truncated like keys, for values not sensitive
+	Values bool
+
+	// MaxBytes of a key or value logged, 0 is DefaultLogBytes
+	MaxBytes int
+}
+
+// logger of a store, it checks its level before formatting anything
+type logger struct {
+	Logger
+	level *slog.LevelVar
+	opts  LogOptions
+}
+
+func newLogger(opts LogOptions) *logger {
+	l := &logger{Logger: opts.Logger, level: opts.Level, opts: opts}
+	if l.Logger == nil {
+		l.Logger = stderrLogger
+	}
+	if l.level == nil {
+		l.level = LogLevel
+	}
+	if l.opts.MaxBytes <= 0 {
+		l.opts.MaxBytes = DefaultLogBytes
+	}
+	return l
+}
+
+// loggerOf the logger of a store of this package, defaultLogger for others
+func loggerOf(store KvStore) *logger {
+	switch s := store.(type) {
+	case badgerStore:
+		return s.log
+	case *memStore:
+		return s.log
+	}
+	return defaultLogger
+}
+
+func (l *logger) enabled(level slog.Level) bool {
+	return level >= l.level.Level() && l.Enabled(context.Background(), level)
+}
+
+func (l *logger) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	if l.enabled(level) {
+		l.LogAttrs(context.Background(), level, msg, attrs...)
+	}
+}
+
+func (l *logger) debug(msg string, attrs ...slog.Attr) {
+	l.log(slog.LevelDebug, msg, attrs...)
+}
+
+func (l *logger) warn(msg string, attrs ...slog.Attr) {
+	l.log(slog.LevelWarn, msg, attrs...)
+}
+
+// key attribute of a key, formatted only if it is logged
+func (l *logger) key(name string, k []byte) slog.Attr {
+	return slog.Any(name, loggedBytes{b: k, max: l.opts.MaxBytes, redact: l.opts.RedactKeys})
+}
+
+// keys attribute of keys, formatted only if it is logged
+func (l *logger) keys(name string, keys [][]byte) slog.Attr {
+	return slog.Any(name, loggedKeys{keys: keys, max: l.opts.MaxBytes, redact: l.opts.RedactKeys})
+}
+
+// value attribute of a value, its length only unless LogOptions.Values
+func (l *logger) value(name string, v []byte) slog.Attr {
+	return slog.Any(name, loggedBytes{b: v, max: l.opts.MaxBytes, redact: !l.opts.Values})
+}
+
+// loggedBytes a key or value formatted by formatBytes when a record is logged
+type loggedBytes struct {
+	b      []byte
+	max    int
+	redact bool
+}
+
+func (b loggedBytes) LogValue() slog.Value {
+	return slog.StringValue(formatBytes(b.b, b.max, b.redact))
+}
+
+type loggedKeys struct {
+	keys   [][]byte
+	max    int
+	redact bool
+}
+
+func (k loggedKeys) LogValue() slog.Value {
+	arr := make([]string, len(k.keys))
+	for i, key := range k.keys {
+		arr[i] = formatBytes(key, k.max, k.redact)
+	}
+	return slog.StringValue(strings.Join(arr, ","))
+}
+
+// formatBytes b as text if printable and quoted otherwise, cut after max bytes. A redacted b is its length
+func formatBytes(b []byte, max int, redact bool) string {
+	if redact {
+		return fmt.Sprintf("<%d bytes>", len(b))
+	}
+	s := string(b[:min(len(b), max)])
+	if !printable(s) {
+		s = strconv.Quote(s)
+	}
+	if len(b) > max {
+		s = fmt.Sprintf("%s...<%d bytes>", s, len(b))
+	}
+	return s
+}
+
+func printable(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// badgerLogger badger.Logger logging to the logger of a store
+type badgerLogger struct {
+	log *logger
+}
+
+func (b badgerLogger) Errorf(format string, args ...interface{}) {
+	b.logf(slog.LevelError, format, args...)
+}
+
+func (b badgerLogger) Warningf(format string, args ...interface{}) {
+	b.logf(slog.LevelWarn, format, args...)
+}
+
+func (b badgerLogger) Infof(format string, args ...interface{}) {
+	b.logf(slog.LevelInfo, format, args...)
+}
+
+func (b badgerLogger) Debugf(format string, args ...interface{}) {
+	b.logf(slog.LevelDebug, format, args...)
+}
+
+func (b badgerLogger) logf(level slog.Level, format string, args ...interface{}) {
+	if b.log.enabled(level) {
+		msg := strings.TrimSpace(fmt.Sprintf(format, args...))
+		b.log.LogAttrs(context.Background(), level, msg, slog.String("engine", EngineBadger))
+	}
+}
+
+// L log a call of method with its keys at debug level
+//
+// Deprecated: stores log through LogOptions, L logs keys like a store opened without options
+func L(method string, keys ...[]byte) {
+	if defaultLogger.enabled(slog.LevelDebug) {
+		defaultLogger.LogAttrs(context.Background(), slog.LevelDebug, method, defaultLogger.keys("keys", keys))
+	}
+}
@@ -0,0 +1,103 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// records logged as json, one per line
+func records(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var rows []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		row := make(map[string]interface{})
+		assert.True(t, json.Unmarshal([]byte(line), &row) == nil)
+		rows = append(rows, row)
+	}
+	buf.Reset()
+	return rows
+}
+
+// test stores log through the logger of their options from their level, which can be changed at runtime
+func TestLogOptions(t *testing.T) {
+	var buf bytes.Buffer
+	level := new(slog.LevelVar)
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s, err := NewMemoryStore(Options{Log: LogOptions{Logger: logger, Level: level}})
+	assert.True(t, err == nil)
+
+	assert.True(t, s.Set(TestBucket, []byte("tiger"), []byte("secret")) == nil)
+	assert.Equal(t, 0, len(records(t, &buf)), "debug is off")
+
+	level.Set(slog.LevelDebug)
+	assert.True(t, s.Set(TestBucket, []byte("tiger"), []byte("secret")) == nil)
+	rows := records(t, &buf)
+	assert.Equal(t, 1, len(rows))
+	assert.Equal(t, "Set", rows[0]["msg"])
+	assert.Equal(t, "DEBUG", rows[0]["level"])
+	assert.Contains(t, rows[0]["key"], "tiger")
+	assert.Equal(t, "<6 bytes>", rows[0]["value"], "values are not logged by default")
+
+	level.Set(slog.LevelInfo)
+	_, _, _ = s.Get(TestBucket, []byte("tiger"))
+	assert.Equal(t, 0, len(records(t, &buf)))
+}
+
+// test keys and values are redacted or truncated by options
+func TestLogRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelDebug)
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	s, _ := NewMemoryStore(Options{Log: LogOptions{Logger: logger, Level: level, RedactKeys: true, Values: true}})
+	assert.True(t, s.Set(TestBucket, []byte("tiger"), []byte("v")) == nil)
+	rows := records(t, &buf)
+	assert.True(t, strings.HasPrefix(rows[0]["key"].(string), "<"), rows[0]["key"])
+	assert.NotContains(t, rows[0]["key"], "tiger")
+	assert.Equal(t, "v", rows[0]["value"])
+
+	s, _ = NewMemoryStore(Options{Log: LogOptions{Logger: logger, Level: level, MaxBytes: 4}})
+	assert.True(t, s.Set(TestBucket, []byte("tiger"), []byte("v")) == nil)
+	rows = records(t, &buf)
+	assert.True(t, strings.HasSuffix(rows[0]["key"].(string), "bytes>"), rows[0]["key"])
+}
+
+// test bytes are logged as text when printable
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "tiger", formatBytes([]byte("tiger"), 64, false))
+	assert.Equal(t, `"a\x00b"`, formatBytes([]byte("a\x00b"), 64, false))
+	assert.Equal(t, "tig...<5 bytes>", formatBytes([]byte("tiger"), 3, false))
+	assert.Equal(t, `"\xff"...<2 bytes>`, formatBytes([]byte{0xff, 0xfe}, 1, false))
+	assert.Equal(t, "<5 bytes>", formatBytes([]byte("tiger"), 64, true))
+	assert.Equal(t, "", formatBytes(nil, 64, false))
+}
+
+// test badger logs to the logger of the store
+func TestBadgerLogger(t *testing.T) {
+	var buf bytes.Buffer
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelWarn)
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	b := badgerLogger{log: newLogger(LogOptions{Logger: logger, Level: level})}
+
+	b.Infof("opened %d tables\n", 3)
+	b.Warningf("slow %s\n", "compaction")
+	rows := records(t, &buf)
+	assert.Equal(t, 1, len(rows))
+	assert.Equal(t, "slow compaction", rows[0]["msg"])
+	assert.Equal(t, "WARN", rows[0]["level"])
+	assert.Equal(t, EngineBadger, rows[0]["engine"])
+
+	s, err := Open(EngineBadger, Options{Log: LogOptions{Logger: logger, Level: level}})
+	assert.True(t, err == nil)
+	defer s.Close()
+	_, ok := s.(badgerStore).opts.Logger.(badgerLogger)
+	assert.True(t, ok)
+}
@@ -0,0 +1,851 @@
+package kvstore
+
+import (
+	"context"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/google/btree"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// memDegree degree of the B-tree of keys of a memory store
+	memDegree = 32
+)
+
+// memStore keeps keys ordered in a B-tree in memory with the same key layout as badgerStore
+type memStore struct {
+	mu     *sync.RWMutex
+	keys   *btree.BTreeG[string]
+	data   map[string]memEntry
+	opts   Options
+	format KeyFormat
+	log    *logger
+	closed bool
+
+	version  uint64 // of the last commit
+	pending  []memChange
+	watchers map[*watcher]struct{}
+}
+
+// memEntry a value with its expiry like badger, unix time in seconds and 0 is never
+type memEntry struct {
+	value     []byte
+	expiresAt uint64
+	version   uint64
+	meta      byte // user meta like badger
+}
+
+// memChange a write not published to watchers yet
+type memChange struct {
+	t     EventType
+	key   string
+	entry memEntry
+}
+
+// NewMemoryStore a store in memory, Dir and ValueDir in opts are ignored
+func NewMemoryStore(opts Options) (KvStore, error) {
+	return &memStore{
+		mu:       &sync.RWMutex{},
+		keys:     btree.NewOrderedG[string](memDegree),
+		data:     make(map[string]memEntry),
+		opts:     opts,
+		format:   opts.KeyFormat.orLegacy(),
+		log:      newLogger(opts.Log),
+		watchers: make(map[*watcher]struct{}),
+	}, nil
+}
+
+func (m *memStore) SetCtx(ctx context.Context, bucket, k []byte, v []byte) error {
+	newKey := m.format.Encode(bucket, k)
+	m.log.debug("Set", m.log.key("key", newKey), m.log.value("value", v))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publish()
+	if err := m.writable(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.put(string(newKey), v, 0, 0)
+	return nil
+}
+
+func (m *memStore) SetWithTTLCtx(ctx context.Context, bucket, k []byte, v []byte, ttl time.Duration) error {
+	newKey := m.format.Encode(bucket, k)
+	m.log.debug("SetWithTTL", m.log.key("key", newKey), m.log.value("value", v), slog.Duration("ttl", ttl))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publish()
+	if err := m.writable(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.put(string(newKey), v, ttlExpiresAt(ttl), 0)
+	return nil
+}
+
+func (m *memStore) GetCtx(ctx context.Context, bucket, k []byte) (result []byte, found bool, e error) {
+	newKey := m.format.Encode(bucket, k)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, false, StoreClosedError
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	entry, ok := m.get(string(newKey))
+	m.log.debug("Get", m.log.key("key", newKey), m.log.value("value", entry.value))
+	if !ok {
+		return nil, false, KeyNotFoundError
+	}
+	return copyBytes(entry.value), true, nil
+}
+
+func (m *memStore) PSetCtx(ctx context.Context, bucket []byte, keys, values [][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publish()
+	if err := m.writable(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		newKey := m.format.Encode(bucket, key)
+		m.log.debug("PSet", m.log.key("key", newKey), m.log.value("value", values[i]))
+		m.put(string(newKey), values[i], 0, 0)
+	}
+	return nil
+}
+
+func (m *memStore) PSetWithTTLCtx(ctx context.Context, bucket []byte, keys, values [][]byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publish()
+	if err := m.writable(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		newKey := m.format.Encode(bucket, key)
+		m.log.debug("PSetWithTTL", m.log.key("key", newKey), m.log.value("value", values[i]), slog.Duration("ttl", ttl))
+		m.put(string(newKey), values[i], ttlExpiresAt(ttl), 0)
+	}
+	return nil
+}
+
+func (m *memStore) TTLCtx(ctx context.Context, bucket, k []byte) (time.Duration, error) {
+	newKey := m.format.Encode(bucket, k)
+	m.log.debug("TTL", m.log.key("key", newKey))
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return 0, StoreClosedError
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	e, ok := m.get(string(newKey))
+	if !ok {
+		return 0, KeyNotFoundError
+	}
+	return remaining(e.expiresAt), nil
+}
+
+func (m *memStore) PersistCtx(ctx context.Context, bucket, k []byte) error {
+	newKey := m.format.Encode(bucket, k)
+	m.log.debug("Persist", m.log.key("key", newKey))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publish()
+	if err := m.writable(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	e, ok := m.get(string(newKey))
+	if !ok {
+		return KeyNotFoundError
+	}
+	m.put(string(newKey), e.value, 0, e.meta)
+	return nil
+}
+
+func (m *memStore) PGetCtx(ctx context.Context, bucket []byte, keys [][]byte) ([][]byte, error) {
+	var values = make([][]byte, len(keys))
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return values, StoreClosedError
+	}
+	for i, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return values, err
+		}
+		newKey := m.format.Encode(bucket, key)
+		e, ok := m.get(string(newKey))
+		if !ok {
+			m.log.debug("PGet", m.log.key("key", newKey), slog.Any("error", KeyNotFoundError))
+			return values, KeyNotFoundError
+		}
+		values[i] = copyBytes(e.value)
+		m.log.debug("PGet", m.log.key("key", newKey), m.log.value("value", values[i]))
+	}
+	return values, nil
+}
+
+func (m *memStore) CompareAndSwapCtx(ctx context.Context, bucket, k, expected, v []byte) error {
+	m.log.debug("CompareAndSwap", m.log.key("key", m.format.Encode(bucket, k)), m.log.value("expected", expected), m.log.value("value", v))
+	return compareAndSwap(m.updater(ctx), bucket, k, expected, v)
+}
+
+func (m *memStore) SetIfAbsentCtx(ctx context.Context, bucket, k, v []byte) error {
+	m.log.debug("SetIfAbsent", m.log.key("key", m.format.Encode(bucket, k)), m.log.value("value", v))
+	return setIfAbsent(m.updater(ctx), bucket, k, v)
+}
+
+func (m *memStore) DeleteIfEqualsCtx(ctx context.Context, bucket, k, expected []byte) error {
+	m.log.debug("DeleteIfEquals", m.log.key("key", m.format.Encode(bucket, k)), m.log.value("expected", expected))
+	return deleteIfEquals(m.updater(ctx), bucket, k, expected)
+}
+
+func (m *memStore) IncrCtx(ctx context.Context, bucket, k []byte, delta int64) (int64, error) {
+	m.log.debug("Incr", m.log.key("key", m.format.Encode(bucket, k)), slog.Int64("delta", delta))
+	return incr(m.updater(ctx), bucket, k, delta)
+}
+
+func (m *memStore) SequenceCtx(ctx context.Context, bucket, name []byte, leaseSize uint64) (Sequence, error) {
+	m.log.debug("Sequence", m.log.key("key", m.format.Encode(bucket, name)))
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return newLeaseSequence(m.Update, bucket, name, leaseSize)
+}
+
+func (m *memStore) DeleteCtx(ctx context.Context, bucket, key []byte) error {
+	newKey := m.format.Encode(bucket, key)
+	m.log.debug("Delete", m.log.key("key", newKey))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publish()
+	if err := m.writable(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.remove(string(newKey))
+	return nil
+}
+
+func (m *memStore) DeleteKeysCtx(ctx context.Context, bucket []byte, keys [][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publish()
+	if err := m.writable(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		newKey := m.format.Encode(bucket, key)
+		m.log.debug("DeleteKeys", m.log.key("key", newKey))
+		m.remove(string(newKey))
+	}
+	return nil
+}
+
+func (m *memStore) KeysCtx(ctx context.Context, bucket, prefix []byte) (keys [][]byte, values [][]byte, err error) {
+	m.log.debug("Keys", m.log.key("bucket", bucket), m.log.key("prefix", prefix))
+	err = m.scan(ctx, bucket, prefix, func(userKey []byte, v []byte) {
+		keys = append(keys, userKey)
+		values = append(values, copyBytes(v))
+	})
+	return keys, values, err
+}
+
+func (m *memStore) KeyStringsCtx(ctx context.Context, bucket, prefix []byte) (keys []string, values [][]byte, err error) {
+	m.log.debug("KeyStrings", m.log.key("bucket", bucket), m.log.key("prefix", prefix))
+	err = m.scan(ctx, bucket, prefix, func(userKey []byte, v []byte) {
+		keys = append(keys, string(userKey))
+		values = append(values, copyBytes(v))
+	})
+	return keys, values, err
+}
+
+func (m *memStore) KeysWithoutValuesCtx(ctx context.Context, bucket, prefix []byte) (keys [][]byte, err error) {
+	m.log.debug("KeysWithoutValues", m.log.key("bucket", bucket), m.log.key("prefix", prefix))
+	err = m.scan(ctx, bucket, prefix, func(userKey []byte, _ []byte) {
+		keys = append(keys, userKey)
+	})
+	return keys, err
+}
+
+func (m *memStore) KeyStringsWithoutValuesCtx(ctx context.Context, bucket, prefix []byte) (keys []string, err error) {
+	m.log.debug("KeyStringsWithoutValues", m.log.key("bucket", bucket), m.log.key("prefix", prefix))
+	err = m.scan(ctx, bucket, prefix, func(userKey []byte, _ []byte) {
+		keys = append(keys, string(userKey))
+	})
+	return keys, err
+}
+
+func (m *memStore) RangeCtx(ctx context.Context, bucket []byte, opts RangeOptions) (RangePage, error) {
+	m.log.debug("Range", m.log.key("bucket", bucket), m.log.key("prefix", opts.Prefix))
+	return rangePage(ctx, func(bucket []byte, opts CursorOptions) (Cursor, error) {
+		return m.CursorCtx(ctx, bucket, opts)
+	}, bucket, opts)
+}
+
+func (m *memStore) Watch(ctx context.Context, bucket, prefix []byte) (<-chan Event, error) {
+	m.log.debug("Watch", m.log.key("bucket", bucket), m.log.key("prefix", prefix))
+	return m.watch(ctx, bucket, prefix, 0, false)
+}
+
+// WatchFrom a memory store keeps no history, it replays the live keys written after version and no deletes
+func (m *memStore) WatchFrom(ctx context.Context, bucket, prefix []byte, version uint64) (<-chan Event, error) {
+	m.log.debug("WatchFrom", m.log.key("bucket", bucket), m.log.key("prefix", prefix))
+	return m.watch(ctx, bucket, prefix, version, true)
+}
+
+func (m *memStore) watch(ctx context.Context, bucket, prefix []byte, version uint64, replay bool) (<-chan Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, StoreClosedError
+	}
+	w := newWatcher(m.format, bucket, prefix, m.version)
+	if replay {
+		var events []Event
+		p := string(w.prefix)
+		m.keys.AscendGreaterOrEqual(p, func(key string) bool {
+			if !strings.HasPrefix(key, p) {
+				return false
+			}
+			e := m.data[key]
+			if e.version > version && !expired(e.expiresAt) && w.match([]byte(key)) {
+				events = append(events, w.event(EventPut, []byte(key), e.value, e.expiresAt, e.version))
+			}
+			return true
+		})
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].Version < events[j].Version
+		})
+		w.push(events...)
+	}
+	m.watchers[w] = struct{}{}
+	go w.run(ctx, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.watchers, w)
+	})
+	return w.out, nil
+}
+
+func (m *memStore) BucketsCtx(ctx context.Context) ([][]byte, error) {
+	m.log.debug("Buckets")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, StoreClosedError
+	}
+	found := make(map[string]struct{})
+	var err error
+	// after a bucket is found the scan starts again after its keys
+	for from, more := "", true; more && err == nil; {
+		more = false
+		m.keys.AscendGreaterOrEqual(from, func(key string) bool {
+			if err = ctx.Err(); err != nil {
+				return false
+			}
+			if expired(m.data[key].expiresAt) {
+				return true
+			}
+			if next := addBucket(m.format, found, []byte(key)); next != nil {
+				from, more = string(next), true
+				return false
+			}
+			return true
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sortedBuckets(found), nil
+}
+
+func (m *memStore) AllKeysCtx(ctx context.Context, async func(key string, deletedOrExpired bool)) error {
+	m.log.debug("AllKeys")
+	return m.scanRaw(ctx, nil, func(key string, e memEntry) {
+		async(key, expired(e.expiresAt))
+	})
+}
+
+func (m *memStore) Close() error {
+	m.log.debug("Close")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	m.keys.Clear(false)
+	m.data = make(map[string]memEntry)
+	for w := range m.watchers {
+		w.close()
+	}
+	return nil
+}
+
+func (m *memStore) SyncCtx(ctx context.Context) error {
+	m.log.debug("Sync")
+	return nil
+}
+
+// GCCtx there is nothing to collect in memory
+func (m *memStore) GCCtx(ctx context.Context, discardRatio float64) (int, error) {
+	m.log.debug("GC")
+	return 0, nil
+}
+
+func (m *memStore) Stats() (Stats, error) {
+	m.log.debug("Stats")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return Stats{}, StoreClosedError
+	}
+	stats := Stats{
+		Engine:    EngineMemory,
+		KeyFormat: m.format,
+		ReadOnly:  m.opts.ReadOnly,
+	}
+	for key, e := range m.data {
+		if expired(e.expiresAt) {
+			continue
+		}
+		stats.Keys++
+		stats.LSMSize += int64(len(key))
+		stats.VLogSize += int64(len(e.value))
+	}
+	return stats, nil
+}
+
+func (m *memStore) Exec(f func(txn *badger.Txn) error) error {
+	m.log.debug("Exec")
+	return NotSupportedError
+}
+
+func (m *memStore) ReadOnly() bool {
+	return m.opts.ReadOnly
+}
+
+func (m *memStore) Path() []string {
+	return []string{}
+}
+
+func (m *memStore) KeyFormat() KeyFormat {
+	return m.format
+}
+
+// scan visit live keys with prefix in bucket in order until ctx is done, userKey has bucket removed
+func (m *memStore) scan(ctx context.Context, bucket, prefix []byte, visit func(userKey []byte, v []byte)) error {
+	if m.opts.LegacyPrefixes {
+		prefix = LegacyPrefix(bucket, prefix)
+	}
+	return m.scanRaw(ctx, m.format.scanPrefix(bucket, prefix), func(key string, e memEntry) {
+		if !expired(e.expiresAt) && m.format.inBucket(bucket, []byte(key)) {
+			visit(m.format.userKey(bucket, []byte(key)), e.value)
+		}
+	})
+}
+
+// scanRaw visit keys with prefix in order including expired ones until ctx is done, holding the read lock
+func (m *memStore) scanRaw(ctx context.Context, prefix []byte, visit func(key string, e memEntry)) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return StoreClosedError
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p := string(prefix)
+	var err error
+	m.keys.AscendGreaterOrEqual(p, func(key string) bool {
+		if !strings.HasPrefix(key, p) {
+			return false
+		}
+		if err = ctx.Err(); err != nil {
+			return false
+		}
+		visit(key, m.data[key])
+		return true
+	})
+	return err
+}
+
+// writable check store could be written, must hold the lock
+func (m *memStore) writable() error {
+	if m.closed {
+		return StoreClosedError
+	}
+	if m.opts.ReadOnly {
+		return ReadOnlyError
+	}
+	return nil
+}
+
+// get a live entry, must hold the lock
+func (m *memStore) get(key string) (memEntry, bool) {
+	e, ok := m.data[key]
+	if !ok || expired(e.expiresAt) {
+		return memEntry{}, false
+	}
+	return e, true
+}
+
+// put a copy of v in the next commit, must hold the write lock
+func (m *memStore) put(key string, v []byte, expiresAt uint64, meta byte) {
+	e := memEntry{value: copyBytes(v), expiresAt: expiresAt, version: m.version + 1, meta: meta}
+	m.store(key, e)
+	m.pending = append(m.pending, memChange{t: EventPut, key: key, entry: e})
+}
+
+// remove a key in the next commit, must hold the write lock
+func (m *memStore) remove(key string) {
+	m.unlink(key)
+	m.pending = append(m.pending, memChange{t: EventDelete, key: key, entry: memEntry{version: m.version + 1}})
+}
+
+// store an entry without a change, must hold the write lock
+func (m *memStore) store(key string, e memEntry) {
+	if _, ok := m.data[key]; !ok {
+		m.keys.ReplaceOrInsert(key)
+	}
+	m.data[key] = e
+}
+
+// unlink a key without a change, must hold the write lock
+func (m *memStore) unlink(key string) {
+	if _, ok := m.data[key]; !ok {
+		return
+	}
+	delete(m.data, key)
+	m.keys.Delete(key)
+}
+
+// publish pending changes as a commit to watchers, must hold the write lock
+func (m *memStore) publish() {
+	if len(m.pending) == 0 {
+		return
+	}
+	m.version++
+	// like a badger commit, the last change of a key in order of keys
+	sort.SliceStable(m.pending, func(i, j int) bool {
+		return m.pending[i].key < m.pending[j].key
+	})
+	for i, c := range m.pending {
+		if i+1 < len(m.pending) && m.pending[i+1].key == c.key {
+			continue
+		}
+		for w := range m.watchers {
+			if w.match([]byte(c.key)) {
+				w.push(w.event(c.t, []byte(c.key), c.entry.value, c.entry.expiresAt, c.entry.version))
+			}
+		}
+	}
+	m.pending = nil
+}
+
+// memCursor find its position again on each move, it sees writes made after it is opened
+type memCursor struct {
+	m     *memStore
+	r     cursorRange
+	opts  CursorOptions
+	key   string // engine key at the cursor
+	valid bool
+	count int
+}
+
+func (m *memStore) CursorCtx(ctx context.Context, bucket []byte, opts CursorOptions) (Cursor, error) {
+	m.log.debug("Cursor", m.log.key("bucket", bucket), m.log.key("prefix", opts.Prefix))
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, StoreClosedError
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &memCursor{
+		m:    m,
+		r:    newCursorRange(m.format, bucket, opts),
+		opts: opts,
+	}, nil
+}
+
+func (c *memCursor) Seek(key []byte) bool {
+	c.count = 1
+	ascending := !c.opts.Reverse
+	raw := c.r.seekKey(key)
+	if ascending {
+		if raw == nil || c.r.below(raw) {
+			raw = c.r.lower
+		}
+		return c.settle(string(raw), ascending, false)
+	}
+	if raw == nil || c.r.above(raw) {
+		if c.r.upper == nil {
+			return c.settle("", ascending, false)
+		}
+		return c.settle(string(c.r.upper), ascending, true)
+	}
+	return c.settle(string(raw), ascending, false)
+}
+
+func (c *memCursor) Next() bool {
+	if c.opts.Limit > 0 && c.count >= c.opts.Limit {
+		c.valid = false
+		return false
+	}
+	c.count++
+	return c.move(!c.opts.Reverse)
+}
+
+func (c *memCursor) Prev() bool {
+	c.count--
+	return c.move(c.opts.Reverse)
+}
+
+func (c *memCursor) move(ascending bool) bool {
+	if !c.valid {
+		return false
+	}
+	return c.settle(c.key, ascending, true)
+}
+
+// settle on the first visible key from raw in ascending or descending order.
+// Descending from "" starts at the last key
+func (c *memCursor) settle(raw string, ascending bool, skipEqual bool) bool {
+	c.m.mu.RLock()
+	defer c.m.mu.RUnlock()
+	c.valid = false
+	visit := func(key string) bool {
+		if skipEqual && key == raw {
+			return true
+		}
+		k := []byte(key)
+		if (ascending && c.r.above(k)) || (!ascending && c.r.below(k)) {
+			return false
+		}
+		if c.r.visible(k) && !expired(c.m.data[key].expiresAt) {
+			c.key, c.valid = key, true
+			return false
+		}
+		return true
+	}
+	switch {
+	case ascending:
+		c.m.keys.AscendGreaterOrEqual(raw, visit)
+	case raw == "":
+		c.m.keys.Descend(visit)
+	default:
+		c.m.keys.DescendLessOrEqual(raw, visit)
+	}
+	return c.valid
+}
+
+func (c *memCursor) Valid() bool {
+	return c.valid
+}
+
+func (c *memCursor) Key() []byte {
+	if !c.valid {
+		return nil
+	}
+	return c.r.format.userKey(c.r.bucket, []byte(c.key))
+}
+
+func (c *memCursor) Value() ([]byte, error) {
+	if !c.valid {
+		return nil, KeyNotFoundError
+	}
+	c.m.mu.RLock()
+	defer c.m.mu.RUnlock()
+	e, ok := c.m.get(c.key)
+	if !ok {
+		return nil, KeyNotFoundError
+	}
+	return copyBytes(e.value), nil
+}
+
+func (c *memCursor) ExpiresAt() uint64 {
+	if !c.valid {
+		return 0
+	}
+	c.m.mu.RLock()
+	defer c.m.mu.RUnlock()
+	return c.m.data[c.key].expiresAt
+}
+
+func (c *memCursor) UserMeta() byte {
+	if !c.valid {
+		return 0
+	}
+	c.m.mu.RLock()
+	defer c.m.mu.RUnlock()
+	return c.m.data[c.key].meta
+}
+
+func (c *memCursor) Close() error {
+	c.valid = false
+	return nil
+}
+
+// memTxn holds the lock of the store until it ends, it keeps old entries to roll back
+type memTxn struct {
+	ctx      context.Context // Scan checks it
+	m        *memStore
+	readOnly bool
+	undo     map[string]*memEntry // nil if the key did not exist
+}
+
+// Update hold the write lock while f runs, f must not call the store
+func (m *memStore) UpdateCtx(ctx context.Context, f func(txn Txn) error) error {
+	m.log.debug("Update")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publish()
+	if err := m.writable(); err != nil {
+		return err
+	}
+	t := &memTxn{ctx: ctx, m: m, undo: make(map[string]*memEntry)}
+	if err := ctxTxn(ctx, f)(t); err != nil {
+		t.rollback()
+		return err
+	}
+	return nil
+}
+
+// View hold the read lock while f runs, f must not write the store
+func (m *memStore) ViewCtx(ctx context.Context, f func(txn Txn) error) error {
+	m.log.debug("View")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return StoreClosedError
+	}
+	return ctxTxn(ctx, f)(&memTxn{ctx: ctx, m: m, readOnly: true})
+}
+
+// BatchCtx is atomic in memory, there is no size limit
+func (m *memStore) BatchCtx(ctx context.Context, f func(txn Txn) error) error {
+	m.log.debug("Batch")
+	return m.UpdateCtx(ctx, f)
+}
+
+func (t *memTxn) Get(bucket, k []byte) ([]byte, error) {
+	e, ok := t.m.get(string(t.m.format.Encode(bucket, k)))
+	if !ok {
+		return nil, KeyNotFoundError
+	}
+	return copyBytes(e.value), nil
+}
+
+func (t *memTxn) Set(bucket, k, v []byte) error {
+	return t.SetWithTTL(bucket, k, v, 0)
+}
+
+func (t *memTxn) SetWithTTL(bucket, k, v []byte, ttl time.Duration) error {
+	return t.SetWithMeta(bucket, k, v, 0, ttl)
+}
+
+func (t *memTxn) SetWithMeta(bucket, k, v []byte, meta byte, ttl time.Duration) error {
+	newKey := string(t.m.format.Encode(bucket, k))
+	if err := t.save(newKey); err != nil {
+		return err
+	}
+	t.m.put(newKey, v, ttlExpiresAt(ttl), meta)
+	return nil
+}
+
+func (t *memTxn) SetWithExpiresAt(bucket, k, v []byte, expiresAt uint64) error {
+	newKey := string(t.m.format.Encode(bucket, k))
+	if err := t.save(newKey); err != nil {
+		return err
+	}
+	t.m.put(newKey, v, expiresAt, 0)
+	return nil
+}
+
+func (t *memTxn) Delete(bucket, k []byte) error {
+	newKey := string(t.m.format.Encode(bucket, k))
+	if err := t.save(newKey); err != nil {
+		return err
+	}
+	t.m.remove(newKey)
+	return nil
+}
+
+func (t *memTxn) Scan(bucket, prefix []byte, visit func(k, v []byte) error) error {
+	scanPrefix := string(append(t.m.format.BucketPrefix(bucket), prefix...))
+	var keys []string // visit may write, keys are collected first
+	t.m.keys.AscendGreaterOrEqual(scanPrefix, func(key string) bool {
+		if !strings.HasPrefix(key, scanPrefix) {
+			return false
+		}
+		keys = append(keys, key)
+		return true
+	})
+	for _, key := range keys {
+		if err := t.ctx.Err(); err != nil {
+			return err
+		}
+		e, ok := t.m.get(key)
+		if !ok || !t.m.format.inBucket(bucket, []byte(key)) {
+			continue
+		}
+		if err := visit(t.m.format.userKey(bucket, []byte(key)), copyBytes(e.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save the entry of key before its first write
+func (t *memTxn) save(key string) error {
+	if t.readOnly {
+		return ReadOnlyError
+	}
+	if _, saved := t.undo[key]; saved {
+		return nil
+	}
+	if e, ok := t.m.data[key]; ok {
+		t.undo[key] = &e
+	} else {
+		t.undo[key] = nil
+	}
+	return nil
+}
+
+// rollback every write of the transaction, watchers never see them
+func (t *memTxn) rollback() {
+	for key, e := range t.undo {
+		if e == nil {
+			t.m.unlink(key)
+		} else {
+			t.m.store(key, *e)
+		}
+	}
+	t.m.pending = nil
+}
@@ -0,0 +1,182 @@
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func newMemoryStore(t *testing.T) KvStore {
+	s, err := NewMemoryStore(Options{})
+	assert.True(t, err == nil)
+	return s
+}
+
+// test set get
+func Test_memStore_SetAndGet(t *testing.T) {
+	s := newMemoryStore(t)
+
+	key := "tiger"
+	value := []byte("i-like-kv")
+	assert.True(t, s.Set(TestBucket, []byte(key), value) == nil)
+
+	// value should be copied on set
+	value[0] = 'I'
+
+	if val, f, err := s.Get(TestBucket, []byte(key)); err != nil {
+		t.Fatalf("get error. bucket=%s, key=%s, %v", TestBucket, key, err)
+	} else if !f {
+		t.Fatalf("key not exist, should be there. bucket=%s, key=%s", TestBucket, key)
+	} else if string(val) != "i-like-kv" {
+		t.Fatalf("value should be same but not bucket=%s, key=%s, get-value=%s", TestBucket, key, string(val))
+	}
+
+	if val, f, err := s.Get(TestBucket, []byte("lion")); !errors.Is(err, KeyNotFoundError) || f || val != nil {
+		t.Fatalf("get a key not set should return not found. found=%v, %v", f, err)
+	}
+}
+
+// test p set, p get, delete keys
+func Test_memStore_PSetAndPGetAndDeleteKeys(t *testing.T) {
+	s := newMemoryStore(t)
+
+	var keys [][]byte
+	var values [][]byte
+	for i := 0; i < 100; i++ {
+		keys = append(keys, []byte("tiger-"+strconv.Itoa(i)))
+		values = append(values, []byte("i-like-kv-"+strconv.Itoa(i)))
+	}
+	assert.True(t, s.PSet(TestBucket, keys, values) == nil)
+
+	if val, err := s.PGet(TestBucket, keys); err != nil {
+		t.Fatalf("pget error. bucket=%s, %v", TestBucket, err)
+	} else {
+		for i := range keys {
+			assert.Equal(t, string(values[i]), string(val[i]))
+		}
+	}
+
+	assert.True(t, s.DeleteKeys(TestBucket, keys[20:40]) == nil)
+	for i := range keys {
+		_, f, err := s.Get(TestBucket, keys[i])
+		if i >= 20 && i < 40 {
+			assert.True(t, errors.Is(err, KeyNotFoundError) && !f)
+		} else {
+			assert.True(t, err == nil && f)
+		}
+	}
+
+	_, err := s.PGet(TestBucket, keys)
+	assert.True(t, errors.Is(err, KeyNotFoundError))
+
+	assert.True(t, s.Delete(TestBucket, keys[0]) == nil)
+	_, _, err = s.Get(TestBucket, keys[0])
+	assert.True(t, errors.Is(err, KeyNotFoundError))
+}
+
+// test read only and closed store reject writes
+func Test_memStore_ReadOnlyAndClose(t *testing.T) {
+	s, err := NewMemoryStore(Options{ReadOnly: true})
+	assert.True(t, err == nil)
+	assert.True(t, s.ReadOnly())
+	assert.True(t, errors.Is(s.Set(TestBucket, []byte("k"), []byte("v")), ReadOnlyError))
+
+	s = newMemoryStore(t)
+	assert.True(t, s.Set(TestBucket, []byte("k"), []byte("v")) == nil)
+	assert.True(t, s.Close() == nil)
+	assert.True(t, s.Close() == nil)
+	assert.True(t, errors.Is(s.Set(TestBucket, []byte("k"), []byte("v")), StoreClosedError))
+	_, _, err = s.Get(TestBucket, []byte("k"))
+	assert.True(t, errors.Is(err, StoreClosedError))
+}
+
+// test memory store returns the same scan results as badger store
+func Test_memStore_SameAsBadger(t *testing.T) {
+	var dir = getDataPath()
+	t.Logf("data path %s", dir)
+	b, err := NewBadgerStore(badger.DefaultOptions(dir))
+	defer func() {
+		_ = b.Close()
+		_ = os.RemoveAll(dir)
+	}()
+	assert.True(t, err == nil)
+	// prefixes starting with the bucket are taken like NewBadgerStore takes them
+	m, err := NewMemoryStore(Options{LegacyPrefixes: true})
+	assert.True(t, err == nil)
+
+	buckets := [][]byte{TestBucket, []byte("test"), []byte("other")}
+	for _, s := range []KvStore{b, m} {
+		for _, bucket := range buckets {
+			for i := 0; i < 20; i++ {
+				k := []byte("tiger-" + strconv.Itoa(i))
+				assert.True(t, s.Set(bucket, k, append([]byte("v-"), k...)) == nil)
+			}
+		}
+		assert.True(t, s.DeleteKeys(TestBucket, [][]byte{[]byte("tiger-3"), []byte("tiger-13")}) == nil)
+	}
+
+	prefixes := [][]byte{
+		nil,
+		[]byte("test"),
+		TestBucket,
+		BuildKey(len(TestBucket)+len("tiger-1"), TestBucket, []byte("tiger-1")),
+	}
+	for _, prefix := range prefixes {
+		bKeys, bValues, err := b.Keys(TestBucket, prefix)
+		assert.True(t, err == nil)
+		mKeys, mValues, err := m.Keys(TestBucket, prefix)
+		assert.True(t, err == nil)
+		assert.Equal(t, bKeys, mKeys, "prefix %s", prefix)
+		assert.Equal(t, bValues, mValues, "prefix %s", prefix)
+
+		bStrings, err := b.KeyStringsWithoutValues(TestBucket, prefix)
+		assert.True(t, err == nil)
+		mStrings, err := m.KeyStringsWithoutValues(TestBucket, prefix)
+		assert.True(t, err == nil)
+		assert.Equal(t, bStrings, mStrings, "prefix %s", prefix)
+	}
+
+	var bAll, mAll []string
+	assert.True(t, b.AllKeys(func(key string, deletedOrExpired bool) {
+		if !deletedOrExpired {
+			bAll = append(bAll, key)
+		}
+	}) == nil)
+	assert.True(t, m.AllKeys(func(key string, deletedOrExpired bool) {
+		mAll = append(mAll, key)
+	}) == nil)
+	sort.Strings(bAll)
+	assert.Equal(t, bAll, mAll)
+}
+
+// test keys written in any order are kept in order
+func Test_memStore_Order(t *testing.T) {
+	s := newMemoryStore(t)
+	var keys, values [][]byte
+	for _, i := range rand.Perm(2000) {
+		keys = append(keys, []byte(fmt.Sprintf("k%04d", i)))
+		values = append(values, []byte(strconv.Itoa(i)))
+	}
+	assert.True(t, s.PSet(TestBucket, keys, values) == nil)
+	assert.True(t, s.DeleteKeys(TestBucket, keys[:1000]) == nil)
+
+	got, err := s.KeyStringsWithoutValues(TestBucket, nil)
+	assert.True(t, err == nil)
+	assert.Equal(t, 1000, len(got))
+	assert.True(t, sort.StringsAreSorted(got))
+
+	c, err := s.Cursor(TestBucket, CursorOptions{Reverse: true})
+	assert.True(t, err == nil)
+	var reversed []string
+	for ok := c.Seek(nil); ok; ok = c.Next() {
+		reversed = append(reversed, string(c.Key()))
+	}
+	assert.Equal(t, len(got), len(reversed))
+	assert.Equal(t, got[0], reversed[len(reversed)-1])
+}
@@ -0,0 +1,141 @@
+// Package metrics counts calls of a KvStore, their errors, latency and bytes, and serves them with sizes of
+// the store in the Prometheus text format. It has no dependency on a Prometheus client.
+//
+//	store := metrics.New(local, metrics.Options{Name: "meta"})
+//	http.Handle("/metrics", metrics.Handler(store))
+package metrics
+
+import (
+	"bufio"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// DefaultBuckets upper bounds in seconds of the histogram of latency
+	DefaultBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+	// ScanBuckets upper bounds of the histogram of keys returned by a scan
+	ScanBuckets = []float64{0, 1, 10, 100, 1000, 10000, 100000}
+)
+
+// histogram counts of values up to each bound, a value goes to the first bound it does not exceed
+type histogram struct {
+	bounds []float64
+
+	lock   sync.Mutex
+	counts []uint64 // one more than bounds for +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	bounds = append([]float64(nil), bounds...)
+	sort.Float64s(bounds)
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// samples of the histogram, buckets are cumulative like Prometheus
+func (h *histogram) samples(f *family, labels []string) {
+	h.lock.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, count := h.sum, h.count
+	h.lock.Unlock()
+
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += counts[i]
+		f.add("_bucket", float64(cumulative), append(labels, "le", formatFloat(bound))...)
+	}
+	f.add("_bucket", float64(count), append(labels, "le", "+Inf")...)
+	f.add("_sum", sum, labels...)
+	f.add("_count", float64(count), labels...)
+}
+
+// family samples of a metric with its help and type
+type family struct {
+	name string
+	help string
+	typ  string
+	rows []string
+}
+
+// add a sample of the family, suffix is appended to the name, labels are pairs of names and values
+func (f *family) add(suffix string, v float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(f.name)
+	b.WriteString(suffix)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i])
+			b.WriteString(`="`)
+			b.WriteString(escape(labels[i+1]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(v))
+	f.rows = append(f.rows, b.String())
+}
+
+// write families in the text format, samples of families of the same name are written together
+func write(w *bufio.Writer, families []*family) error {
+	var names []string
+	merged := make(map[string]*family)
+	for _, f := range families {
+		m, ok := merged[f.name]
+		if !ok {
+			m = &family{name: f.name, help: f.help, typ: f.typ}
+			merged[f.name] = m
+			names = append(names, f.name)
+		}
+		m.rows = append(m.rows, f.rows...)
+	}
+	for _, name := range names {
+		f := merged[name]
+		if len(f.rows) == 0 {
+			continue
+		}
+		w.WriteString("# HELP " + f.name + " " + f.help + "\n")
+		w.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+		for _, row := range f.rows {
+			w.WriteString(row)
+			w.WriteByte('\n')
+		}
+	}
+	return w.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escape a label value
+func escape(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
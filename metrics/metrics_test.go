@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// test buckets of a histogram are cumulative
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]float64{1, 0.1})
+	for _, v := range []float64{0.05, 0.1, 0.5, 2} {
+		h.observe(v)
+	}
+	f := &family{name: "latency"}
+	h.samples(f, []string{"method", "Get"})
+	assert.Equal(t, []string{
+		`latency_bucket{method="Get",le="0.1"} 2`,
+		`latency_bucket{method="Get",le="1"} 3`,
+		`latency_bucket{method="Get",le="+Inf"} 4`,
+		`latency_sum{method="Get"} 2.65`,
+		`latency_count{method="Get"} 4`,
+	}, f.rows)
+}
+
+// test families of the same name are written once with their samples together
+func TestWrite(t *testing.T) {
+	a := &family{name: "calls_total", help: "Calls.", typ: "counter"}
+	a.add("", 1, "store", "a")
+	b := &family{name: "calls_total", help: "Calls.", typ: "counter"}
+	b.add("", 2, "store", "b\"\n\\")
+	empty := &family{name: "empty", help: "Nothing.", typ: "gauge"}
+	g := &family{name: "size", help: "Size.", typ: "gauge"}
+	g.add("", math.Inf(1))
+
+	var buf bytes.Buffer
+	assert.True(t, write(bufio.NewWriter(&buf), []*family{a, empty, g, b}) == nil)
+	assert.Equal(t, `# HELP calls_total Calls.
+# TYPE calls_total counter
+calls_total{store="a"} 1
+calls_total{store="b\"\n\\"} 2
+# HELP size Size.
+# TYPE size gauge
+size +Inf
+`, buf.String())
+}
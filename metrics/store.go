@@ -0,0 +1,565 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	kvstore "github.com/gmqio/kv-store"
+	"io"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Options of the metrics of a store
+type Options struct {
+	// Name value of the store label, it tells stores of one Handler apart
+	Name string
+
+	// Buckets upper bounds in seconds of the histogram of latency, nil for DefaultBuckets
+	Buckets []float64
+}
+
+// Store counts calls of a store, KeyNotFoundError is not counted as an error
+type Store struct {
+	kvstore.KvStore
+	name    string
+	methods map[string]*method // every method, fixed by New
+}
+
+var _ kvstore.KvStore = (*Store)(nil)
+
+// method metrics of a method of KvStore
+type method struct {
+	calls   atomic.Uint64
+	errors  atomic.Uint64
+	read    atomic.Uint64 // bytes of keys and values returned
+	written atomic.Uint64 // bytes of keys and values given
+	latency *histogram
+	scanned *histogram // keys returned by a scan, nil for other methods
+}
+
+// methods of KvStore counted, scans have a histogram of keys returned
+var methods = map[string]bool{
+	"Set": false, "Get": false, "SetWithTTL": false, "PSet": false, "PSetWithTTL": false, "TTL": false,
+	"Persist": false, "PGet": false, "CompareAndSwap": false, "SetIfAbsent": false, "Incr": false,
+	"Sequence": false, "Delete": false, "DeleteIfEquals": false, "DeleteKeys": false,
+	"Keys": true, "KeyStrings": true, "KeysWithoutValues": true, "KeyStringsWithoutValues": true,
+	"Cursor": true, "Range": true, "Watch": false, "WatchFrom": false, "Buckets": true, "AllKeys": true,
+	"Sync": false, "GC": false, "Backup": false, "Restore": false, "Update": false, "View": false,
+	"Batch": false, "Exec": false,
+}
+
+// New count calls of store
+func New(store kvstore.KvStore, opts Options) *Store {
+	if opts.Buckets == nil {
+		opts.Buckets = DefaultBuckets
+	}
+	s := &Store{KvStore: store, name: opts.Name, methods: make(map[string]*method)}
+	for name, scan := range methods {
+		m := &method{latency: newHistogram(opts.Buckets)}
+		if scan {
+			m.scanned = newHistogram(ScanBuckets)
+		}
+		s.methods[name] = m
+	}
+	return s
+}
+
+// Unwrap the store counted
+func (s *Store) Unwrap() kvstore.KvStore {
+	return s.KvStore
+}
+
+// Handler serve metrics of stores in the Prometheus text format
+func Handler(stores ...*Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = Write(w, stores...)
+	})
+}
+
+// Write metrics of stores in the Prometheus text format
+func Write(w io.Writer, stores ...*Store) error {
+	var families []*family
+	for _, s := range stores {
+		families = append(families, s.families()...)
+	}
+	return write(bufio.NewWriter(w), families)
+}
+
+// families of the store, methods never called are left out. Sizes come from Stats of the store when it is open
+func (s *Store) families() []*family {
+	calls := &family{name: "kvstore_calls_total", help: "Calls of a method of the store.", typ: "counter"}
+	errs := &family{name: "kvstore_errors_total", help: "Calls of a method of the store returning an error other than key not found.", typ: "counter"}
+	read := &family{name: "kvstore_read_bytes_total", help: "Bytes of keys and values returned by a method.", typ: "counter"}
+	written := &family{name: "kvstore_written_bytes_total", help: "Bytes of keys and values given to a method.", typ: "counter"}
+	latency := &family{name: "kvstore_call_duration_seconds", help: "Latency of calls of a method.", typ: "histogram"}
+	scanned := &family{name: "kvstore_scan_keys", help: "Keys returned by a scan.", typ: "histogram"}
+
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m := s.methods[name]
+		n := m.calls.Load()
+		if n == 0 {
+			continue
+		}
+		labels := []string{"store", s.name, "method", name}
+		calls.add("", float64(n), labels...)
+		errs.add("", float64(m.errors.Load()), labels...)
+		read.add("", float64(m.read.Load()), labels...)
+		written.add("", float64(m.written.Load()), labels...)
+		m.latency.samples(latency, labels)
+		if m.scanned != nil {
+			m.scanned.samples(scanned, labels)
+		}
+	}
+	families := []*family{calls, errs, read, written, latency, scanned}
+
+	stats, err := s.KvStore.Stats()
+	if err != nil {
+		return families
+	}
+	labels := []string{"store", s.name, "engine", stats.Engine}
+	for _, g := range []struct {
+		name string
+		help string
+		v    float64
+	}{
+		{"kvstore_keys", "Keys in tables of badger including versions and deletes, live keys in memory.", float64(stats.Keys)},
+		{"kvstore_tables", "LSM tables of badger.", float64(stats.Tables)},
+		{"kvstore_lsm_size_bytes", "Bytes of the LSM tree of badger, of keys and values in memory.", float64(stats.LSMSize)},
+		{"kvstore_vlog_size_bytes", "Bytes of value logs of badger.", float64(stats.VLogSize)},
+		{"kvstore_pending_compactions", "Levels of badger due for a compaction.", float64(stats.PendingCompactions)},
+	} {
+		f := &family{name: g.name, help: g.help, typ: "gauge"}
+		f.add("", g.v, labels...)
+		families = append(families, f)
+	}
+	return families
+}
+
+// done count a call of a method started at start
+func (s *Store) done(name string, start time.Time, err error, read, written int) {
+	m := s.methods[name]
+	m.latency.observe(time.Since(start).Seconds())
+	m.calls.Add(1)
+	if err != nil && !errors.Is(err, kvstore.KeyNotFoundError) {
+		m.errors.Add(1)
+	}
+	m.read.Add(uint64(read))
+	m.written.Add(uint64(written))
+}
+
+// scan count a call of a scan returning keys
+func (s *Store) scan(name string, start time.Time, err error, keys int, read int) {
+	s.done(name, start, err, read, 0)
+	if err == nil {
+		s.methods[name].scanned.observe(float64(keys))
+	}
+}
+
+// size bytes of slices
+func size(slices ...[]byte) int {
+	n := 0
+	for _, b := range slices {
+		n += len(b)
+	}
+	return n
+}
+
+// sizes bytes of lists of slices
+func sizes(lists ...[][]byte) int {
+	n := 0
+	for _, list := range lists {
+		n += size(list...)
+	}
+	return n
+}
+
+func (s *Store) Set(bucket, k []byte, v []byte) error {
+	start := time.Now()
+	err := s.KvStore.Set(bucket, k, v)
+	s.done("Set", start, err, 0, size(k, v))
+	return err
+}
+
+func (s *Store) Get(bucket, k []byte) (result []byte, found bool, e error) {
+	start := time.Now()
+	v, found, err := s.KvStore.Get(bucket, k)
+	s.done("Get", start, err, len(v), len(k))
+	return v, found, err
+}
+
+func (s *Store) SetWithTTL(bucket, k []byte, v []byte, ttl time.Duration) error {
+	start := time.Now()
+	err := s.KvStore.SetWithTTL(bucket, k, v, ttl)
+	s.done("SetWithTTL", start, err, 0, size(k, v))
+	return err
+}
+
+func (s *Store) PSet(bucket []byte, keys, values [][]byte) error {
+	start := time.Now()
+	err := s.KvStore.PSet(bucket, keys, values)
+	s.done("PSet", start, err, 0, sizes(keys, values))
+	return err
+}
+
+func (s *Store) PSetWithTTL(bucket []byte, keys, values [][]byte, ttl time.Duration) error {
+	start := time.Now()
+	err := s.KvStore.PSetWithTTL(bucket, keys, values, ttl)
+	s.done("PSetWithTTL", start, err, 0, sizes(keys, values))
+	return err
+}
+
+func (s *Store) TTL(bucket, k []byte) (time.Duration, error) {
+	start := time.Now()
+	ttl, err := s.KvStore.TTL(bucket, k)
+	s.done("TTL", start, err, 0, len(k))
+	return ttl, err
+}
+
+func (s *Store) Persist(bucket, k []byte) error {
+	start := time.Now()
+	err := s.KvStore.Persist(bucket, k)
+	s.done("Persist", start, err, 0, len(k))
+	return err
+}
+
+func (s *Store) PGet(bucket []byte, keys [][]byte) ([][]byte, error) {
+	start := time.Now()
+	values, err := s.KvStore.PGet(bucket, keys)
+	s.done("PGet", start, err, sizes(values), sizes(keys))
+	return values, err
+}
+
+func (s *Store) CompareAndSwap(bucket, k, expected, v []byte) error {
+	start := time.Now()
+	err := s.KvStore.CompareAndSwap(bucket, k, expected, v)
+	s.done("CompareAndSwap", start, err, 0, size(k, expected, v))
+	return err
+}
+
+func (s *Store) SetIfAbsent(bucket, k, v []byte) error {
+	start := time.Now()
+	err := s.KvStore.SetIfAbsent(bucket, k, v)
+	s.done("SetIfAbsent", start, err, 0, size(k, v))
+	return err
+}
+
+func (s *Store) Incr(bucket, k []byte, delta int64) (int64, error) {
+	start := time.Now()
+	n, err := s.KvStore.Incr(bucket, k, delta)
+	s.done("Incr", start, err, 0, len(k))
+	return n, err
+}
+
+func (s *Store) Sequence(bucket, name []byte, leaseSize uint64) (kvstore.Sequence, error) {
+	start := time.Now()
+	seq, err := s.KvStore.Sequence(bucket, name, leaseSize)
+	s.done("Sequence", start, err, 0, len(name))
+	return seq, err
+}
+
+func (s *Store) Delete(bucket, key []byte) error {
+	start := time.Now()
+	err := s.KvStore.Delete(bucket, key)
+	s.done("Delete", start, err, 0, len(key))
+	return err
+}
+
+func (s *Store) DeleteIfEquals(bucket, k, expected []byte) error {
+	start := time.Now()
+	err := s.KvStore.DeleteIfEquals(bucket, k, expected)
+	s.done("DeleteIfEquals", start, err, 0, size(k, expected))
+	return err
+}
+
+func (s *Store) DeleteKeys(bucket []byte, keys [][]byte) error {
+	start := time.Now()
+	err := s.KvStore.DeleteKeys(bucket, keys)
+	s.done("DeleteKeys", start, err, 0, sizes(keys))
+	return err
+}
+
+func (s *Store) Keys(bucket, prefix []byte) (keys [][]byte, values [][]byte, err error) {
+	start := time.Now()
+	keys, values, err = s.KvStore.Keys(bucket, prefix)
+	s.scan("Keys", start, err, len(keys), sizes(keys, values))
+	return keys, values, err
+}
+
+func (s *Store) KeyStrings(bucket, prefix []byte) (keys []string, values [][]byte, err error) {
+	start := time.Now()
+	keys, values, err = s.KvStore.KeyStrings(bucket, prefix)
+	n := sizes(values)
+	for _, k := range keys {
+		n += len(k)
+	}
+	s.scan("KeyStrings", start, err, len(keys), n)
+	return keys, values, err
+}
+
+func (s *Store) KeysWithoutValues(bucket, prefix []byte) (keys [][]byte, err error) {
+	start := time.Now()
+	keys, err = s.KvStore.KeysWithoutValues(bucket, prefix)
+	s.scan("KeysWithoutValues", start, err, len(keys), sizes(keys))
+	return keys, err
+}
+
+func (s *Store) KeyStringsWithoutValues(bucket, prefix []byte) (keys []string, err error) {
+	start := time.Now()
+	keys, err = s.KvStore.KeyStringsWithoutValues(bucket, prefix)
+	n := 0
+	for _, k := range keys {
+		n += len(k)
+	}
+	s.scan("KeyStringsWithoutValues", start, err, len(keys), n)
+	return keys, err
+}
+
+// Cursor the call is counted when the cursor is closed, with the keys it visited
+func (s *Store) Cursor(bucket []byte, opts kvstore.CursorOptions) (kvstore.Cursor, error) {
+	start := time.Now()
+	c, err := s.KvStore.Cursor(bucket, opts)
+	if err != nil {
+		s.scan("Cursor", start, err, 0, 0)
+		return nil, err
+	}
+	return &cursor{Cursor: c, s: s, start: start}, nil
+}
+
+func (s *Store) Range(bucket []byte, opts kvstore.RangeOptions) (kvstore.RangePage, error) {
+	start := time.Now()
+	page, err := s.KvStore.Range(bucket, opts)
+	s.scan("Range", start, err, len(page.Keys), sizes(page.Keys, page.Values))
+	return page, err
+}
+
+func (s *Store) Watch(ctx context.Context, bucket, prefix []byte) (<-chan kvstore.Event, error) {
+	start := time.Now()
+	ch, err := s.KvStore.Watch(ctx, bucket, prefix)
+	s.done("Watch", start, err, 0, 0)
+	return ch, err
+}
+
+func (s *Store) WatchFrom(ctx context.Context, bucket, prefix []byte, version uint64) (<-chan kvstore.Event, error) {
+	start := time.Now()
+	ch, err := s.KvStore.WatchFrom(ctx, bucket, prefix, version)
+	s.done("WatchFrom", start, err, 0, 0)
+	return ch, err
+}
+
+func (s *Store) Buckets() ([][]byte, error) {
+	start := time.Now()
+	buckets, err := s.KvStore.Buckets()
+	s.scan("Buckets", start, err, len(buckets), sizes(buckets))
+	return buckets, err
+}
+
+func (s *Store) AllKeys(async func(key string, deletedOrExpired bool)) error {
+	return s.AllKeysCtx(context.Background(), async)
+}
+
+// AllKeysCtx AllKeys stopped when ctx is done, kvstore.WithContext of the store uses it
+func (s *Store) AllKeysCtx(ctx context.Context, async func(key string, deletedOrExpired bool)) error {
+	start := time.Now()
+	keys, n := 0, 0
+	err := kvstore.WithContext(s.KvStore).AllKeysCtx(ctx, func(key string, deletedOrExpired bool) {
+		keys++
+		n += len(key)
+		async(key, deletedOrExpired)
+	})
+	s.scan("AllKeys", start, err, keys, n)
+	return err
+}
+
+func (s *Store) Sync() error {
+	start := time.Now()
+	err := s.KvStore.Sync()
+	s.done("Sync", start, err, 0, 0)
+	return err
+}
+
+func (s *Store) GC(discardRatio float64) (int, error) {
+	start := time.Now()
+	n, err := s.KvStore.GC(discardRatio)
+	s.done("GC", start, err, 0, 0)
+	return n, err
+}
+
+// Backup bytes of the backup are counted as read
+func (s *Store) Backup(w io.Writer, since uint64, buckets ...[]byte) (uint64, error) {
+	start := time.Now()
+	cw := &countWriter{w: w}
+	version, err := s.KvStore.Backup(cw, since, buckets...)
+	s.done("Backup", start, err, int(cw.n), 0)
+	return version, err
+}
+
+// Restore bytes of the backup are counted as written
+func (s *Store) Restore(r io.Reader) error {
+	start := time.Now()
+	cr := &countReader{r: r}
+	err := s.KvStore.Restore(cr)
+	s.done("Restore", start, err, 0, int(cr.n))
+	return err
+}
+
+func (s *Store) Update(f func(txn kvstore.Txn) error) error {
+	return s.txn("Update", s.KvStore.Update, f)
+}
+
+func (s *Store) View(f func(txn kvstore.Txn) error) error {
+	return s.txn("View", s.KvStore.View, f)
+}
+
+func (s *Store) Batch(f func(txn kvstore.Txn) error) error {
+	return s.txn("Batch", s.KvStore.Batch, f)
+}
+
+// txn count bytes of a transaction of run
+func (s *Store) txn(name string, run func(f func(txn kvstore.Txn) error) error, f func(txn kvstore.Txn) error) error {
+	start := time.Now()
+	var t *txn
+	err := run(func(inner kvstore.Txn) error {
+		// a retry counts the last run only
+		t = &txn{Txn: inner}
+		return f(t)
+	})
+	read, written := 0, 0
+	if t != nil {
+		read, written = t.read, t.written
+	}
+	s.done(name, start, err, read, written)
+	return err
+}
+
+func (s *Store) Exec(f func(txn *badger.Txn) error) error {
+	start := time.Now()
+	err := s.KvStore.Exec(f)
+	s.done("Exec", start, err, 0, 0)
+	return err
+}
+
+// txn counts bytes of a transaction
+type txn struct {
+	kvstore.Txn
+	read    int
+	written int
+}
+
+func (t *txn) Get(bucket, k []byte) ([]byte, error) {
+	v, err := t.Txn.Get(bucket, k)
+	t.read += len(v)
+	t.written += len(k)
+	return v, err
+}
+
+func (t *txn) Set(bucket, k, v []byte) error {
+	t.written += size(k, v)
+	return t.Txn.Set(bucket, k, v)
+}
+
+func (t *txn) SetWithTTL(bucket, k, v []byte, ttl time.Duration) error {
+	t.written += size(k, v)
+	return t.Txn.SetWithTTL(bucket, k, v, ttl)
+}
+
+func (t *txn) SetWithMeta(bucket, k, v []byte, meta byte, ttl time.Duration) error {
+	t.written += size(k, v)
+	return t.Txn.SetWithMeta(bucket, k, v, meta, ttl)
+}
+
+func (t *txn) SetWithExpiresAt(bucket, k, v []byte, expiresAt uint64) error {
+	t.written += size(k, v)
+	return t.Txn.SetWithExpiresAt(bucket, k, v, expiresAt)
+}
+
+func (t *txn) Delete(bucket, k []byte) error {
+	t.written += len(k)
+	return t.Txn.Delete(bucket, k)
+}
+
+func (t *txn) Scan(bucket, prefix []byte, visit func(k, v []byte) error) error {
+	return t.Txn.Scan(bucket, prefix, func(k, v []byte) error {
+		t.read += size(k, v)
+		return visit(k, v)
+	})
+}
+
+// cursor counts keys visited until it is closed
+type cursor struct {
+	kvstore.Cursor
+	s     *Store
+	start time.Time
+	keys  int
+	read  int
+}
+
+func (c *cursor) visit(ok bool) bool {
+	if ok {
+		c.keys++
+		c.read += len(c.Cursor.Key())
+	}
+	return ok
+}
+
+func (c *cursor) Seek(key []byte) bool {
+	return c.visit(c.Cursor.Seek(key))
+}
+
+func (c *cursor) Next() bool {
+	return c.visit(c.Cursor.Next())
+}
+
+func (c *cursor) Prev() bool {
+	return c.visit(c.Cursor.Prev())
+}
+
+func (c *cursor) Value() ([]byte, error) {
+	v, err := c.Cursor.Value()
+	c.read += len(v)
+	return v, err
+}
+
+func (c *cursor) Close() error {
+	err := c.Cursor.Close()
+	c.s.scan("Cursor", c.start, err, c.keys, c.read)
+	return err
+}
+
+// countWriter counts bytes written to w
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countReader counts bytes read from r
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
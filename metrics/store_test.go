@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/gmqio/kv-store/kvstoretest"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape metrics of stores
+func scrape(t *testing.T, stores ...*Store) string {
+	r := httptest.NewRecorder()
+	Handler(stores...).ServeHTTP(r, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.True(t, strings.HasPrefix(r.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+	return r.Body.String()
+}
+
+// test calls, errors, bytes and scans are counted
+func TestStore(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, store kvstore.KvStore) {
+		s := New(store, Options{Name: "meta"})
+		bucket := []byte("b")
+		assert.True(t, s.Set(bucket, []byte("a"), []byte("123")) == nil)
+		assert.True(t, s.Set(bucket, []byte("b"), []byte("4")) == nil)
+		_, _, _ = s.Get(bucket, []byte("a"))
+		_, _, err := s.Get(bucket, []byte("x"))
+		assert.True(t, errors.Is(err, kvstore.KeyNotFoundError))
+		_, err = s.Incr(bucket, []byte("a"), 1)
+		assert.True(t, err == nil)
+		assert.Equal(t, kvstore.PreconditionFailedError, s.SetIfAbsent(bucket, []byte("a"), nil))
+		keys, _, _ := s.Keys(bucket, nil)
+		assert.Equal(t, 2, len(keys))
+		assert.True(t, s.View(func(txn kvstore.Txn) error {
+			_, err := txn.Get(bucket, []byte("b"))
+			return err
+		}) == nil)
+		c, err := s.Cursor(bucket, kvstore.CursorOptions{})
+		assert.True(t, err == nil)
+		for ok := c.Seek(nil); ok; ok = c.Next() {
+		}
+		assert.True(t, c.Close() == nil)
+
+		out := scrape(t, s)
+		stats, err := store.Stats()
+		assert.True(t, err == nil)
+		for _, line := range []string{
+			`kvstore_calls_total{store="meta",method="Set"} 2`,
+			`kvstore_written_bytes_total{store="meta",method="Set"} 6`,
+			`kvstore_calls_total{store="meta",method="Get"} 2`,
+			`kvstore_errors_total{store="meta",method="Get"} 0`,
+			`kvstore_read_bytes_total{store="meta",method="Get"} 3`,
+			`kvstore_errors_total{store="meta",method="SetIfAbsent"} 1`,
+			`kvstore_read_bytes_total{store="meta",method="Keys"} 6`,
+			`kvstore_scan_keys_bucket{store="meta",method="Keys",le="1"} 0`,
+			`kvstore_scan_keys_bucket{store="meta",method="Keys",le="10"} 1`,
+			`kvstore_scan_keys_count{store="meta",method="Cursor"} 1`,
+			`kvstore_call_duration_seconds_count{store="meta",method="Incr"} 1`,
+			`kvstore_read_bytes_total{store="meta",method="View"} 1`,
+			fmt.Sprintf(`kvstore_keys{store="meta",engine=%q} %d`, stats.Engine, stats.Keys),
+			fmt.Sprintf(`kvstore_pending_compactions{store="meta",engine=%q} %d`, stats.Engine, stats.PendingCompactions),
+			"# TYPE kvstore_call_duration_seconds histogram",
+		} {
+			assert.Contains(t, out, line+"\n")
+		}
+		assert.NotContains(t, out, `method="Delete"`, "methods never called are left out")
+	})
+}
+
+// test AllKeys stops with the context given to kvstore.WithContext
+func TestStoreAllKeysCtx(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, store kvstore.KvStore) {
+		s := New(store, Options{Name: "meta"})
+		for _, k := range []string{"a", "b", "c"} {
+			assert.True(t, s.Set([]byte("b"), []byte(k), nil) == nil)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		n := 0
+		err := kvstore.WithContext(s).AllKeysCtx(ctx, func(key string, deletedOrExpired bool) {
+			n++
+			cancel()
+		})
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 1, n)
+		assert.Contains(t, scrape(t, s), `kvstore_calls_total{store="meta",method="AllKeys"} 1`+"\n")
+	})
+}
+
+// test one handler serves many stores, a closed store has no sizes
+func TestHandler(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, store kvstore.KvStore) {
+		a := New(store, Options{Name: "a"})
+		b := New(kvstoretest.Open(t, kvstore.EngineMemory, kvstore.Options{}), Options{Name: "b"})
+		_ = a.Sync()
+		_ = b.Sync()
+		assert.True(t, b.Close() == nil)
+		stats, err := store.Stats()
+		assert.True(t, err == nil)
+
+		out := scrape(t, a, b)
+		assert.Equal(t, 1, strings.Count(out, "# TYPE kvstore_calls_total counter"))
+		assert.Contains(t, out, `kvstore_calls_total{store="a",method="Sync"} 1`)
+		assert.Contains(t, out, `kvstore_calls_total{store="b",method="Sync"} 1`)
+		assert.Contains(t, out, fmt.Sprintf(`kvstore_keys{store="a",engine=%q} 0`, stats.Engine))
+		assert.NotContains(t, out, `kvstore_keys{store="b"`)
+
+		r := httptest.NewRecorder()
+		Handler(a).ServeHTTP(r, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, r.Code)
+	})
+}
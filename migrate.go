@@ -0,0 +1,106 @@
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"os"
+	"path/filepath"
+)
+
+// MigrateOptions options to migrate keys of a badger directory into another key format
+type MigrateOptions struct {
+	// To key format of the new directory
+	To KeyFormat
+
+	// Buckets known bucket names. A legacy key is split after the longest known bucket,
+	// so buckets with Split in their names are migrated correctly
+	Buckets [][]byte
+
+	// Logger badger logger of both directories, nil to disable
+	Logger badger.Logger
+}
+
+// MigrateKeyFormat copy every live key of the badger directory src into a new directory dst, re-encoding keys
+// into opts.To. Values, expiry and user meta are kept. src is not changed, it must not be opened by others.
+// Replace src with dst after it returns to finish the migration. It returns how many keys are copied
+func MigrateKeyFormat(src, dst string, opts MigrateOptions) (int, error) {
+	if opts.To == KeyFormatAuto {
+		return 0, fmt.Errorf("%w: migrate to %s", KeyFormatMismatchError, opts.To)
+	}
+	from, _, err := resolveKeyFormat(src, KeyFormatAuto)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(filepath.Join(dst, "MANIFEST")); err == nil {
+		return 0, fmt.Errorf("migrate to %s: directory is not empty", dst)
+	}
+
+	srcDB, err := badger.Open(badger.DefaultOptions(src).WithReadOnly(true).WithLogger(opts.Logger))
+	if err != nil {
+		return 0, err
+	}
+	defer srcDB.Close()
+	dstDB, err := badger.Open(badger.DefaultOptions(dst).WithLogger(opts.Logger))
+	if err != nil {
+		return 0, err
+	}
+	defer dstDB.Close()
+
+	count := 0
+	wb := dstDB.NewWriteBatch()
+	defer wb.Cancel()
+	err = srcDB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if item.IsDeletedOrExpired() {
+				continue
+			}
+			bucket, key, err := decodeKnown(from, item.Key(), opts.Buckets)
+			if err != nil {
+				return err
+			}
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			e := badger.NewEntry(opts.To.Encode(bucket, key), v).WithMeta(item.UserMeta())
+			e.ExpiresAt = item.ExpiresAt()
+			if err := wb.SetEntry(e); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	if err := wb.Flush(); err != nil {
+		return count, err
+	}
+	return count, WriteKeyFormat(dst, opts.To)
+}
+
+// decodeKnown decode raw, a legacy key is split after the longest bucket in buckets if any matches
+func decodeKnown(format KeyFormat, raw []byte, buckets [][]byte) (bucket, key []byte, err error) {
+	if format.orLegacy() == KeyFormatLegacy {
+		for _, b := range buckets {
+			prefix := format.BucketPrefix(b)
+			if len(b) > len(bucket) && len(prefix) > 0 && bytes.HasPrefix(raw, prefix) {
+				bucket, key = b, raw[len(prefix):]
+			}
+		}
+		if bucket != nil {
+			return bucket, key, nil
+		}
+	}
+	bucket, key, err = format.Decode(raw)
+	if errors.Is(err, BadKeyError) {
+		return nil, nil, fmt.Errorf("migrate from %s: %w", format, err)
+	}
+	return bucket, key, err
+}
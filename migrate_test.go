@@ -0,0 +1,70 @@
+package kvstore
+
+import (
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// test migrate a legacy directory into length prefixed keys
+func TestMigrateKeyFormat(t *testing.T) {
+	src := getDataPath()
+	dst := getDataPath()
+	t.Logf("data path %s, %s", src, dst)
+	defer func() {
+		_ = os.RemoveAll(src)
+		_ = os.RemoveAll(dst)
+	}()
+
+	s, err := NewBadgerStore(badger.DefaultOptions(src))
+	assert.True(t, err == nil)
+	var keys, values [][]byte
+	for i := 0; i < 100; i++ {
+		keys = append(keys, []byte("tiger-"+strconv.Itoa(i)))
+		values = append(values, []byte("i-like-kv-"+strconv.Itoa(i)))
+	}
+	assert.True(t, s.PSet(TestBucket, keys, values) == nil)
+	assert.True(t, s.Set([]byte("cluster@test"), []byte("broker"), []byte("at")) == nil)
+	assert.True(t, s.Exec(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(KeyFormatLegacy.Encode(TestBucket, []byte("ttl")), []byte("v")).WithTTL(time.Hour))
+	}) == nil)
+	assert.True(t, s.Delete(TestBucket, keys[0]) == nil)
+	assert.True(t, s.Close() == nil)
+
+	n, err := MigrateKeyFormat(src, dst, MigrateOptions{
+		To:      KeyFormatLengthPrefixed,
+		Buckets: [][]byte{TestBucket, []byte("cluster@test")},
+	})
+	assert.True(t, err == nil, "%v", err)
+	assert.Equal(t, 101, n)
+
+	s, err = NewBadgerStore(badger.DefaultOptions(dst))
+	assert.True(t, err == nil)
+	defer s.Close()
+	assert.Equal(t, KeyFormatLengthPrefixed, s.KeyFormat())
+
+	got, err := s.PGet(TestBucket, keys[1:])
+	assert.True(t, err == nil)
+	assert.Equal(t, values[1:], got)
+	_, f, _ := s.Get(TestBucket, keys[0])
+	assert.False(t, f)
+
+	v, _, err := s.Get([]byte("cluster@test"), []byte("broker"))
+	assert.True(t, err == nil)
+	assert.Equal(t, "at", string(v))
+
+	assert.True(t, s.Exec(func(txn *badger.Txn) error {
+		item, err := txn.Get(KeyFormatLengthPrefixed.Encode(TestBucket, []byte("ttl")))
+		if err == nil {
+			assert.True(t, item.ExpiresAt() > uint64(time.Now().Unix()))
+		}
+		return err
+	}) == nil)
+
+	// dst is not empty any more
+	_, err = MigrateKeyFormat(src, dst, MigrateOptions{To: KeyFormatLengthPrefixed})
+	assert.True(t, err != nil)
+}
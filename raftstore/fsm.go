@@ -0,0 +1,300 @@
+package raftstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/hashicorp/raft"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// MetaBucket bucket of the state machine keeping the index of the last command applied
+	MetaBucket = []byte("!raft")
+
+	BadCommandError = errors.New("bad raft command")
+)
+
+// appliedKey key in MetaBucket of the index of the last command applied
+var appliedKey = []byte("applied")
+
+// op a write proposed through the log
+type op byte
+
+const (
+	opSet op = iota + 1
+	opDelete
+	opPersist
+	opCompareAndSwap
+	opSetIfAbsent
+	opDeleteIfEquals
+	opIncr
+)
+
+// command a write of the log. values are the expected value then the new one for opCompareAndSwap, and the
+// expected value for opDeleteIfEquals
+type command struct {
+	op     op
+	bucket []byte
+	keys   [][]byte
+	values [][]byte
+
+	// expiresAt unix time in nanoseconds, 0 never expires. A deadline instead of a ttl so every node
+	// expires the key at the same time
+	expiresAt int64
+	delta     int64
+}
+
+// marshal op, expiresAt and delta then bucket, keys and values, each with its length
+func (c *command) marshal() []byte {
+	buf := []byte{byte(c.op)}
+	buf = binary.AppendVarint(buf, c.expiresAt)
+	buf = binary.AppendVarint(buf, c.delta)
+	buf = appendBytes(buf, c.bucket)
+	for _, list := range [][][]byte{c.keys, c.values} {
+		buf = binary.AppendUvarint(buf, uint64(len(list)))
+		for _, b := range list {
+			buf = appendBytes(buf, b)
+		}
+	}
+	return buf
+}
+
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// unmarshal a command of marshal, byte slices share buf
+func (c *command) unmarshal(buf []byte) error {
+	r := bytes.NewReader(buf)
+	t, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("%w: %v", BadCommandError, err)
+	}
+	c.op = op(t)
+	if c.expiresAt, err = binary.ReadVarint(r); err != nil {
+		return fmt.Errorf("%w: %v", BadCommandError, err)
+	}
+	if c.delta, err = binary.ReadVarint(r); err != nil {
+		return fmt.Errorf("%w: %v", BadCommandError, err)
+	}
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		start := len(buf) - r.Len()
+		_, _ = r.Seek(int64(n), io.SeekCurrent)
+		return buf[start : start+int(n) : start+int(n)], nil
+	}
+	if c.bucket, err = readBytes(); err != nil {
+		return fmt.Errorf("%w: %v", BadCommandError, err)
+	}
+	for _, list := range []*[][]byte{&c.keys, &c.values} {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("%w: %v", BadCommandError, err)
+		}
+		if n > uint64(r.Len()) {
+			return fmt.Errorf("%w: %d of %d bytes", BadCommandError, n, r.Len())
+		}
+		*list = make([][]byte, n)
+		for i := range *list {
+			if (*list)[i], err = readBytes(); err != nil {
+				return fmt.Errorf("%w: %v", BadCommandError, err)
+			}
+		}
+	}
+	return nil
+}
+
+// result of a command, n for opIncr
+type result struct {
+	n   int64
+	err error
+}
+
+// fsm applies commands to a local store. The index of the last command is written in the transaction of
+// the command, or after it when the command fails and writes nothing, so a snapshot taken while commands
+// are applied says which commands it has
+type fsm struct {
+	store kvstore.KvStore
+
+	lock    sync.Mutex
+	applied uint64
+}
+
+func newFSM(store kvstore.KvStore) (*fsm, error) {
+	f := &fsm{store: store}
+	return f, f.load()
+}
+
+// load the applied index of the store, must hold the lock or own f
+func (f *fsm) load() error {
+	v, _, err := f.store.Get(MetaBucket, appliedKey)
+	if errors.Is(err, kvstore.KeyNotFoundError) {
+		v, err = make([]byte, 8), nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(v) != 8 {
+		return fmt.Errorf("%w: applied index of %d bytes", BadCommandError, len(v))
+	}
+	f.applied = binary.BigEndian.Uint64(v)
+	return nil
+}
+
+// Apply a command unless the store already has it, the result is a result
+func (f *fsm) Apply(log *raft.Log) interface{} {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if log.Index <= f.applied {
+		return result{}
+	}
+	var c command
+	if err := c.unmarshal(log.Data); err != nil {
+		return result{err: err}
+	}
+	index := binary.BigEndian.AppendUint64(nil, log.Index)
+	var res result
+	err := f.store.Update(func(txn kvstore.Txn) error {
+		if res = c.apply(txn); res.err != nil {
+			return res.err
+		}
+		return txn.Set(MetaBucket, appliedKey, index)
+	})
+	if res.err != nil {
+		// a command failing aborts its writes, it is applied all the same
+		err = f.store.Set(MetaBucket, appliedKey, index)
+	}
+	if err != nil {
+		return result{err: err}
+	}
+	f.applied = log.Index
+	return res
+}
+
+// Snapshot of the store, it is written by Persist while commands go on
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	return snapshot{store: f.store}, nil
+}
+
+// Restore drop every key and load a snapshot, the log is applied after the commands the snapshot has
+func (f *fsm) Restore(r io.ReadCloser) error {
+	defer r.Close()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := kvstore.DropAll(f.store); err != nil {
+		return err
+	}
+	if err := f.store.Restore(r); err != nil {
+		return err
+	}
+	return f.load()
+}
+
+// snapshot a backup of the store
+type snapshot struct {
+	store kvstore.KvStore
+}
+
+func (s snapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := s.store.Backup(sink, 0); err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s snapshot) Release() {}
+
+// apply the command in txn, errors of the command are results and not errors of the transaction
+func (c *command) apply(txn kvstore.Txn) result {
+	switch c.op {
+	case opSet:
+		if len(c.keys) != len(c.values) {
+			return result{err: fmt.Errorf("%w: %d keys and %d values", BadCommandError, len(c.keys), len(c.values))}
+		}
+		for i, k := range c.keys {
+			if err := c.set(txn, k, c.values[i]); err != nil {
+				return result{err: err}
+			}
+		}
+		return result{}
+	case opDelete:
+		for _, k := range c.keys {
+			if err := txn.Delete(c.bucket, k); err != nil {
+				return result{err: err}
+			}
+		}
+		return result{}
+	}
+	if values := map[op]int{opCompareAndSwap: 2, opSetIfAbsent: 1, opDeleteIfEquals: 1}[c.op]; len(c.keys) != 1 || len(c.values) != values {
+		return result{err: fmt.Errorf("%w: %d keys and %d values for op %d", BadCommandError, len(c.keys), len(c.values), c.op)}
+	}
+	k := c.keys[0]
+	switch c.op {
+	case opPersist:
+		v, err := txn.Get(c.bucket, k)
+		if err != nil {
+			return result{err: err}
+		}
+		return result{err: txn.Set(c.bucket, k, v)}
+	case opCompareAndSwap, opDeleteIfEquals:
+		old, err := txn.Get(c.bucket, k)
+		if errors.Is(err, kvstore.KeyNotFoundError) || (err == nil && !bytes.Equal(old, c.values[0])) {
+			return result{err: kvstore.PreconditionFailedError}
+		}
+		if err != nil {
+			return result{err: err}
+		}
+		if c.op == opDeleteIfEquals {
+			return result{err: txn.Delete(c.bucket, k)}
+		}
+		return result{err: txn.Set(c.bucket, k, c.values[1])}
+	case opSetIfAbsent:
+		_, err := txn.Get(c.bucket, k)
+		if err == nil {
+			return result{err: kvstore.PreconditionFailedError}
+		}
+		if !errors.Is(err, kvstore.KeyNotFoundError) {
+			return result{err: err}
+		}
+		return result{err: txn.Set(c.bucket, k, c.values[0])}
+	case opIncr:
+		var n int64
+		v, err := txn.Get(c.bucket, k)
+		if err == nil {
+			if n, err = strconv.ParseInt(string(v), 10, 64); err != nil {
+				return result{err: fmt.Errorf("%w: %q", kvstore.NotIntegerError, v)}
+			}
+		} else if !errors.Is(err, kvstore.KeyNotFoundError) {
+			return result{err: err}
+		}
+		if (c.delta > 0 && n > math.MaxInt64-c.delta) || (c.delta < 0 && n < math.MinInt64-c.delta) {
+			return result{err: kvstore.NotIntegerError}
+		}
+		n += c.delta
+		return result{n: n, err: txn.Set(c.bucket, k, []byte(strconv.FormatInt(n, 10)))}
+	}
+	return result{err: fmt.Errorf("%w: op %d", BadCommandError, c.op)}
+}
+
+// set a key with the expiry of the command, not the clock of the node, so every node has the same key
+func (c *command) set(txn kvstore.Txn, k, v []byte) error {
+	if c.expiresAt == 0 {
+		return txn.Set(c.bucket, k, v)
+	}
+	return txn.SetWithExpiresAt(c.bucket, k, v, uint64(time.Unix(0, c.expiresAt).Unix()))
+}
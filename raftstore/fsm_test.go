@@ -0,0 +1,114 @@
+package raftstore
+
+import (
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newFSMStore(t *testing.T) *fsm {
+	s, err := kvstore.NewBadgerStore(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	assert.True(t, err == nil)
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	f, err := newFSM(s)
+	assert.True(t, err == nil)
+	return f
+}
+
+// test a command is the same after marshal and unmarshal
+func TestCommand(t *testing.T) {
+	c := command{
+		op:        opCompareAndSwap,
+		bucket:    []byte("meta"),
+		keys:      [][]byte{[]byte("a")},
+		values:    [][]byte{[]byte("1"), {}},
+		expiresAt: time.Now().UnixNano(),
+		delta:     -3,
+	}
+	var got command
+	assert.True(t, got.unmarshal(c.marshal()) == nil)
+	assert.Equal(t, c, got)
+
+	buf := c.marshal()
+	for i := 0; i < len(buf); i++ {
+		assert.True(t, errors.Is(got.unmarshal(buf[:i]), BadCommandError), "truncated at %d", i)
+	}
+	res := (&command{op: opIncr, bucket: []byte("meta")}).apply(nil)
+	assert.True(t, errors.Is(res.err, BadCommandError), "no key")
+}
+
+// test commands already in the store are skipped, after a snapshot taken while commands went on too
+func TestFSM(t *testing.T) {
+	f := newFSMStore(t)
+	incr := (&command{op: opIncr, bucket: []byte("meta"), keys: [][]byte{[]byte("n")}, delta: 1}).marshal()
+	for i := uint64(1); i <= 5; i++ {
+		res := f.Apply(&raft.Log{Index: i, Data: incr}).(result)
+		assert.True(t, res.err == nil)
+		assert.Equal(t, int64(i), res.n)
+	}
+	assert.Equal(t, result{}, f.Apply(&raft.Log{Index: 3, Data: incr}), "applied already")
+
+	snapshots := raft.NewInmemSnapshotStore()
+	sink, err := snapshots.Create(raft.SnapshotVersionMax, 3, 1, raft.Configuration{}, 1, nil)
+	assert.True(t, err == nil)
+	snapshot, _ := f.Snapshot()
+	assert.True(t, snapshot.Persist(sink) == nil)
+
+	// the snapshot of index 3 has the commands up to 5, a wrapped store drops its keys for it too
+	other, err := newFSM(kvstore.Wrap(newFSMStore(t).store))
+	assert.True(t, err == nil)
+	assert.True(t, other.store.Set([]byte("meta"), []byte("stale"), []byte("v")) == nil)
+	_, rc, err := snapshots.Open(sink.ID())
+	assert.True(t, err == nil)
+	assert.True(t, other.Restore(rc) == nil)
+	for i := uint64(4); i <= 6; i++ {
+		other.Apply(&raft.Log{Index: i, Data: incr})
+	}
+	v, _, err := other.store.Get([]byte("meta"), []byte("n"))
+	assert.True(t, err == nil)
+	assert.Equal(t, "6", string(v))
+	_, _, err = other.store.Get([]byte("meta"), []byte("stale"))
+	assert.True(t, errors.Is(err, kvstore.KeyNotFoundError))
+
+	// an expired key is not found
+	set := (&command{op: opSet, bucket: []byte("meta"), keys: [][]byte{[]byte("n")}, values: [][]byte{[]byte("v")},
+		expiresAt: time.Now().Add(-time.Second).UnixNano()}).marshal()
+	assert.Equal(t, result{}, other.Apply(&raft.Log{Index: 7, Data: set}))
+	_, _, err = other.store.Get([]byte("meta"), []byte("n"))
+	assert.True(t, errors.Is(err, kvstore.KeyNotFoundError))
+}
+
+// test a key expires at the time of its command, not by the clock of the node
+func TestFSMExpiresAt(t *testing.T) {
+	f := newFSMStore(t)
+	expiresAt := time.Now().Add(time.Hour).UnixNano()
+	set := (&command{op: opSet, bucket: []byte("meta"), keys: [][]byte{[]byte("a")}, values: [][]byte{[]byte("v")},
+		expiresAt: expiresAt}).marshal()
+	assert.Equal(t, result{}, f.Apply(&raft.Log{Index: 1, Data: set}))
+	c, err := f.store.Cursor([]byte("meta"), kvstore.CursorOptions{})
+	assert.True(t, err == nil)
+	assert.True(t, c.Seek(nil))
+	assert.Equal(t, uint64(time.Unix(0, expiresAt).Unix()), c.ExpiresAt())
+	assert.True(t, c.Close() == nil)
+}
+
+// test a command failing after some writes leaves none of them and is applied
+func TestFSMFailed(t *testing.T) {
+	f := newFSMStore(t)
+	set := (&command{op: opSet, bucket: []byte("meta"), keys: [][]byte{[]byte("a"), make([]byte, 1<<17)},
+		values: [][]byte{[]byte("1"), []byte("2")}}).marshal()
+	res := f.Apply(&raft.Log{Index: 1, Data: set}).(result)
+	assert.True(t, res.err != nil)
+	_, _, err := f.store.Get([]byte("meta"), []byte("a"))
+	assert.True(t, errors.Is(err, kvstore.KeyNotFoundError), "the first key is not written")
+
+	f.applied = 0
+	assert.True(t, f.load() == nil)
+	assert.Equal(t, uint64(1), f.applied)
+}
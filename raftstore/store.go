@@ -0,0 +1,481 @@
+// Package raftstore is a KvStore replicated by raft. Writes are proposed to the leader and applied to the
+// local store of every node in the order of the log, reads are served by the leader after a barrier so they
+// see every write committed before them.
+//
+//	local, _ := kvstore.Open(kvstore.EngineBadger, kvstore.Options{Dir: "/data/meta"})
+//	store, err := raftstore.New(local, raftstore.Options{ID: "node-1", Transport: transport})
+//	err = store.Bootstrap(raftstore.Member{ID: "node-1", Addr: "10.0.0.1:7000"}, ...)
+//
+// A write or a read on a follower fails with NotLeaderError telling the leader
+package raftstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/hashicorp/raft"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTimeout a write or a read waits for the log at most this long
+	DefaultTimeout = 5 * time.Second
+)
+
+var (
+	NotLeaderError = errors.New("not the raft leader")
+	TimeoutError   = errors.New("raft timeout")
+)
+
+// Options of a node, Transport is required. The log, stable and snapshot stores are in memory by default,
+// pass stores on disk for a node to restart with its log
+type Options struct {
+	// ID of the node, unique in the cluster
+	ID string
+
+	// Config of raft, nil for raft.DefaultConfig. LocalID is set to ID
+	Config *raft.Config
+
+	Transport   raft.Transport
+	LogStore    raft.LogStore
+	StableStore raft.StableStore
+	Snapshots   raft.SnapshotStore
+
+	// Timeout of writes and reads, 0 is DefaultTimeout
+	Timeout time.Duration
+}
+
+// Member a node of the cluster
+type Member struct {
+	ID   string
+	Addr string
+
+	// Voter a member voting in elections and for commits
+	Voter bool
+}
+
+// Store a KvStore replicated by raft, Sequence, Restore, Update, Batch and Exec are not supported.
+// Watch and WatchFrom deliver writes applied to the local store
+type Store struct {
+	local kvstore.KvStore
+	raft  *raft.Raft
+	fsm   *fsm
+	opts  Options
+
+	// reads waiting for the next barrier, one barrier is in flight at a time
+	lock       sync.Mutex
+	next       *barrier
+	barriering bool
+}
+
+var _ kvstore.KvStore = (*Store)(nil)
+
+// barrier reads waiting for a raft barrier proposed after they started
+type barrier struct {
+	done chan struct{}
+	err  error
+}
+
+// New start a node applying the log to local, it joins a cluster by Bootstrap or AddVoter of the leader.
+// local should be a store of Open and not be written by anything else
+func New(local kvstore.KvStore, opts Options) (*Store, error) {
+	if local.ReadOnly() {
+		return nil, kvstore.ReadOnlyError
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	config := raft.DefaultConfig()
+	if opts.Config != nil {
+		c := *opts.Config
+		config = &c
+	} else if kvstore.LogLevel.Level() > slog.LevelDebug {
+		config.LogLevel = "WARN"
+	}
+	config.LocalID = raft.ServerID(opts.ID)
+	if opts.LogStore == nil {
+		opts.LogStore = raft.NewInmemStore()
+	}
+	if opts.StableStore == nil {
+		opts.StableStore = raft.NewInmemStore()
+	}
+	if opts.Snapshots == nil {
+		opts.Snapshots = raft.NewInmemSnapshotStore()
+	}
+	f, err := newFSM(local)
+	if err != nil {
+		return nil, err
+	}
+	r, err := raft.NewRaft(config, f, opts.LogStore, opts.StableStore, opts.Snapshots, opts.Transport)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{local: local, raft: r, fsm: f, opts: opts}, nil
+}
+
+// Bootstrap the cluster with its first members on one of them, members are voters
+func (s *Store) Bootstrap(members ...Member) error {
+	var config raft.Configuration
+	for _, m := range members {
+		config.Servers = append(config.Servers, raft.Server{
+			Suffrage: raft.Voter,
+			ID:       raft.ServerID(m.ID),
+			Address:  raft.ServerAddress(m.Addr),
+		})
+	}
+	return s.error(s.raft.BootstrapCluster(config).Error())
+}
+
+// AddVoter add a member voting in elections or make a member a voter, on the leader
+func (s *Store) AddVoter(id, addr string) error {
+	return s.error(s.raft.AddVoter(raft.ServerID(id), raft.ServerAddress(addr), 0, s.opts.Timeout).Error())
+}
+
+// AddNonvoter add a member getting the log without voting, on the leader
+func (s *Store) AddNonvoter(id, addr string) error {
+	return s.error(s.raft.AddNonvoter(raft.ServerID(id), raft.ServerAddress(addr), 0, s.opts.Timeout).Error())
+}
+
+// RemoveMember remove a member from the cluster, on the leader
+func (s *Store) RemoveMember(id string) error {
+	return s.error(s.raft.RemoveServer(raft.ServerID(id), 0, s.opts.Timeout).Error())
+}
+
+// Members of the cluster as known by this node
+func (s *Store) Members() ([]Member, error) {
+	future := s.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, s.error(err)
+	}
+	var members []Member
+	for _, server := range future.Configuration().Servers {
+		members = append(members, Member{
+			ID:    string(server.ID),
+			Addr:  string(server.Address),
+			Voter: server.Suffrage == raft.Voter,
+		})
+	}
+	return members, nil
+}
+
+// Leader the member leading the cluster, empty if there is none now
+func (s *Store) Leader() Member {
+	addr, id := s.raft.LeaderWithID()
+	return Member{ID: string(id), Addr: string(addr), Voter: true}
+}
+
+// IsLeader check this node leads the cluster
+func (s *Store) IsLeader() bool {
+	return s.raft.State() == raft.Leader
+}
+
+// Applied index of the last write of the log applied to the local store
+func (s *Store) Applied() uint64 {
+	s.fsm.lock.Lock()
+	defer s.fsm.lock.Unlock()
+	return s.fsm.applied
+}
+
+// Snapshot the local store now so the log before it can be truncated
+func (s *Store) Snapshot() error {
+	return s.error(s.raft.Snapshot().Error())
+}
+
+// error of raft as an error of a store
+func (s *Store) error(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, raft.ErrNotLeader), errors.Is(err, raft.ErrLeadershipLost),
+		errors.Is(err, raft.ErrLeadershipTransferInProgress):
+		if leader := s.Leader(); leader.ID != "" {
+			return fmt.Errorf("%w: leader is %s at %s", NotLeaderError, leader.ID, leader.Addr)
+		}
+		return fmt.Errorf("%w: no leader", NotLeaderError)
+	case errors.Is(err, raft.ErrRaftShutdown):
+		return kvstore.StoreClosedError
+	case errors.Is(err, raft.ErrEnqueueTimeout):
+		return TimeoutError
+	}
+	return err
+}
+
+// propose a write and wait until it is applied on this node
+func (s *Store) propose(c *command) (int64, error) {
+	future := s.raft.Apply(c.marshal(), s.opts.Timeout)
+	if err := future.Error(); err != nil {
+		return 0, s.error(err)
+	}
+	res := future.Response().(result)
+	return res.n, res.err
+}
+
+// read wait until the local store has every write committed before the call. Reads share a barrier
+// proposed after they started
+func (s *Store) read() error {
+	s.lock.Lock()
+	if s.next == nil {
+		s.next = &barrier{done: make(chan struct{})}
+	}
+	b := s.next
+	if !s.barriering {
+		s.barriering = true
+		go s.barriers()
+	}
+	s.lock.Unlock()
+	<-b.done
+	return b.err
+}
+
+// barriers propose barriers while reads wait for one
+func (s *Store) barriers() {
+	for {
+		s.lock.Lock()
+		b := s.next
+		s.next = nil
+		if b == nil {
+			s.barriering = false
+			s.lock.Unlock()
+			return
+		}
+		s.lock.Unlock()
+		b.err = s.error(s.raft.Barrier(s.opts.Timeout).Error())
+		close(b.done)
+	}
+}
+
+// expiresAt the deadline of ttl in unix nanoseconds, 0 never expires
+func expiresAt(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(ttl).UnixNano()
+}
+
+func (s *Store) Set(bucket, k []byte, v []byte) error {
+	return s.SetWithTTL(bucket, k, v, 0)
+}
+
+func (s *Store) SetWithTTL(bucket, k []byte, v []byte, ttl time.Duration) error {
+	_, err := s.propose(&command{op: opSet, bucket: bucket, keys: [][]byte{k}, values: [][]byte{v}, expiresAt: expiresAt(ttl)})
+	return err
+}
+
+func (s *Store) PSet(bucket []byte, keys, values [][]byte) error {
+	return s.PSetWithTTL(bucket, keys, values, 0)
+}
+
+// PSetWithTTL the keys are set in one transaction of every local store, TxnTooBigError if they do not fit
+func (s *Store) PSetWithTTL(bucket []byte, keys, values [][]byte, ttl time.Duration) error {
+	_, err := s.propose(&command{op: opSet, bucket: bucket, keys: keys, values: values, expiresAt: expiresAt(ttl)})
+	return err
+}
+
+func (s *Store) Persist(bucket, k []byte) error {
+	_, err := s.propose(&command{op: opPersist, bucket: bucket, keys: [][]byte{k}})
+	return err
+}
+
+func (s *Store) CompareAndSwap(bucket, k, expected, v []byte) error {
+	_, err := s.propose(&command{op: opCompareAndSwap, bucket: bucket, keys: [][]byte{k}, values: [][]byte{expected, v}})
+	return err
+}
+
+func (s *Store) SetIfAbsent(bucket, k, v []byte) error {
+	_, err := s.propose(&command{op: opSetIfAbsent, bucket: bucket, keys: [][]byte{k}, values: [][]byte{v}})
+	return err
+}
+
+func (s *Store) DeleteIfEquals(bucket, k, expected []byte) error {
+	_, err := s.propose(&command{op: opDeleteIfEquals, bucket: bucket, keys: [][]byte{k}, values: [][]byte{expected}})
+	return err
+}
+
+func (s *Store) Incr(bucket, k []byte, delta int64) (int64, error) {
+	return s.propose(&command{op: opIncr, bucket: bucket, keys: [][]byte{k}, delta: delta})
+}
+
+func (s *Store) Delete(bucket, key []byte) error {
+	return s.DeleteKeys(bucket, [][]byte{key})
+}
+
+func (s *Store) DeleteKeys(bucket []byte, keys [][]byte) error {
+	_, err := s.propose(&command{op: opDelete, bucket: bucket, keys: keys})
+	return err
+}
+
+func (s *Store) Get(bucket, k []byte) (result []byte, found bool, e error) {
+	if err := s.read(); err != nil {
+		return nil, false, err
+	}
+	return s.local.Get(bucket, k)
+}
+
+func (s *Store) TTL(bucket, k []byte) (time.Duration, error) {
+	if err := s.read(); err != nil {
+		return 0, err
+	}
+	return s.local.TTL(bucket, k)
+}
+
+func (s *Store) PGet(bucket []byte, keys [][]byte) ([][]byte, error) {
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+	return s.local.PGet(bucket, keys)
+}
+
+func (s *Store) Keys(bucket, prefix []byte) (keys [][]byte, values [][]byte, err error) {
+	if err := s.read(); err != nil {
+		return nil, nil, err
+	}
+	return s.local.Keys(bucket, prefix)
+}
+
+func (s *Store) KeyStrings(bucket, prefix []byte) (keys []string, values [][]byte, err error) {
+	if err := s.read(); err != nil {
+		return nil, nil, err
+	}
+	return s.local.KeyStrings(bucket, prefix)
+}
+
+func (s *Store) KeysWithoutValues(bucket, prefix []byte) (keys [][]byte, err error) {
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+	return s.local.KeysWithoutValues(bucket, prefix)
+}
+
+func (s *Store) KeyStringsWithoutValues(bucket, prefix []byte) (keys []string, err error) {
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+	return s.local.KeyStringsWithoutValues(bucket, prefix)
+}
+
+// Cursor see the writes committed before it is opened, and may see later ones
+func (s *Store) Cursor(bucket []byte, opts kvstore.CursorOptions) (kvstore.Cursor, error) {
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+	return s.local.Cursor(bucket, opts)
+}
+
+func (s *Store) Range(bucket []byte, opts kvstore.RangeOptions) (kvstore.RangePage, error) {
+	if err := s.read(); err != nil {
+		return kvstore.RangePage{}, err
+	}
+	return s.local.Range(bucket, opts)
+}
+
+func (s *Store) Watch(ctx context.Context, bucket, prefix []byte) (<-chan kvstore.Event, error) {
+	return s.local.Watch(ctx, bucket, prefix)
+}
+
+func (s *Store) WatchFrom(ctx context.Context, bucket, prefix []byte, version uint64) (<-chan kvstore.Event, error) {
+	return s.local.WatchFrom(ctx, bucket, prefix, version)
+}
+
+// Buckets without MetaBucket
+func (s *Store) Buckets() ([][]byte, error) {
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+	buckets, err := s.local.Buckets()
+	out := buckets[:0]
+	for _, b := range buckets {
+		if string(b) != string(MetaBucket) {
+			out = append(out, b)
+		}
+	}
+	return out, err
+}
+
+// AllKeys without keys of MetaBucket
+func (s *Store) AllKeys(async func(key string, deletedOrExpired bool)) error {
+	if err := s.read(); err != nil {
+		return err
+	}
+	meta := string(s.local.KeyFormat().BucketPrefix(MetaBucket))
+	return s.local.AllKeys(func(key string, deletedOrExpired bool) {
+		if !strings.HasPrefix(key, meta) {
+			async(key, deletedOrExpired)
+		}
+	})
+}
+
+// Close stop the node and close the local store
+func (s *Store) Close() error {
+	err := s.error(s.raft.Shutdown().Error())
+	if errors.Is(err, kvstore.StoreClosedError) {
+		err = nil
+	}
+	return errors.Join(err, s.local.Close())
+}
+
+// Sync flush the local store
+func (s *Store) Sync() error {
+	return s.local.Sync()
+}
+
+// GC of the local store
+func (s *Store) GC(discardRatio float64) (int, error) {
+	return s.local.GC(discardRatio)
+}
+
+// Stats of the local store
+func (s *Store) Stats() (kvstore.Stats, error) {
+	return s.local.Stats()
+}
+
+// Backup the local store, it has the writes applied on this node
+func (s *Store) Backup(w io.Writer, since uint64, buckets ...[]byte) (uint64, error) {
+	return s.local.Backup(w, since, buckets...)
+}
+
+func (s *Store) Restore(r io.Reader) error {
+	return kvstore.NotSupportedError
+}
+
+func (s *Store) Sequence(bucket, name []byte, leaseSize uint64) (kvstore.Sequence, error) {
+	return nil, kvstore.NotSupportedError
+}
+
+// Update transactions are not replicated, use CompareAndSwap
+func (s *Store) Update(f func(txn kvstore.Txn) error) error {
+	return kvstore.NotSupportedError
+}
+
+// View run f on the local store after a read barrier
+func (s *Store) View(f func(txn kvstore.Txn) error) error {
+	if err := s.read(); err != nil {
+		return err
+	}
+	return s.local.View(f)
+}
+
+func (s *Store) Batch(f func(txn kvstore.Txn) error) error {
+	return kvstore.NotSupportedError
+}
+
+func (s *Store) Exec(f func(txn *badger.Txn) error) error {
+	return kvstore.NotSupportedError
+}
+
+func (s *Store) ReadOnly() bool {
+	return false
+}
+
+func (s *Store) Path() []string {
+	return s.local.Path()
+}
+
+func (s *Store) KeyFormat() kvstore.KeyFormat {
+	return s.local.KeyFormat()
+}
@@ -0,0 +1,255 @@
+package raftstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"time"
+)
+
+// cluster nodes of a store in one process, connected by in memory transports
+type cluster struct {
+	t      *testing.T
+	nodes  map[string]*Store
+	locals map[string]kvstore.KvStore
+	trans  map[string]*raft.InmemTransport
+}
+
+func newCluster(t *testing.T, n int) *cluster {
+	c := &cluster{
+		t:      t,
+		nodes:  make(map[string]*Store),
+		locals: make(map[string]kvstore.KvStore),
+		trans:  make(map[string]*raft.InmemTransport),
+	}
+	var members []Member
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("node-%d", i)
+		c.add(id)
+		members = append(members, Member{ID: id, Addr: id})
+	}
+	t.Cleanup(func() {
+		for _, s := range c.nodes {
+			_ = s.Close()
+		}
+	})
+	assert.True(t, c.nodes["node-0"].Bootstrap(members...) == nil)
+	return c
+}
+
+// add start a node not in the cluster yet, its address is its id
+func (c *cluster) add(id string) *Store {
+	_, trans := raft.NewInmemTransport(raft.ServerAddress(id))
+	for other, t := range c.trans {
+		trans.Connect(raft.ServerAddress(other), t)
+		t.Connect(raft.ServerAddress(id), trans)
+	}
+	local, err := kvstore.NewBadgerStore(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	assert.True(c.t, err == nil)
+	config := raft.DefaultConfig()
+	config.HeartbeatTimeout = 200 * time.Millisecond
+	config.ElectionTimeout = 200 * time.Millisecond
+	config.LeaderLeaseTimeout = 200 * time.Millisecond
+	config.CommitTimeout = 5 * time.Millisecond
+	config.TrailingLogs = 4
+	config.LogOutput = io.Discard
+	s, err := New(local, Options{ID: id, Config: config, Transport: trans})
+	assert.True(c.t, err == nil)
+	c.nodes[id], c.locals[id], c.trans[id] = s, local, trans
+	return s
+}
+
+// leader wait until a node leads the cluster
+func (c *cluster) leader() *Store {
+	c.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, s := range c.nodes {
+			if s.IsLeader() {
+				return s
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.t.Fatalf("no leader")
+	return nil
+}
+
+// follower a node not leading the cluster
+func (c *cluster) follower() *Store {
+	leader := c.leader()
+	for _, s := range c.nodes {
+		if s != leader {
+			return s
+		}
+	}
+	return nil
+}
+
+// stop a node, it leaves the cluster without being removed
+func (c *cluster) stop(s *Store) {
+	for id, node := range c.nodes {
+		if node == s {
+			_ = s.Close()
+			delete(c.nodes, id)
+			for _, t := range c.trans {
+				t.Disconnect(raft.ServerAddress(id))
+			}
+		}
+	}
+}
+
+// converged wait until every node applied the log of the leader, then check a key of each local store.
+// Local stores are read after it, badger does not expect reads while a snapshot is restored
+func (c *cluster) converged(bucket, k []byte, v string) {
+	c.t.Helper()
+	applied := c.leader().Applied()
+	deadline := time.Now().Add(10 * time.Second)
+	for id, s := range c.nodes {
+		for s.Applied() < applied {
+			if time.Now().After(deadline) {
+				c.t.Fatalf("%s applied %d of %d", id, s.Applied(), applied)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		got, _, _ := c.locals[id].Get(bucket, k)
+		assert.Equal(c.t, v, string(got), id)
+	}
+}
+
+var bucket = []byte("meta")
+
+// test writes of the leader are applied on every node
+func TestStore(t *testing.T) {
+	c := newCluster(t, 3)
+	s := c.leader()
+
+	assert.True(t, s.Set(bucket, []byte("a"), []byte("1")) == nil)
+	assert.True(t, s.PSet(bucket, [][]byte{[]byte("b"), []byte("c")}, [][]byte{[]byte("2"), []byte("3")}) == nil)
+	assert.True(t, s.SetWithTTL(bucket, []byte("ttl"), []byte("v"), time.Hour) == nil)
+	v, found, err := s.Get(bucket, []byte("a"))
+	assert.True(t, err == nil && found)
+	assert.Equal(t, "1", string(v))
+	ttl, err := s.TTL(bucket, []byte("ttl"))
+	assert.True(t, err == nil && ttl > 59*time.Minute)
+	assert.True(t, s.Persist(bucket, []byte("ttl")) == nil)
+	ttl, _ = s.TTL(bucket, []byte("ttl"))
+	assert.Equal(t, time.Duration(0), ttl)
+
+	assert.Equal(t, kvstore.PreconditionFailedError, s.CompareAndSwap(bucket, []byte("a"), []byte("0"), []byte("x")))
+	assert.True(t, s.CompareAndSwap(bucket, []byte("a"), []byte("1"), []byte("x")) == nil)
+	assert.Equal(t, kvstore.PreconditionFailedError, s.SetIfAbsent(bucket, []byte("a"), []byte("y")))
+	assert.Equal(t, kvstore.PreconditionFailedError, s.DeleteIfEquals(bucket, []byte("b"), []byte("0")))
+	assert.True(t, s.DeleteIfEquals(bucket, []byte("b"), []byte("2")) == nil)
+	n, err := s.Incr(bucket, []byte("n"), 5)
+	assert.True(t, err == nil && n == 5)
+	_, err = s.Incr(bucket, []byte("a"), 1)
+	assert.True(t, errors.Is(err, kvstore.NotIntegerError))
+	assert.True(t, s.DeleteKeys(bucket, [][]byte{[]byte("c"), []byte("missing")}) == nil)
+
+	keys, err := s.KeyStringsWithoutValues(bucket, nil)
+	assert.True(t, err == nil)
+	assert.Equal(t, []string{"a", "n", "ttl"}, keys)
+	buckets, err := s.Buckets()
+	assert.True(t, err == nil)
+	assert.Equal(t, [][]byte{bucket}, buckets, "without the meta bucket")
+	c.converged(bucket, []byte("n"), "5")
+	c.converged(bucket, []byte("a"), "x")
+
+	assert.Equal(t, kvstore.NotSupportedError, s.Update(func(txn kvstore.Txn) error { return nil }))
+	assert.True(t, s.View(func(txn kvstore.Txn) error {
+		v, err := txn.Get(bucket, []byte("ttl"))
+		assert.Equal(t, "v", string(v))
+		return err
+	}) == nil)
+}
+
+// test followers tell the leader
+func TestNotLeader(t *testing.T) {
+	c := newCluster(t, 3)
+	leader := c.leader()
+	s := c.follower()
+	err := s.Set(bucket, []byte("a"), []byte("1"))
+	assert.True(t, errors.Is(err, NotLeaderError))
+	assert.Contains(t, err.Error(), leader.Leader().ID)
+	_, _, err = s.Get(bucket, []byte("a"))
+	assert.True(t, errors.Is(err, NotLeaderError))
+	assert.Equal(t, leader.Leader(), s.Leader())
+}
+
+// test a new leader is elected when the leader stops, it has every write
+func TestFailover(t *testing.T) {
+	c := newCluster(t, 3)
+	s := c.leader()
+	for i := 0; i < 10; i++ {
+		_, err := s.Incr(bucket, []byte("n"), 1)
+		assert.True(t, err == nil)
+	}
+	c.stop(s)
+
+	s = c.leader()
+	n, err := s.Incr(bucket, []byte("n"), 1)
+	assert.True(t, err == nil)
+	assert.Equal(t, int64(11), n)
+	c.converged(bucket, []byte("n"), "11")
+}
+
+// test members added after a snapshot get it, then the log after it
+func TestMembership(t *testing.T) {
+	c := newCluster(t, 3)
+	s := c.leader()
+	for i := 0; i < 20; i++ {
+		_, err := s.Incr(bucket, []byte("n"), 1)
+		assert.True(t, err == nil)
+	}
+	err := s.Snapshot()
+	assert.True(t, err == nil, "%v", err)
+	assert.True(t, s.Set(bucket, []byte("after"), []byte("snapshot")) == nil)
+
+	c.add("node-3")
+	err = s.AddVoter("node-3", "node-3")
+	assert.True(t, err == nil, "%v", err)
+	c.converged(bucket, []byte("after"), "snapshot")
+	c.converged(bucket, []byte("n"), "20")
+	members, err := s.Members()
+	assert.True(t, err == nil)
+	assert.Equal(t, 4, len(members))
+
+	assert.True(t, s.RemoveMember("node-3") == nil)
+	members, _ = s.Members()
+	assert.Equal(t, 3, len(members))
+	c.stop(c.nodes["node-3"])
+	assert.True(t, s.Set(bucket, []byte("a"), []byte("1")) == nil)
+}
+
+// test concurrent reads see writes done before them
+func TestRead(t *testing.T) {
+	c := newCluster(t, 3)
+	s := c.leader()
+	done := make(chan error)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			k := []byte(fmt.Sprintf("k-%d", i))
+			if err := s.Set(bucket, k, k); err != nil {
+				done <- err
+				return
+			}
+			v, _, err := s.Get(bucket, k)
+			if err == nil && string(v) != string(k) {
+				err = fmt.Errorf("%s is %s", k, v)
+			}
+			done <- err
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		assert.True(t, <-done == nil)
+	}
+	assert.True(t, s.Close() == nil)
+	_, _, err := s.Get(bucket, []byte("k-0"))
+	assert.Equal(t, kvstore.StoreClosedError, err)
+}
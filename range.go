@@ -0,0 +1,137 @@
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+const (
+	// DefaultRangeLimit max keys in a page when RangeOptions.Limit is 0
+	DefaultRangeLimit = 1000
+
+	rangeTokenVersion = 1
+	rangeTokenReverse = 1 << 0
+)
+
+var (
+	InvalidTokenError = errors.New("invalid continuation token")
+)
+
+// RangeOptions options of a page of keys in a bucket, keys are relative to the bucket
+type RangeOptions struct {
+	// Prefix only return keys with prefix
+	Prefix []byte
+
+	// Start first key, included. nil to start from the first key
+	Start []byte
+
+	// End last key, excluded. nil to end after the last key
+	End []byte
+
+	// Limit max keys in a page, 0 is DefaultRangeLimit
+	Limit int
+
+	// Reverse return keys from the last to the first
+	Reverse bool
+
+	// KeysOnly do not return values
+	KeysOnly bool
+
+	// Token continue after the last key of a previous page, the other options should be the same as that call
+	Token string
+}
+
+// RangePage a page of keys and values in order
+type RangePage struct {
+	Keys   [][]byte
+	Values [][]byte
+
+	// Token to get the next page, empty if there are no more keys
+	Token string
+}
+
+// cursorFunc open a cursor over a bucket
+type cursorFunc func(bucket []byte, opts CursorOptions) (Cursor, error)
+
+// rangePage read a page with a cursor until ctx is done. A page resumes after the key in its token,
+// so keys written or deleted between pages never shift the next page
+func rangePage(ctx context.Context, cursor cursorFunc, bucket []byte, opts RangeOptions) (RangePage, error) {
+	var page RangePage
+	var after []byte
+	if opts.Token != "" {
+		var err error
+		if after, err = decodeRangeToken(opts.Token, bucket, opts.Reverse); err != nil {
+			return page, err
+		}
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultRangeLimit
+	}
+
+	copts := CursorOptions{
+		Prefix:   opts.Prefix,
+		Start:    opts.Start,
+		End:      opts.End,
+		Reverse:  opts.Reverse,
+		KeysOnly: opts.KeysOnly,
+	}
+	if after != nil && opts.Reverse {
+		copts.End = after
+	}
+	c, err := cursor(bucket, copts)
+	if err != nil {
+		return page, err
+	}
+	defer c.Close()
+
+	c.Seek(after)
+	if after != nil && !opts.Reverse && c.Valid() && bytes.Equal(c.Key(), after) {
+		c.Next()
+	}
+	for ; c.Valid(); c.Next() {
+		if err := ctx.Err(); err != nil {
+			return page, err
+		}
+		if len(page.Keys) == limit {
+			page.Token = encodeRangeToken(bucket, opts.Reverse, page.Keys[len(page.Keys)-1])
+			break
+		}
+		page.Keys = append(page.Keys, c.Key())
+		if !opts.KeysOnly {
+			v, err := c.Value()
+			if err != nil {
+				return page, err
+			}
+			page.Values = append(page.Values, v)
+		}
+	}
+	return page, nil
+}
+
+// encodeRangeToken version, flags, crc32 of bucket and the last key
+func encodeRangeToken(bucket []byte, reverse bool, last []byte) string {
+	token := make([]byte, 6, 6+len(last))
+	token[0] = rangeTokenVersion
+	if reverse {
+		token[1] |= rangeTokenReverse
+	}
+	binary.BigEndian.PutUint32(token[2:], crc32.ChecksumIEEE(bucket))
+	return base64.RawURLEncoding.EncodeToString(append(token, last...))
+}
+
+// decodeRangeToken return the last key of the previous page
+func decodeRangeToken(token string, bucket []byte, reverse bool) ([]byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) < 6 || raw[0] != rangeTokenVersion {
+		return nil, InvalidTokenError
+	}
+	if (raw[1]&rangeTokenReverse != 0) != reverse || binary.BigEndian.Uint32(raw[2:]) != crc32.ChecksumIEEE(bucket) {
+		return nil, InvalidTokenError
+	}
+	return raw[6:], nil
+}
@@ -0,0 +1,80 @@
+package kvstore
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// read every page
+func rangeAll(t *testing.T, s KvStore, opts RangeOptions) []string {
+	var keys []string
+	for {
+		page, err := s.Range(TestBucket, opts)
+		assert.True(t, err == nil, "%v", err)
+		assert.True(t, len(page.Keys) <= opts.Limit)
+		for i, k := range page.Keys {
+			keys = append(keys, string(k))
+			if !opts.KeysOnly {
+				assert.Equal(t, "v-"+string(k), string(page.Values[i]))
+			}
+		}
+		if page.Token == "" {
+			return keys
+		}
+		opts.Token = page.Token
+	}
+}
+
+// test paging through a bucket
+func TestRange(t *testing.T) {
+	testStores(t, fillCursorKeys, func(t *testing.T, s KvStore) {
+		assert.Equal(t, cursorKeys(0, 20, false, 5), rangeAll(t, s, RangeOptions{Limit: 3}))
+		assert.Equal(t, cursorKeys(0, 20, true, 5), rangeAll(t, s, RangeOptions{Limit: 4, Reverse: true, KeysOnly: true}))
+		assert.Equal(t, cursorKeys(2, 15, false, 5), rangeAll(t, s, RangeOptions{Limit: 5, Start: []byte("key-02"), End: []byte("key-15")}))
+		assert.Equal(t, cursorKeys(10, 20, true), rangeAll(t, s, RangeOptions{Limit: 2, Prefix: []byte("key-1"), Reverse: true}))
+
+		// last page is full
+		page, err := s.Range(TestBucket, RangeOptions{Prefix: []byte("key-1"), Limit: 10})
+		assert.True(t, err == nil)
+		assert.Equal(t, 10, len(page.Keys))
+		assert.Equal(t, "", page.Token)
+
+		page, err = s.Range(TestBucket, RangeOptions{})
+		assert.True(t, err == nil)
+		assert.Equal(t, 19, len(page.Keys))
+	})
+}
+
+// test a token resumes after its key when keys are written between pages
+func TestRangeResume(t *testing.T) {
+	testStores(t, fillCursorKeys, func(t *testing.T, s KvStore) {
+		page, err := s.Range(TestBucket, RangeOptions{Limit: 4})
+		assert.True(t, err == nil)
+		assert.Equal(t, cursorKeys(0, 4, false), toStrings(page.Keys))
+
+		assert.True(t, s.Delete(TestBucket, []byte("key-03")) == nil)
+		assert.True(t, s.Delete(TestBucket, []byte("key-04")) == nil)
+		assert.True(t, s.Set(TestBucket, []byte("key-00a"), []byte("v-key-00a")) == nil)
+		assert.True(t, s.Set(TestBucket, []byte("key-03a"), []byte("v-key-03a")) == nil)
+
+		page, err = s.Range(TestBucket, RangeOptions{Limit: 4, Token: page.Token})
+		assert.True(t, err == nil)
+		assert.Equal(t, []string{"key-03a", "key-06", "key-07", "key-08"}, toStrings(page.Keys))
+
+		_, err = s.Range([]byte("test"), RangeOptions{Limit: 4, Token: page.Token})
+		assert.True(t, errors.Is(err, InvalidTokenError))
+		_, err = s.Range(TestBucket, RangeOptions{Limit: 4, Token: page.Token, Reverse: true})
+		assert.True(t, errors.Is(err, InvalidTokenError))
+		_, err = s.Range(TestBucket, RangeOptions{Token: "not a token"})
+		assert.True(t, errors.Is(err, InvalidTokenError))
+	})
+}
+
+func toStrings(bb [][]byte) []string {
+	var result []string
+	for _, b := range bb {
+		result = append(result, string(b))
+	}
+	return result
+}
@@ -0,0 +1,746 @@
+package kvstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4/pb"
+	"io"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultReplicationLogSize keys a primary keeps for followers catching up without a snapshot
+	DefaultReplicationLogSize = 10000
+
+	// DefaultHeartbeat a primary tells followers its version at least this often
+	DefaultHeartbeat = time.Second
+
+	// DefaultReplicationTimeout a follower reconnects when it hears nothing from the primary for it
+	DefaultReplicationTimeout = 5 * time.Second
+
+	// DefaultReplicationRetry a follower waits it before it reconnects
+	DefaultReplicationRetry = time.Second
+
+	// replicationHello a follower sends it then the version it has
+	replicationHello = "kvrepl01"
+)
+
+// frames of a primary, a type, a version and a payload, see writeFrame. A follower answers the version it
+// applied after frameUpdates and frameSnapshotEnd
+const (
+	// frameUpdates a list of a backup, version is the last version of the list
+	frameUpdates byte = 'u'
+
+	// frameSnapshot drop every key, the payloads of frameSnapshotData until frameSnapshotEnd are a full backup
+	frameSnapshot byte = 's'
+
+	frameSnapshotData byte = 'd'
+
+	// frameSnapshotEnd version is the version of the backup
+	frameSnapshotEnd byte = 'e'
+
+	// frameHeartbeat version is the version of the primary
+	frameHeartbeat byte = 'h'
+)
+
+var (
+	ReplicationClosedError = errors.New("replication closed")
+	BadFrameError          = errors.New("bad replication frame")
+)
+
+// PrimaryOptions options of a primary, zero values are the defaults
+type PrimaryOptions struct {
+	// LogSize keys kept for followers to catch up, a follower further behind gets a snapshot
+	LogSize int
+
+	// Heartbeat how often followers are told the version of the primary
+	Heartbeat time.Duration
+}
+
+// FollowerStatus a follower connected to a primary
+type FollowerStatus struct {
+	Addr string
+
+	// Version the follower applied
+	Version uint64
+
+	// Lag versions the follower is behind the primary
+	Lag uint64
+
+	// Snapshots sent to the follower on this connection
+	Snapshots int
+}
+
+// Primary streams committed writes of a badger store to followers
+type Primary struct {
+	store  badgerStore
+	opts   PrimaryOptions
+	cancel context.CancelFunc
+
+	lock     sync.Mutex
+	closed   bool
+	version  uint64   // the last version published
+	log      []*pb.KV // in order of versions
+	logStart uint64   // every version after it is in log
+	replicas map[*replica]struct{}
+	closers  map[io.Closer]struct{}
+}
+
+// replica a follower connected to a primary
+type replica struct {
+	conn   net.Conn
+	notify chan struct{}
+	acked  atomic.Uint64
+
+	// guarded by the lock of the primary
+	queue     []*pb.KV
+	snapshot  bool
+	snapshots int
+}
+
+// NewPrimary stream writes of store to followers connecting to Serve. Only a badger store is supported,
+// a store wrapping one with an Unwrap method, like stores of Wrap, is unwrapped
+func NewPrimary(store KvStore, opts PrimaryOptions) (*Primary, error) {
+	b, ok := unwrap(store).(badgerStore)
+	if !ok {
+		return nil, NotSupportedError
+	}
+	if b.db.IsClosed() {
+		return nil, StoreClosedError
+	}
+	if opts.LogSize <= 0 {
+		opts.LogSize = DefaultReplicationLogSize
+	}
+	if opts.Heartbeat <= 0 {
+		opts.Heartbeat = DefaultHeartbeat
+	}
+	version := b.db.MaxVersion()
+	p := &Primary{
+		store:    b,
+		opts:     opts,
+		version:  version,
+		logStart: version,
+		replicas: make(map[*replica]struct{}),
+		closers:  make(map[io.Closer]struct{}),
+	}
+	cancel, err := subscribe(b.db, b.log, p.publish, func() {
+		_ = p.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.cancel = cancel
+	return p, nil
+}
+
+// Serve followers connecting to l until the primary is closed, then ReplicationClosedError
+func (p *Primary) Serve(l net.Listener) error {
+	if !p.track(l, true) {
+		return ReplicationClosedError
+	}
+	defer p.track(l, false)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			p.lock.Lock()
+			closed := p.closed
+			p.lock.Unlock()
+			if closed {
+				return ReplicationClosedError
+			}
+			return err
+		}
+		go p.ServeConn(conn)
+	}
+}
+
+// ServeConn stream writes to the follower of conn until it is gone or the primary is closed, then close conn
+func (p *Primary) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	if !p.track(conn, true) {
+		return
+	}
+	defer p.track(conn, false)
+
+	var hello [len(replicationHello) + 8]byte
+	_ = conn.SetReadDeadline(time.Now().Add(DefaultReplicationTimeout))
+	if _, err := io.ReadFull(conn, hello[:]); err != nil || string(hello[:len(replicationHello)]) != replicationHello {
+		p.store.log.warn("ServeConn", slog.String("addr", conn.RemoteAddr().String()), slog.String("error", "bad hello"))
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	since := binary.LittleEndian.Uint64(hello[len(replicationHello):])
+
+	r := &replica{conn: conn, notify: make(chan struct{}, 1)}
+	r.acked.Store(since)
+	p.lock.Lock()
+	if since > 0 && since >= p.logStart && since <= p.version {
+		i := sort.Search(len(p.log), func(i int) bool {
+			return p.log[i].Version > since
+		})
+		r.queue = append(r.queue, p.log[i:]...)
+	} else {
+		r.snapshot = true
+	}
+	p.replicas[r] = struct{}{}
+	p.lock.Unlock()
+	defer func() {
+		p.lock.Lock()
+		delete(p.replicas, r)
+		p.lock.Unlock()
+	}()
+
+	// acks until the follower is gone
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var ack [8]byte
+		for {
+			if _, err := io.ReadFull(conn, ack[:]); err != nil {
+				return
+			}
+			r.acked.Store(binary.LittleEndian.Uint64(ack[:]))
+		}
+	}()
+	if err := p.replicate(r, done); err != nil {
+		p.store.log.warn("ServeConn", slog.String("addr", conn.RemoteAddr().String()), slog.Any("error", err))
+	}
+}
+
+// replicate send the snapshot and updates of r, then a heartbeat, every time it is notified or at least
+// every Heartbeat
+func (p *Primary) replicate(r *replica, done <-chan struct{}) error {
+	w := bufio.NewWriterSize(r.conn, 64<<10)
+	heartbeat := time.NewTicker(p.opts.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		p.lock.Lock()
+		snapshot, queue, version := r.snapshot, r.queue, p.version
+		r.snapshot, r.queue = false, nil
+		if snapshot {
+			r.snapshots++
+		}
+		p.lock.Unlock()
+
+		// writes committed after the snapshot started are queued, the follower skips the ones it has
+		if snapshot {
+			if err := p.snapshot(w, version); err != nil {
+				return err
+			}
+		}
+		if err := writeUpdates(w, queue); err != nil {
+			return err
+		}
+		if err := writeFrame(w, frameHeartbeat, version, nil); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		select {
+		case <-r.notify:
+		case <-heartbeat.C:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// snapshot write a full backup of the store, it has every version up to version published before it starts
+func (p *Primary) snapshot(w io.Writer, version uint64) error {
+	if err := writeFrame(w, frameSnapshot, 0, nil); err != nil {
+		return err
+	}
+	last, err := p.store.Backup(frameWriter{w: w}, 0)
+	if err != nil {
+		return err
+	}
+	return writeFrame(w, frameSnapshotEnd, max(last, version), nil)
+}
+
+// publish committed writes to the log and to followers, a follower with more than LogSize keys queued
+// gets a snapshot instead
+func (p *Primary) publish(ctx context.Context, kvs []*pb.KV) {
+	txn := p.store.db.NewTransaction(false)
+	defer txn.Discard()
+	list := make([]*pb.KV, 0, len(kvs))
+	for _, kv := range kvs {
+		if bytes.HasPrefix(kv.Key, badgerInternalPrefix) {
+			continue
+		}
+		meta := byte(0)
+		if len(kv.Value) == 0 && isDeleted(txn, kv.Key, kv.Version) {
+			meta = backupMetaDelete
+		}
+		list = append(list, &pb.KV{
+			Key:       kv.Key,
+			Value:     kv.Value,
+			UserMeta:  kv.Meta,
+			Version:   kv.Version,
+			ExpiresAt: kv.ExpiresAt,
+			Meta:      []byte{meta},
+		})
+	}
+	if len(list) == 0 {
+		return
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	p.log = append(p.log, list...)
+	if n := len(p.log) - p.opts.LogSize; n > 0 {
+		p.logStart = p.log[n-1].Version
+		p.log = p.log[n:]
+	}
+	p.version = max(p.version, list[len(list)-1].Version)
+	for r := range p.replicas {
+		if r.snapshot {
+			continue
+		}
+		if len(r.queue)+len(list) > p.opts.LogSize {
+			r.queue, r.snapshot = nil, true
+		} else {
+			r.queue = append(r.queue, list...)
+		}
+		select {
+		case r.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Version the last version written to the store
+func (p *Primary) Version() uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.version
+}
+
+// Followers connected now
+func (p *Primary) Followers() []FollowerStatus {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	followers := make([]FollowerStatus, 0, len(p.replicas))
+	for r := range p.replicas {
+		acked := r.acked.Load()
+		followers = append(followers, FollowerStatus{
+			Addr:      r.conn.RemoteAddr().String(),
+			Version:   acked,
+			Lag:       p.version - min(acked, p.version),
+			Snapshots: r.snapshots,
+		})
+	}
+	sort.Slice(followers, func(i, j int) bool {
+		return followers[i].Addr < followers[j].Addr
+	})
+	return followers
+}
+
+// Close stop listeners and disconnect followers, the store is left open
+func (p *Primary) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	if p.cancel != nil {
+		p.cancel()
+	}
+	for c := range p.closers {
+		_ = c.Close()
+	}
+	return nil
+}
+
+// track add or remove a listener or a connection, false if the primary is closed
+func (p *Primary) track(c io.Closer, add bool) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !add {
+		delete(p.closers, c)
+		return true
+	}
+	if p.closed {
+		return false
+	}
+	p.closers[c] = struct{}{}
+	return true
+}
+
+// FollowerOptions options of a follower, zero values are the defaults
+type FollowerOptions struct {
+	// Since the version the store already has from the primary, 0 starts from a snapshot
+	Since uint64
+
+	// Timeout reconnect when nothing is heard from the primary for it
+	Timeout time.Duration
+
+	// Retry wait before reconnecting
+	Retry time.Duration
+}
+
+// Follower applies writes of a primary to a store, readers use the read only Store
+type Follower struct {
+	store  KvStore
+	reader KvStore
+	addr   string
+	opts   FollowerOptions
+	log    *logger
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	version atomic.Uint64 // applied
+	primary atomic.Uint64 // the last version heard from the primary
+
+	// lock held by readers of Store, and by the follower while it applies updates or a snapshot.
+	// Restore of badger moves the timestamps of transactions without the lock of badger
+	lock sync.RWMutex
+}
+
+// dropper a store a follower can reset for a snapshot
+type dropper interface {
+	// dropAll delete every key
+	dropAll() error
+}
+
+// DropAll delete every key of a store opened by Open or of the store it wraps, like Wrap,
+// NotSupportedError for other stores
+func DropAll(store KvStore) error {
+	d, ok := unwrap(store).(dropper)
+	if !ok {
+		return NotSupportedError
+	}
+	return d.dropAll()
+}
+
+// NewFollower replicate the primary at addr to store, store should only be written by the follower
+func NewFollower(store KvStore, addr string, opts FollowerOptions) (*Follower, error) {
+	if _, ok := store.(dropper); !ok {
+		return nil, NotSupportedError
+	}
+	if store.ReadOnly() {
+		return nil, ReadOnlyError
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultReplicationTimeout
+	}
+	if opts.Retry <= 0 {
+		opts.Retry = DefaultReplicationRetry
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &Follower{store: store, addr: addr, opts: opts, log: loggerOf(store), ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	f.reader = followerStore{Wrap(store, f.readOnly)}
+	f.version.Store(opts.Since)
+	f.primary.Store(opts.Since)
+	go f.run()
+	return f, nil
+}
+
+// run replicate until the follower is closed, reconnecting after errors
+func (f *Follower) run() {
+	defer close(f.done)
+	for {
+		err := f.replicate()
+		if f.ctx.Err() != nil {
+			return
+		}
+		f.log.warn("Follower", slog.String("addr", f.addr), slog.Any("error", err))
+		select {
+		case <-time.After(f.opts.Retry):
+		case <-f.ctx.Done():
+			return
+		}
+	}
+}
+
+// replicate apply frames of a connection to the primary
+func (f *Follower) replicate() error {
+	var d net.Dialer
+	conn, err := d.DialContext(f.ctx, "tcp", f.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(f.ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+
+	hello := binary.LittleEndian.AppendUint64([]byte(replicationHello), f.version.Load())
+	if _, err := conn.Write(hello); err != nil {
+		return err
+	}
+
+	// a snapshot is restored while it is read, readers wait until it ends
+	var snapshot *io.PipeWriter
+	var restored chan error
+	defer func() {
+		if snapshot != nil {
+			_ = snapshot.CloseWithError(ReplicationClosedError)
+			<-restored
+			f.lock.Unlock()
+		}
+	}()
+
+	r := bufio.NewReaderSize(conn, 64<<10)
+	var buf []byte
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(f.opts.Timeout))
+		var t byte
+		var version uint64
+		t, version, buf, err = readFrame(r, buf)
+		if err != nil {
+			return err
+		}
+		switch t {
+		case frameHeartbeat:
+			f.heard(version)
+			continue
+		case frameUpdates:
+			if snapshot != nil {
+				return fmt.Errorf("%w: updates in a snapshot", BadFrameError)
+			}
+			if err := f.apply(buf); err != nil {
+				return err
+			}
+		case frameSnapshot:
+			if snapshot != nil {
+				return fmt.Errorf("%w: snapshot in a snapshot", BadFrameError)
+			}
+			f.lock.Lock()
+			if err := DropAll(f.store); err != nil {
+				f.lock.Unlock()
+				return err
+			}
+			pr, pw := io.Pipe()
+			snapshot, restored = pw, make(chan error, 1)
+			go func() {
+				err := f.store.Restore(pr)
+				_ = pr.CloseWithError(err)
+				restored <- err
+			}()
+			continue
+		case frameSnapshotData:
+			if snapshot == nil {
+				return fmt.Errorf("%w: data out of a snapshot", BadFrameError)
+			}
+			if _, err := snapshot.Write(buf); err != nil {
+				return err
+			}
+			continue
+		case frameSnapshotEnd:
+			if snapshot == nil {
+				return fmt.Errorf("%w: end out of a snapshot", BadFrameError)
+			}
+			_ = snapshot.Close()
+			err := <-restored
+			snapshot = nil
+			f.lock.Unlock()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: type %q", BadFrameError, t)
+		}
+
+		// the store has every version up to version
+		f.version.Store(version)
+		f.heard(version)
+		if _, err := conn.Write(binary.LittleEndian.AppendUint64(nil, version)); err != nil {
+			return err
+		}
+	}
+}
+
+// apply a list of updates, versions the store already has from a snapshot are skipped
+func (f *Follower) apply(payload []byte) error {
+	applied := f.version.Load()
+	var list pb.KVList
+	err := readKVLists(bytes.NewReader(payload), func(kv *pb.KV) error {
+		if kv.Version > applied {
+			list.Kv = append(list.Kv, kv)
+		}
+		return nil
+	})
+	if err != nil || len(list.Kv) == 0 {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := writeKVList(&buf, &list); err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.store.Restore(&buf)
+}
+
+// heard the primary has version
+func (f *Follower) heard(version uint64) {
+	for {
+		v := f.primary.Load()
+		if version <= v || f.primary.CompareAndSwap(v, version) {
+			return
+		}
+	}
+}
+
+// Store the store of the follower, writes fail with ReadOnlyError and Close leaves it open. Calls wait while
+// updates are applied, and during a snapshot. f of View holds updates back, it should not call the store again
+func (f *Follower) Store() KvStore {
+	return f.reader
+}
+
+// readOnly an interceptor of the store of readers
+func (f *Follower) readOnly(c *Call, next Handler) error {
+	switch c.Op {
+	case OpSet, OpSetWithTTL, OpPSet, OpPSetWithTTL, OpPersist, OpCompareAndSwap, OpSetIfAbsent, OpIncr,
+		OpSequence, OpDelete, OpDeleteIfEquals, OpDeleteKeys, OpRestore, OpUpdate, OpBatch, OpExec:
+		return ReadOnlyError
+	case OpClose:
+		return nil
+	case OpReadOnly:
+		c.Results = []interface{}{true}
+		return nil
+	}
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	err := next(c)
+	if stats, ok := c.result(0).(Stats); ok && c.Op == OpStats {
+		stats.ReadOnly = true
+		c.Results = []interface{}{stats}
+	}
+	return err
+}
+
+// Version the last version of the primary applied, pass it as Since to resume with the same store
+func (f *Follower) Version() uint64 {
+	return f.version.Load()
+}
+
+// Lag versions the store is behind the primary, as of the last frame from the primary
+func (f *Follower) Lag() uint64 {
+	version, primary := f.version.Load(), f.primary.Load()
+	return primary - min(version, primary)
+}
+
+// Close stop replicating and wait until writes to the store are done, the store is left open
+func (f *Follower) Close() error {
+	f.cancel()
+	<-f.done
+	return nil
+}
+
+// followerStore the store of a follower for readers, it hides the store it wraps
+type followerStore struct {
+	KvStore
+}
+
+// writeUpdates write kvs in lists of about backupListSize keys, a version is never split between lists
+func writeUpdates(w io.Writer, kvs []*pb.KV) error {
+	var buf bytes.Buffer
+	for len(kvs) > 0 {
+		n := min(len(kvs), backupListSize)
+		for n < len(kvs) && kvs[n].Version == kvs[n-1].Version {
+			n++
+		}
+		buf.Reset()
+		if err := writeKVList(&buf, &pb.KVList{Kv: kvs[:n]}); err != nil {
+			return err
+		}
+		if err := writeFrame(w, frameUpdates, kvs[n-1].Version, buf.Bytes()); err != nil {
+			return err
+		}
+		kvs = kvs[n:]
+	}
+	return nil
+}
+
+// writeFrame write a type, the version and the size of payload in uint64 little endian, then payload
+func writeFrame(w io.Writer, t byte, version uint64, payload []byte) error {
+	var header [17]byte
+	header[0] = t
+	binary.LittleEndian.PutUint64(header[1:], version)
+	binary.LittleEndian.PutUint64(header[9:], uint64(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readFrame read a frame written by writeFrame, the payload is read into buf
+func readFrame(r io.Reader, buf []byte) (t byte, version uint64, payload []byte, err error) {
+	var header [17]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, 0, buf, err
+	}
+	size := binary.LittleEndian.Uint64(header[9:])
+	if size > backupMaxListBytes {
+		return 0, 0, buf, fmt.Errorf("%w: payload of %d bytes", BadFrameError, size)
+	}
+	if uint64(cap(buf)) < size {
+		buf = make([]byte, size)
+	}
+	if _, err := io.ReadFull(r, buf[:size]); err != nil {
+		return 0, 0, buf, err
+	}
+	return header[0], binary.LittleEndian.Uint64(header[1:]), buf[:size], nil
+}
+
+// frameWriter write every write as a frame of snapshot data
+type frameWriter struct {
+	w io.Writer
+}
+
+func (fw frameWriter) Write(p []byte) (int, error) {
+	if err := writeFrame(fw.w, frameSnapshotData, 0, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (b badgerStore) dropAll() error {
+	b.log.debug("dropAll")
+	if b.opts.ReadOnly {
+		return ReadOnlyError
+	}
+	defer b.cache.clear()
+	return b.db.DropAll()
+}
+
+// dropAll watchers get a delete of every key
+func (m *memStore) dropAll() error {
+	m.log.debug("dropAll")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.publish()
+	if err := m.writable(); err != nil {
+		return err
+	}
+	var keys []string
+	m.keys.Ascend(func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	for _, key := range keys {
+		m.remove(key)
+	}
+	return nil
+}
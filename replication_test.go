@@ -0,0 +1,231 @@
+package kvstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// newPrimary serve a primary of a badger store on localhost
+func newPrimary(t *testing.T, opts PrimaryOptions) (KvStore, *Primary, string) {
+	dir := getDataPath()
+	s, err := NewBadgerStore(badger.DefaultOptions(dir).WithLogger(nil))
+	assert.True(t, err == nil)
+	p, err := NewPrimary(s, opts)
+	assert.True(t, err == nil)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %v", err)
+	}
+	go func() {
+		_ = p.Serve(l)
+	}()
+	t.Cleanup(func() {
+		_ = p.Close()
+		_ = s.Close()
+		_ = os.RemoveAll(dir)
+	})
+	return s, p, l.Addr().String()
+}
+
+// caughtUp wait until f applied every write committed to the store of p
+func caughtUp(t *testing.T, p *Primary, f *Follower) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for f.Version() < p.store.db.MaxVersion() || f.Lag() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("follower at %d, primary at %d", f.Version(), p.Version())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// followersGone wait until closed followers are disconnected from p
+func followersGone(t *testing.T, p *Primary) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for len(p.Followers()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("followers still connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// test followers get a snapshot then the writes of the primary
+func TestReplication(t *testing.T) {
+	s, p, addr := newPrimary(t, PrimaryOptions{Heartbeat: 50 * time.Millisecond})
+	for i := 0; i < 100; i++ {
+		assert.True(t, s.Set(TestBucket, []byte(fmt.Sprintf("key-%03d", i)), []byte("v")) == nil)
+	}
+	assert.True(t, s.Set(TestBucket, []byte("empty"), []byte{}) == nil)
+	assert.True(t, s.Delete(TestBucket, []byte("key-000")) == nil)
+
+	dir := getDataPath()
+	b, err := NewBadgerStore(badger.DefaultOptions(dir).WithLogger(nil))
+	assert.True(t, err == nil)
+	defer func() {
+		_ = b.Close()
+		_ = os.RemoveAll(dir)
+	}()
+	for name, store := range map[string]KvStore{EngineBadger: b, EngineMemory: newMemoryStore(t)} {
+		t.Run(name, func(t *testing.T) {
+			_ = store.Set(TestBucket, []byte("stale"), []byte("v"))
+			f, err := NewFollower(store, addr, FollowerOptions{})
+			assert.True(t, err == nil)
+			defer f.Close()
+			caughtUp(t, p, f)
+
+			r := f.Store()
+			keys, err := r.KeyStringsWithoutValues(TestBucket, nil)
+			assert.True(t, err == nil)
+			assert.Equal(t, 100, len(keys), "the snapshot drops stale keys")
+			v, found, err := r.Get(TestBucket, []byte("empty"))
+			assert.True(t, err == nil && found && len(v) == 0)
+
+			// writes after the snapshot
+			assert.True(t, s.SetWithTTL(TestBucket, []byte("ttl"), []byte("v"), time.Hour) == nil)
+			assert.True(t, s.Delete(TestBucket, []byte("key-001")) == nil)
+			assert.True(t, s.Update(func(txn Txn) error {
+				_ = txn.Set(TestBucket, []byte("key-001"), []byte("again"))
+				return txn.Delete(TestBucket, []byte("key-002"))
+			}) == nil)
+			caughtUp(t, p, f)
+
+			v, _, err = r.Get(TestBucket, []byte("key-001"))
+			assert.True(t, err == nil)
+			assert.Equal(t, "again", string(v))
+			_, _, err = r.Get(TestBucket, []byte("key-002"))
+			assert.True(t, errors.Is(err, KeyNotFoundError))
+			ttl, err := r.TTL(TestBucket, []byte("ttl"))
+			assert.True(t, err == nil && ttl > 50*time.Minute)
+
+			followers := p.Followers()
+			assert.Equal(t, 1, len(followers))
+			assert.Equal(t, 1, followers[0].Snapshots)
+			assert.Equal(t, uint64(0), f.Lag())
+		})
+		followersGone(t, p)
+	}
+}
+
+// test a follower resuming with Since catches up from the log, or from a snapshot when it is too far behind
+func TestReplicationCatchUp(t *testing.T) {
+	s, p, addr := newPrimary(t, PrimaryOptions{LogSize: 20, Heartbeat: 50 * time.Millisecond})
+	store := newMemoryStore(t)
+	f, err := NewFollower(store, addr, FollowerOptions{})
+	assert.True(t, err == nil)
+	assert.True(t, s.Set(TestBucket, []byte("a"), []byte("1")) == nil)
+	caughtUp(t, p, f)
+	assert.True(t, f.Close() == nil)
+
+	resume := func(writes int) int {
+		for i := 0; i < writes; i++ {
+			assert.True(t, s.Set(TestBucket, []byte(fmt.Sprintf("key-%03d", i)), []byte("v")) == nil)
+		}
+		followersGone(t, p)
+		f, err = NewFollower(store, addr, FollowerOptions{Since: f.Version()})
+		assert.True(t, err == nil)
+		defer f.Close()
+		caughtUp(t, p, f)
+		keys, _ := store.KeyStringsWithoutValues(TestBucket, nil)
+		assert.Equal(t, 1+writes, len(keys))
+		for {
+			if followers := p.Followers(); len(followers) == 1 {
+				return followers[0].Snapshots
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	assert.Equal(t, 0, resume(10), "in the log")
+	assert.Equal(t, 1, resume(50), "behind the log")
+}
+
+// test the store of a follower is read only
+func TestFollowerStore(t *testing.T) {
+	_, p, addr := newPrimary(t, PrimaryOptions{})
+	store := newMemoryStore(t)
+	f, err := NewFollower(store, addr, FollowerOptions{})
+	assert.True(t, err == nil)
+	defer f.Close()
+
+	r := f.Store()
+	assert.True(t, r.ReadOnly())
+	assert.Equal(t, ReadOnlyError, r.Set(TestBucket, []byte("a"), []byte("1")))
+	assert.Equal(t, ReadOnlyError, r.Update(func(txn Txn) error { return nil }))
+	_, err = r.Incr(TestBucket, []byte("n"), 1)
+	assert.Equal(t, ReadOnlyError, err)
+	stats, err := r.Stats()
+	assert.True(t, err == nil && stats.ReadOnly)
+	assert.True(t, r.Close() == nil)
+	caughtUp(t, p, f)
+
+	assert.Equal(t, ReadOnlyError, r.Exec(func(txn *badger.Txn) error { return nil }))
+	assert.Equal(t, ReadOnlyError, r.Restore(nil))
+	_, ok := r.(unwrapper)
+	assert.True(t, !ok, "the store written by the follower is hidden")
+
+	_, err = NewPrimary(store, PrimaryOptions{})
+	assert.Equal(t, NotSupportedError, err)
+	_, err = NewFollower(r, addr, FollowerOptions{})
+	assert.Equal(t, NotSupportedError, err)
+}
+
+// test a primary of a wrapped badger store
+func TestPrimaryWrapped(t *testing.T) {
+	s, _, _ := newPrimary(t, PrimaryOptions{})
+	p, err := NewPrimary(Wrap(Wrap(s)), PrimaryOptions{})
+	assert.True(t, err == nil)
+	assert.True(t, p.Close() == nil)
+}
+
+// test readers of a badger follower while it applies updates, run it with -race
+func TestFollowerReads(t *testing.T) {
+	s, p, addr := newPrimary(t, PrimaryOptions{Heartbeat: 50 * time.Millisecond})
+	dir := getDataPath()
+	b, err := NewBadgerStore(badger.DefaultOptions(dir).WithLogger(nil))
+	assert.True(t, err == nil)
+	defer func() {
+		_ = b.Close()
+		_ = os.RemoveAll(dir)
+	}()
+	f, err := NewFollower(b, addr, FollowerOptions{})
+	assert.True(t, err == nil)
+	defer f.Close()
+
+	r := f.Store()
+	done := make(chan struct{})
+	read := make(chan int)
+	go func() {
+		n := 0
+		for {
+			select {
+			case <-done:
+				read <- n
+				return
+			default:
+			}
+			_, _, _ = r.Get(TestBucket, []byte("key-000"))
+			if c, err := r.Cursor(TestBucket, CursorOptions{}); err == nil {
+				for c.Seek(nil); c.Valid(); c.Next() {
+				}
+				_ = c.Close()
+			}
+			n++
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		assert.True(t, s.Set(TestBucket, []byte(fmt.Sprintf("key-%03d", i)), []byte("v")) == nil)
+	}
+	caughtUp(t, p, f)
+	close(done)
+	assert.True(t, <-read > 0)
+	keys, err := r.KeysWithoutValues(TestBucket, nil)
+	assert.True(t, err == nil)
+	assert.Equal(t, 200, len(keys))
+}
@@ -0,0 +1,88 @@
+package grpc
+
+import (
+	"errors"
+	kvstore "github.com/gmqio/kv-store"
+	"sync"
+	"time"
+)
+
+// getBatcher sends concurrent Gets of a bucket together as one PGet
+type getBatcher struct {
+	c      *Client
+	window time.Duration
+	max    int
+
+	lock    sync.Mutex
+	pending map[string]*getBatch // by bucket
+}
+
+// getBatch Gets of a bucket waiting to be sent
+type getBatch struct {
+	bucket []byte
+	keys   [][]byte
+	done   chan struct{}
+
+	// values, found and err of the PGet, set before done is closed
+	values [][]byte
+	found  []bool
+	err    error
+}
+
+func newGetBatcher(c *Client, window time.Duration, max int) *getBatcher {
+	return &getBatcher{c: c, window: window, max: max, pending: make(map[string]*getBatch)}
+}
+
+// get add a key to the batch of its bucket and wait for the batch. A server older than found of PGet fails
+// the whole PGet on a key not found, then every key of the batch is sent alone
+func (g *getBatcher) get(bucket, k []byte) ([]byte, bool, error) {
+	g.lock.Lock()
+	b := g.pending[string(bucket)]
+	if b == nil {
+		b = &getBatch{bucket: bucket, done: make(chan struct{})}
+		g.pending[string(bucket)] = b
+		time.AfterFunc(g.window, func() {
+			g.send(b)
+		})
+	}
+	i := len(b.keys)
+	b.keys = append(b.keys, k)
+	full := len(b.keys) == g.max
+	g.lock.Unlock()
+
+	if full {
+		g.send(b)
+	}
+	<-b.done
+	if errors.Is(b.err, kvstore.KeyNotFoundError) && len(b.keys) > 1 {
+		return g.c.get(bucket, k)
+	}
+	if b.err != nil {
+		return nil, false, b.err
+	}
+	if !b.found[i] {
+		return nil, false, kvstore.KeyNotFoundError
+	}
+	return b.values[i], true, nil
+}
+
+// send b if it is still pending, after the window or when it is full
+func (g *getBatcher) send(b *getBatch) {
+	g.lock.Lock()
+	if g.pending[string(b.bucket)] != b {
+		g.lock.Unlock()
+		return
+	}
+	delete(g.pending, string(b.bucket))
+	g.lock.Unlock()
+
+	if len(b.keys) == 1 {
+		var found bool
+		var v []byte
+		v, found, b.err = g.c.get(b.bucket, b.keys[0])
+		b.values, b.found = [][]byte{v}, []bool{found}
+	} else {
+		b.values, b.found, b.err = g.c.pget(b.bucket, b.keys)
+	}
+	close(b.done)
+}
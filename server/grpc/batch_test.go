@@ -0,0 +1,79 @@
+package grpc
+
+import (
+	"fmt"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/gmqio/kv-store/kvstoretest"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"sync"
+	"testing"
+	"time"
+)
+
+// getAll get keys concurrently, return values or errors by key
+func getAll(c *Client, bucket []byte, keys []string) map[string]any {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]any)
+	for _, k := range keys {
+		wg.Add(1)
+		go func(k string) {
+			defer wg.Done()
+			v, _, err := c.Get(bucket, []byte(k))
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				results[k] = err
+			} else {
+				results[k] = string(v)
+			}
+		}(k)
+	}
+	wg.Wait()
+	return results
+}
+
+// test concurrent gets are sent as PGets
+func TestBatchGet(t *testing.T) {
+	s := kvstoretest.Open(t, kvstore.EngineMemory, kvstore.Options{})
+	var keys []string
+	for i := 0; i < 50; i++ {
+		keys = append(keys, fmt.Sprintf("key-%02d", i))
+		_ = s.Set([]byte("meta"), []byte(keys[i]), []byte("v-"+keys[i]))
+	}
+	f := newFaults()
+	dial := serve(t, s, grpc.UnaryInterceptor(f.unary))
+	c, err := NewClient(ClientOptions{BatchWindow: 50 * time.Millisecond, MaxBatch: 20}, dial())
+	assert.True(t, err == nil)
+
+	results := getAll(c, []byte("meta"), keys)
+	for _, k := range keys {
+		assert.Equal(t, "v-"+k, results[k])
+	}
+	assert.Equal(t, 0, f.count("Get"))
+	assert.True(t, f.count("PGet") >= 3 && f.count("PGet") < 10, "%d", f.count("PGet"))
+
+	// a key not found is reported by found of the PGet, keys are not sent alone
+	pgets := f.count("PGet")
+	results = getAll(c, []byte("meta"), []string{"key-00", "key-01", "x"})
+	assert.Equal(t, "v-key-00", results["key-00"])
+	assert.Equal(t, "v-key-01", results["key-01"])
+	assert.Equal(t, kvstore.KeyNotFoundError, results["x"])
+	assert.Equal(t, 0, f.count("Get"))
+	assert.Equal(t, pgets+1, f.count("PGet"))
+
+	_, _, err = c.Get([]byte("meta"), []byte("y"))
+	assert.Equal(t, kvstore.KeyNotFoundError, err)
+	v, _, err := c.Get([]byte("meta"), []byte("key-02"))
+	assert.True(t, err == nil)
+	assert.Equal(t, "v-key-02", string(v))
+
+	// PGet without missing still fails on a key not found
+	_, err = c.PGet([]byte("meta"), [][]byte{[]byte("key-00"), []byte("x")})
+	assert.Equal(t, kvstore.KeyNotFoundError, err)
+	values, found, err := c.pget([]byte("meta"), [][]byte{[]byte("x"), []byte("key-00")})
+	assert.True(t, err == nil)
+	assert.Equal(t, []bool{false, true}, found)
+	assert.Equal(t, "v-key-00", string(values[1]))
+}
@@ -0,0 +1,597 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/gmqio/kv-store/server/grpc/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultBackoff wait before the first retry when ClientOptions.Backoff is 0
+	DefaultBackoff = 50 * time.Millisecond
+
+	// DefaultMaxBackoff max wait between retries when ClientOptions.MaxBackoff is 0
+	DefaultMaxBackoff = 2 * time.Second
+
+	// DefaultMaxBatch gets sent in a PGet when ClientOptions.MaxBatch is 0
+	DefaultMaxBatch = 128
+)
+
+// ClientOptions options of a Client
+type ClientOptions struct {
+	// PoolSize connections Dial opens, calls use them in turn. 0 is one connection
+	PoolSize int
+
+	// Timeout deadline of a call, of every attempt when it is retried. 0 is no deadline
+	Timeout time.Duration
+
+	// Retries times a read is sent again after an error of the connection or a deadline, 0 never retries.
+	// Writes are never sent again, a write may be applied when its error is returned
+	Retries int
+
+	// Backoff wait before the first retry, doubled for each next one up to MaxBackoff, with a random jitter
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// BatchWindow concurrent Gets of a bucket in the window are sent together as one PGet, 0 sends every Get
+	BatchWindow time.Duration
+
+	// MaxBatch gets of a PGet, a batch is sent when it is full
+	MaxBatch int
+}
+
+// Client a KvStore of a remote store. Cursors read streams of Keys, transactions run in the client and commit
+// with Commit, see Update. Exec, sequences, watches and backups need the store in the process, they return
+// NotSupportedError
+type Client struct {
+	conns   []*grpc.ClientConn // dialed by the client
+	clients []pb.KvStoreClient
+	next    atomic.Uint64
+	opts    ClientOptions
+	batcher *getBatcher // nil without BatchWindow
+	info    *pb.InfoResponse
+}
+
+var _ kvstore.KvStore = (*Client)(nil)
+
+// Dial open opts.PoolSize connections to a server, Close closes them
+func Dial(target string, opts ClientOptions, dialOpts ...grpc.DialOption) (*Client, error) {
+	conns := make([]*grpc.ClientConn, max(opts.PoolSize, 1))
+	pool := make([]grpc.ClientConnInterface, len(conns))
+	closeAll := func() {
+		for _, conn := range conns {
+			if conn != nil {
+				_ = conn.Close()
+			}
+		}
+	}
+	for i := range conns {
+		var err error
+		if conns[i], err = grpc.Dial(target, dialOpts...); err != nil {
+			closeAll()
+			return nil, err
+		}
+		pool[i] = conns[i]
+	}
+	c, err := NewClient(opts, pool...)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	c.conns = conns
+	return c, nil
+}
+
+// NewClient a store of connections used in turn, it reads what does not change of the store.
+// opts.PoolSize is ignored and Close does not close conns
+func NewClient(opts ClientOptions, conns ...grpc.ClientConnInterface) (*Client, error) {
+	if len(conns) == 0 {
+		return nil, errors.New("grpc: no connection")
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = DefaultMaxBatch
+	}
+	c := &Client{opts: opts}
+	for _, conn := range conns {
+		c.clients = append(c.clients, pb.NewKvStoreClient(conn))
+	}
+	if opts.BatchWindow > 0 {
+		c.batcher = newGetBatcher(c, opts.BatchWindow, opts.MaxBatch)
+	}
+	err := c.call(true, func(ctx context.Context, client pb.KvStoreClient) error {
+		var err error
+		c.info, err = client.Info(ctx, &pb.InfoRequest{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// noRetry an error of a read which must not be sent again
+type noRetry struct {
+	error
+}
+
+// call f with a connection of the pool and the deadline of a call, reads are retried.
+// The error is the error of kvstore of its status
+func (c *Client) call(read bool, f func(ctx context.Context, client pb.KvStoreClient) error) error {
+	backoff := c.opts.Backoff
+	for attempt := 0; ; attempt++ {
+		err := c.attempt(f)
+		var stop noRetry
+		if errors.As(err, &stop) {
+			return storeError(stop.error)
+		}
+		if err == nil || !read || attempt >= c.opts.Retries || !retryable(err) {
+			return storeError(err)
+		}
+		time.Sleep(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)))
+		backoff = min(2*backoff, c.opts.MaxBackoff)
+	}
+}
+
+func (c *Client) attempt(f func(ctx context.Context, client pb.KvStoreClient) error) error {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if c.opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+	}
+	defer cancel()
+	return f(ctx, c.client())
+}
+
+// client the next connection of the pool
+func (c *Client) client() pb.KvStoreClient {
+	return c.clients[(c.next.Add(1)-1)%uint64(len(c.clients))]
+}
+
+// retryable an error of the connection or a deadline, a closed store is not
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable:
+		return !errors.Is(storeError(err), kvstore.StoreClosedError)
+	case codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// remoteError an error of the remote store, it is the error of kvstore of its code and message
+type remoteError struct {
+	err error
+	msg string
+}
+
+func (e *remoteError) Error() string {
+	return e.msg
+}
+
+func (e *remoteError) Unwrap() error {
+	return e.err
+}
+
+// storeError the error of kvstore of a status, deadlines and cancels are errors of context,
+// other errors as they are
+func storeError(err error) error {
+	st, ok := status.FromError(err)
+	if err == nil || !ok {
+		return err
+	}
+	for _, e := range storeErrors {
+		if st.Code() != e.code || !strings.Contains(st.Message(), e.err.Error()) {
+			continue
+		}
+		if st.Message() == e.err.Error() {
+			return e.err
+		}
+		return &remoteError{err: e.err, msg: st.Message()}
+	}
+	switch st.Code() {
+	case codes.DeadlineExceeded:
+		return &remoteError{err: context.DeadlineExceeded, msg: err.Error()}
+	case codes.Canceled:
+		return &remoteError{err: context.Canceled, msg: err.Error()}
+	}
+	return err
+}
+
+func (c *Client) Set(bucket, k []byte, v []byte) error {
+	return c.SetWithTTL(bucket, k, v, 0)
+}
+
+// Get a key-value, concurrent Gets are sent together as one PGet with ClientOptions.BatchWindow
+func (c *Client) Get(bucket, k []byte) (result []byte, found bool, e error) {
+	if c.batcher != nil {
+		return c.batcher.get(bucket, k)
+	}
+	return c.get(bucket, k)
+}
+
+func (c *Client) get(bucket, k []byte) ([]byte, bool, error) {
+	var r *pb.GetResponse
+	err := c.call(true, func(ctx context.Context, client pb.KvStoreClient) error {
+		var err error
+		r, err = client.Get(ctx, &pb.GetRequest{Bucket: bucket, Key: k})
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if !r.Found {
+		return nil, false, kvstore.KeyNotFoundError
+	}
+	return r.Value, true, nil
+}
+
+func (c *Client) SetWithTTL(bucket, k []byte, v []byte, ttl time.Duration) error {
+	return c.call(false, func(ctx context.Context, client pb.KvStoreClient) error {
+		_, err := client.Set(ctx, &pb.SetRequest{Bucket: bucket, Key: k, Value: v, Ttl: int64(ttl)})
+		return err
+	})
+}
+
+func (c *Client) PSet(bucket []byte, keys, values [][]byte) error {
+	return c.PSetWithTTL(bucket, keys, values, 0)
+}
+
+func (c *Client) PSetWithTTL(bucket []byte, keys, values [][]byte, ttl time.Duration) error {
+	return c.call(false, func(ctx context.Context, client pb.KvStoreClient) error {
+		_, err := client.PSet(ctx, &pb.PSetRequest{Bucket: bucket, Keys: keys, Values: values, Ttl: int64(ttl)})
+		return err
+	})
+}
+
+func (c *Client) TTL(bucket, k []byte) (time.Duration, error) {
+	var r *pb.TTLResponse
+	err := c.call(true, func(ctx context.Context, client pb.KvStoreClient) error {
+		var err error
+		r, err = client.TTL(ctx, &pb.TTLRequest{Bucket: bucket, Key: k})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(r.Ttl), nil
+}
+
+func (c *Client) Persist(bucket, k []byte) error {
+	return c.call(false, func(ctx context.Context, client pb.KvStoreClient) error {
+		_, err := client.Persist(ctx, &pb.PersistRequest{Bucket: bucket, Key: k})
+		return err
+	})
+}
+
+func (c *Client) PGet(bucket []byte, keys [][]byte) ([][]byte, error) {
+	var r *pb.PGetResponse
+	err := c.call(true, func(ctx context.Context, client pb.KvStoreClient) error {
+		var err error
+		r, err = client.PGet(ctx, &pb.PGetRequest{Bucket: bucket, Keys: keys})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Values, nil
+}
+
+// pget values of keys and whether each key is found, a key not found does not fail the call
+func (c *Client) pget(bucket []byte, keys [][]byte) ([][]byte, []bool, error) {
+	var r *pb.PGetResponse
+	err := c.call(true, func(ctx context.Context, client pb.KvStoreClient) error {
+		var err error
+		r, err = client.PGet(ctx, &pb.PGetRequest{Bucket: bucket, Keys: keys, Missing: true})
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	found := r.Found
+	if found == nil {
+		// a server not knowing missing fails the call on a key not found, every key is found
+		found = make([]bool, len(r.Values))
+		for i := range found {
+			found[i] = true
+		}
+	}
+	if len(r.Values) != len(keys) || len(found) != len(keys) {
+		return nil, nil, fmt.Errorf("PGet of %d keys: %d values and %d found", len(keys), len(r.Values), len(found))
+	}
+	return r.Values, found, nil
+}
+
+func (c *Client) CompareAndSwap(bucket, k, expected, v []byte) error {
+	return c.call(false, func(ctx context.Context, client pb.KvStoreClient) error {
+		_, err := client.CompareAndSwap(ctx, &pb.CompareAndSwapRequest{Bucket: bucket, Key: k, Expected: expected, Value: v})
+		return err
+	})
+}
+
+func (c *Client) SetIfAbsent(bucket, k, v []byte) error {
+	return c.call(false, func(ctx context.Context, client pb.KvStoreClient) error {
+		_, err := client.SetIfAbsent(ctx, &pb.SetIfAbsentRequest{Bucket: bucket, Key: k, Value: v})
+		return err
+	})
+}
+
+func (c *Client) Incr(bucket, k []byte, delta int64) (int64, error) {
+	var r *pb.IncrResponse
+	err := c.call(false, func(ctx context.Context, client pb.KvStoreClient) error {
+		var err error
+		r, err = client.Incr(ctx, &pb.IncrRequest{Bucket: bucket, Key: k, Delta: delta})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return r.Value, nil
+}
+
+func (c *Client) Sequence(_, _ []byte, _ uint64) (kvstore.Sequence, error) {
+	return nil, kvstore.NotSupportedError
+}
+
+func (c *Client) Delete(bucket, key []byte) error {
+	return c.call(false, func(ctx context.Context, client pb.KvStoreClient) error {
+		_, err := client.Delete(ctx, &pb.DeleteRequest{Bucket: bucket, Key: key})
+		return err
+	})
+}
+
+func (c *Client) DeleteIfEquals(bucket, k, expected []byte) error {
+	return c.call(false, func(ctx context.Context, client pb.KvStoreClient) error {
+		_, err := client.DeleteIfEquals(ctx, &pb.DeleteIfEqualsRequest{Bucket: bucket, Key: k, Expected: expected})
+		return err
+	})
+}
+
+func (c *Client) DeleteKeys(bucket []byte, keys [][]byte) error {
+	return c.call(false, func(ctx context.Context, client pb.KvStoreClient) error {
+		_, err := client.DeleteKeys(ctx, &pb.DeleteKeysRequest{Bucket: bucket, Keys: keys})
+		return err
+	})
+}
+
+// keys read the stream of Keys, a retry reads it again from the first key
+func (c *Client) keys(bucket, prefix []byte, keysOnly bool) (keys [][]byte, values [][]byte, err error) {
+	err = c.call(true, func(ctx context.Context, client pb.KvStoreClient) error {
+		keys, values = nil, nil
+		stream, err := client.Keys(ctx, &pb.KeysRequest{Bucket: bucket, Prefix: prefix, KeysOnly: keysOnly})
+		if err != nil {
+			return err
+		}
+		for {
+			kv, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			keys = append(keys, kv.Key)
+			if !keysOnly {
+				values = append(values, kv.Value)
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys, values, nil
+}
+
+func (c *Client) Keys(bucket, prefix []byte) (keys [][]byte, values [][]byte, err error) {
+	return c.keys(bucket, prefix, false)
+}
+
+func (c *Client) KeyStrings(bucket, prefix []byte) (keys []string, values [][]byte, err error) {
+	bkeys, values, err := c.keys(bucket, prefix, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return toStrings(bkeys), values, nil
+}
+
+func (c *Client) KeysWithoutValues(bucket, prefix []byte) (keys [][]byte, err error) {
+	keys, _, err = c.keys(bucket, prefix, true)
+	return keys, err
+}
+
+func (c *Client) KeyStringsWithoutValues(bucket, prefix []byte) (keys []string, err error) {
+	bkeys, _, err := c.keys(bucket, prefix, true)
+	if err != nil {
+		return nil, err
+	}
+	return toStrings(bkeys), nil
+}
+
+func toStrings(keys [][]byte) []string {
+	result := make([]string, len(keys))
+	for i, k := range keys {
+		result[i] = string(k)
+	}
+	return result
+}
+
+// Cursor of a bucket reading a stream of Keys, see clientCursor
+func (c *Client) Cursor(bucket []byte, opts kvstore.CursorOptions) (kvstore.Cursor, error) {
+	return &clientCursor{c: c, bucket: bucket, opts: opts}, nil
+}
+
+func (c *Client) Range(bucket []byte, opts kvstore.RangeOptions) (kvstore.RangePage, error) {
+	var r *pb.RangeResponse
+	err := c.call(true, func(ctx context.Context, client pb.KvStoreClient) error {
+		var err error
+		r, err = client.Range(ctx, &pb.RangeRequest{
+			Bucket:   bucket,
+			Prefix:   opts.Prefix,
+			Start:    opts.Start,
+			End:      opts.End,
+			Limit:    int32(opts.Limit),
+			Reverse:  opts.Reverse,
+			KeysOnly: opts.KeysOnly,
+			Token:    opts.Token,
+		})
+		return err
+	})
+	if err != nil {
+		return kvstore.RangePage{}, err
+	}
+	return kvstore.RangePage{Keys: r.Keys, Values: r.Values, Token: r.Token}, nil
+}
+
+func (c *Client) Watch(_ context.Context, _, _ []byte) (<-chan kvstore.Event, error) {
+	return nil, kvstore.NotSupportedError
+}
+
+func (c *Client) WatchFrom(_ context.Context, _, _ []byte, _ uint64) (<-chan kvstore.Event, error) {
+	return nil, kvstore.NotSupportedError
+}
+
+func (c *Client) Buckets() ([][]byte, error) {
+	var r *pb.BucketsResponse
+	err := c.call(true, func(ctx context.Context, client pb.KvStoreClient) error {
+		var err error
+		r, err = client.Buckets(ctx, &pb.BucketsRequest{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Buckets, nil
+}
+
+// AllKeys is retried until the first key is passed to async
+func (c *Client) AllKeys(async func(key string, deletedOrExpired bool)) error {
+	return c.call(true, func(ctx context.Context, client pb.KvStoreClient) error {
+		stream, err := client.AllKeys(ctx, &pb.AllKeysRequest{})
+		if err != nil {
+			return err
+		}
+		for visited := false; ; visited = true {
+			r, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil && visited {
+				return noRetry{err}
+			}
+			if err != nil {
+				return err
+			}
+			async(r.Key, r.DeletedOrExpired)
+		}
+	})
+}
+
+// Close the connections dialed by the client, the remote store stays open
+func (c *Client) Close() error {
+	var err error
+	for _, conn := range c.conns {
+		err = errors.Join(err, conn.Close())
+	}
+	return err
+}
+
+func (c *Client) Sync() error {
+	return c.call(false, func(ctx context.Context, client pb.KvStoreClient) error {
+		_, err := client.Sync(ctx, &pb.SyncRequest{})
+		return err
+	})
+}
+
+func (c *Client) GC(discardRatio float64) (int, error) {
+	var r *pb.GCResponse
+	err := c.call(false, func(ctx context.Context, client pb.KvStoreClient) error {
+		var err error
+		r, err = client.GC(ctx, &pb.GCRequest{DiscardRatio: discardRatio})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(r.Rewritten), nil
+}
+
+func (c *Client) Stats() (kvstore.Stats, error) {
+	var r *pb.StatsResponse
+	err := c.call(true, func(ctx context.Context, client pb.KvStoreClient) error {
+		var err error
+		r, err = client.Stats(ctx, &pb.StatsRequest{})
+		return err
+	})
+	if err != nil {
+		return kvstore.Stats{}, err
+	}
+	return kvstore.Stats{
+		Engine:    r.Engine,
+		KeyFormat: kvstore.KeyFormat(r.KeyFormat),
+		ReadOnly:  r.ReadOnly,
+		Keys:      r.Keys,
+		Tables:    int(r.Tables),
+		LSMSize:   r.LsmSize,
+		VLogSize:  r.VlogSize,
+	}, nil
+}
+
+func (c *Client) Backup(_ io.Writer, since uint64, _ ...[]byte) (uint64, error) {
+	return since, kvstore.NotSupportedError
+}
+
+func (c *Client) Restore(_ io.Reader) error {
+	return kvstore.NotSupportedError
+}
+
+// Update run f with reads of the remote store and writes kept in the client, then Commit sends the writes
+// with the values f read. The commit fails with TxnConflictError when one of them changed, f runs again up
+// to MaxTxnRetries times
+func (c *Client) Update(f func(txn kvstore.Txn) error) error {
+	return c.txn(f, false, false)
+}
+
+// View run f with reads of the remote store, Commit checks the values f read did not change so f saw them
+// all at once, or f runs again like Update
+func (c *Client) View(f func(txn kvstore.Txn) error) error {
+	return c.txn(f, true, false)
+}
+
+// Batch run f with reads of the remote store and writes kept in the client, sent with Commit in batches of
+// maxCommitSize. Reads are not checked
+func (c *Client) Batch(f func(txn kvstore.Txn) error) error {
+	return c.txn(f, false, true)
+}
+
+func (c *Client) Exec(_ func(txn *badger.Txn) error) error {
+	return kvstore.NotSupportedError
+}
+
+// ReadOnly of the remote store when the client was created
+func (c *Client) ReadOnly() bool {
+	return c.info.ReadOnly
+}
+
+// Path of the remote store on its host
+func (c *Client) Path() []string {
+	return c.info.Path
+}
+
+func (c *Client) KeyFormat() kvstore.KeyFormat {
+	return kvstore.KeyFormat(c.info.KeyFormat)
+}
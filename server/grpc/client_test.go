@@ -0,0 +1,332 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/gmqio/kv-store/kvstoretest"
+	"github.com/gmqio/kv-store/server/grpc/pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newClient(t *testing.T, store kvstore.KvStore) *Client {
+	c, err := NewClient(ClientOptions{}, serve(t, store)())
+	assert.True(t, err == nil)
+	return c
+}
+
+// test a client works like the store it connects to
+func TestClient(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		c := newClient(t, s)
+		bucket := []byte("meta")
+
+		assert.True(t, c.Set(bucket, []byte("a"), []byte("1")) == nil)
+		v, found, err := c.Get(bucket, []byte("a"))
+		assert.True(t, err == nil && found)
+		assert.Equal(t, "1", string(v))
+		_, found, err = c.Get(bucket, []byte("x"))
+		assert.True(t, !found && err == kvstore.KeyNotFoundError)
+
+		assert.True(t, c.SetWithTTL(bucket, []byte("b"), []byte("2"), time.Hour) == nil)
+		ttl, err := c.TTL(bucket, []byte("b"))
+		assert.True(t, err == nil && ttl > 59*time.Minute)
+		assert.True(t, c.Persist(bucket, []byte("b")) == nil)
+		ttl, _ = c.TTL(bucket, []byte("b"))
+		assert.Equal(t, time.Duration(0), ttl)
+
+		assert.True(t, c.PSet(bucket, [][]byte{[]byte("c"), []byte("d")}, [][]byte{[]byte("3"), []byte("4")}) == nil)
+		values, err := c.PGet(bucket, [][]byte{[]byte("d"), []byte("c")})
+		assert.True(t, err == nil)
+		assert.Equal(t, [][]byte{[]byte("4"), []byte("3")}, values)
+		_, err = c.PGet(bucket, [][]byte{[]byte("x")})
+		assert.True(t, errors.Is(err, kvstore.KeyNotFoundError))
+
+		assert.True(t, c.CompareAndSwap(bucket, []byte("a"), []byte("1"), []byte("5")) == nil)
+		assert.Equal(t, kvstore.PreconditionFailedError, c.CompareAndSwap(bucket, []byte("a"), []byte("1"), []byte("6")))
+		assert.Equal(t, kvstore.PreconditionFailedError, c.SetIfAbsent(bucket, []byte("a"), []byte("6")))
+		assert.Equal(t, kvstore.PreconditionFailedError, c.DeleteIfEquals(bucket, []byte("a"), []byte("1")))
+		n, err := c.Incr(bucket, []byte("n"), 3)
+		assert.True(t, err == nil)
+		assert.Equal(t, int64(3), n)
+		_, err = c.Incr(bucket, []byte("c"), 1)
+		assert.True(t, err == nil)
+		_, err = c.Incr(bucket, []byte("b"), 1)
+		assert.True(t, err == nil)
+		_ = c.Set(bucket, []byte("s"), []byte("text"))
+		_, err = c.Incr(bucket, []byte("s"), 1)
+		assert.True(t, errors.Is(err, kvstore.NotIntegerError))
+		assert.Equal(t, "value is not an integer or out of range: \"text\"", err.Error())
+
+		keys, values, err := c.KeyStrings(bucket, nil)
+		assert.True(t, err == nil)
+		assert.Equal(t, []string{"a", "b", "c", "d", "n", "s"}, keys)
+		assert.Equal(t, "5", string(values[0]))
+		bkeys, err := c.KeysWithoutValues(bucket, []byte("c"))
+		assert.True(t, err == nil)
+		assert.Equal(t, [][]byte{[]byte("c")}, bkeys)
+
+		page, err := c.Range(bucket, kvstore.RangeOptions{Start: []byte("b"), Limit: 2, KeysOnly: true})
+		assert.True(t, err == nil)
+		assert.Equal(t, [][]byte{[]byte("b"), []byte("c")}, page.Keys)
+		page, err = c.Range(bucket, kvstore.RangeOptions{Start: []byte("b"), Limit: 2, KeysOnly: true, Token: page.Token})
+		assert.True(t, err == nil)
+		assert.Equal(t, [][]byte{[]byte("d"), []byte("n")}, page.Keys)
+		_, err = c.Range(bucket, kvstore.RangeOptions{Token: "bad"})
+		assert.Equal(t, kvstore.InvalidTokenError, err)
+
+		assert.True(t, c.Delete(bucket, []byte("a")) == nil)
+		assert.True(t, c.DeleteKeys(bucket, [][]byte{[]byte("b"), []byte("c")}) == nil)
+		keys, _ = c.KeyStringsWithoutValues(bucket, nil)
+		assert.Equal(t, []string{"d", "n", "s"}, keys)
+
+		_ = c.Set([]byte("topics"), []byte("orders"), []byte("1"))
+		buckets, err := c.Buckets()
+		assert.True(t, err == nil)
+		assert.Equal(t, [][]byte{[]byte("meta"), []byte("topics")}, buckets)
+		count := 0
+		assert.True(t, c.AllKeys(func(string, bool) { count++ }) == nil)
+		assert.Equal(t, 4, count)
+
+		assert.True(t, c.Sync() == nil)
+		_, err = c.GC(0.5)
+		assert.True(t, err == nil)
+		stats, err := c.Stats()
+		assert.True(t, err == nil)
+		local, _ := s.Stats()
+		assert.Equal(t, local, stats)
+		assert.Equal(t, s.KeyFormat(), c.KeyFormat())
+		assert.False(t, c.ReadOnly())
+	})
+}
+
+// test cursors of a client visit keys like cursors of the store
+func TestClientCursor(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		c := newClient(t, s)
+		bucket := []byte("meta")
+		for _, k := range []string{"a", "b1", "b2", "b3", "c"} {
+			assert.True(t, s.Set(bucket, []byte(k), []byte("v"+k)) == nil)
+		}
+		assert.True(t, s.Update(func(txn kvstore.Txn) error {
+			return txn.SetWithMeta(bucket, []byte("d"), []byte("vd"), 7, time.Hour)
+		}) == nil)
+		_ = s.Set([]byte("other"), []byte("a"), []byte("1"))
+
+		visit := func(store kvstore.KvStore, opts kvstore.CursorOptions) (keys []string) {
+			cursor, err := store.Cursor(bucket, opts)
+			assert.True(t, err == nil)
+			for cursor.Seek(nil); cursor.Valid(); cursor.Next() {
+				v, err := cursor.Value()
+				assert.True(t, err == nil)
+				keys = append(keys, string(cursor.Key())+"="+string(v))
+			}
+			assert.True(t, cursor.Close() == nil)
+			return keys
+		}
+		for _, opts := range []kvstore.CursorOptions{
+			{},
+			{Prefix: []byte("b")},
+			{Start: []byte("b2"), End: []byte("d")},
+			{Reverse: true},
+			{Reverse: true, Prefix: []byte("b"), KeysOnly: true},
+			{Limit: 2},
+		} {
+			assert.Equal(t, visit(s, opts), visit(c, opts), fmt.Sprintf("%+v", opts))
+		}
+
+		cursor, err := c.Cursor(bucket, kvstore.CursorOptions{})
+		assert.True(t, err == nil)
+		assert.True(t, cursor.Seek([]byte("b")))
+		assert.Equal(t, "b1", string(cursor.Key()))
+		assert.True(t, cursor.Next() && cursor.Next())
+		assert.Equal(t, "b3", string(cursor.Key()))
+		assert.True(t, cursor.Prev())
+		assert.Equal(t, "b2", string(cursor.Key()))
+		assert.True(t, cursor.Next())
+		assert.Equal(t, "b3", string(cursor.Key()))
+		assert.True(t, cursor.Seek([]byte("d")))
+		assert.True(t, cursor.ExpiresAt() > uint64(time.Now().Unix()))
+		assert.Equal(t, byte(7), cursor.UserMeta())
+		assert.False(t, cursor.Next())
+		assert.False(t, cursor.Valid())
+		assert.True(t, cursor.Close() == nil)
+	})
+}
+
+// test transactions of a client read their writes and run again after a conflict
+func TestClientTxn(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		c := newClient(t, s)
+		bucket := []byte("meta")
+		_ = s.Set(bucket, []byte("a"), []byte("1"))
+		_ = s.Set(bucket, []byte("b"), []byte("2"))
+
+		err := c.Update(func(txn kvstore.Txn) error {
+			_ = txn.Set(bucket, []byte("c"), []byte("3"))
+			_ = txn.Delete(bucket, []byte("a"))
+			v, err := txn.Get(bucket, []byte("c"))
+			assert.True(t, err == nil)
+			assert.Equal(t, "3", string(v))
+			_, err = txn.Get(bucket, []byte("a"))
+			assert.Equal(t, kvstore.KeyNotFoundError, err)
+			var keys []string
+			assert.True(t, txn.Scan(bucket, nil, func(k, v []byte) error {
+				keys = append(keys, string(k)+"="+string(v))
+				return nil
+			}) == nil)
+			assert.Equal(t, []string{"b=2", "c=3"}, keys)
+			return nil
+		})
+		assert.True(t, err == nil)
+		keys, _ := s.KeyStringsWithoutValues(bucket, nil)
+		assert.Equal(t, []string{"b", "c"}, keys)
+
+		runs := 0
+		err = c.Update(func(txn kvstore.Txn) error {
+			runs++
+			v, err := txn.Get(bucket, []byte("b"))
+			if err != nil {
+				return err
+			}
+			if runs == 1 {
+				_ = s.Set(bucket, []byte("b"), []byte("20"))
+			}
+			return txn.Set(bucket, []byte("d"), append(v, '!'))
+		})
+		assert.True(t, err == nil)
+		assert.Equal(t, 2, runs)
+		v, _, _ := s.Get(bucket, []byte("d"))
+		assert.Equal(t, "20!", string(v))
+
+		runs = 0
+		err = c.Update(func(txn kvstore.Txn) error {
+			runs++
+			_, _ = txn.Get(bucket, []byte("b"))
+			_ = s.Set(bucket, []byte("b"), []byte(fmt.Sprint(runs)))
+			return txn.Set(bucket, []byte("e"), []byte("1"))
+		})
+		assert.Equal(t, kvstore.TxnConflictError, err)
+		assert.Equal(t, kvstore.MaxTxnRetries+1, runs)
+
+		assert.True(t, c.View(func(txn kvstore.Txn) error {
+			v, err := txn.Get(bucket, []byte("c"))
+			assert.True(t, err == nil)
+			assert.Equal(t, "3", string(v))
+			_, err = txn.Get(bucket, []byte("x"))
+			assert.Equal(t, kvstore.KeyNotFoundError, err)
+			assert.Equal(t, kvstore.ReadOnlyError, txn.Set(bucket, []byte("x"), []byte("1")))
+			return nil
+		}) == nil)
+
+		assert.True(t, c.Batch(func(txn kvstore.Txn) error {
+			for i := 0; i < 300; i++ {
+				if err := txn.Set([]byte("batch"), []byte(fmt.Sprintf("%03d", i)), make([]byte, 10<<10)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}) == nil)
+		keys, _ = s.KeyStringsWithoutValues([]byte("batch"), nil)
+		assert.Equal(t, 300, len(keys))
+	})
+}
+
+// test what needs a store in the process
+func TestClientNotSupported(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		c := newClient(t, s)
+		_, err := c.Backup(&bytes.Buffer{}, 0)
+		assert.Equal(t, kvstore.NotSupportedError, err)
+		_, err = c.Watch(context.Background(), nil, nil)
+		assert.Equal(t, kvstore.NotSupportedError, err)
+		assert.True(t, c.Close() == nil)
+	})
+}
+
+// test errors of a read only store
+func TestClientReadOnly(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{ReadOnly: true}, func(t *testing.T, s kvstore.KvStore) {
+		c := newClient(t, s)
+		assert.True(t, c.ReadOnly())
+		assert.Equal(t, kvstore.ReadOnlyError, c.Set([]byte("meta"), []byte("a"), []byte("1")))
+	})
+}
+
+// test reads are retried after errors of the connection, writes are not
+func TestClientRetry(t *testing.T) {
+	f := newFaults()
+	dial := serve(t, kvstoretest.Open(t, kvstore.EngineMemory, kvstore.Options{}), grpc.UnaryInterceptor(f.unary))
+	c, err := NewClient(ClientOptions{Retries: 2, Backoff: time.Millisecond}, dial())
+	assert.True(t, err == nil)
+
+	f.fail["Set"] = 1
+	err = c.Set([]byte("meta"), []byte("a"), []byte("1"))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 1, f.count("Set"))
+
+	assert.True(t, c.Set([]byte("meta"), []byte("a"), []byte("1")) == nil)
+	f.fail["Get"] = 2
+	v, _, err := c.Get([]byte("meta"), []byte("a"))
+	assert.True(t, err == nil)
+	assert.Equal(t, "1", string(v))
+	assert.Equal(t, 3, f.count("Get"))
+
+	f.fail["Get"] = 3
+	_, _, err = c.Get([]byte("meta"), []byte("a"))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 6, f.count("Get"))
+
+	// a key not found is not retried
+	_, _, err = c.Get([]byte("meta"), []byte("x"))
+	assert.Equal(t, kvstore.KeyNotFoundError, err)
+	assert.Equal(t, 7, f.count("Get"))
+}
+
+// test a deadline of a call
+func TestClientTimeout(t *testing.T) {
+	f := newFaults()
+	dial := serve(t, kvstoretest.Open(t, kvstore.EngineMemory, kvstore.Options{}), grpc.UnaryInterceptor(f.unary))
+	c, err := NewClient(ClientOptions{Timeout: 20 * time.Millisecond}, dial())
+	assert.True(t, err == nil)
+	f.delay = 200 * time.Millisecond
+	_, _, err = c.Get([]byte("meta"), []byte("a"))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+}
+
+// test calls use every connection of the pool
+func TestClientPool(t *testing.T) {
+	l := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	pb.RegisterKvStoreServer(gs, NewServer(kvstoretest.Open(t, kvstore.EngineMemory, kvstore.Options{})))
+	go func() {
+		_ = gs.Serve(l)
+	}()
+	defer gs.Stop()
+
+	var dials atomic.Int32
+	c, err := Dial("bufnet", ClientOptions{PoolSize: 3},
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			dials.Add(1)
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.True(t, err == nil)
+	for i := 0; i < 6; i++ {
+		assert.True(t, c.Set([]byte("meta"), []byte("a"), []byte("1")) == nil)
+	}
+	assert.Equal(t, int32(3), dials.Load())
+	assert.True(t, c.Close() == nil)
+	assert.True(t, c.Set([]byte("meta"), []byte("a"), []byte("1")) != nil)
+}
@@ -0,0 +1,159 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/gmqio/kv-store/server/grpc/pb"
+	"io"
+)
+
+// clientCursor a cursor reading a stream of Keys. Seek opens a new stream, so does a move against the order
+// of the stream, then keys written since the last stream are seen. Streams have no deadline of
+// ClientOptions.Timeout and are not retried, an error of a stream ends the cursor and Close returns it
+type clientCursor struct {
+	c         *Client
+	bucket    []byte
+	opts      kvstore.CursorOptions
+	stream    pb.KvStore_KeysClient // nil when closed
+	cancel    context.CancelFunc
+	ascending bool // order of stream
+	kv        *pb.KeyValue
+	count     int
+	err       error
+}
+
+// open a stream from key in ascending or descending order
+func (c *clientCursor) open(key []byte, ascending bool) bool {
+	c.stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := c.c.client().Keys(ctx, &pb.KeysRequest{
+		Bucket:   c.bucket,
+		Prefix:   c.opts.Prefix,
+		KeysOnly: c.opts.KeysOnly,
+		Start:    c.opts.Start,
+		End:      c.opts.End,
+		Reverse:  !ascending,
+		Seek:     key,
+	})
+	if err != nil {
+		cancel()
+		c.err = storeError(err)
+		return false
+	}
+	c.stream, c.cancel, c.ascending = stream, cancel, ascending
+	return true
+}
+
+// stop the stream
+func (c *clientCursor) stop() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.stream, c.cancel = nil, nil
+}
+
+// settle on the next key of the stream, skipping a key equal to skip
+func (c *clientCursor) settle(skip []byte) bool {
+	c.kv = nil
+	for c.stream != nil {
+		kv, err := c.stream.Recv()
+		if err != nil {
+			if err != io.EOF {
+				c.err = storeError(err)
+			}
+			c.stop()
+			return false
+		}
+		if skip != nil && bytes.Equal(kv.Key, skip) {
+			continue
+		}
+		c.kv = kv
+		return true
+	}
+	return false
+}
+
+func (c *clientCursor) Seek(key []byte) bool {
+	c.count = 1
+	c.kv = nil
+	if !c.open(key, !c.opts.Reverse) {
+		return false
+	}
+	return c.settle(nil)
+}
+
+func (c *clientCursor) Next() bool {
+	if c.opts.Limit > 0 && c.count >= c.opts.Limit {
+		c.stop()
+		c.kv = nil
+		return false
+	}
+	c.count++
+	return c.move(!c.opts.Reverse)
+}
+
+func (c *clientCursor) Prev() bool {
+	c.count--
+	return c.move(c.opts.Reverse)
+}
+
+// move one key in ascending or descending order
+func (c *clientCursor) move(ascending bool) bool {
+	if c.kv == nil {
+		return false
+	}
+	if c.stream != nil && c.ascending == ascending {
+		return c.settle(nil)
+	}
+	key := c.kv.Key
+	if !c.open(key, ascending) {
+		c.kv = nil
+		return false
+	}
+	return c.settle(key)
+}
+
+func (c *clientCursor) Valid() bool {
+	return c.kv != nil
+}
+
+func (c *clientCursor) Key() []byte {
+	if c.kv == nil {
+		return nil
+	}
+	return c.kv.Key
+}
+
+// Value at the cursor, a Get with KeysOnly
+func (c *clientCursor) Value() ([]byte, error) {
+	if c.kv == nil {
+		return nil, kvstore.KeyNotFoundError
+	}
+	if !c.opts.KeysOnly {
+		return c.kv.Value, nil
+	}
+	v, _, err := c.c.get(c.bucket, c.kv.Key)
+	return v, err
+}
+
+func (c *clientCursor) ExpiresAt() uint64 {
+	if c.kv == nil {
+		return 0
+	}
+	return c.kv.ExpiresAt
+}
+
+func (c *clientCursor) UserMeta() byte {
+	if c.kv == nil {
+		return 0
+	}
+	return byte(c.kv.UserMeta)
+}
+
+// Close stop the stream, the error of a stream which failed
+func (c *clientCursor) Close() error {
+	c.stop()
+	c.kv = nil
+	return c.err
+}
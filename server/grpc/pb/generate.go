@@ -0,0 +1,4 @@
+// Package pb messages and service of server/grpc generated from kvstore.proto
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative kvstore.proto
@@ -0,0 +1,917 @@
+// KvStore service of a store, methods are like methods of kvstore.KvStore.
+// Errors of the store have a code and the message of the error, see server/grpc
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: kvstore.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	KvStore_Set_FullMethodName            = "/kvstore.v1.KvStore/Set"
+	KvStore_Get_FullMethodName            = "/kvstore.v1.KvStore/Get"
+	KvStore_PSet_FullMethodName           = "/kvstore.v1.KvStore/PSet"
+	KvStore_PGet_FullMethodName           = "/kvstore.v1.KvStore/PGet"
+	KvStore_TTL_FullMethodName            = "/kvstore.v1.KvStore/TTL"
+	KvStore_Persist_FullMethodName        = "/kvstore.v1.KvStore/Persist"
+	KvStore_CompareAndSwap_FullMethodName = "/kvstore.v1.KvStore/CompareAndSwap"
+	KvStore_SetIfAbsent_FullMethodName    = "/kvstore.v1.KvStore/SetIfAbsent"
+	KvStore_Incr_FullMethodName           = "/kvstore.v1.KvStore/Incr"
+	KvStore_Delete_FullMethodName         = "/kvstore.v1.KvStore/Delete"
+	KvStore_DeleteIfEquals_FullMethodName = "/kvstore.v1.KvStore/DeleteIfEquals"
+	KvStore_DeleteKeys_FullMethodName     = "/kvstore.v1.KvStore/DeleteKeys"
+	KvStore_Keys_FullMethodName           = "/kvstore.v1.KvStore/Keys"
+	KvStore_Range_FullMethodName          = "/kvstore.v1.KvStore/Range"
+	KvStore_Commit_FullMethodName         = "/kvstore.v1.KvStore/Commit"
+	KvStore_Buckets_FullMethodName        = "/kvstore.v1.KvStore/Buckets"
+	KvStore_AllKeys_FullMethodName        = "/kvstore.v1.KvStore/AllKeys"
+	KvStore_Sync_FullMethodName           = "/kvstore.v1.KvStore/Sync"
+	KvStore_GC_FullMethodName             = "/kvstore.v1.KvStore/GC"
+	KvStore_Stats_FullMethodName          = "/kvstore.v1.KvStore/Stats"
+	KvStore_Info_FullMethodName           = "/kvstore.v1.KvStore/Info"
+)
+
+// KvStoreClient is the client API for KvStore service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type KvStoreClient interface {
+	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	PSet(ctx context.Context, in *PSetRequest, opts ...grpc.CallOption) (*PSetResponse, error)
+	PGet(ctx context.Context, in *PGetRequest, opts ...grpc.CallOption) (*PGetResponse, error)
+	TTL(ctx context.Context, in *TTLRequest, opts ...grpc.CallOption) (*TTLResponse, error)
+	Persist(ctx context.Context, in *PersistRequest, opts ...grpc.CallOption) (*PersistResponse, error)
+	CompareAndSwap(ctx context.Context, in *CompareAndSwapRequest, opts ...grpc.CallOption) (*CompareAndSwapResponse, error)
+	SetIfAbsent(ctx context.Context, in *SetIfAbsentRequest, opts ...grpc.CallOption) (*SetIfAbsentResponse, error)
+	Incr(ctx context.Context, in *IncrRequest, opts ...grpc.CallOption) (*IncrResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	DeleteIfEquals(ctx context.Context, in *DeleteIfEqualsRequest, opts ...grpc.CallOption) (*DeleteIfEqualsResponse, error)
+	DeleteKeys(ctx context.Context, in *DeleteKeysRequest, opts ...grpc.CallOption) (*DeleteKeysResponse, error)
+	// Keys stream keys and values with prefix in a bucket in order
+	Keys(ctx context.Context, in *KeysRequest, opts ...grpc.CallOption) (KvStore_KeysClient, error)
+	Range(ctx context.Context, in *RangeRequest, opts ...grpc.CallOption) (*RangeResponse, error)
+	// Commit apply the writes of a transaction run by the client if the values it read did not change since,
+	// ABORTED when one did
+	Commit(ctx context.Context, in *CommitRequest, opts ...grpc.CallOption) (*CommitResponse, error)
+	Buckets(ctx context.Context, in *BucketsRequest, opts ...grpc.CallOption) (*BucketsResponse, error)
+	// AllKeys stream every key of the engine
+	AllKeys(ctx context.Context, in *AllKeysRequest, opts ...grpc.CallOption) (KvStore_AllKeysClient, error)
+	Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*SyncResponse, error)
+	GC(ctx context.Context, in *GCRequest, opts ...grpc.CallOption) (*GCResponse, error)
+	Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error)
+	// Info what does not change while the store is open
+	Info(ctx context.Context, in *InfoRequest, opts ...grpc.CallOption) (*InfoResponse, error)
+}
+
+type kvStoreClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewKvStoreClient(cc grpc.ClientConnInterface) KvStoreClient {
+	return &kvStoreClient{cc}
+}
+
+func (c *kvStoreClient) Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, KvStore_Set_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, KvStore_Get_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) PSet(ctx context.Context, in *PSetRequest, opts ...grpc.CallOption) (*PSetResponse, error) {
+	out := new(PSetResponse)
+	err := c.cc.Invoke(ctx, KvStore_PSet_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) PGet(ctx context.Context, in *PGetRequest, opts ...grpc.CallOption) (*PGetResponse, error) {
+	out := new(PGetResponse)
+	err := c.cc.Invoke(ctx, KvStore_PGet_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) TTL(ctx context.Context, in *TTLRequest, opts ...grpc.CallOption) (*TTLResponse, error) {
+	out := new(TTLResponse)
+	err := c.cc.Invoke(ctx, KvStore_TTL_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) Persist(ctx context.Context, in *PersistRequest, opts ...grpc.CallOption) (*PersistResponse, error) {
+	out := new(PersistResponse)
+	err := c.cc.Invoke(ctx, KvStore_Persist_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) CompareAndSwap(ctx context.Context, in *CompareAndSwapRequest, opts ...grpc.CallOption) (*CompareAndSwapResponse, error) {
+	out := new(CompareAndSwapResponse)
+	err := c.cc.Invoke(ctx, KvStore_CompareAndSwap_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) SetIfAbsent(ctx context.Context, in *SetIfAbsentRequest, opts ...grpc.CallOption) (*SetIfAbsentResponse, error) {
+	out := new(SetIfAbsentResponse)
+	err := c.cc.Invoke(ctx, KvStore_SetIfAbsent_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) Incr(ctx context.Context, in *IncrRequest, opts ...grpc.CallOption) (*IncrResponse, error) {
+	out := new(IncrResponse)
+	err := c.cc.Invoke(ctx, KvStore_Incr_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, KvStore_Delete_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) DeleteIfEquals(ctx context.Context, in *DeleteIfEqualsRequest, opts ...grpc.CallOption) (*DeleteIfEqualsResponse, error) {
+	out := new(DeleteIfEqualsResponse)
+	err := c.cc.Invoke(ctx, KvStore_DeleteIfEquals_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) DeleteKeys(ctx context.Context, in *DeleteKeysRequest, opts ...grpc.CallOption) (*DeleteKeysResponse, error) {
+	out := new(DeleteKeysResponse)
+	err := c.cc.Invoke(ctx, KvStore_DeleteKeys_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) Keys(ctx context.Context, in *KeysRequest, opts ...grpc.CallOption) (KvStore_KeysClient, error) {
+	stream, err := c.cc.NewStream(ctx, &KvStore_ServiceDesc.Streams[0], KvStore_Keys_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kvStoreKeysClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type KvStore_KeysClient interface {
+	Recv() (*KeyValue, error)
+	grpc.ClientStream
+}
+
+type kvStoreKeysClient struct {
+	grpc.ClientStream
+}
+
+func (x *kvStoreKeysClient) Recv() (*KeyValue, error) {
+	m := new(KeyValue)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *kvStoreClient) Range(ctx context.Context, in *RangeRequest, opts ...grpc.CallOption) (*RangeResponse, error) {
+	out := new(RangeResponse)
+	err := c.cc.Invoke(ctx, KvStore_Range_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) Commit(ctx context.Context, in *CommitRequest, opts ...grpc.CallOption) (*CommitResponse, error) {
+	out := new(CommitResponse)
+	err := c.cc.Invoke(ctx, KvStore_Commit_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) Buckets(ctx context.Context, in *BucketsRequest, opts ...grpc.CallOption) (*BucketsResponse, error) {
+	out := new(BucketsResponse)
+	err := c.cc.Invoke(ctx, KvStore_Buckets_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) AllKeys(ctx context.Context, in *AllKeysRequest, opts ...grpc.CallOption) (KvStore_AllKeysClient, error) {
+	stream, err := c.cc.NewStream(ctx, &KvStore_ServiceDesc.Streams[1], KvStore_AllKeys_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kvStoreAllKeysClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type KvStore_AllKeysClient interface {
+	Recv() (*AllKeysResponse, error)
+	grpc.ClientStream
+}
+
+type kvStoreAllKeysClient struct {
+	grpc.ClientStream
+}
+
+func (x *kvStoreAllKeysClient) Recv() (*AllKeysResponse, error) {
+	m := new(AllKeysResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *kvStoreClient) Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (*SyncResponse, error) {
+	out := new(SyncResponse)
+	err := c.cc.Invoke(ctx, KvStore_Sync_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) GC(ctx context.Context, in *GCRequest, opts ...grpc.CallOption) (*GCResponse, error) {
+	out := new(GCResponse)
+	err := c.cc.Invoke(ctx, KvStore_GC_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error) {
+	out := new(StatsResponse)
+	err := c.cc.Invoke(ctx, KvStore_Stats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kvStoreClient) Info(ctx context.Context, in *InfoRequest, opts ...grpc.CallOption) (*InfoResponse, error) {
+	out := new(InfoResponse)
+	err := c.cc.Invoke(ctx, KvStore_Info_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// KvStoreServer is the server API for KvStore service.
+// All implementations must embed UnimplementedKvStoreServer
+// for forward compatibility
+type KvStoreServer interface {
+	Set(context.Context, *SetRequest) (*SetResponse, error)
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	PSet(context.Context, *PSetRequest) (*PSetResponse, error)
+	PGet(context.Context, *PGetRequest) (*PGetResponse, error)
+	TTL(context.Context, *TTLRequest) (*TTLResponse, error)
+	Persist(context.Context, *PersistRequest) (*PersistResponse, error)
+	CompareAndSwap(context.Context, *CompareAndSwapRequest) (*CompareAndSwapResponse, error)
+	SetIfAbsent(context.Context, *SetIfAbsentRequest) (*SetIfAbsentResponse, error)
+	Incr(context.Context, *IncrRequest) (*IncrResponse, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	DeleteIfEquals(context.Context, *DeleteIfEqualsRequest) (*DeleteIfEqualsResponse, error)
+	DeleteKeys(context.Context, *DeleteKeysRequest) (*DeleteKeysResponse, error)
+	// Keys stream keys and values with prefix in a bucket in order
+	Keys(*KeysRequest, KvStore_KeysServer) error
+	Range(context.Context, *RangeRequest) (*RangeResponse, error)
+	// Commit apply the writes of a transaction run by the client if the values it read did not change since,
+	// ABORTED when one did
+	Commit(context.Context, *CommitRequest) (*CommitResponse, error)
+	Buckets(context.Context, *BucketsRequest) (*BucketsResponse, error)
+	// AllKeys stream every key of the engine
+	AllKeys(*AllKeysRequest, KvStore_AllKeysServer) error
+	Sync(context.Context, *SyncRequest) (*SyncResponse, error)
+	GC(context.Context, *GCRequest) (*GCResponse, error)
+	Stats(context.Context, *StatsRequest) (*StatsResponse, error)
+	// Info what does not change while the store is open
+	Info(context.Context, *InfoRequest) (*InfoResponse, error)
+	mustEmbedUnimplementedKvStoreServer()
+}
+
+// UnimplementedKvStoreServer must be embedded to have forward compatible implementations.
+type UnimplementedKvStoreServer struct {
+}
+
+func (UnimplementedKvStoreServer) Set(context.Context, *SetRequest) (*SetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedKvStoreServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedKvStoreServer) PSet(context.Context, *PSetRequest) (*PSetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PSet not implemented")
+}
+func (UnimplementedKvStoreServer) PGet(context.Context, *PGetRequest) (*PGetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PGet not implemented")
+}
+func (UnimplementedKvStoreServer) TTL(context.Context, *TTLRequest) (*TTLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TTL not implemented")
+}
+func (UnimplementedKvStoreServer) Persist(context.Context, *PersistRequest) (*PersistResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Persist not implemented")
+}
+func (UnimplementedKvStoreServer) CompareAndSwap(context.Context, *CompareAndSwapRequest) (*CompareAndSwapResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CompareAndSwap not implemented")
+}
+func (UnimplementedKvStoreServer) SetIfAbsent(context.Context, *SetIfAbsentRequest) (*SetIfAbsentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetIfAbsent not implemented")
+}
+func (UnimplementedKvStoreServer) Incr(context.Context, *IncrRequest) (*IncrResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Incr not implemented")
+}
+func (UnimplementedKvStoreServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedKvStoreServer) DeleteIfEquals(context.Context, *DeleteIfEqualsRequest) (*DeleteIfEqualsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteIfEquals not implemented")
+}
+func (UnimplementedKvStoreServer) DeleteKeys(context.Context, *DeleteKeysRequest) (*DeleteKeysResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteKeys not implemented")
+}
+func (UnimplementedKvStoreServer) Keys(*KeysRequest, KvStore_KeysServer) error {
+	return status.Errorf(codes.Unimplemented, "method Keys not implemented")
+}
+func (UnimplementedKvStoreServer) Range(context.Context, *RangeRequest) (*RangeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Range not implemented")
+}
+func (UnimplementedKvStoreServer) Commit(context.Context, *CommitRequest) (*CommitResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Commit not implemented")
+}
+func (UnimplementedKvStoreServer) Buckets(context.Context, *BucketsRequest) (*BucketsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Buckets not implemented")
+}
+func (UnimplementedKvStoreServer) AllKeys(*AllKeysRequest, KvStore_AllKeysServer) error {
+	return status.Errorf(codes.Unimplemented, "method AllKeys not implemented")
+}
+func (UnimplementedKvStoreServer) Sync(context.Context, *SyncRequest) (*SyncResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Sync not implemented")
+}
+func (UnimplementedKvStoreServer) GC(context.Context, *GCRequest) (*GCResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GC not implemented")
+}
+func (UnimplementedKvStoreServer) Stats(context.Context, *StatsRequest) (*StatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
+func (UnimplementedKvStoreServer) Info(context.Context, *InfoRequest) (*InfoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Info not implemented")
+}
+func (UnimplementedKvStoreServer) mustEmbedUnimplementedKvStoreServer() {}
+
+// UnsafeKvStoreServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to KvStoreServer will
+// result in compilation errors.
+type UnsafeKvStoreServer interface {
+	mustEmbedUnimplementedKvStoreServer()
+}
+
+func RegisterKvStoreServer(s grpc.ServiceRegistrar, srv KvStoreServer) {
+	s.RegisterService(&KvStore_ServiceDesc, srv)
+}
+
+func _KvStore_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_Set_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).Set(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_PSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PSetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).PSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_PSet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).PSet(ctx, req.(*PSetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_PGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).PGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_PGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).PGet(ctx, req.(*PGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_TTL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TTLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).TTL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_TTL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).TTL(ctx, req.(*TTLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_Persist_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PersistRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).Persist(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_Persist_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).Persist(ctx, req.(*PersistRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_CompareAndSwap_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompareAndSwapRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).CompareAndSwap(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_CompareAndSwap_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).CompareAndSwap(ctx, req.(*CompareAndSwapRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_SetIfAbsent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetIfAbsentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).SetIfAbsent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_SetIfAbsent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).SetIfAbsent(ctx, req.(*SetIfAbsentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_Incr_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IncrRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).Incr(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_Incr_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).Incr(ctx, req.(*IncrRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_DeleteIfEquals_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteIfEqualsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).DeleteIfEquals(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_DeleteIfEquals_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).DeleteIfEquals(ctx, req.(*DeleteIfEqualsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_DeleteKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).DeleteKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_DeleteKeys_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).DeleteKeys(ctx, req.(*DeleteKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_Keys_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(KeysRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KvStoreServer).Keys(m, &kvStoreKeysServer{stream})
+}
+
+type KvStore_KeysServer interface {
+	Send(*KeyValue) error
+	grpc.ServerStream
+}
+
+type kvStoreKeysServer struct {
+	grpc.ServerStream
+}
+
+func (x *kvStoreKeysServer) Send(m *KeyValue) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _KvStore_Range_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).Range(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_Range_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).Range(ctx, req.(*RangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_Commit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).Commit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_Commit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).Commit(ctx, req.(*CommitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_Buckets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BucketsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).Buckets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_Buckets_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).Buckets(ctx, req.(*BucketsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_AllKeys_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(AllKeysRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KvStoreServer).AllKeys(m, &kvStoreAllKeysServer{stream})
+}
+
+type KvStore_AllKeysServer interface {
+	Send(*AllKeysResponse) error
+	grpc.ServerStream
+}
+
+type kvStoreAllKeysServer struct {
+	grpc.ServerStream
+}
+
+func (x *kvStoreAllKeysServer) Send(m *AllKeysResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _KvStore_Sync_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SyncRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).Sync(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_Sync_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).Sync(ctx, req.(*SyncRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_GC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GCRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).GC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_GC_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).GC(ctx, req.(*GCRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_Stats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).Stats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KvStore_Info_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KvStoreServer).Info(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KvStore_Info_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KvStoreServer).Info(ctx, req.(*InfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// KvStore_ServiceDesc is the grpc.ServiceDesc for KvStore service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var KvStore_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kvstore.v1.KvStore",
+	HandlerType: (*KvStoreServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Set",
+			Handler:    _KvStore_Set_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _KvStore_Get_Handler,
+		},
+		{
+			MethodName: "PSet",
+			Handler:    _KvStore_PSet_Handler,
+		},
+		{
+			MethodName: "PGet",
+			Handler:    _KvStore_PGet_Handler,
+		},
+		{
+			MethodName: "TTL",
+			Handler:    _KvStore_TTL_Handler,
+		},
+		{
+			MethodName: "Persist",
+			Handler:    _KvStore_Persist_Handler,
+		},
+		{
+			MethodName: "CompareAndSwap",
+			Handler:    _KvStore_CompareAndSwap_Handler,
+		},
+		{
+			MethodName: "SetIfAbsent",
+			Handler:    _KvStore_SetIfAbsent_Handler,
+		},
+		{
+			MethodName: "Incr",
+			Handler:    _KvStore_Incr_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _KvStore_Delete_Handler,
+		},
+		{
+			MethodName: "DeleteIfEquals",
+			Handler:    _KvStore_DeleteIfEquals_Handler,
+		},
+		{
+			MethodName: "DeleteKeys",
+			Handler:    _KvStore_DeleteKeys_Handler,
+		},
+		{
+			MethodName: "Range",
+			Handler:    _KvStore_Range_Handler,
+		},
+		{
+			MethodName: "Commit",
+			Handler:    _KvStore_Commit_Handler,
+		},
+		{
+			MethodName: "Buckets",
+			Handler:    _KvStore_Buckets_Handler,
+		},
+		{
+			MethodName: "Sync",
+			Handler:    _KvStore_Sync_Handler,
+		},
+		{
+			MethodName: "GC",
+			Handler:    _KvStore_GC_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _KvStore_Stats_Handler,
+		},
+		{
+			MethodName: "Info",
+			Handler:    _KvStore_Info_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Keys",
+			Handler:       _KvStore_Keys_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "AllKeys",
+			Handler:       _KvStore_AllKeys_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "kvstore.proto",
+}
@@ -0,0 +1,380 @@
+// Package grpc serves a KvStore as the grpc service of pb/kvstore.proto, and Client is a KvStore of a remote
+// store, so code can switch between a store opened in its process and a store of a sidecar.
+//
+//	gs := grpc.NewServer()
+//	pb.RegisterKvStoreServer(gs, NewServer(store))
+//	_ = gs.Serve(listener)
+//
+//	store, err := Dial("localhost:7070", ClientOptions{PoolSize: 4, Timeout: time.Second, Retries: 3},
+//		grpc.WithTransportCredentials(insecure.NewCredentials()))
+//
+// An error of the store has a code and its message, the client returns it as the error of kvstore like
+// KeyNotFoundError, so errors.Is works the same for both
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/gmqio/kv-store/server/grpc/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// storeErrors code of each error of a store, a code may have many errors told apart by messages
+var storeErrors = []struct {
+	err  error
+	code codes.Code
+}{
+	{kvstore.KeyNotFoundError, codes.NotFound},
+	{kvstore.ReadOnlyError, codes.PermissionDenied},
+	{kvstore.PreconditionFailedError, codes.FailedPrecondition},
+	{kvstore.NotIntegerError, codes.InvalidArgument},
+	{kvstore.InvalidTokenError, codes.InvalidArgument},
+	{kvstore.BadKeyError, codes.InvalidArgument},
+	{kvstore.TxnConflictError, codes.Aborted},
+	{kvstore.TxnTooBigError, codes.ResourceExhausted},
+	{kvstore.NotSupportedError, codes.Unimplemented},
+	{kvstore.StoreClosedError, codes.Unavailable},
+}
+
+// Server serves a store, register it to a grpc.Server with pb.RegisterKvStoreServer.
+// A call stops with the context of its request, see kvstore.WithContext for stores not KvStoreCtx
+type Server struct {
+	pb.UnimplementedKvStoreServer
+	store kvstore.KvStoreCtx
+}
+
+// NewServer serve store
+func NewServer(store kvstore.KvStore) *Server {
+	return &Server{store: kvstore.WithContext(store)}
+}
+
+// StatusOf the status of an error of a store, nil for nil
+func StatusOf(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	for _, e := range storeErrors {
+		if errors.Is(err, e.err) {
+			return status.Error(e.code, err.Error())
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, err.Error())
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// writable fail writes of a read only store before they reach it, badger fails them with its own error
+func (s *Server) writable() error {
+	if s.store.ReadOnly() {
+		return StatusOf(kvstore.ReadOnlyError)
+	}
+	return nil
+}
+
+func (s *Server) Set(ctx context.Context, r *pb.SetRequest) (*pb.SetResponse, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	return &pb.SetResponse{}, StatusOf(s.store.SetWithTTLCtx(ctx, r.Bucket, r.Key, r.Value, time.Duration(r.Ttl)))
+}
+
+func (s *Server) Get(ctx context.Context, r *pb.GetRequest) (*pb.GetResponse, error) {
+	v, found, err := s.store.GetCtx(ctx, r.Bucket, r.Key)
+	if errors.Is(err, kvstore.KeyNotFoundError) {
+		return &pb.GetResponse{}, nil
+	}
+	if err != nil {
+		return nil, StatusOf(err)
+	}
+	return &pb.GetResponse{Value: v, Found: found}, nil
+}
+
+func (s *Server) PSet(ctx context.Context, r *pb.PSetRequest) (*pb.PSetResponse, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	return &pb.PSetResponse{}, StatusOf(s.store.PSetWithTTLCtx(ctx, r.Bucket, r.Keys, r.Values, time.Duration(r.Ttl)))
+}
+
+// PGet values of keys, a key not found fails the call unless the request asks for missing keys
+func (s *Server) PGet(ctx context.Context, r *pb.PGetRequest) (*pb.PGetResponse, error) {
+	if !r.Missing {
+		values, err := s.store.PGetCtx(ctx, r.Bucket, r.Keys)
+		if err != nil {
+			return nil, StatusOf(err)
+		}
+		return &pb.PGetResponse{Values: values}, nil
+	}
+
+	values, found := make([][]byte, len(r.Keys)), make([]bool, len(r.Keys))
+	err := s.store.ViewCtx(ctx, func(txn kvstore.Txn) error {
+		for i, k := range r.Keys {
+			v, err := txn.Get(r.Bucket, k)
+			if errors.Is(err, kvstore.KeyNotFoundError) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			values[i], found[i] = v, true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, StatusOf(err)
+	}
+	return &pb.PGetResponse{Values: values, Found: found}, nil
+}
+
+func (s *Server) TTL(ctx context.Context, r *pb.TTLRequest) (*pb.TTLResponse, error) {
+	ttl, err := s.store.TTLCtx(ctx, r.Bucket, r.Key)
+	if err != nil {
+		return nil, StatusOf(err)
+	}
+	return &pb.TTLResponse{Ttl: int64(ttl)}, nil
+}
+
+func (s *Server) Persist(ctx context.Context, r *pb.PersistRequest) (*pb.PersistResponse, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	return &pb.PersistResponse{}, StatusOf(s.store.PersistCtx(ctx, r.Bucket, r.Key))
+}
+
+func (s *Server) CompareAndSwap(ctx context.Context, r *pb.CompareAndSwapRequest) (*pb.CompareAndSwapResponse, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	return &pb.CompareAndSwapResponse{}, StatusOf(s.store.CompareAndSwapCtx(ctx, r.Bucket, r.Key, r.Expected, r.Value))
+}
+
+func (s *Server) SetIfAbsent(ctx context.Context, r *pb.SetIfAbsentRequest) (*pb.SetIfAbsentResponse, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	return &pb.SetIfAbsentResponse{}, StatusOf(s.store.SetIfAbsentCtx(ctx, r.Bucket, r.Key, r.Value))
+}
+
+func (s *Server) Incr(ctx context.Context, r *pb.IncrRequest) (*pb.IncrResponse, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	n, err := s.store.IncrCtx(ctx, r.Bucket, r.Key, r.Delta)
+	if err != nil {
+		return nil, StatusOf(err)
+	}
+	return &pb.IncrResponse{Value: n}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, r *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteResponse{}, StatusOf(s.store.DeleteCtx(ctx, r.Bucket, r.Key))
+}
+
+func (s *Server) DeleteIfEquals(ctx context.Context, r *pb.DeleteIfEqualsRequest) (*pb.DeleteIfEqualsResponse, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteIfEqualsResponse{}, StatusOf(s.store.DeleteIfEqualsCtx(ctx, r.Bucket, r.Key, r.Expected))
+}
+
+func (s *Server) DeleteKeys(ctx context.Context, r *pb.DeleteKeysRequest) (*pb.DeleteKeysResponse, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteKeysResponse{}, StatusOf(s.store.DeleteKeysCtx(ctx, r.Bucket, r.Keys))
+}
+
+// Keys stream keys of a bucket with a prefix from a cursor, they are sent while the bucket is read
+func (s *Server) Keys(r *pb.KeysRequest, stream pb.KvStore_KeysServer) error {
+	ctx := stream.Context()
+	c, err := s.store.CursorCtx(ctx, r.Bucket, kvstore.CursorOptions{
+		Prefix:   r.Prefix,
+		Start:    r.Start,
+		End:      r.End,
+		Reverse:  r.Reverse,
+		KeysOnly: r.KeysOnly,
+	})
+	if err != nil {
+		return StatusOf(err)
+	}
+	defer c.Close()
+	for c.Seek(r.Seek); c.Valid(); c.Next() {
+		if err := ctx.Err(); err != nil {
+			return StatusOf(err)
+		}
+		kv := &pb.KeyValue{Key: c.Key(), ExpiresAt: c.ExpiresAt(), UserMeta: uint32(c.UserMeta())}
+		if !r.KeysOnly {
+			if kv.Value, err = c.Value(); err != nil {
+				return StatusOf(err)
+			}
+		}
+		if err := stream.Send(kv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) Range(ctx context.Context, r *pb.RangeRequest) (*pb.RangeResponse, error) {
+	page, err := s.store.RangeCtx(ctx, r.Bucket, kvstore.RangeOptions{
+		Prefix:   r.Prefix,
+		Start:    r.Start,
+		End:      r.End,
+		Limit:    int(r.Limit),
+		Reverse:  r.Reverse,
+		KeysOnly: r.KeysOnly,
+		Token:    r.Token,
+	})
+	if err != nil {
+		return nil, StatusOf(err)
+	}
+	return &pb.RangeResponse{Keys: page.Keys, Values: page.Values, Token: page.Token}, nil
+}
+
+// Commit run a transaction of a client again with what it read and wrote, TxnConflictError when a value it
+// read changed
+func (s *Server) Commit(ctx context.Context, r *pb.CommitRequest) (*pb.CommitResponse, error) {
+	if len(r.Writes) > 0 {
+		if err := s.writable(); err != nil {
+			return nil, err
+		}
+	}
+	f := func(txn kvstore.Txn) error {
+		for _, read := range r.Reads {
+			if err := checkRead(txn, read); err != nil {
+				return err
+			}
+		}
+		for _, w := range r.Writes {
+			if err := write(txn, w); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var err error
+	switch {
+	case r.Batch:
+		err = s.store.BatchCtx(ctx, f)
+	case len(r.Writes) == 0:
+		err = s.store.ViewCtx(ctx, f)
+	default:
+		err = s.store.UpdateCtx(ctx, f)
+	}
+	if err != nil {
+		return nil, StatusOf(err)
+	}
+	return &pb.CommitResponse{}, nil
+}
+
+// checkRead read again what a transaction read, TxnConflictError when it changed
+func checkRead(txn kvstore.Txn, read *pb.TxnRead) error {
+	if read.Scan {
+		i := 0
+		err := txn.Scan(read.Bucket, read.Prefix, func(k, v []byte) error {
+			if i >= len(read.Entries) || !bytes.Equal(k, read.Entries[i].Key) || !bytes.Equal(v, read.Entries[i].Value) {
+				return kvstore.TxnConflictError
+			}
+			i++
+			return nil
+		})
+		if err == nil && i < len(read.Entries) {
+			return kvstore.TxnConflictError
+		}
+		return err
+	}
+	v, err := txn.Get(read.Bucket, read.Key)
+	if err != nil && !errors.Is(err, kvstore.KeyNotFoundError) {
+		return err
+	}
+	if found := err == nil; found != read.Found || !bytes.Equal(v, read.Value) {
+		return kvstore.TxnConflictError
+	}
+	return nil
+}
+
+func write(txn kvstore.Txn, w *pb.TxnWrite) error {
+	switch {
+	case w.Delete:
+		return txn.Delete(w.Bucket, w.Key)
+	case w.ExpiresAt > 0:
+		return txn.SetWithExpiresAt(w.Bucket, w.Key, w.Value, w.ExpiresAt)
+	}
+	return txn.SetWithMeta(w.Bucket, w.Key, w.Value, byte(w.Meta), time.Duration(w.Ttl))
+}
+
+func (s *Server) Buckets(ctx context.Context, _ *pb.BucketsRequest) (*pb.BucketsResponse, error) {
+	buckets, err := s.store.BucketsCtx(ctx)
+	if err != nil {
+		return nil, StatusOf(err)
+	}
+	return &pb.BucketsResponse{Buckets: buckets}, nil
+}
+
+// AllKeys stream keys until the client is gone, a failed send stops the scan
+func (s *Server) AllKeys(_ *pb.AllKeysRequest, stream pb.KvStore_AllKeysServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	var sendErr error
+	err := s.store.AllKeysCtx(ctx, func(key string, deletedOrExpired bool) {
+		if sendErr == nil {
+			if sendErr = stream.Send(&pb.AllKeysResponse{Key: key, DeletedOrExpired: deletedOrExpired}); sendErr != nil {
+				cancel()
+			}
+		}
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	return StatusOf(err)
+}
+
+func (s *Server) Sync(ctx context.Context, _ *pb.SyncRequest) (*pb.SyncResponse, error) {
+	return &pb.SyncResponse{}, StatusOf(s.store.SyncCtx(ctx))
+}
+
+func (s *Server) GC(ctx context.Context, r *pb.GCRequest) (*pb.GCResponse, error) {
+	n, err := s.store.GCCtx(ctx, r.DiscardRatio)
+	if err != nil {
+		return nil, StatusOf(err)
+	}
+	return &pb.GCResponse{Rewritten: int32(n)}, nil
+}
+
+func (s *Server) Stats(_ context.Context, _ *pb.StatsRequest) (*pb.StatsResponse, error) {
+	stats, err := s.store.Stats()
+	if err != nil {
+		return nil, StatusOf(err)
+	}
+	return &pb.StatsResponse{
+		Engine:    stats.Engine,
+		KeyFormat: uint32(stats.KeyFormat),
+		ReadOnly:  stats.ReadOnly,
+		Keys:      stats.Keys,
+		Tables:    int64(stats.Tables),
+		LsmSize:   stats.LSMSize,
+		VlogSize:  stats.VLogSize,
+	}, nil
+}
+
+func (s *Server) Info(_ context.Context, _ *pb.InfoRequest) (*pb.InfoResponse, error) {
+	return &pb.InfoResponse{
+		ReadOnly:  s.store.ReadOnly(),
+		KeyFormat: uint32(s.store.KeyFormat()),
+		Path:      s.store.Path(),
+	}, nil
+}
@@ -0,0 +1,188 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/gmqio/kv-store/kvstoretest"
+	"github.com/gmqio/kv-store/server/grpc/pb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serve store on connections in memory, dial returns a new connection of a client
+func serve(t *testing.T, store kvstore.KvStore, opts ...grpc.ServerOption) (dial func() *grpc.ClientConn) {
+	l := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer(opts...)
+	pb.RegisterKvStoreServer(gs, NewServer(store))
+	go func() {
+		_ = gs.Serve(l)
+	}()
+	t.Cleanup(gs.Stop)
+	return func() *grpc.ClientConn {
+		conn, err := grpc.Dial("bufnet", dialer(l), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		assert.True(t, err == nil)
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		return conn
+	}
+}
+
+func dialer(l *bufconn.Listener) grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return l.DialContext(ctx)
+	})
+}
+
+// faults a server interceptor counting calls of methods, it fails the first calls and delays calls
+type faults struct {
+	lock  sync.Mutex
+	calls map[string]int
+	fail  map[string]int // calls to fail with codes.Unavailable
+	delay time.Duration
+}
+
+func newFaults() *faults {
+	return &faults{calls: make(map[string]int), fail: make(map[string]int)}
+}
+
+func (f *faults) count(method string) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.calls[method]
+}
+
+func (f *faults) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	method := path.Base(info.FullMethod)
+	f.lock.Lock()
+	f.calls[method]++
+	failed := f.fail[method] > 0
+	if failed {
+		f.fail[method]--
+	}
+	delay := f.delay
+	f.lock.Unlock()
+	if failed {
+		return nil, status.Error(codes.Unavailable, "injected")
+	}
+	time.Sleep(delay)
+	return handler(ctx, req)
+}
+
+// test keys and all keys are streamed
+func TestStream(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		for i := 0; i < 100; i++ {
+			_ = s.Set([]byte("meta"), []byte(fmt.Sprintf("key-%03d", i)), []byte("v"))
+		}
+		client := pb.NewKvStoreClient(serve(t, s)())
+
+		stream, err := client.Keys(context.Background(), &pb.KeysRequest{Bucket: []byte("meta"), Prefix: []byte("key-0"), KeysOnly: true})
+		assert.True(t, err == nil)
+		n := 0
+		for {
+			kv, err := stream.Recv()
+			if err != nil {
+				break
+			}
+			assert.Equal(t, fmt.Sprintf("key-%03d", n), string(kv.Key))
+			assert.Equal(t, 0, len(kv.Value))
+			n++
+		}
+		assert.Equal(t, 100, n)
+
+		all, err := client.AllKeys(context.Background(), &pb.AllKeysRequest{})
+		assert.True(t, err == nil)
+		n = 0
+		for {
+			if _, err := all.Recv(); err != nil {
+				break
+			}
+			n++
+		}
+		assert.Equal(t, 100, n)
+	})
+}
+
+// fakeStream a server stream of a context, it cancels the context after some sends
+type fakeStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	cancel context.CancelFunc
+	sends  int
+	max    int
+}
+
+func (f *fakeStream) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeStream) send() error {
+	if f.sends++; f.sends == f.max {
+		f.cancel()
+	}
+	return nil
+}
+
+func (f *fakeStream) Send(*pb.AllKeysResponse) error {
+	return f.send()
+}
+
+type fakeKeysStream struct {
+	*fakeStream
+}
+
+func (f fakeKeysStream) Send(*pb.KeyValue) error {
+	return f.send()
+}
+
+// test calls stop with the context of their request
+func TestCanceled(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		for i := 0; i < 100; i++ {
+			_ = s.Set([]byte("meta"), []byte(fmt.Sprintf("key-%03d", i)), []byte("v"))
+		}
+		server := NewServer(s)
+		newStream := func() *fakeStream {
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			return &fakeStream{ctx: ctx, cancel: cancel, max: 10}
+		}
+
+		stream := newStream()
+		assert.Equal(t, codes.Canceled, status.Code(server.AllKeys(&pb.AllKeysRequest{}, stream)))
+		assert.Equal(t, 10, stream.sends)
+		stream = newStream()
+		err := server.Keys(&pb.KeysRequest{Bucket: []byte("meta")}, fakeKeysStream{stream})
+		assert.Equal(t, codes.Canceled, status.Code(err))
+		assert.Equal(t, 10, stream.sends)
+
+		ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+		defer cancel()
+		_, err = server.Get(ctx, &pb.GetRequest{Bucket: []byte("meta"), Key: []byte("key-000")})
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		_, err = server.Set(ctx, &pb.SetRequest{Bucket: []byte("meta"), Key: []byte("key-000")})
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	})
+}
+
+func TestStatusOf(t *testing.T) {
+	assert.True(t, StatusOf(nil) == nil)
+	assert.Equal(t, codes.NotFound, status.Code(StatusOf(kvstore.KeyNotFoundError)))
+	assert.Equal(t, codes.InvalidArgument, status.Code(StatusOf(fmt.Errorf("%w: %q", kvstore.NotIntegerError, "a"))))
+	assert.Equal(t, codes.Unavailable, status.Code(StatusOf(kvstore.StoreClosedError)))
+	assert.Equal(t, codes.Unknown, status.Code(StatusOf(errors.New("disk full"))))
+	st := status.Error(codes.DeadlineExceeded, "late")
+	assert.Equal(t, st, StatusOf(st))
+}
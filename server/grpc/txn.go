@@ -0,0 +1,169 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/gmqio/kv-store/server/grpc/pb"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxCommitSize bytes of keys and values of a Commit of Batch, more writes are sent in the next Commit
+const maxCommitSize = 1 << 20
+
+// txnKey a key of a bucket written by a transaction
+type txnKey struct {
+	bucket string
+	key    string
+}
+
+// clientTxn a transaction run in the client, reads go to the remote store and writes are kept until commit
+type clientTxn struct {
+	c        *Client
+	readOnly bool
+	batch    bool // reads are not checked
+	reads    []*pb.TxnRead
+	writes   []*pb.TxnWrite
+	written  map[txnKey]*pb.TxnWrite // last write of each key
+}
+
+// txn run f in a new clientTxn until its commit does not conflict, up to MaxTxnRetries times
+func (c *Client) txn(f func(txn kvstore.Txn) error, readOnly, batch bool) error {
+	var err error
+	for i := 0; i <= kvstore.MaxTxnRetries; i++ {
+		t := &clientTxn{c: c, readOnly: readOnly, batch: batch, written: make(map[txnKey]*pb.TxnWrite)}
+		if err = f(t); err != nil {
+			return err
+		}
+		if err = t.commit(); !errors.Is(err, kvstore.TxnConflictError) {
+			return err
+		}
+	}
+	return err
+}
+
+// Get a value written by the transaction, or of the remote store
+func (t *clientTxn) Get(bucket, k []byte) ([]byte, error) {
+	if w, ok := t.written[txnKey{bucket: string(bucket), key: string(k)}]; ok {
+		if deleted(w) {
+			return nil, kvstore.KeyNotFoundError
+		}
+		return w.Value, nil
+	}
+	v, found, err := t.c.get(bucket, k)
+	if err != nil && !errors.Is(err, kvstore.KeyNotFoundError) {
+		return nil, err
+	}
+	if !t.batch {
+		t.reads = append(t.reads, &pb.TxnRead{Bucket: bucket, Key: k, Found: found, Value: v})
+	}
+	if !found {
+		return nil, kvstore.KeyNotFoundError
+	}
+	return v, nil
+}
+
+func (t *clientTxn) Set(bucket, k, v []byte) error {
+	return t.write(&pb.TxnWrite{Bucket: bucket, Key: k, Value: v})
+}
+
+func (t *clientTxn) SetWithTTL(bucket, k, v []byte, ttl time.Duration) error {
+	return t.write(&pb.TxnWrite{Bucket: bucket, Key: k, Value: v, Ttl: int64(ttl)})
+}
+
+func (t *clientTxn) SetWithMeta(bucket, k, v []byte, meta byte, ttl time.Duration) error {
+	return t.write(&pb.TxnWrite{Bucket: bucket, Key: k, Value: v, Meta: uint32(meta), Ttl: int64(ttl)})
+}
+
+func (t *clientTxn) SetWithExpiresAt(bucket, k, v []byte, expiresAt uint64) error {
+	return t.write(&pb.TxnWrite{Bucket: bucket, Key: k, Value: v, ExpiresAt: expiresAt})
+}
+
+func (t *clientTxn) Delete(bucket, k []byte) error {
+	return t.write(&pb.TxnWrite{Bucket: bucket, Key: k, Delete: true})
+}
+
+func (t *clientTxn) write(w *pb.TxnWrite) error {
+	if t.readOnly {
+		return kvstore.ReadOnlyError
+	}
+	t.writes = append(t.writes, w)
+	t.written[txnKey{bucket: string(w.Bucket), key: string(w.Key)}] = w
+	return nil
+}
+
+// deleted check a write deletes its key or sets it expired
+func deleted(w *pb.TxnWrite) bool {
+	return w.Delete || (w.ExpiresAt > 0 && w.ExpiresAt <= uint64(time.Now().Unix()))
+}
+
+// Scan keys of the remote store with the writes of the transaction, keys are read at once from a stream of Keys
+func (t *clientTxn) Scan(bucket, prefix []byte, visit func(k, v []byte) error) error {
+	keys, values, err := t.c.keys(bucket, prefix, false)
+	if err != nil {
+		return err
+	}
+	if !t.batch {
+		read := &pb.TxnRead{Bucket: bucket, Scan: true, Prefix: prefix, Entries: make([]*pb.KeyValue, len(keys))}
+		for i := range keys {
+			read.Entries[i] = &pb.KeyValue{Key: keys[i], Value: values[i]}
+		}
+		t.reads = append(t.reads, read)
+	}
+	entries := make(map[string][]byte, len(keys))
+	for i, k := range keys {
+		entries[string(k)] = values[i]
+	}
+	for key, w := range t.written {
+		if key.bucket != string(bucket) || !strings.HasPrefix(key.key, string(prefix)) {
+			continue
+		}
+		if deleted(w) {
+			delete(entries, key.key)
+		} else {
+			entries[key.key] = w.Value
+		}
+	}
+	sorted := make([]string, 0, len(entries))
+	for k := range entries {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		if err := visit([]byte(k), entries[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit send the writes with the reads. Without writes one read can not have changed, it is not sent
+func (t *clientTxn) commit() error {
+	if t.batch {
+		for len(t.writes) > 0 {
+			n, size := 0, 0
+			for ; n < len(t.writes) && size < maxCommitSize; n++ {
+				size += len(t.writes[n].Key) + len(t.writes[n].Value)
+			}
+			if err := t.send(&pb.CommitRequest{Writes: t.writes[:n], Batch: true}); err != nil {
+				return err
+			}
+			t.writes = t.writes[n:]
+		}
+		return nil
+	}
+	if len(t.writes) == 0 && len(t.reads) <= 1 {
+		return nil
+	}
+	return t.send(&pb.CommitRequest{Reads: t.reads, Writes: t.writes})
+}
+
+// send a Commit, it is retried like a read without writes
+func (t *clientTxn) send(r *pb.CommitRequest) error {
+	return t.c.call(len(r.Writes) == 0, func(ctx context.Context, client pb.KvStoreClient) error {
+		_, err := client.Commit(ctx, r)
+		return err
+	})
+}
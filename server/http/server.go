@@ -0,0 +1,362 @@
+// Package http serves a KvStore as a REST api of json.
+//
+//	GET    /buckets                              buckets of the store
+//	GET    /buckets/{bucket}/keys                a page of keys, query prefix, start, end, limit, reverse, keys_only and token
+//	GET    /buckets/{bucket}/keys/{key}          value of a key
+//	PUT    /buckets/{bucket}/keys/{key}          set the body as the value, query ttl like 10s
+//	DELETE /buckets/{bucket}/keys/{key}          delete a key
+//	POST   /buckets/{bucket}/batch/get           values of keys, PGet
+//	POST   /buckets/{bucket}/batch/set           set keys and values, PSet
+//
+// Buckets and keys in paths are escaped, buckets, keys and values in json are base64 as they may not be utf-8
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	kvstore "github.com/gmqio/kv-store"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// StatusClientClosedRequest status of a request canceled by its client before the store answered
+	StatusClientClosedRequest = 499
+)
+
+var (
+	// MaxBodyBytes max bytes of a request body
+	MaxBodyBytes int64 = 32 << 20
+
+	BadRequestError = errors.New("bad request")
+)
+
+// Handler serves a store
+type Handler struct {
+	store kvstore.KvStoreCtx
+}
+
+// ErrorResponse body of a response with an error status
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// BucketsResponse body of GET /buckets
+type BucketsResponse struct {
+	Buckets [][]byte `json:"buckets"`
+}
+
+// KeysResponse body of GET /buckets/{bucket}/keys, Values is empty with keys_only
+type KeysResponse struct {
+	Keys   [][]byte `json:"keys"`
+	Values [][]byte `json:"values,omitempty"`
+
+	// Token pass it back as the token query to get the next page, empty if there are no more keys
+	Token string `json:"token,omitempty"`
+}
+
+// BatchGetRequest body of POST /buckets/{bucket}/batch/get
+type BatchGetRequest struct {
+	Keys [][]byte `json:"keys"`
+}
+
+// BatchGetResponse values in the order of keys
+type BatchGetResponse struct {
+	Values [][]byte `json:"values"`
+}
+
+// BatchSetRequest body of POST /buckets/{bucket}/batch/set, TTL like 10s and empty never expires
+type BatchSetRequest struct {
+	Keys   [][]byte `json:"keys"`
+	Values [][]byte `json:"values"`
+	TTL    string   `json:"ttl,omitempty"`
+}
+
+// NewHandler serve store
+func NewHandler(store kvstore.KvStore) *Handler {
+	return &Handler{store: kvstore.WithContext(store)}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+	parts, err := splitPath(r.URL.EscapedPath())
+	if err != nil || len(parts) == 0 || parts[0] != "buckets" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route %s", r.URL.Path))
+		return
+	}
+	switch {
+	case len(parts) == 1:
+		h.allow(w, r, h.buckets, http.MethodGet)
+	case len(parts) == 3 && parts[2] == "keys":
+		h.allow(w, r, func(w http.ResponseWriter, r *http.Request) {
+			h.keys(w, r, []byte(parts[1]))
+		}, http.MethodGet)
+	case len(parts) == 4 && parts[2] == "keys":
+		bucket, key := []byte(parts[1]), []byte(parts[3])
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			h.get(w, r, bucket, key)
+		case http.MethodPut:
+			h.write(w, r, func() error {
+				return h.set(r, bucket, key)
+			})
+		case http.MethodDelete:
+			h.write(w, r, func() error {
+				return h.store.DeleteCtx(r.Context(), bucket, key)
+			})
+		default:
+			notAllowed(w, http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete)
+		}
+	case len(parts) == 4 && parts[2] == "batch" && parts[3] == "get":
+		h.allow(w, r, func(w http.ResponseWriter, r *http.Request) {
+			h.batchGet(w, r, []byte(parts[1]))
+		}, http.MethodPost)
+	case len(parts) == 4 && parts[2] == "batch" && parts[3] == "set":
+		h.allow(w, r, func(w http.ResponseWriter, r *http.Request) {
+			h.write(w, r, func() error {
+				return h.batchSet(r, []byte(parts[1]))
+			})
+		}, http.MethodPost)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route %s", r.URL.Path))
+	}
+}
+
+// splitPath unescape segments of an escaped path
+func splitPath(path string) ([]string, error) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil, nil
+	}
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		var err error
+		if parts[i], err = url.PathUnescape(part); err != nil {
+			return nil, err
+		}
+	}
+	return parts, nil
+}
+
+// allow serve r by f if its method is one of methods
+func (h *Handler) allow(w http.ResponseWriter, r *http.Request, f http.HandlerFunc, methods ...string) {
+	for _, m := range methods {
+		if r.Method == m {
+			f(w, r)
+			return
+		}
+	}
+	notAllowed(w, methods...)
+}
+
+func notAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+func (h *Handler) buckets(w http.ResponseWriter, r *http.Request) {
+	buckets, err := h.store.BucketsCtx(r.Context())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if buckets == nil {
+		buckets = [][]byte{}
+	}
+	writeJSON(w, http.StatusOK, BucketsResponse{Buckets: buckets})
+}
+
+func (h *Handler) keys(w http.ResponseWriter, r *http.Request, bucket []byte) {
+	q := r.URL.Query()
+	opts := kvstore.RangeOptions{
+		Prefix: []byte(q.Get("prefix")),
+		Token:  q.Get("token"),
+	}
+	if q.Has("start") {
+		opts.Start = []byte(q.Get("start"))
+	}
+	if q.Has("end") {
+		opts.End = []byte(q.Get("end"))
+	}
+	var err error
+	if opts.Limit, err = intQuery(q, "limit"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if opts.Reverse, err = boolQuery(q, "reverse"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if opts.KeysOnly, err = boolQuery(q, "keys_only"); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.store.RangeCtx(r.Context(), bucket, opts)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if page.Keys == nil {
+		page.Keys = [][]byte{}
+	}
+	writeJSON(w, http.StatusOK, KeysResponse{Keys: page.Keys, Values: page.Values, Token: page.Token})
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, bucket, key []byte) {
+	v, _, err := h.store.GetCtx(r.Context(), bucket, key)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(v)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(v)
+}
+
+func (h *Handler) set(r *http.Request, bucket, key []byte) error {
+	ttl, err := durationQuery(r.URL.Query(), "ttl")
+	if err != nil {
+		return err
+	}
+	v, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %w", BadRequestError, err)
+	}
+	return h.store.SetWithTTLCtx(r.Context(), bucket, key, v, ttl)
+}
+
+func (h *Handler) batchGet(w http.ResponseWriter, r *http.Request, bucket []byte) {
+	var req BatchGetRequest
+	if err := readJSON(r, &req); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	values, err := h.store.PGetCtx(r.Context(), bucket, req.Keys)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, BatchGetResponse{Values: values})
+}
+
+func (h *Handler) batchSet(r *http.Request, bucket []byte) error {
+	var req BatchSetRequest
+	if err := readJSON(r, &req); err != nil {
+		return err
+	}
+	if len(req.Keys) != len(req.Values) {
+		return fmt.Errorf("%w: %d keys and %d values", BadRequestError, len(req.Keys), len(req.Values))
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			return fmt.Errorf("%w: ttl %v", BadRequestError, err)
+		}
+	}
+	return h.store.PSetWithTTLCtx(r.Context(), bucket, req.Keys, req.Values, ttl)
+}
+
+// write run f if the store is writable, 204 if it succeeds
+func (h *Handler) write(w http.ResponseWriter, r *http.Request, f func() error) {
+	if h.store.ReadOnly() {
+		writeError(w, http.StatusConflict, kvstore.ReadOnlyError)
+		return
+	}
+	if err := f(); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func readJSON(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: %w", BadRequestError, err)
+	}
+	return nil
+}
+
+func intQuery(q url.Values, name string) (int, error) {
+	if !q.Has(name) {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(q.Get(name))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: %s %q", BadRequestError, name, q.Get(name))
+	}
+	return n, nil
+}
+
+func boolQuery(q url.Values, name string) (bool, error) {
+	if !q.Has(name) {
+		return false, nil
+	}
+	if q.Get(name) == "" {
+		return true, nil
+	}
+	b, err := strconv.ParseBool(q.Get(name))
+	if err != nil {
+		return false, fmt.Errorf("%w: %s %q", BadRequestError, name, q.Get(name))
+	}
+	return b, nil
+}
+
+func durationQuery(q url.Values, name string) (time.Duration, error) {
+	if !q.Has(name) {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(q.Get(name))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s %q", BadRequestError, name, q.Get(name))
+	}
+	return d, nil
+}
+
+// StatusOf the status of an error of a store
+func StatusOf(err error) int {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, kvstore.KeyNotFoundError):
+		return http.StatusNotFound
+	case errors.Is(err, kvstore.ReadOnlyError):
+		return http.StatusConflict
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, BadRequestError), errors.Is(err, kvstore.InvalidTokenError):
+		return http.StatusBadRequest
+	case errors.Is(err, kvstore.PreconditionFailedError):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, kvstore.NotSupportedError):
+		return http.StatusNotImplemented
+	case errors.Is(err, kvstore.StoreClosedError):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	writeError(w, StatusOf(err), err)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,189 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/gmqio/kv-store/kvstoretest"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// do a request, return the status and body
+func do(h http.Handler, method, target string, body string) (int, string) {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, r))
+	return w.Code, w.Body.String()
+}
+
+// test get, put and delete a key
+func TestKey(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		h := NewHandler(s)
+
+		code, _ := do(h, http.MethodPut, "/buckets/brokers/keys/broker-1", "up")
+		assert.Equal(t, http.StatusNoContent, code)
+		code, body := do(h, http.MethodGet, "/buckets/brokers/keys/broker-1", "")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "up", body)
+
+		// escaped bucket and key
+		code, _ = do(h, http.MethodPut, "/buckets/a%2Fb/keys/c%2Fd%20e?ttl=1h", "v")
+		assert.Equal(t, http.StatusNoContent, code)
+		code, body = do(h, http.MethodGet, "/buckets/a%2Fb/keys/c%2Fd%20e", "")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "v", body)
+
+		code, _ = do(h, http.MethodDelete, "/buckets/brokers/keys/broker-1", "")
+		assert.Equal(t, http.StatusNoContent, code)
+		code, body = do(h, http.MethodGet, "/buckets/brokers/keys/broker-1", "")
+		assert.Equal(t, http.StatusNotFound, code)
+		assert.Equal(t, `{"error":"key not found"}`+"\n", body)
+
+		code, _ = do(h, http.MethodPut, "/buckets/brokers/keys/broker-1?ttl=soon", "up")
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = do(h, http.MethodPost, "/buckets/brokers/keys/broker-1", "up")
+		assert.Equal(t, http.StatusMethodNotAllowed, code)
+		code, _ = do(h, http.MethodGet, "/keys", "")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+// test buckets and pages of keys
+func TestKeys(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		for _, k := range []string{"broker-1", "broker-2", "broker-3", "cluster"} {
+			_ = s.Set([]byte("meta"), []byte(k), []byte("v-"+k))
+		}
+		_ = s.Set([]byte("topics"), []byte("orders"), []byte("3"))
+		h := NewHandler(s)
+
+		code, body := do(h, http.MethodGet, "/buckets", "")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, `{"buckets":["bWV0YQ==","dG9waWNz"]}`+"\n", body)
+
+		var keys []string
+		target := "/buckets/meta/keys?prefix=broker-&limit=2"
+		for {
+			var page KeysResponse
+			code, body = do(h, http.MethodGet, target, "")
+			assert.Equal(t, http.StatusOK, code)
+			assert.True(t, json.Unmarshal([]byte(body), &page) == nil)
+			for _, k := range page.Keys {
+				keys = append(keys, string(k))
+			}
+			assert.Equal(t, "v-"+string(page.Keys[0]), string(page.Values[0]))
+			if page.Token == "" {
+				break
+			}
+			target = "/buckets/meta/keys?prefix=broker-&limit=2&token=" + page.Token
+		}
+		assert.Equal(t, []string{"broker-1", "broker-2", "broker-3"}, keys)
+
+		code, body = do(h, http.MethodGet, "/buckets/meta/keys?reverse&keys_only&limit=1", "")
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, strings.HasPrefix(body, `{"keys":["Y2x1c3Rlcg=="],"token":"`), body)
+
+		code, _ = do(h, http.MethodGet, "/buckets/meta/keys?token=bad", "")
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = do(h, http.MethodGet, "/buckets/meta/keys?limit=-1", "")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+// test batch get and set
+func TestBatch(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		h := NewHandler(s)
+
+		code, _ := do(h, http.MethodPost, "/buckets/meta/batch/set", `{"keys":["YQ==","Yg=="],"values":["MQ==","Mg=="],"ttl":"1h"}`)
+		assert.Equal(t, http.StatusNoContent, code)
+		code, body := do(h, http.MethodPost, "/buckets/meta/batch/get", `{"keys":["Yg==","YQ=="]}`)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, `{"values":["Mg==","MQ=="]}`+"\n", body)
+
+		code, _ = do(h, http.MethodPost, "/buckets/meta/batch/get", `{"keys":["YQ==","Yw=="]}`)
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = do(h, http.MethodPost, "/buckets/meta/batch/set", `{"keys":["YQ=="],"values":[]}`)
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = do(h, http.MethodPost, "/buckets/meta/batch/set", `not json`)
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = do(h, http.MethodGet, "/buckets/meta/batch/set", "")
+		assert.Equal(t, http.StatusMethodNotAllowed, code)
+
+		MaxBodyBytes = 8
+		defer func() {
+			MaxBodyBytes = 32 << 20
+		}()
+		code, _ = do(h, http.MethodPost, "/buckets/meta/batch/set", `{"keys":["YQ=="],"values":["MQ=="]}`)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+	})
+}
+
+// test keys which are not utf-8 are kept in json
+func TestBinaryKeys(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		h := NewHandler(s)
+		key := []byte{0xff, 0xfe, 'k'}
+		body, _ := json.Marshal(BatchSetRequest{Keys: [][]byte{key}, Values: [][]byte{[]byte("v")}})
+		code, _ := do(h, http.MethodPost, "/buckets/meta/batch/set", string(body))
+		assert.Equal(t, http.StatusNoContent, code)
+		v, _, err := s.Get([]byte("meta"), key)
+		assert.True(t, err == nil)
+		assert.Equal(t, "v", string(v))
+
+		var page KeysResponse
+		code, resp := do(h, http.MethodGet, "/buckets/meta/keys?prefix=%FF", "")
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, json.Unmarshal([]byte(resp), &page) == nil)
+		assert.Equal(t, [][]byte{key}, page.Keys)
+
+		body, _ = json.Marshal(BatchGetRequest{Keys: [][]byte{key}})
+		code, resp = do(h, http.MethodPost, "/buckets/meta/batch/get", string(body))
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, `{"values":["dg=="]}`+"\n", resp)
+	})
+}
+
+// test writes to a read only store
+func TestReadOnly(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{ReadOnly: true}, func(t *testing.T, s kvstore.KvStore) {
+		h := NewHandler(s)
+		code, body := do(h, http.MethodPut, "/buckets/meta/keys/a", "v")
+		assert.Equal(t, http.StatusConflict, code)
+		assert.True(t, strings.Contains(body, kvstore.ReadOnlyError.Error()))
+		code, _ = do(h, http.MethodDelete, "/buckets/meta/keys/a", "")
+		assert.Equal(t, http.StatusConflict, code)
+		code, _ = do(h, http.MethodPost, "/buckets/meta/batch/set", `{"keys":[],"values":[]}`)
+		assert.Equal(t, http.StatusConflict, code)
+		code, _ = do(h, http.MethodGet, "/buckets/meta/keys/a", "")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestStatusOf(t *testing.T) {
+	assert.Equal(t, http.StatusServiceUnavailable, StatusOf(kvstore.StoreClosedError))
+	assert.Equal(t, http.StatusInternalServerError, StatusOf(bytes.ErrTooLarge))
+	assert.Equal(t, http.StatusGatewayTimeout, StatusOf(context.DeadlineExceeded))
+}
+
+// test a request canceled by its client stops its scan
+func TestCanceled(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		h := NewHandler(s)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/buckets/meta/keys", nil).WithContext(ctx))
+		assert.Equal(t, StatusClientClosedRequest, w.Code)
+	})
+}
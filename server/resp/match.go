@@ -0,0 +1,83 @@
+package resp
+
+// match a key with a glob pattern of redis, * any bytes, ? one byte, [abc] [^abc] [a-z] a class and \ escapes.
+// On a mismatch only the last * takes one more byte, so a match is O(len(pattern) * len(key))
+func match(pattern, key []byte) bool {
+	p, k := 0, 0
+	star, starKey := -1, 0 // pattern after the last * and the key it took until there
+	for p < len(pattern) || k < len(key) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				p++
+				star, starKey = p, k
+				continue
+			case '?':
+				if k < len(key) {
+					p, k = p+1, k+1
+					continue
+				}
+			case '[':
+				if k < len(key) {
+					if ok, rest := matchClass(pattern[p+1:], key[k]); ok {
+						p, k = len(pattern)-len(rest), k+1
+						continue
+					}
+				}
+			default:
+				c := p
+				if pattern[c] == '\\' && c+1 < len(pattern) {
+					c++
+				}
+				if k < len(key) && key[k] == pattern[c] {
+					p, k = c+1, k+1
+					continue
+				}
+			}
+		}
+		if star < 0 || starKey == len(key) {
+			return false
+		}
+		starKey++
+		p, k = star, starKey
+	}
+	return true
+}
+
+// matchClass match c with a class after its [, return the pattern after its ]. A class not closed ends the pattern
+func matchClass(pattern []byte, c byte) (bool, []byte) {
+	not := len(pattern) > 0 && pattern[0] == '^'
+	if not {
+		pattern = pattern[1:]
+	}
+	found := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			found = found || pattern[1] == c
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := min(pattern[0], pattern[2]), max(pattern[0], pattern[2])
+			found = found || (lo <= c && c <= hi)
+			pattern = pattern[3:]
+		default:
+			found = found || pattern[0] == c
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		pattern = pattern[1:]
+	}
+	return found != not, pattern
+}
+
+// literalPrefix bytes of pattern before its first special byte, every key matched starts with it
+func literalPrefix(pattern []byte) []byte {
+	for i, c := range pattern {
+		switch c {
+		case '*', '?', '[', '\\':
+			return pattern[:i]
+		}
+	}
+	return pattern
+}
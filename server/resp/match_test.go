@@ -0,0 +1,69 @@
+package resp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	for _, c := range []struct {
+		pattern, key string
+		match        bool
+	}{
+		{"", "", true},
+		{"*", "", true},
+		{"*", "abc", true},
+		{"a*", "abc", true},
+		{"a*", "bac", false},
+		{"*c", "abc", true},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "aXbY", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hallo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{`[\]]`, "]", true},
+		{"abc", "abcd", false},
+		{"*a", "ba", true},
+		{"a*", "", false},
+		{"*?", "", false},
+		{"**a**", "xxa", true},
+		{"*[a-c]d", "xbcd", true},
+		{`*\*`, "ab*", true},
+		{`*\*`, "ab", false},
+	} {
+		assert.Equal(t, c.match, match([]byte(c.pattern), []byte(c.key)), "%q %q", c.pattern, c.key)
+	}
+}
+
+// test patterns of many * do not backtrack exponentially
+func TestMatchStars(t *testing.T) {
+	pattern := []byte(strings.Repeat("a*", 30) + "b")
+	key := []byte(strings.Repeat("a", 10000))
+	done := make(chan bool)
+	go func() {
+		done <- match(pattern, key)
+	}()
+	select {
+	case matched := <-done:
+		assert.True(t, !matched)
+	case <-time.After(10 * time.Second):
+		t.Fatal("match takes too long")
+	}
+}
+
+func TestLiteralPrefix(t *testing.T) {
+	assert.Equal(t, "orders:", string(literalPrefix([]byte("orders:*"))))
+	assert.Equal(t, "key-", string(literalPrefix([]byte("key-?[0-9]"))))
+	assert.Equal(t, "a", string(literalPrefix([]byte(`a\*`))))
+	assert.Equal(t, "abc", string(literalPrefix([]byte("abc"))))
+}
@@ -0,0 +1,195 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+const (
+	// DefaultMaxBulkBytes max bytes of an argument of a command when Options.MaxBulkBytes is 0
+	DefaultMaxBulkBytes = 32 << 20
+
+	// DefaultMaxArgs max arguments of a command when Options.MaxArgs is 0
+	DefaultMaxArgs = 64 << 10
+
+	// readBufferSize an inline command longer than it is an error
+	readBufferSize = 64 << 10
+)
+
+var (
+	ProtocolError = errors.New("protocol error")
+)
+
+// reader reads commands of a client, arrays of bulk strings like clients send or inline commands like telnet.
+// Lengths are sent by the client, buffers grow as data arrives and are never allocated from a length alone
+type reader struct {
+	r            *bufio.Reader
+	maxArgs      int
+	maxBulkBytes int
+}
+
+func newReader(r io.Reader, maxArgs, maxBulkBytes int) *reader {
+	return &reader{r: bufio.NewReaderSize(r, readBufferSize), maxArgs: maxArgs, maxBulkBytes: maxBulkBytes}
+}
+
+// buffered check bytes of a command are read and not handled, replies are flushed after a pipeline
+func (r *reader) buffered() bool {
+	return r.r.Buffered() > 0
+}
+
+// readCommand read the arguments of a command, empty for an empty line
+func (r *reader) readCommand() ([][]byte, error) {
+	line, err := r.line()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		fields := bytes.Fields(line)
+		args := make([][]byte, len(fields))
+		for i, f := range fields {
+			args[i] = append([]byte(nil), f...)
+		}
+		return args, nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > r.maxArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", ProtocolError)
+	}
+	var args [][]byte
+	for i := 0; i < n; i++ {
+		line, err := r.line()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got %q", ProtocolError, line)
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > r.maxBulkBytes {
+			return nil, fmt.Errorf("%w: invalid bulk length", ProtocolError)
+		}
+		arg, err := r.bulk(size)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// bulk read size bytes and CRLF, the buffer at most doubles for each read
+func (r *reader) bulk(size int) ([]byte, error) {
+	b := make([]byte, 0, min(size, readBufferSize))
+	for len(b) < size {
+		n := min(size-len(b), max(len(b), readBufferSize))
+		b = slices.Grow(b, n)
+		if _, err := io.ReadFull(r.r, b[len(b):len(b)+n]); err != nil {
+			return nil, err
+		}
+		b = b[:len(b)+n]
+	}
+	var end [2]byte
+	if _, err := io.ReadFull(r.r, end[:]); err != nil {
+		return nil, err
+	}
+	if end != [2]byte{'\r', '\n'} {
+		return nil, fmt.Errorf("%w: bulk not ended by CRLF", ProtocolError)
+	}
+	return b, nil
+}
+
+// line read a line without its end, it is valid until the next read
+func (r *reader) line() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("%w: too big request", ProtocolError)
+	}
+	if err != nil {
+		return nil, err
+	}
+	line = bytes.TrimSuffix(line[:len(line)-1], []byte("\r"))
+	return line, nil
+}
+
+// writer writes replies in RESP2 or RESP3, errors are kept until flush
+type writer struct {
+	w     *bufio.Writer
+	proto int
+}
+
+func newWriter(w io.Writer) *writer {
+	return &writer{w: bufio.NewWriter(w), proto: 2}
+}
+
+func (w *writer) flush() error {
+	return w.w.Flush()
+}
+
+func (w *writer) header(prefix byte, n int64) {
+	_ = w.w.WriteByte(prefix)
+	_, _ = w.w.WriteString(strconv.FormatInt(n, 10))
+	_, _ = w.w.WriteString("\r\n")
+}
+
+// simple string without CR and LF
+func (w *writer) simple(s string) {
+	_ = w.w.WriteByte('+')
+	_, _ = w.w.WriteString(s)
+	_, _ = w.w.WriteString("\r\n")
+}
+
+// error starts with its code like ERR, CR and LF are replaced by spaces
+func (w *writer) error(s string) {
+	_ = w.w.WriteByte('-')
+	_, _ = w.w.WriteString(replaceLineEnds(s))
+	_, _ = w.w.WriteString("\r\n")
+}
+
+func (w *writer) integer(n int64) {
+	w.header(':', n)
+}
+
+func (w *writer) bulk(b []byte) {
+	w.header('$', int64(len(b)))
+	_, _ = w.w.Write(b)
+	_, _ = w.w.WriteString("\r\n")
+}
+
+// null a key not found
+func (w *writer) null() {
+	if w.proto == 3 {
+		_, _ = w.w.WriteString("_\r\n")
+		return
+	}
+	_, _ = w.w.WriteString("$-1\r\n")
+}
+
+// array of n elements written next
+func (w *writer) array(n int) {
+	w.header('*', int64(n))
+}
+
+// mapHeader of n pairs written next, an array of 2n elements in RESP2
+func (w *writer) mapHeader(n int) {
+	if w.proto == 3 {
+		w.header('%', int64(n))
+		return
+	}
+	w.array(2 * n)
+}
+
+func replaceLineEnds(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c == '\r' || c == '\n' {
+			b[i] = ' '
+		}
+	}
+	return string(b)
+}
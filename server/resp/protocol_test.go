@@ -0,0 +1,68 @@
+package resp
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReadCommand(t *testing.T) {
+	r := newReader(strings.NewReader("*2\r\n$3\r\nGET\r\n$4\r\na\r\nb\r\n  set  a 1 \r\n\r\n*0\r\n"), DefaultMaxArgs, DefaultMaxBulkBytes)
+	args, err := r.readCommand()
+	assert.True(t, err == nil)
+	assert.Equal(t, [][]byte{[]byte("GET"), []byte("a\r\nb")}, args)
+	args, err = r.readCommand()
+	assert.True(t, err == nil)
+	assert.Equal(t, [][]byte{[]byte("set"), []byte("a"), []byte("1")}, args)
+	args, _ = r.readCommand()
+	assert.Equal(t, 0, len(args))
+	args, _ = r.readCommand()
+	assert.Equal(t, 0, len(args))
+	_, err = r.readCommand()
+	assert.Equal(t, io.EOF, err)
+
+	for _, bad := range []string{"*x\r\n", "*1\r\n:1\r\n", "*1\r\n$-1\r\n", "*1\r\n$1\r\nab\r\n", strings.Repeat("a", readBufferSize+1)} {
+		_, err := newReader(strings.NewReader(bad), DefaultMaxArgs, DefaultMaxBulkBytes).readCommand()
+		assert.True(t, errors.Is(err, ProtocolError), "%q", bad)
+	}
+}
+
+// test lengths sent by a client are checked with the limits and not trusted for allocations
+func TestReadCommandLimits(t *testing.T) {
+	for _, bad := range []string{"*3\r\n", "*1\r\n$5\r\n"} {
+		_, err := newReader(strings.NewReader(bad), 2, 4).readCommand()
+		assert.True(t, errors.Is(err, ProtocolError), "%q", bad)
+	}
+
+	// lengths within the limits with nothing after them
+	allocs := testing.AllocsPerRun(10, func() {
+		_, err := newReader(strings.NewReader("*1\r\n$1000000000\r\nabc"), 1, 1<<30).readCommand()
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+	})
+	assert.True(t, allocs < 10, "%v", allocs)
+
+	big := strings.Repeat("a", 3*readBufferSize+1)
+	args, err := newReader(strings.NewReader("*1\r\n$"+strconv.Itoa(len(big))+"\r\n"+big+"\r\n"), 1, len(big)).readCommand()
+	assert.True(t, err == nil)
+	assert.Equal(t, [][]byte{[]byte(big)}, args)
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	w.simple("OK")
+	w.error("ERR a\r\nb")
+	w.integer(-1)
+	w.bulk([]byte("a"))
+	w.null()
+	w.mapHeader(1)
+	w.proto = 3
+	w.null()
+	w.mapHeader(1)
+	assert.True(t, w.flush() == nil)
+	assert.Equal(t, "+OK\r\n-ERR a  b\r\n:-1\r\n$1\r\na\r\n$-1\r\n*2\r\n_\r\n%1\r\n", buf.String())
+}
@@ -0,0 +1,629 @@
+// Package resp serves a KvStore over the redis protocol, so redis-cli and redis clients can use a store.
+// Replies are RESP2, or RESP3 after HELLO 3.
+//
+// A database number of SELECT is a bucket, Options.Buckets names them. With Options.Delimiter a key like
+// orders:42 is key 42 of bucket orders, a key without the delimiter is in the bucket of the database.
+//
+//	GET key
+//	SET key value [EX seconds | PX milliseconds] [NX]
+//	MGET key [key ...]
+//	MSET key value [key value ...]
+//	DEL key [key ...]
+//	EXISTS key [key ...]
+//	INCR key, INCRBY key delta, DECR key, DECRBY key delta
+//	SCAN cursor [MATCH pattern] [COUNT count]
+//	SELECT db, HELLO [protover], PING [message], ECHO message, QUIT
+//
+// A cursor of SCAN is kept by its connection, the last MaxScans cursors of a connection can be continued.
+// With the delimiter, SCAN of a pattern like orders:* scans bucket orders
+package resp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	kvstore "github.com/gmqio/kv-store"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDatabases databases when Options.Buckets is nil, the bucket of a database is its number
+	DefaultDatabases = 16
+
+	// MaxScans cursors of SCAN kept by a connection
+	MaxScans = 16
+
+	// Version redis version told by HELLO, clients pick features by it
+	Version = "7.0.0"
+
+	// defaultScanCount keys read by SCAN without COUNT
+	defaultScanCount = 10
+)
+
+var (
+	ServerClosedError = errors.New("resp: server closed")
+)
+
+// Options of a Server
+type Options struct {
+	// Buckets the bucket of each database number, empty is DefaultDatabases buckets "0", "1" and so on
+	Buckets []string
+
+	// Delimiter split a key into a bucket and a key at the first delimiter, empty does not split
+	Delimiter string
+
+	// MaxArgs max arguments of a command, 0 is DefaultMaxArgs
+	MaxArgs int
+
+	// MaxBulkBytes max bytes of an argument of a command, 0 is DefaultMaxBulkBytes
+	MaxBulkBytes int
+}
+
+// Server serves a store to redis clients
+type Server struct {
+	store     kvstore.KvStore
+	buckets   [][]byte
+	delimiter []byte
+
+	maxArgs      int
+	maxBulkBytes int
+
+	lock    sync.Mutex
+	closed  bool
+	closers map[io.Closer]struct{} // listeners and connections
+}
+
+// NewServer serve store
+func NewServer(store kvstore.KvStore, opts Options) *Server {
+	s := &Server{
+		store:     store,
+		delimiter: []byte(opts.Delimiter),
+		closers:   make(map[io.Closer]struct{}),
+
+		maxArgs:      opts.MaxArgs,
+		maxBulkBytes: opts.MaxBulkBytes,
+	}
+	if s.maxArgs <= 0 {
+		s.maxArgs = DefaultMaxArgs
+	}
+	if s.maxBulkBytes <= 0 {
+		s.maxBulkBytes = DefaultMaxBulkBytes
+	}
+	for _, b := range opts.Buckets {
+		s.buckets = append(s.buckets, []byte(b))
+	}
+	if len(opts.Buckets) == 0 {
+		for i := 0; i < DefaultDatabases; i++ {
+			s.buckets = append(s.buckets, []byte(strconv.Itoa(i)))
+		}
+	}
+	return s
+}
+
+// Serve connections of l until Close, it always returns an error, ServerClosedError after Close
+func (s *Server) Serve(l net.Listener) error {
+	if !s.track(l, true) {
+		return ServerClosedError
+	}
+	defer s.track(l, false)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				return ServerClosedError
+			}
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serve commands of conn until the client quits or the server is closed, then close conn
+func (s *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	if !s.track(conn, true) {
+		return
+	}
+	defer s.track(conn, false)
+
+	c := &session{server: s, r: newReader(conn, s.maxArgs, s.maxBulkBytes), w: newWriter(conn), scans: make(map[uint64]*scan)}
+	for {
+		args, err := c.r.readCommand()
+		if err != nil {
+			if errors.Is(err, ProtocolError) {
+				// like redis, "ERR Protocol error: invalid multibulk length"
+				c.w.error("ERR Protocol error" + strings.TrimPrefix(err.Error(), ProtocolError.Error()))
+				_ = c.w.flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		c.do(args)
+		if c.quit || !c.r.buffered() {
+			if err := c.w.flush(); err != nil || c.quit {
+				return
+			}
+		}
+	}
+}
+
+// Close stop listeners and close connections
+func (s *Server) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	for c := range s.closers {
+		_ = c.Close()
+	}
+	return nil
+}
+
+// track add or remove a listener or a connection, false if the server is closed
+func (s *Server) track(c io.Closer, add bool) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !add {
+		delete(s.closers, c)
+		return true
+	}
+	if s.closed {
+		return false
+	}
+	s.closers[c] = struct{}{}
+	return true
+}
+
+// scan a cursor of SCAN
+type scan struct {
+	bucket []byte
+	prefix []byte
+	name   []byte // prefix of keys returned
+	token  string
+}
+
+// session state of a connection
+type session struct {
+	server *Server
+	r      *reader
+	w      *writer
+	db     int
+	quit   bool
+	scans  map[uint64]*scan
+	cursor uint64 // the last cursor
+}
+
+type command struct {
+	// arity arguments with the name, negative is at least -arity
+	arity int
+	run   func(c *session, args [][]byte)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"get":    {2, (*session).get},
+		"set":    {-3, (*session).set},
+		"mget":   {-2, (*session).mget},
+		"mset":   {-3, (*session).mset},
+		"del":    {-2, (*session).del},
+		"exists": {-2, (*session).exists},
+		"incr":   {2, (*session).incr},
+		"incrby": {3, (*session).incr},
+		"decr":   {2, (*session).incr},
+		"decrby": {3, (*session).incr},
+		"scan":   {-2, (*session).scan},
+		"select": {2, (*session).selectDB},
+		"hello":  {-1, (*session).hello},
+		"ping":   {-1, (*session).ping},
+		"echo":   {2, (*session).echo},
+		"quit":   {1, (*session).quitConn},
+
+		// redis-cli and clients send them when they connect
+		"command": {-1, (*session).emptyArray},
+		"client":  {-2, (*session).ok},
+	}
+}
+
+func (c *session) do(args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		c.w.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || len(args) < -cmd.arity {
+		c.w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return
+	}
+	cmd.run(c, args)
+}
+
+// key the bucket and the key of a key of a client
+func (c *session) key(k []byte) (bucket, key []byte) {
+	if len(c.server.delimiter) > 0 {
+		if i := bytes.Index(k, c.server.delimiter); i > 0 {
+			return k[:i], k[i+len(c.server.delimiter):]
+		}
+	}
+	return c.server.buckets[c.db], k
+}
+
+// storeError reply an error of the store
+func (c *session) storeError(err error) {
+	switch {
+	case errors.Is(err, kvstore.NotIntegerError):
+		c.w.error("ERR value is not an integer or out of range")
+	case errors.Is(err, kvstore.ReadOnlyError):
+		c.w.error("READONLY " + err.Error())
+	default:
+		c.w.error("ERR " + err.Error())
+	}
+}
+
+func (c *session) get(args [][]byte) {
+	bucket, key := c.key(args[1])
+	v, found, err := c.server.store.Get(bucket, key)
+	switch {
+	case errors.Is(err, kvstore.KeyNotFoundError) || (err == nil && !found):
+		c.w.null()
+	case err != nil:
+		c.storeError(err)
+	default:
+		c.w.bulk(v)
+	}
+}
+
+func (c *session) set(args [][]byte) {
+	var ttl time.Duration
+	nx := false
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "EX", "PX":
+			if ttl > 0 || i+1 == len(args) {
+				c.w.error("ERR syntax error")
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				c.w.error("ERR value is not an integer or out of range")
+				return
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			if n <= 0 || n > math.MaxInt64/int64(unit) {
+				c.w.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			ttl = time.Duration(n) * unit
+		case "NX":
+			nx = true
+		default:
+			c.w.error("ERR syntax error")
+			return
+		}
+	}
+
+	bucket, key := c.key(args[1])
+	err := c.server.store.Update(func(txn kvstore.Txn) error {
+		if nx {
+			if _, err := txn.Get(bucket, key); err == nil {
+				return kvstore.PreconditionFailedError
+			} else if !errors.Is(err, kvstore.KeyNotFoundError) {
+				return err
+			}
+		}
+		return txn.SetWithTTL(bucket, key, args[2], ttl)
+	})
+	switch {
+	case errors.Is(err, kvstore.PreconditionFailedError):
+		c.w.null()
+	case err != nil:
+		c.storeError(err)
+	default:
+		c.w.simple("OK")
+	}
+}
+
+func (c *session) mget(args [][]byte) {
+	values := make([][]byte, len(args)-1)
+	found := make([]bool, len(args)-1)
+	err := c.server.store.View(func(txn kvstore.Txn) error {
+		for i, k := range args[1:] {
+			bucket, key := c.key(k)
+			v, err := txn.Get(bucket, key)
+			if errors.Is(err, kvstore.KeyNotFoundError) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			values[i], found[i] = v, true
+		}
+		return nil
+	})
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+	c.w.array(len(values))
+	for i, v := range values {
+		if found[i] {
+			c.w.bulk(v)
+		} else {
+			c.w.null()
+		}
+	}
+}
+
+// mset set every key in one transaction
+func (c *session) mset(args [][]byte) {
+	if len(args)%2 == 0 {
+		c.w.error("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+	err := c.server.store.Update(func(txn kvstore.Txn) error {
+		for i := 1; i < len(args); i += 2 {
+			bucket, key := c.key(args[i])
+			if err := txn.Set(bucket, key, args[i+1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+	c.w.simple("OK")
+}
+
+// del reply the number of keys deleted
+func (c *session) del(args [][]byte) {
+	var n int64
+	err := c.server.store.Update(func(txn kvstore.Txn) error {
+		n = 0
+		for _, k := range args[1:] {
+			bucket, key := c.key(k)
+			if _, err := txn.Get(bucket, key); errors.Is(err, kvstore.KeyNotFoundError) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if err := txn.Delete(bucket, key); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+	c.w.integer(n)
+}
+
+// exists reply the number of keys found, a key repeated is counted again
+func (c *session) exists(args [][]byte) {
+	var n int64
+	err := c.server.store.View(func(txn kvstore.Txn) error {
+		for _, k := range args[1:] {
+			bucket, key := c.key(k)
+			if _, err := txn.Get(bucket, key); err == nil {
+				n++
+			} else if !errors.Is(err, kvstore.KeyNotFoundError) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+	c.w.integer(n)
+}
+
+// incr INCR, INCRBY, DECR and DECRBY
+func (c *session) incr(args [][]byte) {
+	delta := int64(1)
+	if len(args) == 3 {
+		var err error
+		if delta, err = strconv.ParseInt(string(args[2]), 10, 64); err != nil {
+			c.w.error("ERR value is not an integer or out of range")
+			return
+		}
+	}
+	if strings.HasPrefix(strings.ToLower(string(args[0])), "decr") {
+		if delta == math.MinInt64 {
+			c.w.error("ERR decrement would overflow")
+			return
+		}
+		delta = -delta
+	}
+	bucket, key := c.key(args[1])
+	n, err := c.server.store.Incr(bucket, key, delta)
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+	c.w.integer(n)
+}
+
+// scan reply the next cursor and a page of keys, cursor 0 starts a scan and the last page has cursor 0
+func (c *session) scan(args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		c.w.error("ERR invalid cursor")
+		return
+	}
+	var pattern []byte
+	count := defaultScanCount
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			c.w.error("ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil || count < 1 {
+				c.w.error("ERR syntax error")
+				return
+			}
+		default:
+			c.w.error("ERR syntax error")
+			return
+		}
+	}
+
+	sc := c.scans[cursor]
+	if cursor == 0 {
+		sc = c.newScan(pattern)
+	} else if sc == nil {
+		c.w.error("ERR invalid cursor")
+		return
+	}
+	delete(c.scans, cursor)
+	page, err := c.server.store.Range(sc.bucket, kvstore.RangeOptions{
+		Prefix:   sc.prefix,
+		Limit:    count,
+		KeysOnly: true,
+		Token:    sc.token,
+	})
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+
+	next := uint64(0)
+	if page.Token != "" {
+		sc.token = page.Token
+		next = c.keepScan(sc)
+	}
+	var keys [][]byte
+	for _, k := range page.Keys {
+		k = append(append([]byte(nil), sc.name...), k...)
+		if pattern == nil || match(pattern, k) {
+			keys = append(keys, k)
+		}
+	}
+	c.w.array(2)
+	c.w.bulk([]byte(strconv.FormatUint(next, 10)))
+	c.w.array(len(keys))
+	for _, k := range keys {
+		c.w.bulk(k)
+	}
+}
+
+// newScan scan the bucket of the database, or the bucket in the literal prefix of pattern with the delimiter
+func (c *session) newScan(pattern []byte) *scan {
+	prefix := literalPrefix(pattern)
+	sc := &scan{bucket: c.server.buckets[c.db], prefix: prefix}
+	if d := c.server.delimiter; len(d) > 0 {
+		if i := bytes.Index(prefix, d); i > 0 {
+			sc.bucket, sc.prefix, sc.name = prefix[:i], prefix[i+len(d):], prefix[:i+len(d)]
+		}
+	}
+	return sc
+}
+
+// keepScan keep sc for its next cursor, the oldest cursor is dropped after MaxScans
+func (c *session) keepScan(sc *scan) uint64 {
+	c.cursor++
+	c.scans[c.cursor] = sc
+	if len(c.scans) > MaxScans {
+		oldest := c.cursor
+		for cursor := range c.scans {
+			oldest = min(oldest, cursor)
+		}
+		delete(c.scans, oldest)
+	}
+	return c.cursor
+}
+
+func (c *session) selectDB(args [][]byte) {
+	db, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		c.w.error("ERR value is not an integer or out of range")
+		return
+	}
+	if db < 0 || db >= len(c.server.buckets) {
+		c.w.error("ERR DB index is out of range")
+		return
+	}
+	c.db = db
+	c.w.simple("OK")
+}
+
+// hello switch to the protocol version and reply about the server, options after the version are ignored
+func (c *session) hello(args [][]byte) {
+	if len(args) > 1 {
+		proto, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			c.w.error("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if proto != 2 && proto != 3 {
+			c.w.error("NOPROTO unsupported protocol version")
+			return
+		}
+		c.w.proto = proto
+	}
+	c.w.mapHeader(6)
+	c.w.bulk([]byte("server"))
+	c.w.bulk([]byte("kvstore"))
+	c.w.bulk([]byte("version"))
+	c.w.bulk([]byte(Version))
+	c.w.bulk([]byte("proto"))
+	c.w.integer(int64(c.w.proto))
+	c.w.bulk([]byte("mode"))
+	c.w.bulk([]byte("standalone"))
+	c.w.bulk([]byte("role"))
+	c.w.bulk([]byte("master"))
+	c.w.bulk([]byte("modules"))
+	c.w.array(0)
+}
+
+func (c *session) ping(args [][]byte) {
+	switch len(args) {
+	case 1:
+		c.w.simple("PONG")
+	case 2:
+		c.w.bulk(args[1])
+	default:
+		c.w.error("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (c *session) echo(args [][]byte) {
+	c.w.bulk(args[1])
+}
+
+func (c *session) quitConn(_ [][]byte) {
+	c.quit = true
+	c.w.simple("OK")
+}
+
+func (c *session) emptyArray(_ [][]byte) {
+	c.w.array(0)
+}
+
+func (c *session) ok(_ [][]byte) {
+	c.w.simple("OK")
+}
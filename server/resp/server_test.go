@@ -0,0 +1,266 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/gmqio/kv-store/kvstoretest"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// client a redis client of a connection served by a server
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newClient(t *testing.T, store kvstore.KvStore, opts Options) *client {
+	s := NewServer(store, opts)
+	c, conn := net.Pipe()
+	go s.ServeConn(conn)
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = s.Close()
+	})
+	return &client{t: t, conn: c, r: bufio.NewReader(c)}
+}
+
+// do send a command and read its reply
+func (c *client) do(args ...string) any {
+	c.t.Helper()
+	cmd := "*" + strconv.Itoa(len(args)) + "\r\n"
+	for _, a := range args {
+		cmd += "$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n"
+	}
+	_, err := c.conn.Write([]byte(cmd))
+	assert.True(c.t, err == nil)
+	return c.read()
+}
+
+// read a reply, a string, an int64, nil, an error or a slice of replies
+func (c *client) read() any {
+	c.t.Helper()
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return errors.New(line[1:])
+	case ':':
+		n, _ := strconv.ParseInt(line[1:], 10, 64)
+		return n
+	case '_':
+		return nil
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			c.t.Fatalf("read: %v", err)
+		}
+		return string(buf[:n])
+	case '*', '%':
+		n, _ := strconv.Atoi(line[1:])
+		if line[0] == '%' {
+			n *= 2
+		}
+		replies := []any{}
+		for i := 0; i < n; i++ {
+			replies = append(replies, c.read())
+		}
+		return replies
+	}
+	c.t.Fatalf("bad reply %q", line)
+	return nil
+}
+
+// test get, set, mget, mset, del, exists and incr
+func TestCommands(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		c := newClient(t, s, Options{})
+
+		assert.Equal(t, "PONG", c.do("PING"))
+		assert.Equal(t, "OK", c.do("SET", "a", "1"))
+		assert.Equal(t, "1", c.do("get", "a"))
+		assert.Equal(t, nil, c.do("GET", "b"))
+		v, _, _ := s.Get([]byte("0"), []byte("a"))
+		assert.Equal(t, "1", string(v), "database 0 is bucket 0")
+
+		assert.Equal(t, nil, c.do("SET", "a", "2", "NX"))
+		assert.Equal(t, "OK", c.do("SET", "b", "", "EX", "100"))
+		ttl, _ := s.TTL([]byte("0"), []byte("b"))
+		assert.True(t, ttl > 90*time.Second && ttl <= 100*time.Second)
+		assert.Equal(t, "", c.do("GET", "b"))
+		assert.Equal(t, "OK", c.do("SET", "c", "3", "PX", "100000"))
+		assert.Equal(t, errors.New("ERR syntax error"), c.do("SET", "a", "1", "EX"))
+		assert.Equal(t, errors.New("ERR invalid expire time in 'set' command"), c.do("SET", "a", "1", "EX", "0"))
+
+		assert.Equal(t, "OK", c.do("MSET", "d", "4", "e", "five"))
+		assert.Equal(t, []any{"1", nil, "", "4"}, c.do("MGET", "a", "x", "b", "d"))
+		assert.Equal(t, errors.New("ERR wrong number of arguments for 'mset' command"), c.do("MSET", "d", "4", "e"))
+
+		assert.Equal(t, int64(3), c.do("EXISTS", "a", "a", "b", "x"))
+		assert.Equal(t, int64(2), c.do("DEL", "a", "b", "x"))
+		assert.Equal(t, int64(0), c.do("EXISTS", "a", "b"))
+
+		assert.Equal(t, int64(1), c.do("INCR", "n"))
+		assert.Equal(t, int64(11), c.do("INCRBY", "n", "10"))
+		assert.Equal(t, int64(10), c.do("DECR", "n"))
+		assert.Equal(t, int64(5), c.do("DECRBY", "n", "5"))
+		assert.Equal(t, errors.New("ERR value is not an integer or out of range"), c.do("INCR", "e"))
+
+		assert.Equal(t, errors.New("ERR unknown command 'FLUSHALL'"), c.do("FLUSHALL"))
+		assert.Equal(t, errors.New("ERR wrong number of arguments for 'get' command"), c.do("GET"))
+	})
+}
+
+// test databases and the delimiter select buckets
+func TestBuckets(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		c := newClient(t, s, Options{Buckets: []string{"meta", "topics"}, Delimiter: ":"})
+
+		assert.Equal(t, "OK", c.do("SET", "a", "1"))
+		assert.Equal(t, "OK", c.do("SELECT", "1"))
+		assert.Equal(t, "OK", c.do("SET", "a", "2"))
+		assert.Equal(t, "OK", c.do("SET", "orders:42", "3"))
+		assert.Equal(t, "OK", c.do("SET", ":b", "4"))
+		assert.Equal(t, errors.New("ERR DB index is out of range"), c.do("SELECT", "2"))
+
+		for _, kv := range [][3]string{{"meta", "a", "1"}, {"topics", "a", "2"}, {"orders", "42", "3"}, {"topics", ":b", "4"}} {
+			v, _, err := s.Get([]byte(kv[0]), []byte(kv[1]))
+			assert.True(t, err == nil, "%v", kv)
+			assert.Equal(t, kv[2], string(v))
+		}
+		assert.Equal(t, "1", c.do("GET", "meta:a"))
+		assert.Equal(t, []any{"3", "2"}, c.do("MGET", "orders:42", "a"))
+	})
+}
+
+// test scan pages with cursors
+func TestScan(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		for i := 0; i < 25; i++ {
+			_ = s.Set([]byte("0"), []byte(fmt.Sprintf("key-%02d", i)), []byte("v"))
+		}
+		_ = s.Set([]byte("0"), []byte("other"), []byte("v"))
+		_ = s.Set([]byte("orders"), []byte("42"), []byte("v"))
+		c := newClient(t, s, Options{Delimiter: ":"})
+
+		scanAll := func(args ...string) []string {
+			var keys []string
+			cursor := "0"
+			for {
+				reply := c.do(append([]string{"SCAN", cursor}, args...)...).([]any)
+				for _, k := range reply[1].([]any) {
+					keys = append(keys, k.(string))
+				}
+				if cursor = reply[0].(string); cursor == "0" {
+					return keys
+				}
+			}
+		}
+		assert.Equal(t, 26, len(scanAll()))
+		keys := scanAll("MATCH", "key-1*", "COUNT", "3")
+		assert.Equal(t, []string{"key-10", "key-11", "key-12", "key-13", "key-14", "key-15", "key-16", "key-17", "key-18", "key-19"}, keys)
+		assert.Equal(t, []string{"key-05", "key-15"}, scanAll("MATCH", "*5"))
+		assert.Equal(t, []string{"orders:42"}, scanAll("MATCH", "orders:*"))
+
+		assert.Equal(t, errors.New("ERR invalid cursor"), c.do("SCAN", "7"))
+		assert.Equal(t, errors.New("ERR syntax error"), c.do("SCAN", "0", "COUNT"))
+
+		// only the last cursors are kept
+		first := c.do("SCAN", "0", "COUNT", "1").([]any)[0].(string)
+		for i := 0; i < MaxScans; i++ {
+			c.do("SCAN", "0", "COUNT", "1")
+		}
+		assert.Equal(t, errors.New("ERR invalid cursor"), c.do("SCAN", first))
+	})
+}
+
+// test empty Buckets are the default databases
+func TestEmptyBuckets(t *testing.T) {
+	s := kvstoretest.Open(t, kvstore.EngineMemory, kvstore.Options{})
+	c := newClient(t, s, Options{Buckets: []string{}})
+	assert.Equal(t, "OK", c.do("SET", "a", "1"))
+	v, _, err := s.Get([]byte("0"), []byte("a"))
+	assert.True(t, err == nil)
+	assert.Equal(t, "1", string(v))
+}
+
+// test a protocol error is replied like redis before the connection is closed
+func TestProtocolError(t *testing.T) {
+	c := newClient(t, kvstoretest.Open(t, kvstore.EngineMemory, kvstore.Options{}), Options{})
+	_, err := c.conn.Write([]byte("*x\r\n"))
+	assert.True(t, err == nil)
+	assert.Equal(t, errors.New("ERR Protocol error: invalid multibulk length"), c.read())
+}
+
+// test replies of RESP3 after HELLO 3
+func TestHello(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		c := newClient(t, s, Options{})
+		reply := c.do("HELLO", "3").([]any)
+		assert.Equal(t, []any{"proto", int64(3)}, reply[4:6])
+		assert.Equal(t, nil, c.do("GET", "a"))
+		_, err := c.conn.Write([]byte("*1\r\n$3\r\nGET\r\n"))
+		assert.True(t, err == nil)
+		assert.Equal(t, errors.New("ERR wrong number of arguments for 'get' command"), c.read())
+		assert.Equal(t, errors.New("NOPROTO unsupported protocol version"), c.do("HELLO", "4"))
+
+		// inline commands and pipelines
+		_, err = c.conn.Write([]byte("SET a 1\r\nGET a\r\n"))
+		assert.True(t, err == nil)
+		assert.Equal(t, "OK", c.read())
+		assert.Equal(t, "1", c.read())
+	})
+}
+
+// test errors of the store
+func TestStoreErrors(t *testing.T) {
+	kvstoretest.Stores(t, kvstore.Options{ReadOnly: true}, func(t *testing.T, s kvstore.KvStore) {
+		c := newClient(t, s, Options{})
+		assert.Equal(t, errors.New("READONLY store is read only"), c.do("SET", "a", "1"))
+		assert.Equal(t, nil, c.do("GET", "a"))
+		assert.Equal(t, "OK", c.do("QUIT"))
+		_, err := c.r.ReadByte()
+		assert.True(t, err != nil, "closed after QUIT")
+	})
+}
+
+// test Serve until Close
+func TestServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %v", err)
+	}
+	s := NewServer(kvstoretest.Open(t, kvstore.EngineMemory, kvstore.Options{}), Options{})
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(l)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.True(t, err == nil)
+	c := &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+	assert.Equal(t, "PONG", c.do("PING"))
+
+	assert.True(t, s.Close() == nil)
+	assert.Equal(t, ServerClosedError, <-done)
+	_, err = c.r.ReadByte()
+	assert.True(t, err != nil, "connections are closed")
+	assert.Equal(t, ServerClosedError, s.Serve(l))
+}
@@ -0,0 +1,79 @@
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Stats sizes of a store
+type Stats struct {
+	Engine    string
+	KeyFormat KeyFormat
+	ReadOnly  bool
+
+	// Keys versions of keys in tables of badger including deletes, keys in the memtable are not counted.
+	// The number of live keys in memory
+	Keys uint64
+
+	// Tables number of LSM tables of badger
+	Tables int
+
+	// LSMSize and VLogSize bytes on disk of badger, bytes of keys and values in memory
+	LSMSize  int64
+	VLogSize int64
+
+	// PendingCompactions levels of badger due for a compaction, 0 in memory
+	PendingCompactions int
+
+	// Cache of badger, zero without a cache
+	Cache CacheStats
+}
+
+func (b badgerStore) GCCtx(ctx context.Context, discardRatio float64) (int, error) {
+	b.log.debug("GC")
+	if b.opts.InMemory {
+		return 0, nil
+	}
+	if b.opts.ReadOnly {
+		return 0, ReadOnlyError
+	}
+	n := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		err := b.db.RunValueLogGC(discardRatio)
+		if errors.Is(err, badger.ErrNoRewrite) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+func (b badgerStore) Stats() (Stats, error) {
+	b.log.debug("Stats")
+	if b.db.IsClosed() {
+		return Stats{}, StoreClosedError
+	}
+	stats := Stats{
+		Engine:    EngineBadger,
+		KeyFormat: b.format,
+		ReadOnly:  b.opts.ReadOnly,
+	}
+	for _, t := range b.db.Tables() {
+		stats.Keys += uint64(t.KeyCount)
+		stats.Tables++
+	}
+	stats.LSMSize, stats.VLogSize = b.db.Size()
+	for _, level := range b.db.Levels() {
+		if level.Score >= 1 {
+			stats.PendingCompactions++
+		}
+	}
+	stats.Cache = b.cache.stats()
+	return stats, nil
+}
@@ -0,0 +1,31 @@
+package kvstore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// test stats and gc of both engines
+func TestStats(t *testing.T) {
+	testStores(t, fillCursorKeys, func(t *testing.T, s KvStore) {
+		n, err := s.GC(0.5)
+		assert.True(t, err == nil, "%v", err)
+		assert.Equal(t, 0, n)
+
+		stats, err := s.Stats()
+		assert.True(t, err == nil)
+		assert.Equal(t, KeyFormatLegacy, stats.KeyFormat)
+		assert.False(t, stats.ReadOnly)
+		if stats.Engine == EngineMemory {
+			assert.Equal(t, uint64(21), stats.Keys)
+			assert.True(t, stats.VLogSize > 0)
+		} else {
+			assert.Equal(t, EngineBadger, stats.Engine)
+		}
+	})
+
+	s, _ := Open(EngineMemory, Options{})
+	_ = s.Close()
+	_, err := s.Stats()
+	assert.Equal(t, StoreClosedError, err)
+}
@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Recorder a Tracer keeping spans in memory, ended spans are listed by Spans. It is meant for tests
+type Recorder struct {
+	lock  sync.Mutex
+	ended []RecordedSpan
+	next  uint64
+}
+
+var _ Tracer = (*Recorder)(nil)
+
+// RecordedSpan a span ended in a Recorder
+type RecordedSpan struct {
+	ID         uint64
+	Parent     uint64 // 0 for a root span
+	Name       string
+	Attributes map[string]interface{}
+	Err        error
+	Start      time.Time
+	End        time.Time
+}
+
+type recorderKey struct{}
+
+// recordingSpan a span of a Recorder until it ends
+type recordingSpan struct {
+	r     *Recorder
+	lock  sync.Mutex
+	span  RecordedSpan
+	ended bool
+}
+
+func (r *Recorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	r.lock.Lock()
+	r.next++
+	id := r.next
+	r.lock.Unlock()
+
+	s := &recordingSpan{r: r, span: RecordedSpan{ID: id, Name: name, Attributes: make(map[string]interface{}), Start: time.Now()}}
+	if parent, ok := ctx.Value(recorderKey{}).(*recordingSpan); ok && parent.r == r {
+		s.span.Parent = parent.span.ID
+	}
+	s.SetAttributes(attrs...)
+	return context.WithValue(ctx, recorderKey{}, s), s
+}
+
+// Spans ended so far in the order they ended
+func (r *Recorder) Spans() []RecordedSpan {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]RecordedSpan(nil), r.ended...)
+}
+
+// Reset forget spans ended so far
+func (r *Recorder) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.ended = nil
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...Attribute) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ended {
+		return
+	}
+	for _, a := range attrs {
+		s.span.Attributes[a.Key] = a.Value
+	}
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.ended {
+		s.span.Err = err
+	}
+}
+
+func (s *recordingSpan) End() {
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.span.End = time.Now()
+	span := s.span
+	s.lock.Unlock()
+
+	s.r.lock.Lock()
+	defer s.r.lock.Unlock()
+	s.r.ended = append(s.r.ended, span)
+}
@@ -0,0 +1,453 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	kvstore "github.com/gmqio/kv-store"
+	"io"
+	"time"
+)
+
+// attribute keys of spans of a Store
+const (
+	MethodKey       = "kvstore.method"
+	BucketKey       = "kvstore.bucket"
+	KeysKey         = "kvstore.keys"
+	ReadBytesKey    = "kvstore.read_bytes"
+	WrittenBytesKey = "kvstore.written_bytes"
+	FoundKey        = "kvstore.found"
+)
+
+// Store traces calls of a store made through its XxxCtx methods, Watch and WatchFrom. Methods without a
+// context are the ones of the store and are not traced. KeyNotFoundError is not recorded as an error.
+// The context of a call, with its span, is passed on to the store, see kvstore.WithContext
+type Store struct {
+	kvstore.KvStore
+	store  kvstore.KvStoreCtx
+	tracer Tracer
+}
+
+var _ kvstore.KvStoreCtx = (*Store)(nil)
+
+// New trace calls of store with tracer, nil for NoopTracer
+func New(store kvstore.KvStore, tracer Tracer) *Store {
+	if tracer == nil {
+		tracer = NoopTracer{}
+	}
+	return &Store{KvStore: store, store: kvstore.WithContext(store), tracer: tracer}
+}
+
+// Unwrap the store traced
+func (s *Store) Unwrap() kvstore.KvStore {
+	return s.KvStore
+}
+
+// start a span of a method on a bucket, its name is kvstore.method
+func (s *Store) start(ctx context.Context, method string, bucket []byte) (context.Context, Span) {
+	attrs := []Attribute{String(MethodKey, method)}
+	if bucket != nil {
+		attrs = append(attrs, String(BucketKey, string(bucket)))
+	}
+	return s.tracer.Start(ctx, "kvstore."+method, attrs...)
+}
+
+// end a span with the keys of the call, bytes of keys and values returned and given, and its error
+func end(span Span, err error, keys, read, written int) {
+	span.SetAttributes(Int(KeysKey, keys), Int(ReadBytesKey, read), Int(WrittenBytesKey, written))
+	if err != nil && !errors.Is(err, kvstore.KeyNotFoundError) {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// size bytes of slices
+func size(slices ...[]byte) int {
+	n := 0
+	for _, b := range slices {
+		n += len(b)
+	}
+	return n
+}
+
+// sizes bytes of lists of slices
+func sizes(lists ...[][]byte) int {
+	n := 0
+	for _, list := range lists {
+		n += size(list...)
+	}
+	return n
+}
+
+// lengths bytes of strings
+func lengths(list []string) int {
+	n := 0
+	for _, s := range list {
+		n += len(s)
+	}
+	return n
+}
+
+func (s *Store) SetCtx(ctx context.Context, bucket, k []byte, v []byte) error {
+	ctx, span := s.start(ctx, "Set", bucket)
+	err := s.store.SetCtx(ctx, bucket, k, v)
+	end(span, err, 1, 0, size(k, v))
+	return err
+}
+
+func (s *Store) GetCtx(ctx context.Context, bucket, k []byte) (result []byte, found bool, e error) {
+	ctx, span := s.start(ctx, "Get", bucket)
+	v, found, err := s.store.GetCtx(ctx, bucket, k)
+	span.SetAttributes(Bool(FoundKey, found))
+	end(span, err, 1, len(v), len(k))
+	return v, found, err
+}
+
+func (s *Store) SetWithTTLCtx(ctx context.Context, bucket, k []byte, v []byte, ttl time.Duration) error {
+	ctx, span := s.start(ctx, "SetWithTTL", bucket)
+	err := s.store.SetWithTTLCtx(ctx, bucket, k, v, ttl)
+	end(span, err, 1, 0, size(k, v))
+	return err
+}
+
+func (s *Store) PSetCtx(ctx context.Context, bucket []byte, keys, values [][]byte) error {
+	ctx, span := s.start(ctx, "PSet", bucket)
+	err := s.store.PSetCtx(ctx, bucket, keys, values)
+	end(span, err, len(keys), 0, sizes(keys, values))
+	return err
+}
+
+func (s *Store) PSetWithTTLCtx(ctx context.Context, bucket []byte, keys, values [][]byte, ttl time.Duration) error {
+	ctx, span := s.start(ctx, "PSetWithTTL", bucket)
+	err := s.store.PSetWithTTLCtx(ctx, bucket, keys, values, ttl)
+	end(span, err, len(keys), 0, sizes(keys, values))
+	return err
+}
+
+func (s *Store) TTLCtx(ctx context.Context, bucket, k []byte) (time.Duration, error) {
+	ctx, span := s.start(ctx, "TTL", bucket)
+	ttl, err := s.store.TTLCtx(ctx, bucket, k)
+	end(span, err, 1, 0, len(k))
+	return ttl, err
+}
+
+func (s *Store) PersistCtx(ctx context.Context, bucket, k []byte) error {
+	ctx, span := s.start(ctx, "Persist", bucket)
+	err := s.store.PersistCtx(ctx, bucket, k)
+	end(span, err, 1, 0, len(k))
+	return err
+}
+
+func (s *Store) PGetCtx(ctx context.Context, bucket []byte, keys [][]byte) ([][]byte, error) {
+	ctx, span := s.start(ctx, "PGet", bucket)
+	values, err := s.store.PGetCtx(ctx, bucket, keys)
+	end(span, err, len(keys), sizes(values), sizes(keys))
+	return values, err
+}
+
+func (s *Store) CompareAndSwapCtx(ctx context.Context, bucket, k, expected, v []byte) error {
+	ctx, span := s.start(ctx, "CompareAndSwap", bucket)
+	err := s.store.CompareAndSwapCtx(ctx, bucket, k, expected, v)
+	end(span, err, 1, 0, size(k, expected, v))
+	return err
+}
+
+func (s *Store) SetIfAbsentCtx(ctx context.Context, bucket, k, v []byte) error {
+	ctx, span := s.start(ctx, "SetIfAbsent", bucket)
+	err := s.store.SetIfAbsentCtx(ctx, bucket, k, v)
+	end(span, err, 1, 0, size(k, v))
+	return err
+}
+
+func (s *Store) IncrCtx(ctx context.Context, bucket, k []byte, delta int64) (int64, error) {
+	ctx, span := s.start(ctx, "Incr", bucket)
+	n, err := s.store.IncrCtx(ctx, bucket, k, delta)
+	end(span, err, 1, 0, len(k))
+	return n, err
+}
+
+func (s *Store) SequenceCtx(ctx context.Context, bucket, name []byte, leaseSize uint64) (kvstore.Sequence, error) {
+	ctx, span := s.start(ctx, "Sequence", bucket)
+	seq, err := s.store.SequenceCtx(ctx, bucket, name, leaseSize)
+	end(span, err, 1, 0, len(name))
+	return seq, err
+}
+
+func (s *Store) DeleteCtx(ctx context.Context, bucket, key []byte) error {
+	ctx, span := s.start(ctx, "Delete", bucket)
+	err := s.store.DeleteCtx(ctx, bucket, key)
+	end(span, err, 1, 0, len(key))
+	return err
+}
+
+func (s *Store) DeleteIfEqualsCtx(ctx context.Context, bucket, k, expected []byte) error {
+	ctx, span := s.start(ctx, "DeleteIfEquals", bucket)
+	err := s.store.DeleteIfEqualsCtx(ctx, bucket, k, expected)
+	end(span, err, 1, 0, size(k, expected))
+	return err
+}
+
+func (s *Store) DeleteKeysCtx(ctx context.Context, bucket []byte, keys [][]byte) error {
+	ctx, span := s.start(ctx, "DeleteKeys", bucket)
+	err := s.store.DeleteKeysCtx(ctx, bucket, keys)
+	end(span, err, len(keys), 0, sizes(keys))
+	return err
+}
+
+// KeysCtx keys of the span are the keys returned, like other scans
+func (s *Store) KeysCtx(ctx context.Context, bucket, prefix []byte) (keys [][]byte, values [][]byte, err error) {
+	ctx, span := s.start(ctx, "Keys", bucket)
+	keys, values, err = s.store.KeysCtx(ctx, bucket, prefix)
+	end(span, err, len(keys), sizes(keys, values), len(prefix))
+	return keys, values, err
+}
+
+func (s *Store) KeyStringsCtx(ctx context.Context, bucket, prefix []byte) (keys []string, values [][]byte, err error) {
+	ctx, span := s.start(ctx, "KeyStrings", bucket)
+	keys, values, err = s.store.KeyStringsCtx(ctx, bucket, prefix)
+	end(span, err, len(keys), lengths(keys)+sizes(values), len(prefix))
+	return keys, values, err
+}
+
+func (s *Store) KeysWithoutValuesCtx(ctx context.Context, bucket, prefix []byte) (keys [][]byte, err error) {
+	ctx, span := s.start(ctx, "KeysWithoutValues", bucket)
+	keys, err = s.store.KeysWithoutValuesCtx(ctx, bucket, prefix)
+	end(span, err, len(keys), sizes(keys), len(prefix))
+	return keys, err
+}
+
+func (s *Store) KeyStringsWithoutValuesCtx(ctx context.Context, bucket, prefix []byte) (keys []string, err error) {
+	ctx, span := s.start(ctx, "KeyStringsWithoutValues", bucket)
+	keys, err = s.store.KeyStringsWithoutValuesCtx(ctx, bucket, prefix)
+	end(span, err, len(keys), lengths(keys), len(prefix))
+	return keys, err
+}
+
+// CursorCtx the span ends when the cursor is closed, with the keys it visited
+func (s *Store) CursorCtx(ctx context.Context, bucket []byte, opts kvstore.CursorOptions) (kvstore.Cursor, error) {
+	ctx, span := s.start(ctx, "Cursor", bucket)
+	c, err := s.store.CursorCtx(ctx, bucket, opts)
+	if err != nil {
+		end(span, err, 0, 0, 0)
+		return nil, err
+	}
+	return &cursor{Cursor: c, span: span}, nil
+}
+
+func (s *Store) RangeCtx(ctx context.Context, bucket []byte, opts kvstore.RangeOptions) (kvstore.RangePage, error) {
+	ctx, span := s.start(ctx, "Range", bucket)
+	page, err := s.store.RangeCtx(ctx, bucket, opts)
+	end(span, err, len(page.Keys), sizes(page.Keys, page.Values), 0)
+	return page, err
+}
+
+// Watch the span ends when the watch is set up, not when it stops
+func (s *Store) Watch(ctx context.Context, bucket, prefix []byte) (<-chan kvstore.Event, error) {
+	_, span := s.start(ctx, "Watch", bucket)
+	ch, err := s.KvStore.Watch(ctx, bucket, prefix)
+	end(span, err, 0, 0, len(prefix))
+	return ch, err
+}
+
+// WatchFrom the span ends when the watch is set up, not when it stops
+func (s *Store) WatchFrom(ctx context.Context, bucket, prefix []byte, version uint64) (<-chan kvstore.Event, error) {
+	_, span := s.start(ctx, "WatchFrom", bucket)
+	ch, err := s.KvStore.WatchFrom(ctx, bucket, prefix, version)
+	end(span, err, 0, 0, len(prefix))
+	return ch, err
+}
+
+func (s *Store) BucketsCtx(ctx context.Context) ([][]byte, error) {
+	ctx, span := s.start(ctx, "Buckets", nil)
+	buckets, err := s.store.BucketsCtx(ctx)
+	end(span, err, len(buckets), sizes(buckets), 0)
+	return buckets, err
+}
+
+func (s *Store) AllKeysCtx(ctx context.Context, async func(key string, deletedOrExpired bool)) error {
+	ctx, span := s.start(ctx, "AllKeys", nil)
+	keys, n := 0, 0
+	err := s.store.AllKeysCtx(ctx, func(key string, deletedOrExpired bool) {
+		keys++
+		n += len(key)
+		async(key, deletedOrExpired)
+	})
+	end(span, err, keys, n, 0)
+	return err
+}
+
+func (s *Store) SyncCtx(ctx context.Context) error {
+	ctx, span := s.start(ctx, "Sync", nil)
+	err := s.store.SyncCtx(ctx)
+	end(span, err, 0, 0, 0)
+	return err
+}
+
+func (s *Store) GCCtx(ctx context.Context, discardRatio float64) (int, error) {
+	ctx, span := s.start(ctx, "GC", nil)
+	n, err := s.store.GCCtx(ctx, discardRatio)
+	end(span, err, 0, 0, 0)
+	return n, err
+}
+
+// BackupCtx bytes of the backup are read bytes of the span
+func (s *Store) BackupCtx(ctx context.Context, w io.Writer, since uint64, buckets ...[]byte) (uint64, error) {
+	ctx, span := s.start(ctx, "Backup", nil)
+	cw := &countWriter{w: w}
+	version, err := s.store.BackupCtx(ctx, cw, since, buckets...)
+	end(span, err, 0, int(cw.n), 0)
+	return version, err
+}
+
+// RestoreCtx bytes of the backup are written bytes of the span
+func (s *Store) RestoreCtx(ctx context.Context, r io.Reader) error {
+	ctx, span := s.start(ctx, "Restore", nil)
+	cr := &countReader{r: r}
+	err := s.store.RestoreCtx(ctx, cr)
+	end(span, err, 0, 0, int(cr.n))
+	return err
+}
+
+func (s *Store) UpdateCtx(ctx context.Context, f func(txn kvstore.Txn) error) error {
+	return s.txn(ctx, "Update", s.store.UpdateCtx, f)
+}
+
+func (s *Store) ViewCtx(ctx context.Context, f func(txn kvstore.Txn) error) error {
+	return s.txn(ctx, "View", s.store.ViewCtx, f)
+}
+
+func (s *Store) BatchCtx(ctx context.Context, f func(txn kvstore.Txn) error) error {
+	return s.txn(ctx, "Batch", s.store.BatchCtx, f)
+}
+
+// txn trace a transaction of run, keys of the span are the keys read or written by its last run
+func (s *Store) txn(ctx context.Context, name string, run func(ctx context.Context, f func(txn kvstore.Txn) error) error, f func(txn kvstore.Txn) error) error {
+	ctx, span := s.start(ctx, name, nil)
+	var t *txn
+	err := run(ctx, func(inner kvstore.Txn) error {
+		t = &txn{Txn: inner}
+		return f(t)
+	})
+	if t == nil {
+		t = &txn{}
+	}
+	end(span, err, t.keys, t.read, t.written)
+	return err
+}
+
+// txn counts keys and bytes of a transaction
+type txn struct {
+	kvstore.Txn
+	keys    int
+	read    int
+	written int
+}
+
+func (t *txn) Get(bucket, k []byte) ([]byte, error) {
+	v, err := t.Txn.Get(bucket, k)
+	t.keys++
+	t.read += len(v)
+	t.written += len(k)
+	return v, err
+}
+
+func (t *txn) Set(bucket, k, v []byte) error {
+	t.keys++
+	t.written += size(k, v)
+	return t.Txn.Set(bucket, k, v)
+}
+
+func (t *txn) SetWithTTL(bucket, k, v []byte, ttl time.Duration) error {
+	t.keys++
+	t.written += size(k, v)
+	return t.Txn.SetWithTTL(bucket, k, v, ttl)
+}
+
+func (t *txn) SetWithMeta(bucket, k, v []byte, meta byte, ttl time.Duration) error {
+	t.keys++
+	t.written += size(k, v)
+	return t.Txn.SetWithMeta(bucket, k, v, meta, ttl)
+}
+
+func (t *txn) SetWithExpiresAt(bucket, k, v []byte, expiresAt uint64) error {
+	t.keys++
+	t.written += size(k, v)
+	return t.Txn.SetWithExpiresAt(bucket, k, v, expiresAt)
+}
+
+func (t *txn) Delete(bucket, k []byte) error {
+	t.keys++
+	t.written += len(k)
+	return t.Txn.Delete(bucket, k)
+}
+
+func (t *txn) Scan(bucket, prefix []byte, visit func(k, v []byte) error) error {
+	return t.Txn.Scan(bucket, prefix, func(k, v []byte) error {
+		t.keys++
+		t.read += size(k, v)
+		return visit(k, v)
+	})
+}
+
+// cursor counts keys visited until it is closed, then ends its span
+type cursor struct {
+	kvstore.Cursor
+	span Span
+	keys int
+	read int
+}
+
+func (c *cursor) visit(ok bool) bool {
+	if ok {
+		c.keys++
+		c.read += len(c.Cursor.Key())
+	}
+	return ok
+}
+
+func (c *cursor) Seek(key []byte) bool {
+	return c.visit(c.Cursor.Seek(key))
+}
+
+func (c *cursor) Next() bool {
+	return c.visit(c.Cursor.Next())
+}
+
+func (c *cursor) Prev() bool {
+	return c.visit(c.Cursor.Prev())
+}
+
+func (c *cursor) Value() ([]byte, error) {
+	v, err := c.Cursor.Value()
+	c.read += len(v)
+	return v, err
+}
+
+func (c *cursor) Close() error {
+	err := c.Cursor.Close()
+	end(c.span, err, c.keys, c.read, 0)
+	return err
+}
+
+// countWriter counts bytes written to w
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countReader counts bytes read from r
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
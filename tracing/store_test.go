@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	kvstore "github.com/gmqio/kv-store"
+	"github.com/gmqio/kv-store/kvstoretest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// testStores run f against a store of every engine, r records its spans
+func testStores(t *testing.T, f func(t *testing.T, s *Store, r *Recorder)) {
+	kvstoretest.Stores(t, kvstore.Options{}, func(t *testing.T, s kvstore.KvStore) {
+		r := &Recorder{}
+		f(t, New(s, r), r)
+	})
+}
+
+// spanOf the last span ended with a name
+func spanOf(r *Recorder, name string) RecordedSpan {
+	spans := r.Spans()
+	for i := len(spans) - 1; i >= 0; i-- {
+		if spans[i].Name == name {
+			return spans[i]
+		}
+	}
+	return RecordedSpan{}
+}
+
+var bucket = []byte("b")
+
+// test calls through XxxCtx methods have spans with their bucket, keys, bytes and error
+func TestStore(t *testing.T) {
+	testStores(t, func(t *testing.T, s *Store, r *Recorder) {
+		ctx, parent := r.Start(context.Background(), "request")
+
+		assert.True(t, s.SetCtx(ctx, bucket, []byte("a"), []byte("123")) == nil)
+		span := spanOf(r, "kvstore.Set")
+		assert.Equal(t, "Set", span.Attributes[MethodKey])
+		assert.Equal(t, "b", span.Attributes[BucketKey])
+		assert.Equal(t, int64(1), span.Attributes[KeysKey])
+		assert.Equal(t, int64(4), span.Attributes[WrittenBytesKey])
+		assert.True(t, span.Err == nil)
+
+		_, found, err := s.GetCtx(ctx, bucket, []byte("x"))
+		assert.True(t, errors.Is(err, kvstore.KeyNotFoundError) && !found)
+		span = spanOf(r, "kvstore.Get")
+		assert.Equal(t, false, span.Attributes[FoundKey])
+		assert.True(t, span.Err == nil, "key not found is not an error")
+
+		assert.Equal(t, kvstore.PreconditionFailedError, s.SetIfAbsentCtx(ctx, bucket, []byte("a"), nil))
+		assert.Equal(t, kvstore.PreconditionFailedError, spanOf(r, "kvstore.SetIfAbsent").Err)
+
+		assert.True(t, s.PSetCtx(ctx, bucket, [][]byte{[]byte("b"), []byte("c")}, [][]byte{[]byte("1"), []byte("2")}) == nil)
+		keys, _, err := s.KeysCtx(ctx, bucket, nil)
+		assert.True(t, err == nil && len(keys) == 3)
+		span = spanOf(r, "kvstore.Keys")
+		assert.Equal(t, int64(3), span.Attributes[KeysKey])
+		assert.Equal(t, int64(3+5), span.Attributes[ReadBytesKey])
+
+		assert.True(t, s.ViewCtx(ctx, func(txn kvstore.Txn) error {
+			_, err := txn.Get(bucket, []byte("b"))
+			return err
+		}) == nil)
+		assert.Equal(t, int64(1), spanOf(r, "kvstore.View").Attributes[KeysKey])
+
+		c, err := s.CursorCtx(ctx, bucket, kvstore.CursorOptions{})
+		assert.True(t, err == nil)
+		for ok := c.Seek(nil); ok; ok = c.Next() {
+		}
+		assert.Equal(t, "", spanOf(r, "kvstore.Cursor").Name, "the span ends when the cursor is closed")
+		assert.True(t, c.Close() == nil)
+		assert.Equal(t, int64(3), spanOf(r, "kvstore.Cursor").Attributes[KeysKey])
+
+		var buf bytes.Buffer
+		_, err = s.BackupCtx(ctx, &buf, 0)
+		assert.True(t, err == nil)
+		assert.Equal(t, int64(buf.Len()), spanOf(r, "kvstore.Backup").Attributes[ReadBytesKey])
+
+		n := 0
+		assert.True(t, s.AllKeysCtx(ctx, func(key string, deletedOrExpired bool) { n++ }) == nil)
+		assert.Equal(t, int64(n), spanOf(r, "kvstore.AllKeys").Attributes[KeysKey])
+
+		parent.End()
+		request := spanOf(r, "request")
+		for _, span := range r.Spans() {
+			if span.ID != request.ID {
+				assert.Equal(t, request.ID, span.Parent, span.Name)
+			}
+		}
+
+		r.Reset()
+		_, _, _ = s.Get(bucket, []byte("a"))
+		assert.Equal(t, 0, len(r.Spans()), "methods without a context are not traced")
+	})
+}
+
+// test the context of a call is passed on to the store
+func TestCanceled(t *testing.T) {
+	testStores(t, func(t *testing.T, s *Store, r *Recorder) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, _, err := s.KeysCtx(ctx, bucket, nil)
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, context.Canceled, spanOf(r, "kvstore.Keys").Err)
+	})
+}
+
+// test a store without a tracer
+func TestNoop(t *testing.T) {
+	testStores(t, func(t *testing.T, s *Store, _ *Recorder) {
+		s = New(s.KvStore, nil)
+		assert.True(t, s.SetCtx(context.Background(), bucket, []byte("a"), []byte("1")) == nil)
+		v, found, err := s.GetCtx(context.Background(), bucket, []byte("a"))
+		assert.True(t, err == nil && found)
+		assert.Equal(t, "1", string(v))
+	})
+}
@@ -0,0 +1,65 @@
+// Package tracing records a span for each call of a KvStore made through the context aware methods of
+// Store, the span of the context is the parent. Spans go to a Tracer, a small interface an application
+// adapts to OpenTelemetry or to its own tracing.
+//
+//	store := tracing.New(local, tracer)
+//	v, found, err := store.GetCtx(r.Context(), bucket, key)
+package tracing
+
+import (
+	"context"
+)
+
+// Tracer starts spans
+type Tracer interface {
+	// Start a span named name, a child of the span of ctx if any. The context returned carries the span
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span a call being traced
+type Span interface {
+	// SetAttributes add attributes to the span, an attribute of the same key is replaced
+	SetAttributes(attrs ...Attribute)
+
+	// RecordError mark the span failed with err
+	RecordError(err error)
+
+	// End the span, it is not changed after
+	End()
+}
+
+// Attribute a key and a value of a span, the value is a string, an int64 or a bool
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String a string attribute
+func String(key, v string) Attribute {
+	return Attribute{Key: key, Value: v}
+}
+
+// Int an int64 attribute
+func Int(key string, v int) Attribute {
+	return Attribute{Key: key, Value: int64(v)}
+}
+
+// Bool a bool attribute
+func Bool(key string, v bool) Attribute {
+	return Attribute{Key: key, Value: v}
+}
+
+// NoopTracer a Tracer recording nothing
+type NoopTracer struct{}
+
+func (NoopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+
+func (noopSpan) RecordError(err error) {}
+
+func (noopSpan) End() {}
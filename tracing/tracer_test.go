@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// test spans of a context are parents of spans started from it
+func TestRecorder(t *testing.T) {
+	r := &Recorder{}
+	ctx, parent := r.Start(context.Background(), "parent", String("a", "1"))
+	_, child := r.Start(ctx, "child")
+	child.SetAttributes(Int("n", 2), String("a", "3"))
+	child.RecordError(errors.New("failed"))
+	child.End()
+	child.SetAttributes(Bool("late", true))
+	child.End()
+	parent.End()
+
+	spans := r.Spans()
+	assert.Equal(t, 2, len(spans), "a span ends once")
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, spans[1].ID, spans[0].Parent)
+	assert.Equal(t, uint64(0), spans[1].Parent)
+	assert.Equal(t, map[string]interface{}{"n": int64(2), "a": "3"}, spans[0].Attributes)
+	assert.Equal(t, "failed", spans[0].Err.Error())
+	assert.Equal(t, "1", spans[1].Attributes["a"])
+	assert.True(t, !spans[0].End.Before(spans[0].Start))
+
+	r.Reset()
+	assert.Equal(t, 0, len(r.Spans()))
+}
+
+// test the noop tracer keeps the context
+func TestNoopTracer(t *testing.T) {
+	ctx := context.WithValue(context.Background(), recorderKey{}, "v")
+	got, span := NoopTracer{}.Start(ctx, "noop")
+	span.SetAttributes(String("a", "1"))
+	span.RecordError(errors.New("failed"))
+	span.End()
+	assert.Equal(t, ctx, got)
+}
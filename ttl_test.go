@@ -0,0 +1,67 @@
+package kvstore
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// test keys with ttl expire and are hidden from scans
+func TestTTL(t *testing.T) {
+	fill := func(s KvStore) {
+		_ = s.Set(TestBucket, []byte("forever"), []byte("v"))
+		_ = s.SetWithTTL(TestBucket, []byte("short"), []byte("v"), time.Second)
+		_ = s.SetWithTTL(TestBucket, []byte("long"), []byte("v"), time.Hour)
+		_ = s.PSetWithTTL(TestBucket, [][]byte{[]byte("p-short-1"), []byte("p-short-2")}, [][]byte{[]byte("1"), []byte("2")}, time.Second)
+		_ = s.SetWithTTL(TestBucket, []byte("persist"), []byte("v"), time.Second)
+		_ = s.Persist(TestBucket, []byte("persist"))
+	}
+	wait := true
+	testStores(t, fill, func(t *testing.T, s KvStore) {
+		ttl, err := s.TTL(TestBucket, []byte("forever"))
+		assert.True(t, err == nil)
+		assert.Equal(t, time.Duration(0), ttl)
+		ttl, err = s.TTL(TestBucket, []byte("long"))
+		assert.True(t, err == nil)
+		assert.True(t, ttl > 59*time.Minute && ttl <= time.Hour, "ttl %s", ttl)
+		_, err = s.TTL(TestBucket, []byte("not-exist"))
+		assert.True(t, errors.Is(err, KeyNotFoundError))
+		assert.True(t, errors.Is(s.Persist(TestBucket, []byte("not-exist")), KeyNotFoundError))
+
+		// expiry is in seconds
+		if wait {
+			time.Sleep(2 * time.Second)
+			wait = false
+		}
+
+		_, f, err := s.Get(TestBucket, []byte("short"))
+		assert.True(t, errors.Is(err, KeyNotFoundError) && !f)
+		_, err = s.TTL(TestBucket, []byte("short"))
+		assert.True(t, errors.Is(err, KeyNotFoundError))
+		_, err = s.PGet(TestBucket, [][]byte{[]byte("p-short-1")})
+		assert.True(t, errors.Is(err, KeyNotFoundError))
+
+		keys, err := s.KeyStringsWithoutValues(TestBucket, nil)
+		assert.True(t, err == nil)
+		assert.Equal(t, []string{"forever", "long", "persist"}, keys)
+
+		page, err := s.Range(TestBucket, RangeOptions{Reverse: true})
+		assert.True(t, err == nil)
+		assert.Equal(t, []string{"persist", "long", "forever"}, toStrings(page.Keys))
+
+		c, err := s.Cursor(TestBucket, CursorOptions{Prefix: []byte("long")})
+		assert.True(t, err == nil)
+		assert.True(t, c.Seek(nil))
+		assert.True(t, c.ExpiresAt() > uint64(time.Now().Unix()))
+		_ = c.Close()
+
+		expired := 0
+		assert.True(t, s.AllKeys(func(key string, deletedOrExpired bool) {
+			if deletedOrExpired {
+				expired++
+			}
+		}) == nil)
+		t.Logf("expired keys %d", expired)
+	})
+}
@@ -0,0 +1,202 @@
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	"log/slog"
+	"time"
+)
+
+var (
+	// MaxTxnRetries times Update runs f again after a conflict
+	MaxTxnRetries = 10
+
+	TxnConflictError = errors.New("transaction conflict")
+	TxnTooBigError   = errors.New("transaction too big")
+)
+
+// Txn a transaction with keys scoped to buckets, it is not safe for concurrent use
+type Txn interface {
+	// Get a value of a key in a bucket, KeyNotFoundError if the key does not exist
+	Get(bucket, k []byte) ([]byte, error)
+
+	// Set a key-value in a bucket
+	Set(bucket, k, v []byte) error
+
+	// SetWithTTL set a key-value in a bucket which expires after ttl, ttl <= 0 never expires
+	SetWithTTL(bucket, k, v []byte, ttl time.Duration) error
+
+	// SetWithMeta set a key-value in a bucket with user meta of badger, kept by Backup and Export
+	SetWithMeta(bucket, k, v []byte, meta byte, ttl time.Duration) error
+
+	// SetWithExpiresAt set a key-value in a bucket which expires at a unix time in seconds, 0 never expires.
+	// A time already passed sets a key expired
+	SetWithExpiresAt(bucket, k, v []byte, expiresAt uint64) error
+
+	// Delete a key in a bucket
+	Delete(bucket, k []byte) error
+
+	// Scan visit keys with prefix in a bucket in order until visit returns an error, keys have bucket removed
+	Scan(bucket, prefix []byte, visit func(k, v []byte) error) error
+}
+
+type badgerTxn struct {
+	ctx    context.Context // Scan and commits of a batch check it
+	db     *badger.DB
+	txn    *badger.Txn
+	format KeyFormat
+	split  bool // commit and start a new transaction when it is too big
+
+	cache   *cache   // invalidated with keys written after the commit
+	written [][]byte // keys written, tracked with a cache
+}
+
+func (b badgerStore) UpdateCtx(ctx context.Context, f func(txn Txn) error) error {
+	b.log.debug("Update")
+	var err error
+	var t *badgerTxn
+	defer func() {
+		t.invalidate()
+	}()
+	for i := 0; i <= MaxTxnRetries; i++ {
+		err = b.db.Update(func(txn *badger.Txn) error {
+			t = &badgerTxn{ctx: ctx, txn: txn, format: b.format, cache: b.cache}
+			return ctxTxn(ctx, f)(t)
+		})
+		if !errors.Is(err, badger.ErrConflict) {
+			break
+		}
+		b.log.debug("Update", slog.Any("error", err))
+	}
+	return txnError(err)
+}
+
+func (b badgerStore) ViewCtx(ctx context.Context, f func(txn Txn) error) error {
+	b.log.debug("View")
+	return txnError(b.db.View(func(txn *badger.Txn) error {
+		return ctxTxn(ctx, f)(&badgerTxn{ctx: ctx, txn: txn, format: b.format})
+	}))
+}
+
+func (b badgerStore) BatchCtx(ctx context.Context, f func(txn Txn) error) error {
+	b.log.debug("Batch")
+	t := &badgerTxn{ctx: ctx, db: b.db, txn: b.db.NewTransaction(true), format: b.format, split: true, cache: b.cache}
+	defer func() {
+		t.txn.Discard()
+		t.invalidate()
+	}()
+	if err := ctxTxn(ctx, f)(t); err != nil {
+		return txnError(err)
+	}
+	return txnError(t.txn.Commit())
+}
+
+func (t *badgerTxn) Get(bucket, k []byte) ([]byte, error) {
+	item, err := t.txn.Get(t.format.Encode(bucket, k))
+	if err != nil {
+		return nil, txnError(err)
+	}
+	return item.ValueCopy(nil)
+}
+
+func (t *badgerTxn) Set(bucket, k, v []byte) error {
+	return t.SetWithTTL(bucket, k, v, 0)
+}
+
+func (t *badgerTxn) SetWithTTL(bucket, k, v []byte, ttl time.Duration) error {
+	return t.SetWithMeta(bucket, k, v, 0, ttl)
+}
+
+func (t *badgerTxn) SetWithMeta(bucket, k, v []byte, meta byte, ttl time.Duration) error {
+	e := newEntry(t.format.Encode(bucket, k), v, ttl).WithMeta(meta)
+	t.wrote(e.Key)
+	return t.write(func(txn *badger.Txn) error {
+		return txn.SetEntry(e)
+	})
+}
+
+func (t *badgerTxn) SetWithExpiresAt(bucket, k, v []byte, expiresAt uint64) error {
+	e := badger.NewEntry(t.format.Encode(bucket, k), v)
+	e.ExpiresAt = expiresAt
+	t.wrote(e.Key)
+	return t.write(func(txn *badger.Txn) error {
+		return txn.SetEntry(e)
+	})
+}
+
+func (t *badgerTxn) Delete(bucket, k []byte) error {
+	newKey := t.format.Encode(bucket, k)
+	t.wrote(newKey)
+	return t.write(func(txn *badger.Txn) error {
+		return txn.Delete(newKey)
+	})
+}
+
+// wrote track a key written to invalidate it in the cache
+func (t *badgerTxn) wrote(key []byte) {
+	if t.cache != nil {
+		t.written = append(t.written, key)
+	}
+}
+
+// invalidate keys written in the cache, a nil transaction wrote nothing
+func (t *badgerTxn) invalidate() {
+	if t != nil && len(t.written) > 0 {
+		t.cache.invalidate(t.written...)
+	}
+}
+
+// write run op in the transaction. In a batch a transaction too big is committed, op runs again in a new one
+func (t *badgerTxn) write(op func(txn *badger.Txn) error) error {
+	err := op(t.txn)
+	if errors.Is(err, badger.ErrTxnTooBig) && t.split {
+		if err = t.ctx.Err(); err != nil {
+			return err
+		}
+		if err = t.txn.Commit(); err != nil {
+			return txnError(err)
+		}
+		t.txn = t.db.NewTransaction(true)
+		err = op(t.txn)
+	}
+	return txnError(err)
+}
+
+func (t *badgerTxn) Scan(bucket, prefix []byte, visit func(k, v []byte) error) error {
+	scanPrefix := append(t.format.BucketPrefix(bucket), prefix...)
+	it := t.txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+	for it.Seek(scanPrefix); it.ValidForPrefix(scanPrefix); it.Next() {
+		if err := t.ctx.Err(); err != nil {
+			return err
+		}
+		item := it.Item()
+		if item.IsDeletedOrExpired() || !t.format.inBucket(bucket, item.Key()) {
+			continue
+		}
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if err := visit(t.format.userKey(bucket, item.Key()), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// txnError map badger errors to errors of the package
+func txnError(err error) error {
+	switch {
+	case errors.Is(err, badger.ErrKeyNotFound):
+		return KeyNotFoundError
+	case errors.Is(err, badger.ErrConflict):
+		return TxnConflictError
+	case errors.Is(err, badger.ErrTxnTooBig):
+		return TxnTooBigError
+	case errors.Is(err, badger.ErrReadOnlyTxn):
+		return ReadOnlyError
+	}
+	return err
+}
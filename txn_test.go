@@ -0,0 +1,155 @@
+package kvstore
+
+import (
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// test update commits, reads its own writes and rolls back on error
+func TestUpdate(t *testing.T) {
+	testStores(t, fillCursorKeys, func(t *testing.T, s KvStore) {
+		err := s.Update(func(txn Txn) error {
+			if err := txn.Set(TestBucket, []byte("tiger"), []byte("i-like-kv")); err != nil {
+				return err
+			}
+			v, err := txn.Get(TestBucket, []byte("tiger"))
+			assert.Equal(t, "i-like-kv", string(v))
+			if err != nil {
+				return err
+			}
+			return txn.Delete(TestBucket, []byte("key-00"))
+		})
+		assert.True(t, err == nil)
+		v, _, _ := s.Get(TestBucket, []byte("tiger"))
+		assert.Equal(t, "i-like-kv", string(v))
+		_, f, _ := s.Get(TestBucket, []byte("key-00"))
+		assert.False(t, f)
+
+		rollback := errors.New("rollback")
+		err = s.Update(func(txn Txn) error {
+			_ = txn.Set(TestBucket, []byte("tiger"), []byte("changed"))
+			_ = txn.Set(TestBucket, []byte("lion"), []byte("new"))
+			_ = txn.Delete(TestBucket, []byte("key-01"))
+			return rollback
+		})
+		assert.True(t, errors.Is(err, rollback))
+		v, _, _ = s.Get(TestBucket, []byte("tiger"))
+		assert.Equal(t, "i-like-kv", string(v))
+		_, f, _ = s.Get(TestBucket, []byte("lion"))
+		assert.False(t, f)
+		_, f, _ = s.Get(TestBucket, []byte("key-01"))
+		assert.True(t, f)
+	})
+}
+
+// test a key set with an expiry time expires then on every engine
+func TestSetWithExpiresAt(t *testing.T) {
+	testStores(t, nil, func(t *testing.T, s KvStore) {
+		expiresAt := uint64(time.Now().Add(time.Hour).Unix())
+		assert.True(t, s.Update(func(txn Txn) error {
+			if err := txn.SetWithExpiresAt(TestBucket, []byte("a"), []byte("1"), expiresAt); err != nil {
+				return err
+			}
+			return txn.SetWithExpiresAt(TestBucket, []byte("b"), []byte("2"), expiresAt-2*3600)
+		}) == nil)
+		c, err := s.Cursor(TestBucket, CursorOptions{})
+		assert.True(t, err == nil)
+		assert.True(t, c.Seek(nil))
+		assert.Equal(t, "a", string(c.Key()))
+		assert.Equal(t, expiresAt, c.ExpiresAt())
+		assert.False(t, c.Next(), "b is expired")
+		assert.True(t, c.Close() == nil)
+	})
+}
+
+// test view is read only and scans a bucket
+func TestView(t *testing.T) {
+	testStores(t, fillCursorKeys, func(t *testing.T, s KvStore) {
+		var keys []string
+		err := s.View(func(txn Txn) error {
+			if _, err := txn.Get(TestBucket, []byte("key-05")); !errors.Is(err, KeyNotFoundError) {
+				t.Errorf("deleted key should be not found, %v", err)
+			}
+			if err := txn.Set(TestBucket, []byte("tiger"), []byte("v")); !errors.Is(err, ReadOnlyError) {
+				t.Errorf("set in view should be read only, %v", err)
+			}
+			return txn.Scan(TestBucket, []byte("key-1"), func(k, v []byte) error {
+				assert.Equal(t, "v-"+string(k), string(v))
+				keys = append(keys, string(k))
+				return nil
+			})
+		})
+		assert.True(t, err == nil)
+		assert.Equal(t, cursorKeys(10, 20, false), keys)
+	})
+}
+
+// test concurrent updates of one key are retried after conflicts
+func TestUpdateConflict(t *testing.T) {
+	testStores(t, nil, func(t *testing.T, s KvStore) {
+		var wg sync.WaitGroup
+		var committed int64
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					err := s.Update(func(txn Txn) error {
+						v, err := txn.Get(TestBucket, []byte("counter"))
+						if errors.Is(err, KeyNotFoundError) {
+							v, err = []byte("0"), nil
+						}
+						if err != nil {
+							return err
+						}
+						n, _ := strconv.Atoi(string(v))
+						return txn.Set(TestBucket, []byte("counter"), []byte(strconv.Itoa(n+1)))
+					})
+					if err == nil {
+						atomic.AddInt64(&committed, 1)
+					} else if !errors.Is(err, TxnConflictError) {
+						t.Errorf("update error %v", err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		v, _, err := s.Get(TestBucket, []byte("counter"))
+		assert.True(t, err == nil)
+		assert.Equal(t, strconv.FormatInt(committed, 10), string(v))
+	})
+}
+
+// test batch splits a transaction too big
+func TestBatch(t *testing.T) {
+	var dir = getDataPath()
+	t.Logf("data path %s", dir)
+	s, err := NewBadgerStore(badger.DefaultOptions(dir).WithMemTableSize(1 << 20).WithValueThreshold(1 << 10))
+	defer func() {
+		_ = s.Close()
+		_ = os.RemoveAll(dir)
+	}()
+	assert.True(t, err == nil, "%v", err)
+
+	write := func(txn Txn) error {
+		for i := 0; i < 20000; i++ {
+			if err := txn.Set(TestBucket, []byte("tiger-"+strconv.Itoa(i)), []byte("i-like-kv")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	assert.True(t, errors.Is(s.Update(write), TxnTooBigError))
+	assert.True(t, s.Batch(write) == nil)
+
+	keys, err := s.KeysWithoutValues(TestBucket, nil)
+	assert.True(t, err == nil)
+	assert.Equal(t, 20000, len(keys))
+}
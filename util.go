@@ -46,10 +46,37 @@ func Now() string {
 	return time.Now().Format("2006-01-02 15:04:05")
 }
 
-// RemovePrefix remove prefix and @kvstore.Split in byte array
+// RemovePrefix remove prefix and the @kvstore.Split after it in byte array
 func RemovePrefix(s []byte, prefix []byte) []byte {
 	if bytes.HasPrefix(s, prefix) {
-		return append([]byte{}, s[len(prefix)+1:]...) // s is a pointer that could be changed outside, we copy its value
+		rest := bytes.TrimPrefix(s[len(prefix):], Split)
+		return append([]byte{}, rest...) // s is a pointer that could be changed outside, we copy its value
 	}
 	return s
 }
+
+// copyBytes return a copy of b that is safe to keep after b is changed
+func copyBytes(b []byte) []byte {
+	return append([]byte{}, b...)
+}
+
+// ttlExpiresAt unix time in seconds a key with ttl expires at like badger.Entry.WithTTL, ttl <= 0 never expires
+func ttlExpiresAt(ttl time.Duration) uint64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return uint64(time.Now().Add(ttl).Unix())
+}
+
+// expired check a key expires at expiresAt is expired, 0 never expires
+func expired(expiresAt uint64) bool {
+	return expiresAt > 0 && expiresAt <= uint64(time.Now().Unix())
+}
+
+// remaining lifetime of a key expires at expiresAt, 0 never expires
+func remaining(expiresAt uint64) time.Duration {
+	if expiresAt == 0 {
+		return 0
+	}
+	return time.Until(time.Unix(int64(expiresAt), 0))
+}
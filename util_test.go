@@ -62,5 +62,8 @@ func TestBuildKey4(t *testing.T) {
 }
 
 func TestRemovePrefix1(t *testing.T) {
-
+	assert.Equal(t, "gmq", string(RemovePrefix([]byte("hello@gmq"), []byte("hello"))))
+	assert.Equal(t, "", string(RemovePrefix([]byte("hello"), []byte("hello"))))
+	assert.Equal(t, "gmq", string(RemovePrefix([]byte("gmq"), []byte(""))))
+	assert.Equal(t, "world@gmq", string(RemovePrefix([]byte("world@gmq"), []byte("hello"))))
 }
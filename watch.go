@@ -0,0 +1,380 @@
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// badgerInternalPrefix keys badger keeps for itself
+var badgerInternalPrefix = []byte("!badger!")
+
+// EventType what happened to a key
+type EventType uint8
+
+const (
+	EventPut EventType = iota + 1
+	EventDelete
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPut:
+		return "put"
+	case EventDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Event a change of a key in a bucket. Changes committed together have the same Version, in order of keys
+type Event struct {
+	Type   EventType
+	Bucket []byte
+	Key    []byte // bucket removed
+
+	// Value nil for EventDelete
+	Value []byte
+
+	// ExpiresAt unix time in seconds the value expires, 0 is never
+	ExpiresAt uint64
+
+	// Version of the commit, pass it to WatchFrom to resume after this event
+	Version uint64
+}
+
+// watcher buffers events of a watch, a consumer reading slowly never blocks writes of the store
+type watcher struct {
+	lock   sync.Mutex
+	cond   *sync.Cond
+	queue  []Event
+	closed bool
+
+	bucket []byte
+	prefix []byte // engine key prefix
+	format KeyFormat
+	after  uint64 // events up to this version were replayed
+	out    chan Event
+}
+
+func newWatcher(format KeyFormat, bucket, prefix []byte, after uint64) *watcher {
+	w := &watcher{
+		bucket: copyBytes(bucket),
+		prefix: append(format.BucketPrefix(bucket), prefix...),
+		format: format,
+		after:  after,
+		out:    make(chan Event),
+	}
+	w.cond = sync.NewCond(&w.lock)
+	return w
+}
+
+// match check an engine key is watched
+func (w *watcher) match(key []byte) bool {
+	return bytes.HasPrefix(key, w.prefix) && w.format.inBucket(w.bucket, key)
+}
+
+// event of an engine key
+func (w *watcher) event(t EventType, key, v []byte, expiresAt, version uint64) Event {
+	e := Event{
+		Type:      t,
+		Bucket:    copyBytes(w.bucket),
+		Key:       w.format.userKey(w.bucket, key),
+		ExpiresAt: expiresAt,
+		Version:   version,
+	}
+	if t == EventPut {
+		e.Value = copyBytes(v)
+	}
+	return e
+}
+
+func (w *watcher) push(events ...Event) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.closed {
+		w.queue = append(w.queue, events...)
+		w.cond.Signal()
+	}
+}
+
+// close stop taking events, events queued are still delivered
+func (w *watcher) close() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.closed = true
+	w.cond.Signal()
+}
+
+// run deliver events until the watcher is closed or ctx is done, then close the channel and call done
+func (w *watcher) run(ctx context.Context, done func()) {
+	stop := context.AfterFunc(ctx, w.close)
+	defer func() {
+		stop()
+		done()
+		close(w.out)
+	}()
+	for {
+		w.lock.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if len(w.queue) == 0 {
+			w.lock.Unlock()
+			return
+		}
+		e := w.queue[0]
+		w.queue[0] = Event{}
+		w.queue = w.queue[1:]
+		w.lock.Unlock()
+
+		select {
+		case w.out <- e:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// watchHub shares one subscription of a badger store among its watchers, it stops with the last watcher
+type watchHub struct {
+	lock     sync.Mutex
+	db       *badger.DB
+	log      *logger
+	cancel   context.CancelFunc // nil if there is no subscription
+	watchers map[*watcher]struct{}
+}
+
+func newWatchHub(db *badger.DB, log *logger) *watchHub {
+	return &watchHub{db: db, log: log, watchers: make(map[*watcher]struct{})}
+}
+
+// subscribedContext tells when a subscription waits for updates. badger.DB.Subscribe registers
+// the subscriber before it waits on Done, updates committed after that are published to it
+type subscribedContext struct {
+	context.Context
+	once       sync.Once
+	subscribed chan struct{}
+}
+
+func (c *subscribedContext) Done() <-chan struct{} {
+	c.once.Do(func() {
+		close(c.subscribed)
+	})
+	return c.Context.Done()
+}
+
+func (b badgerStore) Watch(ctx context.Context, bucket, prefix []byte) (<-chan Event, error) {
+	b.log.debug("Watch", b.log.key("bucket", bucket), b.log.key("prefix", prefix))
+	return b.watch(ctx, bucket, prefix, 0, false)
+}
+
+func (b badgerStore) WatchFrom(ctx context.Context, bucket, prefix []byte, version uint64) (<-chan Event, error) {
+	b.log.debug("WatchFrom", b.log.key("bucket", bucket), b.log.key("prefix", prefix))
+	return b.watch(ctx, bucket, prefix, version, true)
+}
+
+func (b badgerStore) watch(ctx context.Context, bucket, prefix []byte, version uint64, replay bool) (<-chan Event, error) {
+	h := b.watches
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if b.db.IsClosed() {
+		return nil, StoreClosedError
+	}
+	if h.cancel == nil {
+		if err := h.subscribe(); err != nil {
+			return nil, err
+		}
+	}
+
+	// commits after the read version are published to the subscription
+	txn := b.db.NewTransaction(false)
+	defer txn.Discard()
+	w := newWatcher(b.format, bucket, prefix, txn.ReadTs())
+	if replay {
+		events, err := h.replay(txn, w, version)
+		if err != nil {
+			if len(h.watchers) == 0 {
+				h.stop()
+			}
+			return nil, err
+		}
+		w.push(events...)
+	}
+	h.watchers[w] = struct{}{}
+	go w.run(ctx, func() {
+		h.remove(w)
+	})
+	return w.out, nil
+}
+
+// subscribe to every key and wait until badger has registered the subscription, must hold the lock
+func (h *watchHub) subscribe() error {
+	cancel, err := subscribe(h.db, h.log, h.publish, func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		h.stop()
+	})
+	if err != nil {
+		return err
+	}
+	h.cancel = cancel
+	return nil
+}
+
+// subscribe to every key of db, it returns after badger has registered the subscription.
+// publish is called with the context of the subscription, closed is called if the db is closed
+func subscribe(db *badger.DB, log *logger, publish func(ctx context.Context, kvs []*pb.KV), closed func()) (context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sctx := &subscribedContext{Context: ctx, subscribed: make(chan struct{})}
+	failed := make(chan error, 1)
+	go func() {
+		err := db.Subscribe(sctx, func(kvs *pb.KVList) error {
+			publish(ctx, kvs.Kv)
+			return nil
+		}, []pb.Match{{Prefix: nil}})
+		if err != nil {
+			log.warn("Subscribe", slog.Any("error", err))
+		}
+		failed <- err
+		if ctx.Err() == nil {
+			closed()
+		}
+	}()
+	select {
+	case <-sctx.subscribed:
+		return cancel, nil
+	case err := <-failed:
+		cancel()
+		if err == nil {
+			err = StoreClosedError
+		}
+		return nil, err
+	}
+}
+
+// stop the subscription and close every watcher, must hold the lock
+func (h *watchHub) stop() {
+	if h.cancel != nil {
+		h.cancel()
+		h.cancel = nil
+	}
+	for w := range h.watchers {
+		w.close()
+		delete(h.watchers, w)
+	}
+}
+
+func (h *watchHub) close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.stop()
+}
+
+// remove a watcher, the subscription stops with the last one
+func (h *watchHub) remove(w *watcher) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.watchers, w)
+	if len(h.watchers) == 0 {
+		h.stop()
+	}
+}
+
+// publish updates of the subscription of ctx to the watchers
+func (h *watchHub) publish(ctx context.Context, kvs []*pb.KV) {
+	if ctx.Err() != nil {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	sort.SliceStable(kvs, func(i, j int) bool {
+		if kvs[i].Version != kvs[j].Version {
+			return kvs[i].Version < kvs[j].Version
+		}
+		return bytes.Compare(kvs[i].Key, kvs[j].Key) < 0
+	})
+	txn := h.db.NewTransaction(false)
+	defer txn.Discard()
+	for _, kv := range kvs {
+		if bytes.HasPrefix(kv.Key, badgerInternalPrefix) {
+			continue
+		}
+		var deleted *bool
+		for w := range h.watchers {
+			if kv.Version <= w.after || !w.match(kv.Key) {
+				continue
+			}
+			if deleted == nil {
+				d := len(kv.Value) == 0 && isDeleted(txn, kv.Key, kv.Version)
+				deleted = &d
+			}
+			t := EventPut
+			if *deleted {
+				t = EventDelete
+			}
+			w.push(w.event(t, kv.Key, kv.Value, kv.ExpiresAt, kv.Version))
+		}
+	}
+}
+
+// replay events of w with version after version up to the start of w from the versions badger keeps.
+// Versions already compacted away are not replayed
+func (h *watchHub) replay(txn *badger.Txn, w *watcher, version uint64) ([]Event, error) {
+	it := txn.NewIterator(badger.IteratorOptions{
+		PrefetchValues: true,
+		PrefetchSize:   100,
+		AllVersions:    true,
+		Prefix:         w.prefix,
+	})
+	defer it.Close()
+	var events []Event
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		if item.Version() <= version || !w.match(item.Key()) {
+			continue
+		}
+		if deletedItem(item) {
+			events = append(events, w.event(EventDelete, item.Key(), nil, 0, item.Version()))
+			continue
+		}
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, w.event(EventPut, item.Key(), v, item.ExpiresAt(), item.Version()))
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Version < events[j].Version
+	})
+	return events, nil
+}
+
+// isDeleted check the version of key is a delete, a subscription does not tell deletes from empty values
+func isDeleted(txn *badger.Txn, key []byte, version uint64) bool {
+	it := txn.NewIterator(badger.IteratorOptions{AllVersions: true, Prefix: key})
+	defer it.Close()
+	for it.Seek(key); it.Valid(); it.Next() {
+		item := it.Item()
+		if !bytes.Equal(item.Key(), key) || item.Version() < version {
+			break
+		}
+		if item.Version() == version {
+			return deletedItem(item)
+		}
+	}
+	_, err := txn.Get(key)
+	return err != nil
+}
+
+// deletedItem a delete, not a value expired
+func deletedItem(item *badger.Item) bool {
+	return item.IsDeletedOrExpired() && (item.ExpiresAt() == 0 || !expired(item.ExpiresAt()))
+}
@@ -0,0 +1,177 @@
+package kvstore
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// nextEvent wait for an event of ch
+func nextEvent(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+	select {
+	case e, ok := <-ch:
+		if !ok {
+			t.Fatalf("watch closed")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no event")
+	}
+	return Event{}
+}
+
+// watchClosed wait for ch to be closed
+func watchClosed(t *testing.T, ch <-chan Event) bool {
+	t.Helper()
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return true
+			}
+		case <-time.After(5 * time.Second):
+			return false
+		}
+	}
+}
+
+// test puts and deletes of keys with prefix in a bucket are delivered in order
+func TestWatch(t *testing.T) {
+	testStores(t, nil, func(t *testing.T, s KvStore) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ch, err := s.Watch(ctx, TestBucket, []byte("broker-"))
+		assert.True(t, err == nil)
+
+		assert.True(t, s.Set(TestBucket, []byte("broker-1"), []byte("up")) == nil)
+		assert.True(t, s.Set(TestBucket, []byte("cluster"), []byte("up")) == nil)
+		assert.True(t, s.Set([]byte("test"), []byte("broker-1"), []byte("up")) == nil)
+		assert.True(t, s.SetWithTTL(TestBucket, []byte("broker-2"), []byte(""), time.Hour) == nil)
+		assert.True(t, s.Delete(TestBucket, []byte("broker-1")) == nil)
+		assert.True(t, s.Update(func(txn Txn) error {
+			_ = txn.Set(TestBucket, []byte("broker-3"), []byte("up"))
+			return txn.Set(TestBucket, []byte("broker-4"), []byte("up"))
+		}) == nil)
+
+		e := nextEvent(t, ch)
+		assert.Equal(t, EventPut, e.Type)
+		assert.Equal(t, string(TestBucket), string(e.Bucket))
+		assert.Equal(t, "broker-1", string(e.Key))
+		assert.Equal(t, "up", string(e.Value))
+		version := e.Version
+
+		e = nextEvent(t, ch)
+		assert.Equal(t, EventPut, e.Type, "empty value is a put")
+		assert.Equal(t, "broker-2", string(e.Key))
+		assert.True(t, e.ExpiresAt > 0)
+		assert.True(t, e.Version > version)
+		version = e.Version
+
+		e = nextEvent(t, ch)
+		assert.Equal(t, EventDelete, e.Type)
+		assert.Equal(t, "broker-1", string(e.Key))
+		assert.True(t, e.Value == nil)
+		assert.True(t, e.Version > version)
+
+		e3, e4 := nextEvent(t, ch), nextEvent(t, ch)
+		assert.Equal(t, "broker-3", string(e3.Key))
+		assert.Equal(t, "broker-4", string(e4.Key))
+		assert.Equal(t, e3.Version, e4.Version)
+
+		// a rolled back transaction has no event
+		_ = s.Update(func(txn Txn) error {
+			_ = txn.Set(TestBucket, []byte("broker-5"), []byte("up"))
+			return PreconditionFailedError
+		})
+		assert.True(t, s.Set(TestBucket, []byte("broker-6"), []byte("up")) == nil)
+		assert.Equal(t, "broker-6", string(nextEvent(t, ch).Key))
+
+		cancel()
+		assert.True(t, watchClosed(t, ch))
+	})
+}
+
+// test many watchers on one store
+func TestWatchMany(t *testing.T) {
+	testStores(t, nil, func(t *testing.T, s KvStore) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		all, err := s.Watch(ctx, TestBucket, nil)
+		assert.True(t, err == nil)
+		one, err := s.Watch(ctx, TestBucket, []byte("b"))
+		assert.True(t, err == nil)
+
+		assert.True(t, s.PSet(TestBucket, [][]byte{[]byte("a"), []byte("b")}, [][]byte{[]byte("1"), []byte("2")}) == nil)
+		assert.Equal(t, "a", string(nextEvent(t, all).Key))
+		assert.Equal(t, "b", string(nextEvent(t, all).Key))
+		assert.Equal(t, "b", string(nextEvent(t, one).Key))
+
+		// a watcher not read does not block others
+		for i := 0; i < 100; i++ {
+			assert.True(t, s.Set(TestBucket, []byte("a"), []byte("1")) == nil)
+		}
+		for i := 0; i < 100; i++ {
+			assert.Equal(t, "a", string(nextEvent(t, all).Key))
+		}
+	})
+}
+
+// test resuming after the version of the last event handled
+func TestWatchFrom(t *testing.T) {
+	testStores(t, nil, func(t *testing.T, s KvStore) {
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, err := s.Watch(ctx, TestBucket, nil)
+		assert.True(t, err == nil)
+		assert.True(t, s.Set(TestBucket, []byte("a"), []byte("1")) == nil)
+		version := nextEvent(t, ch).Version
+		cancel()
+		assert.True(t, watchClosed(t, ch))
+
+		// missed while not watching
+		assert.True(t, s.Set(TestBucket, []byte("b"), []byte("2")) == nil)
+		assert.True(t, s.Set(TestBucket, []byte("c"), []byte("3")) == nil)
+		assert.True(t, s.Delete(TestBucket, []byte("c")) == nil)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		ch, err = s.WatchFrom(ctx, TestBucket, nil, version)
+		assert.True(t, err == nil)
+		e := nextEvent(t, ch)
+		assert.Equal(t, "b", string(e.Key))
+		assert.Equal(t, "2", string(e.Value))
+		if _, mem := s.(*memStore); !mem {
+			assert.Equal(t, "c", string(nextEvent(t, ch).Key))
+			assert.Equal(t, EventDelete, nextEvent(t, ch).Type)
+		}
+
+		assert.True(t, s.Set(TestBucket, []byte("d"), []byte("4")) == nil)
+		assert.Equal(t, "d", string(nextEvent(t, ch).Key))
+
+		// 0 replays every key kept
+		ch, err = s.WatchFrom(ctx, TestBucket, nil, 0)
+		assert.True(t, err == nil)
+		assert.Equal(t, "a", string(nextEvent(t, ch).Key))
+	})
+}
+
+// test watches end when the store is closed
+func TestWatchClose(t *testing.T) {
+	s := newMemoryStore(t)
+	ch, err := s.Watch(context.Background(), TestBucket, nil)
+	assert.True(t, err == nil)
+	assert.True(t, s.Close() == nil)
+	assert.True(t, watchClosed(t, ch))
+	_, err = s.Watch(context.Background(), TestBucket, nil)
+	assert.Equal(t, StoreClosedError, err)
+
+	b, err := Open(EngineBadger, Options{})
+	assert.True(t, err == nil)
+	ch, err = b.Watch(context.Background(), TestBucket, nil)
+	assert.True(t, err == nil)
+	assert.True(t, b.Close() == nil)
+	assert.True(t, watchClosed(t, ch))
+	_, err = b.Watch(context.Background(), TestBucket, nil)
+	assert.Equal(t, StoreClosedError, err)
+}